@@ -0,0 +1,291 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package benchmark collects the results of benchmark cases that unit test
+// executables run, and compares them against a saved baseline.
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/testreport"
+	"mynewt.apache.org/newt/util"
+)
+
+// The environment variable that tells the test harness to run benchmark
+// cases.  The harness skips them otherwise.
+const BENCH_ENV = "TESTUTIL_BENCH"
+
+// Result is the measurement of a single benchmark case.
+type Result struct {
+	Package string
+	Target  string
+	Suite   string
+	Case    string
+
+	// How many times the harness ran the case.
+	Iterations int64
+
+	// The average time and memory each iteration took.  Bytes is 0 if the
+	// harness did not report it.
+	NsPerOp    float64
+	BytesPerOp int64
+}
+
+// Name returns the name that tables list the result under.
+func (r *Result) Name() string {
+	return r.Package + " " + r.Suite + "/" + r.Case
+}
+
+// key identifies the case that a result measures, so that results of
+// different runs can be compared.
+func (r *Result) key() string {
+	return r.Package + "\x00" + r.Target + "\x00" + r.Suite + "\x00" + r.Case
+}
+
+// The test harness reports each benchmark case on its own line:
+//     [bench] <suite>/<case> <n> iterations <ns> ns/op [<bytes> B/op]
+var benchRe = regexp.MustCompile(`^\[bench\] ([^/\s]+)/(\S+)\s+(\d+) ` +
+	`iterations\s+(\d+(?:\.\d+)?) ns/op(?:\s+(\d+) B/op)?\s*$`)
+
+// Parse extracts the benchmark results of a test executable from its
+// output.
+//
+// @param pkgName               The name of the package under test.
+// @param target                The name of the target the test ran on.
+// @param lines                 The executable's output.
+//
+// @return []*Result            The results, in the order they ran.
+func Parse(pkgName string, target string,
+	lines []testreport.Line) []*Result {
+
+	var results []*Result
+	for _, line := range lines {
+		m := benchRe.FindStringSubmatch(strings.TrimSpace(line.Text))
+		if m == nil {
+			continue
+		}
+
+		r := &Result{
+			Package: pkgName,
+			Target:  target,
+			Suite:   m[1],
+			Case:    m[2],
+		}
+		r.Iterations, _ = strconv.ParseInt(m[3], 10, 64)
+		r.NsPerOp, _ = strconv.ParseFloat(m[4], 64)
+		if m[5] != "" {
+			r.BytesPerOp, _ = strconv.ParseInt(m[5], 10, 64)
+		}
+		results = append(results, r)
+	}
+
+	return results
+}
+
+// Data is the benchmark results of all the tests that ran.
+type Data struct {
+	Results []*Result
+}
+
+func NewData() *Data {
+	return &Data{}
+}
+
+// Add records the results of a package's test executable.
+func (d *Data) Add(results ...*Result) {
+	d.Results = append(d.Results, results...)
+}
+
+// sorted returns the results sorted by name, then by target.
+func (d *Data) sorted() []*Result {
+	results := append([]*Result(nil), d.Results...)
+	sort.SliceStable(results, func(i int, j int) bool {
+		if results[i].Name() != results[j].Name() {
+			return results[i].Name() < results[j].Name()
+		}
+		return results[i].Target < results[j].Target
+	})
+
+	return results
+}
+
+// Load reads a baseline that Save wrote.
+func Load(path string) (*Data, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	d := NewData()
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, util.FmtNewtError(
+			"invalid benchmark baseline %s: %s", path, err.Error())
+	}
+
+	return d, nil
+}
+
+// Save writes the results to a file, for later runs to compare against.
+func (d *Data) Save(path string) error {
+	b, err := json.MarshalIndent(d, "", "    ")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Regression is a benchmark case that got slower or used more memory than
+// in the baseline.
+type Regression struct {
+	Cur  *Result
+	Base *Result
+}
+
+// pctChange returns how much a value grew relative to its baseline, as a
+// percentage.
+func pctChange(cur float64, base float64) float64 {
+	if base == 0 {
+		return 0
+	}
+	return 100 * (cur - base) / base
+}
+
+func (r Regression) String() string {
+	var reasons []string
+	if r.Cur.NsPerOp > r.Base.NsPerOp {
+		reasons = append(reasons, fmt.Sprintf("%.0f -> %.0f ns/op (%+.1f%%)",
+			r.Base.NsPerOp, r.Cur.NsPerOp,
+			pctChange(r.Cur.NsPerOp, r.Base.NsPerOp)))
+	}
+	if r.Cur.BytesPerOp > r.Base.BytesPerOp {
+		reasons = append(reasons, fmt.Sprintf("%d -> %d B/op (%+.1f%%)",
+			r.Base.BytesPerOp, r.Cur.BytesPerOp,
+			pctChange(float64(r.Cur.BytesPerOp),
+				float64(r.Base.BytesPerOp))))
+	}
+
+	name := r.Cur.Name()
+	if r.Cur.Target != "" {
+		name += " on " + r.Cur.Target
+	}
+	return name + ": " + strings.Join(reasons, ", ")
+}
+
+// baseMap indexes the baseline's results by the case they measure.
+func (d *Data) baseMap() map[string]*Result {
+	m := map[string]*Result{}
+	for _, r := range d.Results {
+		m[r.key()] = r
+	}
+
+	return m
+}
+
+// regressed indicates whether a result is worse than its baseline by more
+// than the threshold percentage.
+func regressed(cur *Result, base *Result, threshold float64) bool {
+	return pctChange(cur.NsPerOp, base.NsPerOp) > threshold ||
+		pctChange(float64(cur.BytesPerOp), float64(base.BytesPerOp)) >
+			threshold
+}
+
+// Compare finds the cases that regressed relative to a baseline.  Cases that
+// are not in the baseline are not compared.
+//
+// @param base                  The baseline.
+// @param threshold             How much worse, as a percentage of the
+//                                  baseline, a case may get before it is a
+//                                  regression.
+func (d *Data) Compare(base *Data, threshold float64) []Regression {
+	bm := base.baseMap()
+
+	var regs []Regression
+	for _, r := range d.sorted() {
+		if b := bm[r.key()]; b != nil && regressed(r, b, threshold) {
+			regs = append(regs, Regression{Cur: r, Base: b})
+		}
+	}
+
+	return regs
+}
+
+// WriteTable writes a table of each case's results.  If a baseline is
+// specified, the table also lists each case's change in ns/op, and marks the
+// cases that regressed.
+//
+// @param base                  The baseline; nil for none.
+// @param threshold             See Compare.
+func (d *Data) WriteTable(w io.Writer, base *Data, threshold float64) {
+	results := d.sorted()
+
+	name := func(r *Result) string {
+		if r.Target != "" {
+			return r.Name() + " on " + r.Target
+		}
+		return r.Name()
+	}
+
+	width := len("Benchmark")
+	for _, r := range results {
+		if len(name(r)) > width {
+			width = len(name(r))
+		}
+	}
+
+	var bm map[string]*Result
+	if base != nil {
+		bm = base.baseMap()
+	}
+
+	fmt.Fprintf(w, "%-*s %12s %14s %10s", width, "Benchmark", "Iterations",
+		"ns/op", "B/op")
+	if base != nil {
+		fmt.Fprintf(w, " %10s", "Delta")
+	}
+	fmt.Fprintf(w, "\n")
+
+	for _, r := range results {
+		fmt.Fprintf(w, "%-*s %12d %14.1f %10d", width, name(r),
+			r.Iterations, r.NsPerOp, r.BytesPerOp)
+		if base != nil {
+			if b := bm[r.key()]; b == nil {
+				fmt.Fprintf(w, " %10s", "new")
+			} else {
+				fmt.Fprintf(w, " %+9.1f%%", pctChange(r.NsPerOp, b.NsPerOp))
+				if regressed(r, b, threshold) {
+					fmt.Fprintf(w, "  REGRESSION")
+				}
+			}
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
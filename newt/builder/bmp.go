@@ -0,0 +1,180 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/apache/mynewt-artifact/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// Black Magic Probe backend.  The probe runs a GDB server on its serial port,
+// so gdb connects to it directly with `target extended-remote`.  The probe is
+// configured with target environment settings (`target.env`):
+//
+//     * BMP_PORT: the probe's GDB serial port (e.g., /dev/ttyACM0); required.
+//     * BMP_SCAN: the scan command, "swdp_scan" (default) or "jtag_scan".
+//     * BMP_TARGET: the number of the scanned target to attach to (default 1).
+
+const (
+	BMP_ENV_PORT   = "BMP_PORT"
+	BMP_ENV_SCAN   = "BMP_SCAN"
+	BMP_ENV_TARGET = "BMP_TARGET"
+)
+
+// bmpGdbCmds returns the gdb commands that connect to the probe and attach to
+// the MCU.
+func (t *TargetBuilder) bmpGdbCmds() ([]string, error) {
+	env := t.target.Env
+
+	port := env[BMP_ENV_PORT]
+	if port == "" {
+		return nil, util.FmtNewtError(
+			"target %s uses a Black Magic Probe but does not specify its "+
+				"serial port (target.env: %s)",
+			t.target.FullName(), BMP_ENV_PORT)
+	}
+
+	scan := env[BMP_ENV_SCAN]
+	if scan == "" {
+		scan = "swdp_scan"
+	}
+	if scan != "swdp_scan" && scan != "jtag_scan" {
+		return nil, util.FmtNewtError(
+			"invalid %s \"%s\"; must be swdp_scan or jtag_scan",
+			BMP_ENV_SCAN, scan)
+	}
+
+	tgt := env[BMP_ENV_TARGET]
+	if tgt == "" {
+		tgt = "1"
+	}
+	if _, err := strconv.Atoi(tgt); err != nil {
+		return nil, util.FmtNewtError(
+			"invalid %s \"%s\"; must be a number", BMP_ENV_TARGET, tgt)
+	}
+
+	return []string{
+		"target extended-remote " + port,
+		"monitor " + scan,
+		"attach " + tgt,
+	}, nil
+}
+
+// bmpProbe drives a Black Magic Probe through gdb.  The probe is selected by
+// its serial port, not by serial number.
+type bmpProbe struct {
+	b *Builder
+}
+
+// batch attaches to the MCU, runs the specified gdb commands, and then kills
+// the session, which resets the MCU.
+func (p *bmpProbe) batch(cmds []string) error {
+	gdbCmds, err := p.b.targetBuilder.bmpGdbCmds()
+	if err != nil {
+		return err
+	}
+	gdbCmds = append(gdbCmds, cmds...)
+	gdbCmds = append(gdbCmds, "kill")
+
+	gdb, err := p.b.gdbPath()
+	if err != nil {
+		return err
+	}
+
+	cmd := []string{gdb, "-nx", "-batch"}
+	for _, c := range gdbCmds {
+		cmd = append(cmd, "-ex", c)
+	}
+
+	if _, err := util.ShellCommand(cmd, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *bmpProbe) Program(binPath string, offset int) error {
+	err := p.batch([]string{
+		fmt.Sprintf("restore %s binary 0x%x", util.TryRelPath(binPath), offset),
+	})
+	if err != nil {
+		return err
+	}
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Successfully loaded image.\n")
+
+	return nil
+}
+
+// Erase erases the MCU's flash.  The probe can only erase the entire chip.
+func (p *bmpProbe) Erase(areas []flash.FlashArea) error {
+	if len(areas) > 0 {
+		return util.NewNewtError(
+			"Black Magic Probes can only erase the entire chip")
+	}
+
+	return p.batch([]string{"monitor erase_mass"})
+}
+
+func (p *bmpProbe) ReadMem(area flash.FlashArea, dst string) error {
+	return p.batch([]string{
+		fmt.Sprintf("dump binary memory %s 0x%x 0x%x",
+			dst, area.Offset, area.Offset+area.Size),
+	})
+}
+
+func (p *bmpProbe) Reset() error {
+	return p.batch(nil)
+}
+
+func (p *bmpProbe) StartGdbServer(reset bool, attach bool,
+	noGDB bool) error {
+
+	gdbCmds, err := p.b.targetBuilder.bmpGdbCmds()
+	if err != nil {
+		return err
+	}
+
+	// The probe's GDB server is always running.
+	if noGDB {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Black Magic Probe GDB server: %s\n",
+			p.b.targetBuilder.target.Env[BMP_ENV_PORT])
+		return nil
+	}
+
+	// Attaching halts the MCU; restart the app from its reset vector.
+	if reset {
+		gdbCmds = append(gdbCmds, "run")
+	}
+
+	return p.b.runGdb(gdbCmds)
+}
+
+func (p *bmpProbe) ConsoleStream(channel int) error {
+	return util.NewNewtError("Black Magic Probes do not support RTT")
+}
+
+func (p *bmpProbe) ConsoleReader(channel int) (io.ReadCloser, error) {
+	return nil, util.NewNewtError("Black Magic Probes do not support RTT")
+}
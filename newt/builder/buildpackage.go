@@ -253,9 +253,9 @@ func (bpkg *BuildPackage) privateIncludeDirs(b *Builder) []string {
 		sdkIncls := bpkg.findSdkIncludes()
 		incls = append(incls, sdkIncls...)
 
-	case pkg.PACKAGE_TYPE_UNITTEST:
-		// A unittest package gets access to its parent package's private
-		// includes.
+	case pkg.PACKAGE_TYPE_UNITTEST, pkg.PACKAGE_TYPE_FUZZ:
+		// A unittest or fuzz package gets access to its parent package's
+		// private includes.
 		parentPkg := b.testOwner(bpkg)
 		if parentPkg != nil {
 			parentIncls := parentPkg.privateIncludeDirs(b)
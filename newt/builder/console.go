@@ -0,0 +1,109 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"mynewt.apache.org/newt/newt/serialport"
+	"mynewt.apache.org/newt/util"
+)
+
+// consolePort returns the serial port of the board's console: the specified
+// port, the target's console_port setting, or the port of the USB device
+// that the BSP lists in `bsp.console_usb_ids`.
+func (t *TargetBuilder) consolePort(port string) (string, error) {
+	if port != "" {
+		return port, nil
+	}
+	if t.target.ConsolePort != "" {
+		return t.target.ConsolePort, nil
+	}
+
+	if len(t.bspPkg.ConsoleUsbIds) == 0 {
+		return "", util.FmtNewtError(
+			"cannot find the console of target %s; specify its serial "+
+				"port, or list the console's USB IDs in its BSP "+
+				"(bsp.console_usb_ids)", t.target.FullName())
+	}
+
+	var ids []serialport.UsbId
+	for _, s := range t.bspPkg.ConsoleUsbIds {
+		id, err := serialport.ParseUsbId(s)
+		if err != nil {
+			return "", err
+		}
+		ids = append(ids, id)
+	}
+
+	return serialport.Detect(ids)
+}
+
+// consoleBaud returns the baud rate of the board's console: the specified
+// rate, or the app's CONSOLE_UART_BAUD setting.
+func (t *TargetBuilder) consoleBaud(baud int) int {
+	if baud > 0 {
+		return baud
+	}
+
+	s := t.AppBuilder.cfg.SettingValues()["CONSOLE_UART_BAUD"]
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return n
+	}
+
+	return SERIAL_DFLT_BAUD
+}
+
+// Console connects the terminal to the board's serial console until the
+// port is closed or newt is interrupted.
+//
+// @param port                  The console's serial port; "" to detect it.
+// @param baud                  The console's baud rate; 0 for the app's
+//                                  CONSOLE_UART_BAUD setting.
+func (t *TargetBuilder) Console(port string, baud int) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	port, err := t.consolePort(port)
+	if err != nil {
+		return err
+	}
+	baud = t.consoleBaud(baud)
+
+	f, err := serialport.Open(port, baud)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Console %s at %d baud; press Ctrl-C to quit\n", port, baud)
+
+	go io.Copy(f, os.Stdin)
+
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
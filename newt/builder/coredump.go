@@ -0,0 +1,202 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+
+	"github.com/apache/mynewt-artifact/image"
+
+	"mynewt.apache.org/newt/newt/coredump"
+	"mynewt.apache.org/newt/newt/smp"
+	"mynewt.apache.org/newt/util"
+)
+
+// Core dumps.  When the coredump package is enabled, a device saves its RAM
+// and registers to a flash area (COREDUMP_FLASH_AREA) when it crashes.  The
+// dump is downloaded through the target's debugger backend or over SMP, and
+// converted to an ELF core file for gdb.
+
+const COREDUMP_DFLT_FLASH_AREA = "FLASH_AREA_IMAGE_1"
+
+func (b *Builder) CoreDumpPath() string {
+	return b.AppBinBasePath() + ".core"
+}
+
+func (b *Builder) CoreElfPath() string {
+	return b.AppBinBasePath() + ".core.elf"
+}
+
+// coreDumpArea returns the flash area that the app saves core dumps to.
+func (t *TargetBuilder) coreDumpArea() (string, error) {
+	settings := t.AppBuilder.cfg.SettingValues()
+
+	if _, ok := settings["COREDUMP_FLASH_AREA"]; !ok {
+		return "", util.FmtNewtError(
+			"app %s does not include the coredump package",
+			t.appPkg.FullName())
+	}
+
+	name := settings["COREDUMP_FLASH_AREA"]
+	if name == "" {
+		name = COREDUMP_DFLT_FLASH_AREA
+	}
+
+	return name, nil
+}
+
+// ReadCoreDump downloads the device's core dump through the target's
+// debugger backend and saves it to the app's bin directory.
+func (t *TargetBuilder) ReadCoreDump() error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	debugger, err := t.Debugger()
+	if err != nil {
+		return err
+	}
+	if debugger == "" {
+		return util.FmtNewtError(
+			"target %s does not select a debugger backend; use a serial "+
+				"port to download its core dump", t.target.FullName())
+	}
+
+	name, err := t.coreDumpArea()
+	if err != nil {
+		return err
+	}
+	areas, err := t.eraseAreas([]string{name})
+	if err != nil {
+		return err
+	}
+
+	p, err := t.AppBuilder.newProbe(debugger, "")
+	if err != nil {
+		return err
+	}
+
+	dst := t.AppBuilder.CoreDumpPath()
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Reading core dump from %s\n", name)
+	if err := p.ReadMem(areas[0], dst); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReadCoreDumpSerial downloads the device's core dump through the SMP server
+// on its serial port and saves it to the app's bin directory.
+//
+// @param port                  The device's serial port.
+// @param baud                  The port's baud rate.
+func (t *TargetBuilder) ReadCoreDumpSerial(port string, baud int) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	c, err := smp.Open(port, baud)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Downloading core dump via %s\n", port)
+
+	data, err := c.DownloadCoreDump(nil)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(t.AppBuilder.CoreDumpPath(), data,
+		0644); err != nil {
+
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// checkCoreDumpImage warns if a core dump was not taken while the target's
+// current image was running; its symbols would not match the dump.
+func (b *Builder) checkCoreDumpImage(cd *coredump.CoreDump) {
+	data, err := ioutil.ReadFile(b.AppImgPath())
+	if err != nil {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"* Warning: cannot read %s; core dump not matched to the "+
+				"image\n", util.TryRelPath(b.AppImgPath()))
+		return
+	}
+
+	img, err := image.ParseImage(data)
+	if err != nil {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"* Warning: error parsing image: %s\n", err.Error())
+		return
+	}
+
+	hash, err := img.Hash()
+	if err != nil {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"* Warning: image has no hash: %s\n", err.Error())
+		return
+	}
+
+	if !cd.MatchesImage(hash) {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"* Warning: core dump was taken with image %x; target's image "+
+				"is %x\n", cd.ImageHash, hash)
+	}
+}
+
+// ConvertCoreDump converts the downloaded core dump to an ELF core file.
+func (t *TargetBuilder) ConvertCoreDump() error {
+	b := t.AppBuilder
+
+	data, err := ioutil.ReadFile(b.CoreDumpPath())
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	cd, err := coredump.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "%s", cd.String())
+	b.checkCoreDumpImage(cd)
+
+	if err := cd.WriteElfCore(b.CoreElfPath()); err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Wrote %s\n",
+		util.TryRelPath(b.CoreElfPath()))
+
+	return nil
+}
+
+// DebugCoreDump runs gdb on the app with the converted core dump loaded.
+func (t *TargetBuilder) DebugCoreDump() error {
+	b := t.AppBuilder
+	return b.runGdb([]string{"core-file " + util.TryRelPath(b.CoreElfPath())})
+}
@@ -0,0 +1,262 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/parse"
+	"mynewt.apache.org/newt/util"
+)
+
+// Debugger backends.  By default, a target is loaded and debugged with its
+// BSP's download and debug scripts.  A BSP (`bsp.debugger`) or target
+// (`target.debugger`) can instead select a backend that newt drives itself.
+
+const (
+	DEBUGGER_PYOCD   = "pyocd"
+	DEBUGGER_BMP     = "bmp"
+	DEBUGGER_JLINK   = "jlink"
+	DEBUGGER_OPENOCD = "openocd"
+)
+
+var debuggers = []string{
+	DEBUGGER_PYOCD, DEBUGGER_BMP, DEBUGGER_JLINK, DEBUGGER_OPENOCD,
+}
+
+// The TCP port that newt-driven GDB servers listen on.
+const GDB_SERVER_PORT = 3333
+
+// GDB frontends.  Any other frontend is a command template, run by the shell,
+// in which {gdb} is replaced with the path of gdb, {elf} with the app's ELF
+// file, and {args} with gdb's arguments (the ELF file, followed by the
+// commands that connect to the target).
+const (
+	GDB_FRONTEND_TUI    = "tui"
+	GDB_FRONTEND_GDBGUI = "gdbgui"
+)
+
+// Debugger returns the debugger backend that loads and debugs the target;
+// "" indicates the BSP's scripts.  The target's setting takes precedence
+// over the BSP's.
+func (t *TargetBuilder) Debugger() (string, error) {
+	d := t.target.Debugger
+	if d == "" {
+		d = t.bspPkg.Debugger
+	}
+	if d == "" {
+		return "", nil
+	}
+
+	for _, known := range debuggers {
+		if d == known {
+			return d, nil
+		}
+	}
+
+	return "", util.FmtNewtError(
+		"unknown debugger \"%s\"; must be one of: %s",
+		d, strings.Join(debuggers, ", "))
+}
+
+// loadFile returns the file that a debugger backend writes to flash: the
+// binary of a bootloader, or the image of an app.
+func (b *Builder) loadFile() string {
+	if parse.ValueIsTrue(b.cfg.SettingValues()["BOOT_LOADER"]) {
+		return b.AppBinPath()
+	}
+	return b.AppImgPath()
+}
+
+// elfPath returns the ELF file that the builder links: the app's, or the
+// unit test executable if the builder has no app.
+func (b *Builder) elfPath() string {
+	if b.appPkg == nil && b.testPkg != nil {
+		return b.TestExePath()
+	}
+	return b.AppElfPath()
+}
+
+func (b *Builder) gdbPath() (string, error) {
+	c, err := b.targetBuilder.NewCompiler("", "")
+	if err != nil {
+		return "", err
+	}
+
+	if c.GetGdbPath() == "" {
+		return "", util.NewNewtError(
+			"compiler does not specify a debugger (compiler.path.gdb)")
+	}
+
+	return c.GetGdbPath(), nil
+}
+
+// lookPath resolves a command's path; interactive commands are not run
+// through a shell.
+func lookPath(cmd []string) ([]string, error) {
+	path, err := exec.LookPath(cmd[0])
+	if err != nil {
+		return nil, util.FmtNewtError("cannot find %s: %s",
+			cmd[0], err.Error())
+	}
+
+	return append([]string{path}, cmd[1:]...), nil
+}
+
+// extraGdbCmds returns the target's own gdb commands: its command files are
+// sourced, and then its inline commands are run.
+func (t *TargetBuilder) extraGdbCmds() []string {
+	var cmds []string
+	for _, s := range t.target.GdbScripts {
+		cmds = append(cmds, "source "+util.TryRelPath(s))
+	}
+
+	return append(cmds, t.target.GdbCmds...)
+}
+
+// shellQuote quotes a string for the POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// gdbFrontendCmd builds the command that runs gdb through the target's
+// frontend.
+//
+// @param gdb                   The path of gdb.
+// @param args                  gdb's arguments.
+func (b *Builder) gdbFrontendCmd(gdb string, args []string) ([]string, error) {
+	frontend := b.targetBuilder.target.GdbFrontend
+
+	switch frontend {
+	case "", "gdb":
+		return lookPath(append([]string{gdb}, args...))
+
+	case GDB_FRONTEND_TUI:
+		return lookPath(append([]string{gdb, "-tui"}, args...))
+
+	case GDB_FRONTEND_GDBGUI:
+		path, err := exec.LookPath(gdb)
+		if err != nil {
+			return nil, util.FmtNewtError("cannot find %s: %s",
+				gdb, err.Error())
+		}
+		return lookPath([]string{
+			"gdbgui", "--gdb-cmd", shellJoin(append([]string{path}, args...)),
+		})
+
+	default:
+		// Without its arguments, gdb would not connect to the target.
+		if !strings.Contains(frontend, "{args}") {
+			return nil, util.FmtNewtError(
+				"gdb frontend \"%s\" must be %s, %s, or a command template "+
+					"containing {args}", frontend, GDB_FRONTEND_TUI,
+				GDB_FRONTEND_GDBGUI)
+		}
+
+		r := strings.NewReplacer(
+			"{gdb}", shellQuote(gdb),
+			"{elf}", shellQuote(b.AppElfPath()),
+			"{args}", shellJoin(args))
+		return lookPath([]string{"sh", "-c", r.Replace(frontend)})
+	}
+}
+
+// runGdb runs gdb interactively on the app's ELF file, through the target's
+// gdb frontend.  The target's own gdb commands follow the specified ones.
+//
+// @param gdbCmds               Commands that gdb executes on startup.
+func (b *Builder) runGdb(gdbCmds []string) error {
+	gdb, err := b.gdbPath()
+	if err != nil {
+		return err
+	}
+
+	args := []string{b.AppElfPath()}
+	gdbCmds = append(gdbCmds, b.targetBuilder.extraGdbCmds()...)
+	for _, c := range gdbCmds {
+		args = append(args, "-ex", c)
+	}
+
+	cmd, err := b.gdbFrontendCmd(gdb, args)
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Debug command: %s\n",
+		strings.Join(cmd, " "))
+	return util.ShellInteractiveCommand(cmd, nil)
+}
+
+// runGdbServer runs a GDB server and debugs the app with gdb connected to it.
+// The server is stopped when gdb exits.  If noGDB is true, only the server
+// is run, in the foreground.  The server's output is displayed if verbose
+// output is enabled or if it carries the target's semihosting output.
+//
+// @param serverCmd             The command that runs the GDB server.
+// @param gdbCmds               Commands that gdb executes after connecting.
+// @param noGDB                 Whether to run the server without gdb.
+func (b *Builder) runGdbServer(serverCmd []string, gdbCmds []string,
+	noGDB bool) error {
+
+	serverCmd, err := lookPath(serverCmd)
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "GDB server command: %s\n",
+		strings.Join(serverCmd, " "))
+
+	if noGDB {
+		return util.ShellInteractiveCommand(serverCmd, nil)
+	}
+
+	server := exec.Command(serverCmd[0], serverCmd[1:]...)
+	if util.Verbosity >= util.VERBOSITY_VERBOSE ||
+		b.targetBuilder.target.Semihosting {
+
+		server.Stdout = os.Stdout
+		server.Stderr = os.Stderr
+	}
+	if err := server.Start(); err != nil {
+		return util.FmtNewtError("failed to start %s: %s",
+			serverCmd[0], err.Error())
+	}
+	defer func() {
+		if err := server.Process.Kill(); err != nil {
+			log.Debugf("failed to stop GDB server: %s", err.Error())
+		}
+		server.Wait()
+	}()
+
+	return b.runGdb(gdbCmds)
+}
@@ -0,0 +1,90 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"strings"
+
+	"github.com/apache/mynewt-artifact/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// eraseAreas looks up the named flash areas in the BSP's flash map.  Only
+// areas on the MCU's internal flash (device 0) can be erased through a probe.
+func (t *TargetBuilder) eraseAreas(names []string) ([]flash.FlashArea, error) {
+	var areas []flash.FlashArea
+	for _, name := range names {
+		area, ok := t.bspPkg.FlashMap.Areas[name]
+		if !ok {
+			return nil, util.FmtNewtError(
+				"BSP flash map does not define %s", name)
+		}
+		if area.Device != 0 {
+			return nil, util.FmtNewtError(
+				"%s is on flash device %d; only the internal flash "+
+					"(device 0) can be erased", name, area.Device)
+		}
+		areas = append(areas, area)
+	}
+
+	return areas, nil
+}
+
+// Erase erases the flash of the target's board through its debugger backend.
+//
+// @param areaNames             The names of the flash areas to erase (e.g.,
+//                                  FLASH_AREA_NFFS); empty for a full chip
+//                                  erase.
+// @param probeId               The serial number of the probe to use; "" for
+//                                  the target's probe_id setting.
+func (t *TargetBuilder) Erase(areaNames []string, probeId string) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	debugger, err := t.Debugger()
+	if err != nil {
+		return err
+	}
+	if debugger == "" {
+		return util.FmtNewtError(
+			"target %s does not select a debugger backend; BSP scripts "+
+				"cannot erase flash", t.target.FullName())
+	}
+
+	p, err := t.AppBuilder.newProbe(debugger, probeId)
+	if err != nil {
+		return err
+	}
+
+	areas, err := t.eraseAreas(areaNames)
+	if err != nil {
+		return err
+	}
+
+	if len(areas) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Erasing chip\n")
+	} else {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Erasing %s\n",
+			strings.Join(areaNames, ", "))
+	}
+
+	return p.Erase(areas)
+}
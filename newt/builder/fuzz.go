@@ -0,0 +1,287 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+// A fuzz target package's seed inputs, checked in alongside its source.
+const FUZZ_CORPUS_DIR = "corpus"
+
+// A fuzz target package's dictionary of input tokens, if any.
+const FUZZ_DICT_FILENAME = "fuzz.dict"
+
+const (
+	FUZZ_ENGINE_LIBFUZZER = "libfuzzer"
+	FUZZ_ENGINE_AFL       = "afl"
+)
+
+// FuzzOpts controls a fuzzing campaign.
+type FuzzOpts struct {
+	// FUZZ_ENGINE_LIBFUZZER or FUZZ_ENGINE_AFL.
+	Engine string
+
+	// How long to fuzz; 0 to fuzz until interrupted.
+	Duration time.Duration
+
+	// Additional arguments for the fuzzing engine.
+	Args []string
+}
+
+// fuzzCompilerInfo returns the flags that build a libFuzzer harness with
+// sanitizers.  The fuzzer instrumentation also links in the engine's main().
+func fuzzCompilerInfo() *toolchain.CompilerInfo {
+	flags := []string{
+		"-fsanitize=fuzzer,address,undefined",
+		"-fno-omit-frame-pointer",
+	}
+
+	ci := toolchain.NewCompilerInfo()
+	ci.Cflags = append(ci.Cflags, flags...)
+	ci.CXXflags = append(ci.CXXflags, flags...)
+	ci.Lflags = append(ci.Lflags, flags...)
+
+	return ci
+}
+
+// FuzzCreateExe builds and links a fuzz target package's executable.
+func (t *TargetBuilder) FuzzCreateExe() error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	t.AppBuilder.AddCompilerInfo(fuzzCompilerInfo())
+
+	testRpkg, err := t.getTestRpkg()
+	if err != nil {
+		return err
+	}
+
+	t.AppBuilder.testPkg = t.AppBuilder.PkgMap[testRpkg]
+	if t.AppBuilder.testPkg == nil {
+		return util.FmtNewtError(
+			"builder in invalid state: missing fuzz package")
+	}
+
+	if err := t.AppBuilder.Build(); err != nil {
+		return err
+	}
+
+	if err := t.AppBuilder.SelfTestLink(testRpkg, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// fuzzDirs returns the directories that a campaign reads from and writes to.
+//
+// @return string               The package's seed corpus; "" if it has none.
+// @return string               The directory that the campaign writes its
+//                                  corpus and crashing inputs to.
+func (b *Builder) fuzzDirs() (string, string) {
+	seedDir := filepath.Join(b.testPkg.rpkg.Lpkg.BasePath(), FUZZ_CORPUS_DIR)
+	if !util.NodeExist(seedDir) {
+		seedDir = ""
+	}
+
+	outDir := filepath.Join(filepath.Dir(b.TestExePath()), "fuzz")
+
+	return seedDir, outDir
+}
+
+// libFuzzerCmd returns the command that runs a libFuzzer campaign.  New
+// inputs are added to the first corpus directory, so the package's seed
+// corpus is never modified.
+func (b *Builder) libFuzzerCmd(exePath string, seedDir string,
+	outDir string, opts FuzzOpts) ([]string, error) {
+
+	corpusDir := filepath.Join(outDir, "corpus")
+	crashDir := filepath.Join(outDir, "crashes")
+	for _, dir := range []string{corpusDir, crashDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+	}
+
+	cmd := []string{
+		exePath,
+		"-artifact_prefix=" + crashDir + "/",
+	}
+	if opts.Duration > 0 {
+		cmd = append(cmd, "-max_total_time="+
+			strconv.Itoa(int(opts.Duration/time.Second)))
+	}
+
+	dictPath := filepath.Join(b.testPkg.rpkg.Lpkg.BasePath(),
+		FUZZ_DICT_FILENAME)
+	if util.NodeExist(dictPath) {
+		cmd = append(cmd, "-dict="+dictPath)
+	}
+
+	cmd = append(cmd, opts.Args...)
+	cmd = append(cmd, corpusDir)
+	if seedDir != "" {
+		cmd = append(cmd, seedDir)
+	}
+
+	return cmd, nil
+}
+
+// aflCmd returns the command that runs an AFL++ campaign.  AFL requires at
+// least one seed input; an empty one is used if the package has no corpus.
+func (b *Builder) aflCmd(exePath string, seedDir string,
+	outDir string, opts FuzzOpts) ([]string, error) {
+
+	if seedDir == "" {
+		seedDir = filepath.Join(outDir, "seed")
+		if err := os.MkdirAll(seedDir, os.ModePerm); err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(seedDir, "empty"), nil,
+			0644); err != nil {
+
+			return nil, util.ChildNewtError(err)
+		}
+	}
+
+	cmd := []string{
+		"afl-fuzz",
+		"-i", seedDir,
+		"-o", filepath.Join(outDir, "afl"),
+	}
+	if opts.Duration > 0 {
+		cmd = append(cmd, "-V", strconv.Itoa(int(opts.Duration/time.Second)))
+	}
+
+	dictPath := filepath.Join(b.testPkg.rpkg.Lpkg.BasePath(),
+		FUZZ_DICT_FILENAME)
+	if util.NodeExist(dictPath) {
+		cmd = append(cmd, "-x", dictPath)
+	}
+
+	cmd = append(cmd, opts.Args...)
+	cmd = append(cmd, "--", exePath)
+
+	return cmd, nil
+}
+
+// fuzzCrashes lists the crashing inputs that a campaign found.
+func fuzzCrashes(outDir string, engine string) ([]string, error) {
+	var pattern string
+	if engine == FUZZ_ENGINE_AFL {
+		pattern = filepath.Join(outDir, "afl", "*", "crashes", "id*")
+	} else {
+		pattern = filepath.Join(outDir, "crashes", "*")
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// Fuzz builds a fuzz target package and runs a fuzzing campaign on it.  The
+// campaign's corpus and crashing inputs are kept in the package's bin
+// directory, so that subsequent campaigns continue where it left off.  An
+// error is returned if the campaign finds any crashing inputs.
+func (t *TargetBuilder) Fuzz(opts FuzzOpts) error {
+	if err := t.FuzzCreateExe(); err != nil {
+		return err
+	}
+
+	b := t.AppBuilder
+	exePath := b.TestExePath()
+	seedDir, outDir := b.fuzzDirs()
+
+	var cmd []string
+	var err error
+	switch opts.Engine {
+	case FUZZ_ENGINE_LIBFUZZER:
+		cmd, err = b.libFuzzerCmd(exePath, seedDir, outDir, opts)
+	case FUZZ_ENGINE_AFL:
+		cmd, err = b.aflCmd(exePath, seedDir, outDir, opts)
+	default:
+		err = util.FmtNewtError(
+			"invalid fuzzing engine \"%s\"; must be one of: %s, %s",
+			opts.Engine, FUZZ_ENGINE_LIBFUZZER, FUZZ_ENGINE_AFL)
+	}
+	if err != nil {
+		return err
+	}
+
+	prevCrashes, err := fuzzCrashes(outDir, opts.Engine)
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Fuzzing %s with %s\n",
+		t.testPkg.FullName(), opts.Engine)
+
+	// The engine reports its progress on the console.  libFuzzer exits with
+	// an error when it finds a crash; AFL keeps going.
+	runErr := util.ShellInteractiveCommand(cmd, nil)
+
+	crashes, err := fuzzCrashes(outDir, opts.Engine)
+	if err != nil {
+		return err
+	}
+
+	prevMap := make(map[string]struct{}, len(prevCrashes))
+	for _, c := range prevCrashes {
+		prevMap[c] = struct{}{}
+	}
+	var newCrashes []string
+	for _, c := range crashes {
+		if _, ok := prevMap[c]; !ok {
+			newCrashes = append(newCrashes, c)
+		}
+	}
+
+	if len(newCrashes) > 0 {
+		return util.FmtNewtError(
+			"Fuzzing %s found %d crashing input(s):\n    %s\n"+
+				"Reproduce a crash with: %s <input>",
+			t.testPkg.FullName(), len(newCrashes),
+			strings.Join(newCrashes, "\n    "), exePath)
+	}
+	if runErr != nil {
+		return runErr
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Fuzzing %s found no crashes; corpus saved in %s\n",
+		t.testPkg.FullName(), outDir)
+
+	return nil
+}
@@ -0,0 +1,161 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+// Project-level hooks.  `project.yml` can specify shell commands to run before
+// and after a target is built and before and after an image is created:
+//
+//     project.pre_build_cmds:
+//         - scripts/gen_version_h.sh
+//     project.post_image_cmds:
+//         - scripts/upload.sh "$MYNEWT_IMAGE_PATH"
+//
+// Each command is run with `sh -c` from the project's base directory.  The
+// target being built is described by MYNEWT_* environment variables.
+const (
+	HOOK_PRE_BUILD  = "pre_build_cmds"
+	HOOK_POST_BUILD = "post_build_cmds"
+	HOOK_PRE_IMAGE  = "pre_image_cmds"
+	HOOK_POST_IMAGE = "post_image_cmds"
+)
+
+// hookEnv produces the environment variables passed to hook commands.
+func (t *TargetBuilder) hookEnv() map[string]string {
+	proj := project.GetProject()
+
+	env := map[string]string{}
+
+	// Start with the target's own environment settings; the MYNEWT_*
+	// variables take precedence.
+	for k, v := range t.target.Env {
+		env[k] = v
+	}
+
+	for k, v := range map[string]string{
+		"MYNEWT_PROJECT_ROOT":  proj.Path(),
+		"MYNEWT_TARGET":        t.target.FullName(),
+		"MYNEWT_TARGET_NAME":   t.target.ShortName(),
+		"MYNEWT_BSP":           t.bspPkg.FullName(),
+		"MYNEWT_BUILD_PROFILE": t.target.BuildProfile,
+		"MYNEWT_BIN_ROOT":      BinRoot(),
+		"MYNEWT_BIN_DIR":       TargetBinDir(t.target.FullName()),
+	} {
+		env[k] = v
+	}
+
+	if t.appPkg != nil {
+		env["MYNEWT_APP"] = t.appPkg.FullName()
+	}
+	if t.loaderPkg != nil {
+		env["MYNEWT_LOADER"] = t.loaderPkg.FullName()
+	}
+
+	if t.AppBuilder != nil {
+		if t.AppBuilder.appPkg != nil {
+			env["MYNEWT_APP_BIN_BASENAME"] = t.AppBuilder.AppBinBasePath()
+		}
+
+		// Add all syscfg settings with the MYNEWT_VAL_ prefix, as is done
+		// for the BSP download scripts.
+		for k, v := range t.AppBuilder.cfg.SettingValues() {
+			env["MYNEWT_VAL_"+k] = v
+		}
+	}
+
+	return env
+}
+
+// RunHooks executes the `project.yml` hook commands with the specified name.
+// Hooks are not run for unit test builds.
+//
+// @param name                  The name of the hook list to run (one of the
+//                                  HOOK_[...] constants).
+// @param extraEnv              Additional environment variables to pass to
+//                                  the commands; may be nil.
+//
+// @return error                Error if any command fails.
+func (t *TargetBuilder) RunHooks(name string,
+	extraEnv map[string]string) error {
+
+	if t.testPkg != nil {
+		return nil
+	}
+
+	proj := project.GetProject()
+	cmds := proj.HookCmds(name)
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	envMap := t.hookEnv()
+	for k, v := range extraEnv {
+		envMap[k] = v
+	}
+
+	keys := make([]string, 0, len(envMap))
+	for k, _ := range envMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	env := make([]string, len(keys))
+	for i, k := range keys {
+		env[i] = fmt.Sprintf("%s=%s", k, envMap[k])
+	}
+
+	// Hooks always run from the project's base directory.
+	cwd, err := os.Getwd()
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer os.Chdir(cwd)
+
+	if err := os.Chdir(proj.Path()); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	for _, c := range cmds {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Running %s: %s\n",
+			name, c)
+
+		out, err := util.ShellCommand([]string{"sh", "-c", c}, env)
+		if len(out) > 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", string(out))
+		}
+		if err != nil {
+			return util.FmtNewtError("%s command failed: %s", name, c)
+		}
+
+		log.Debugf("%s command succeeded: %s", name, c)
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/apache/mynewt-artifact/image"
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/serialport"
+	"mynewt.apache.org/newt/newt/testreport"
+	"mynewt.apache.org/newt/util"
+)
+
+// The default time that on-target tests may run.
+const TEST_DFLT_HW_TIMEOUT = 60 * time.Second
+
+// The line that the test harness prints once all tests have run on hardware.
+const TEST_DONE_MARKER = "[done]"
+
+// selfTestCreateImage builds the test executable for the target's BSP and
+// converts it to an image that the bootloader can boot.
+//
+// @return string               The path of the image.
+func (t *TargetBuilder) selfTestCreateImage() (string, error) {
+	if err := t.selfTestCreateExe(t.bspPkg.LinkerScripts, false); err != nil {
+		return "", err
+	}
+
+	binPath := t.AppBuilder.TestExePath() + ".bin"
+	if _, err := os.Stat(binPath); err != nil {
+		return "", util.FmtNewtError(
+			"test executable binary %s not produced; does the compiler "+
+				"package set compiler.ld.binfile?", binPath)
+	}
+
+	ri, err := image.GenerateImage(image.ImageCreateOpts{
+		SrcBinFilename: binPath,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	imgPath := strings.TrimSuffix(t.AppBuilder.TestExePath(), ".elf") +
+		".img"
+	f, err := os.Create(imgPath)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	if _, err := ri.Write(f); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return imgPath, nil
+}
+
+// openTestOutput opens the console that on-target test results are read
+// from.
+func (t *TargetBuilder) openTestOutput(p Probe,
+	opts TestOpts) (io.ReadCloser, error) {
+
+	if opts.Rtt {
+		return p.ConsoleReader(0)
+	}
+
+	port, err := t.consolePort(opts.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	return serialport.Open(port, t.consoleBaud(opts.Baud))
+}
+
+// readTestOutput reads the test harness's output until it finishes or the
+// timeout expires.
+//
+// @return []testreport.Line    The output.
+// @return error                Error if the timeout expired.
+func readTestOutput(r io.Reader,
+	timeout time.Duration) ([]testreport.Line, error) {
+
+	lineChan := make(chan testreport.Line)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lineChan <- testreport.Line{
+				Text: scanner.Text(),
+				Time: time.Now(),
+			}
+		}
+		close(lineChan)
+	}()
+
+	var lines []testreport.Line
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case line, ok := <-lineChan:
+			if !ok {
+				return lines, util.NewNewtError(
+					"test output ended before the tests finished")
+			}
+
+			log.Debugf("test: %s", line.Text)
+			util.StatusMessage(util.VERBOSITY_VERBOSE, "%s\n", line.Text)
+
+			lines = append(lines, line)
+			if strings.TrimSpace(line.Text) == TEST_DONE_MARKER {
+				return lines, nil
+			}
+
+		case <-timer.C:
+			// Unblock the reader.
+			go func() {
+				for range lineChan {
+				}
+			}()
+			return lines, util.FmtNewtError(
+				"tests did not finish within %s", timeout)
+		}
+	}
+}
+
+// SelfTestOnTarget builds the package's tests for the target's hardware,
+// loads them through the target's debugger backend, and collects the
+// results from the board's console.
+func (t *TargetBuilder) SelfTestOnTarget(opts TestOpts) error {
+	pkgName := t.testPkg.FullName()
+	tgtName := t.target.FullName()
+
+	start := time.Now()
+	fail := func(step string, err error) error {
+		if opts.Report != nil {
+			opts.Report.Add(testreport.ErrorSuite(pkgName, tgtName, start,
+				step, err))
+		}
+		return err
+	}
+
+	imgPath, err := t.selfTestCreateImage()
+	if err != nil {
+		return fail("build", err)
+	}
+
+	debugger, err := t.Debugger()
+	if err != nil {
+		return fail("load", err)
+	}
+	if debugger == "" {
+		return fail("load", util.FmtNewtError(
+			"target %s does not select a debugger backend; cannot run "+
+				"tests on it", tgtName))
+	}
+
+	b := t.AppBuilder
+	p, err := b.newProbe(debugger, "")
+	if err != nil {
+		return fail("load", err)
+	}
+
+	area, err := b.loadArea(0)
+	if err != nil {
+		return fail("load", err)
+	}
+
+	// Open a serial console before loading, so that no output is missed.
+	// The RTT control block only exists once the tests start.
+	var r io.ReadCloser
+	if !opts.Rtt {
+		if r, err = t.openTestOutput(p, opts); err != nil {
+			return fail("load", err)
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Loading test image: %s\n",
+		util.TryRelPath(imgPath))
+	if err := p.Program(imgPath, area.Offset); err != nil {
+		if r != nil {
+			r.Close()
+		}
+		return fail("load", err)
+	}
+
+	if opts.Rtt {
+		if r, err = t.openTestOutput(p, opts); err != nil {
+			return fail("run", err)
+		}
+	}
+	defer r.Close()
+
+	timeout := opts.timeout(t.testPkg, TEST_DFLT_HW_TIMEOUT)
+
+	runStart := time.Now()
+	lines, runErr := readTestOutput(r, timeout)
+
+	suites := testreport.Parse(pkgName, tgtName, runStart, lines)
+	if opts.Report != nil {
+		opts.Report.Add(suites...)
+		if runErr != nil && !testreport.HasFailure(suites) {
+			opts.Report.Add(testreport.ErrorSuite(pkgName, tgtName,
+				runStart, "run", runErr))
+		}
+	}
+
+	var failed []string
+	for _, s := range suites {
+		for _, c := range s.Cases {
+			if c.Failure != "" {
+				failed = append(failed, s.Name+"/"+c.Name+": "+c.Failure)
+			}
+		}
+	}
+
+	if runErr != nil {
+		failed = append(failed, runErr.Error())
+	}
+	if len(failed) > 0 {
+		return util.FmtNewtError("Test failure (%s):\n%s",
+			t.testPkg.Name(), strings.Join(failed, "\n"))
+	}
+
+	return nil
+}
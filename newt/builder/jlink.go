@@ -0,0 +1,296 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/apache/mynewt-artifact/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// J-Link backend.  Boards with SEGGER J-Link probes are loaded with JLinkExe
+// and debugged with JLinkGDBServer, given the J-Link device name of the MCU,
+// the debug interface, and the interface speed.  Each setting can be
+// specified by the BSP (`bsp.jlink_<setting>`) or the target
+// (`target.jlink_<setting>`); the target's value takes precedence.
+
+const JLINK_DFLT_SPEED = "4000"
+
+type jlinkCfg struct {
+	Device    string
+	Interface string
+	Speed     string
+	Serial    string
+}
+
+// jlinkSettings resolves and validates the target's J-Link settings.
+func (t *TargetBuilder) jlinkSettings() (jlinkCfg, error) {
+	pick := func(tgtVal string, bspVal string) string {
+		if tgtVal != "" {
+			return tgtVal
+		}
+		return bspVal
+	}
+
+	s := jlinkCfg{
+		Device:    pick(t.target.JlinkDevice, t.bspPkg.JlinkDevice),
+		Interface: pick(t.target.JlinkInterface, t.bspPkg.JlinkInterface),
+		Speed:     pick(t.target.JlinkSpeed, t.bspPkg.JlinkSpeed),
+		Serial:    t.target.ProbeId,
+	}
+
+	if s.Device == "" {
+		return s, util.FmtNewtError(
+			"target %s uses J-Link but neither the target nor its BSP "+
+				"specifies a J-Link device name (jlink_device)",
+			t.target.FullName())
+	}
+
+	s.Interface = strings.ToUpper(s.Interface)
+	switch s.Interface {
+	case "":
+		s.Interface = "SWD"
+	case "SWD", "JTAG":
+	default:
+		return s, util.FmtNewtError(
+			"invalid jlink_interface \"%s\"; must be swd or jtag",
+			s.Interface)
+	}
+
+	switch s.Speed {
+	case "":
+		s.Speed = JLINK_DFLT_SPEED
+	case "auto", "adaptive":
+	default:
+		if _, err := strconv.Atoi(s.Speed); err != nil {
+			return s, util.FmtNewtError(
+				"invalid jlink_speed \"%s\"; must be a number of kHz, "+
+					"auto, or adaptive", s.Speed)
+		}
+	}
+
+	return s, nil
+}
+
+// jlinkScriptPath returns the path of a JLinkExe command file.  Each probe
+// gets its own file so that several can be loaded at once.
+//
+// @param op                    The operation that the file performs (e.g.,
+//                                  "load").
+// @param serial                The serial number of the probe; "" for any.
+func (b *Builder) jlinkScriptPath(op string, serial string) string {
+	if serial == "" {
+		return b.AppBinBasePath() + "." + op + ".jlink"
+	}
+	return b.AppBinBasePath() + "." + serial + "." + op + ".jlink"
+}
+
+// runJlinkExe writes a JLinkExe command file and runs JLinkExe with it.
+//
+// @param op                    The operation that the commands perform.
+// @param cmds                  The JLinkExe commands.
+// @param probeId               The serial number of the probe to use; "" for
+//                                  the target's probe_id setting.
+func (b *Builder) runJlinkExe(op string, cmds []string, probeId string) error {
+	s, err := b.targetBuilder.jlinkSettings()
+	if err != nil {
+		return err
+	}
+	if probeId != "" {
+		s.Serial = probeId
+	}
+
+	script := strings.Join(append(cmds, "exit"), "\n") + "\n"
+
+	scriptPath := b.jlinkScriptPath(op, s.Serial)
+	if err := ioutil.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	cmd := []string{
+		"JLinkExe",
+		"-device", s.Device,
+		"-if", s.Interface,
+		"-speed", s.Speed,
+		"-autoconnect", "1",
+		"-nogui", "1",
+	}
+	if s.Serial != "" {
+		cmd = append(cmd, "-SelectEmuBySN", s.Serial)
+	}
+	cmd = append(cmd, "-CommanderScript", util.TryRelPath(scriptPath))
+
+	// JLinkExe exits successfully even if the commands fail; check its output
+	// for errors.
+	out, err := util.ShellCommand(cmd, nil)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(out), "ERROR") ||
+		strings.Contains(string(out), "FAILED") {
+
+		return util.FmtNewtError("JLinkExe failed to %s:\n%s",
+			op, string(out))
+	}
+
+	return nil
+}
+
+// jlinkProbe drives a SEGGER J-Link probe with SEGGER's command line tools.
+type jlinkProbe struct {
+	b       *Builder
+	probeId string
+}
+
+// settings returns the J-Link settings with the probe's serial number.
+func (p *jlinkProbe) settings() (jlinkCfg, error) {
+	s, err := p.b.targetBuilder.jlinkSettings()
+	if err != nil {
+		return s, err
+	}
+	s.Serial = p.probeId
+
+	return s, nil
+}
+
+func (p *jlinkProbe) Program(binPath string, offset int) error {
+	err := p.b.runJlinkExe("load", []string{
+		"r",
+		fmt.Sprintf("loadbin %s,0x%x", util.TryRelPath(binPath), offset),
+		"r",
+		"g",
+	}, p.probeId)
+	if err != nil {
+		return err
+	}
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Successfully loaded image.\n")
+
+	return nil
+}
+
+// Erase erases the specified flash areas, or the entire chip if none are
+// specified.
+func (p *jlinkProbe) Erase(areas []flash.FlashArea) error {
+	cmds := []string{"r"}
+	if len(areas) == 0 {
+		cmds = append(cmds, "erase")
+	}
+	for _, area := range areas {
+		cmds = append(cmds, fmt.Sprintf("erase 0x%x 0x%x",
+			area.Offset, area.Offset+area.Size))
+	}
+
+	return p.b.runJlinkExe("erase", cmds, p.probeId)
+}
+
+func (p *jlinkProbe) ReadMem(area flash.FlashArea, dst string) error {
+	return p.b.runJlinkExe("readmem", []string{
+		"h",
+		fmt.Sprintf("savebin %s,0x%x,0x%x", dst, area.Offset, area.Size),
+	}, p.probeId)
+}
+
+func (p *jlinkProbe) Reset() error {
+	return p.b.runJlinkExe("reset", []string{"r", "g"}, p.probeId)
+}
+
+func (p *jlinkProbe) StartGdbServer(reset bool, attach bool,
+	noGDB bool) error {
+
+	s, err := p.settings()
+	if err != nil {
+		return err
+	}
+
+	server := []string{
+		"JLinkGDBServer",
+		"-device", s.Device,
+		"-if", s.Interface,
+		"-speed", s.Speed,
+		"-port", strconv.Itoa(GDB_SERVER_PORT),
+		"-singlerun",
+		"-nogui",
+	}
+	if s.Serial != "" {
+		server = append(server, "-select", "USB="+s.Serial)
+	}
+	if attach {
+		server = append(server, "-noreset", "-nohalt")
+	}
+
+	gdbCmds := []string{fmt.Sprintf("target remote :%d", GDB_SERVER_PORT)}
+	if reset {
+		// J-Link's reset command halts the MCU after resetting it.
+		gdbCmds = append(gdbCmds, "monitor reset")
+	}
+	if p.b.targetBuilder.target.Semihosting {
+		// Send semihosting output to gdb's console.
+		gdbCmds = append(gdbCmds,
+			"monitor semihosting enable",
+			"monitor semihosting IOClient 2")
+	}
+
+	return p.b.runGdbServer(server, gdbCmds, noGDB)
+}
+
+// rttCmd returns the command that streams an RTT channel to stdout.
+func (p *jlinkProbe) rttCmd(channel int) ([]string, error) {
+	s, err := p.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := []string{
+		"JLinkRTTLogger",
+		"-Device", s.Device,
+		"-If", s.Interface,
+		"-Speed", s.Speed,
+		"-RTTChannel", strconv.Itoa(channel),
+	}
+	if s.Serial != "" {
+		cmd = append(cmd, "-USB", s.Serial)
+	}
+	cmd = append(cmd, "/dev/stdout")
+
+	return cmd, nil
+}
+
+func (p *jlinkProbe) ConsoleStream(channel int) error {
+	cmd, err := p.rttCmd(channel)
+	if err != nil {
+		return err
+	}
+
+	return runRttCmd(cmd)
+}
+
+func (p *jlinkProbe) ConsoleReader(channel int) (io.ReadCloser, error) {
+	cmd, err := p.rttCmd(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return startCmdReader(cmd)
+}
@@ -26,6 +26,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/apache/mynewt-artifact/flash"
 	"mynewt.apache.org/newt/newt/parse"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
@@ -40,16 +41,7 @@ func (t *TargetBuilder) Load(extraJtagCmd string) error {
 		return err
 	}
 
-	if t.LoaderBuilder != nil {
-		err = t.AppBuilder.Load(1, extraJtagCmd)
-		if err == nil {
-			err = t.LoaderBuilder.Load(0, extraJtagCmd)
-		}
-	} else {
-		err = t.AppBuilder.Load(0, extraJtagCmd)
-	}
-
-	return err
+	return t.loadProbe(extraJtagCmd, "")
 }
 
 func Load(binBaseName string, bspPkg *pkg.BspPackage,
@@ -111,38 +103,99 @@ func (b *Builder) Load(imageSlot int, extraJtagCmd string) error {
 		return err
 	}
 
-	envSettings := map[string]string{
-		"IMAGE_SLOT": strconv.Itoa(imageSlot),
-		"FEATURES":   b.FeatureString(),
+	return b.loadProbe(imageSlot, extraJtagCmd, "")
+}
+
+// loadProbe writes the app to flash through the specified probe.  The target
+// must already be prepared for building.
+//
+// @param imageSlot             The slot to load the image into.
+// @param extraJtagCmd          Extra commands for the BSP's download script.
+// @param probeId               The serial number of the probe to use; "" for
+//                                  the target's probe_id setting.
+func (b *Builder) loadProbe(imageSlot int, extraJtagCmd string,
+	probeId string) error {
+
+	load, err := b.prepLoad(imageSlot, extraJtagCmd, probeId)
+	if err != nil {
+		return err
+	}
+
+	return load()
+}
+
+// prepLoad reads everything that loading the app through the specified probe
+// needs from the builder, and returns a function that runs the loader.
+// Preparation holds the target builder's load lock, so loads through several
+// probes in parallel do not use the builders at the same time.  The returned
+// function runs the external tool; it only reads the target's debugger
+// settings.
+//
+// @param imageSlot             The slot to load the image into.
+// @param extraJtagCmd          Extra commands for the BSP's download script.
+// @param probeId               The serial number of the probe to use; "" for
+//                                  the target's probe_id setting.
+//
+// @return func() error         Loads the app.
+// @return error                Error preparing the load.
+func (b *Builder) prepLoad(imageSlot int, extraJtagCmd string,
+	probeId string) (func() error, error) {
+
+	b.targetBuilder.loadMtx.Lock()
+	defer b.targetBuilder.loadMtx.Unlock()
+
+	var probeDesc string
+	if probeId != "" {
+		probeDesc = fmt.Sprintf(" (probe %s)", probeId)
+	}
+
+	// Start with the target's own environment settings; the settings below
+	// take precedence.
+	envSettings := map[string]string{}
+	for k, v := range b.targetBuilder.target.Env {
+		envSettings[k] = v
+	}
+
+	envSettings["IMAGE_SLOT"] = strconv.Itoa(imageSlot)
+	envSettings["FEATURES"] = b.FeatureString()
+	extraJtagCmd, err := b.targetBuilder.extraJtagCmd(extraJtagCmd)
+	if err != nil {
+		return nil, err
 	}
 	if extraJtagCmd != "" {
 		envSettings["EXTRA_JTAG_CMD"] = extraJtagCmd
 	}
+	if probeId != "" {
+		envSettings["PROBE_SERIAL"] = probeId
+	} else if b.targetBuilder.target.ProbeId != "" {
+		envSettings["PROBE_SERIAL"] = b.targetBuilder.target.ProbeId
+	}
 	settings := b.cfg.SettingValues()
 
-	var flashTargetArea string
 	if parse.ValueIsTrue(settings["BOOT_LOADER"]) {
 		envSettings["BOOT_LOADER"] = "1"
+	}
+	b.loadMessage(imageSlot, probeDesc)
 
-		flashTargetArea = "FLASH_AREA_BOOTLOADER"
-		util.StatusMessage(util.VERBOSITY_DEFAULT,
-			"Loading bootloader\n")
-	} else {
-		if imageSlot == 0 {
-			flashTargetArea = "FLASH_AREA_IMAGE_0"
-		} else if imageSlot == 1 {
-			flashTargetArea = "FLASH_AREA_IMAGE_1"
+	tgtArea, err := b.loadArea(imageSlot)
+	if err != nil {
+		return nil, err
+	}
+	debugger, err := b.targetBuilder.Debugger()
+	if err != nil {
+		return nil, err
+	}
+	if debugger != "" {
+		p, err := b.newProbe(debugger, probeId)
+		if err != nil {
+			return nil, err
 		}
-		util.StatusMessage(util.VERBOSITY_DEFAULT,
-			"Loading %s image into slot %d\n", b.buildName, imageSlot+1)
+		loadFile := b.loadFile()
+		return func() error {
+			return p.Program(loadFile, tgtArea.Offset)
+		}, nil
 	}
 
-	bspPkg := b.targetBuilder.bspPkg
-	tgtArea := bspPkg.FlashMap.Areas[flashTargetArea]
-	if tgtArea.Name == "" {
-		return util.NewNewtError(fmt.Sprintf("No flash target area %s\n",
-			flashTargetArea))
-	}
 	envSettings["FLASH_OFFSET"] = "0x" + strconv.FormatInt(int64(tgtArea.Offset), 16)
 	envSettings["FLASH_AREA_SIZE"] = "0x" + strconv.FormatInt(int64(tgtArea.Size), 16)
 
@@ -154,11 +207,47 @@ func (b *Builder) Load(imageSlot int, extraJtagCmd string) error {
 	// Convert the binary path from absolute to relative.  This is required for
 	// compatibility with unix-in-windows environemnts (e.g., cygwin).
 	binPath := util.TryRelPath(b.AppBinBasePath())
-	if err := Load(binPath, b.targetBuilder.bspPkg, envSettings); err != nil {
-		return err
+	bspPkg := b.targetBuilder.bspPkg
+	return func() error {
+		return Load(binPath, bspPkg, envSettings)
+	}, nil
+}
+
+// loadArea returns the flash area that the app is loaded into: the
+// bootloader's area, or the specified image slot.
+func (b *Builder) loadArea(imageSlot int) (flash.FlashArea, error) {
+	var flashTargetArea string
+	if parse.ValueIsTrue(b.cfg.SettingValues()["BOOT_LOADER"]) {
+		flashTargetArea = "FLASH_AREA_BOOTLOADER"
+	} else if imageSlot == 0 {
+		flashTargetArea = "FLASH_AREA_IMAGE_0"
+	} else if imageSlot == 1 {
+		flashTargetArea = "FLASH_AREA_IMAGE_1"
 	}
 
-	return nil
+	tgtArea := b.targetBuilder.bspPkg.FlashMap.Areas[flashTargetArea]
+	if tgtArea.Name == "" {
+		return tgtArea, util.NewNewtError(fmt.Sprintf(
+			"No flash target area %s\n", flashTargetArea))
+	}
+
+	return tgtArea, nil
+}
+
+// loadMessage announces that the app is being loaded.
+//
+// @param imageSlot             The slot the image is loaded into.
+// @param desc                  Describes where the app is loaded (e.g., the
+//                                  probe); may be "".
+func (b *Builder) loadMessage(imageSlot int, desc string) {
+	if parse.ValueIsTrue(b.cfg.SettingValues()["BOOT_LOADER"]) {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Loading bootloader%s\n", desc)
+	} else {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Loading %s image into slot %d%s\n", b.buildName, imageSlot+1,
+			desc)
+	}
 }
 
 func (t *TargetBuilder) Debug(extraJtagCmd string, reset bool, noGDB bool) error {
@@ -172,8 +261,31 @@ func (t *TargetBuilder) Debug(extraJtagCmd string, reset bool, noGDB bool) error
 	return t.LoaderBuilder.Debug(extraJtagCmd, reset, noGDB)
 }
 
+// Attach debugs the device in its current state: gdb attaches to the running
+// app without loading, resetting, or (where the probe allows it) halting the
+// MCU when the GDB server connects.
+//
+// @param extraJtagCmd          Extra commands for the BSP's debug script.
+// @param noGDB                 Whether to run the GDB server without gdb.
+func (t *TargetBuilder) Attach(extraJtagCmd string, noGDB bool) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	b := t.AppBuilder
+	if t.LoaderBuilder != nil {
+		b = t.LoaderBuilder
+	}
+	if b.appPkg == nil {
+		return util.NewNewtError("app package not specified")
+	}
+
+	binPath := util.TryRelPath(b.AppBinBasePath())
+	return b.debugBin(binPath, extraJtagCmd, false, true, noGDB)
+}
+
 func (b *Builder) debugBin(binPath string, extraJtagCmd string, reset bool,
-	noGDB bool) error {
+	attach bool, noGDB bool) error {
 	/*
 	 * Populate the package list and feature sets.
 	 */
@@ -182,21 +294,67 @@ func (b *Builder) debugBin(binPath string, extraJtagCmd string, reset bool,
 		return err
 	}
 
+	debugger, err := b.targetBuilder.Debugger()
+	if err != nil {
+		return err
+	}
+	if debugger != "" {
+		p, err := b.newProbe(debugger, "")
+		if err != nil {
+			return err
+		}
+		return p.StartGdbServer(reset, attach, noGDB)
+	}
+	if b.targetBuilder.target.GdbFrontend != "" {
+		return util.FmtNewtError(
+			"target %s does not select a debugger backend; BSP debug "+
+				"scripts cannot use a gdb frontend",
+			b.targetBuilder.target.FullName())
+	}
+
 	bspPath := b.bspPkg.rpkg.Lpkg.BasePath()
 	binBaseName := binPath
 	featureString := b.FeatureString()
 
+	// Start with the target's own environment settings.  The settings that
+	// newt passes to the debug script are appended afterwards so that they
+	// take precedence.
+	envSettings := []string{}
+	tgtEnv := b.targetBuilder.target.Env
+	tgtKeys := make([]string, 0, len(tgtEnv))
+	for k, _ := range tgtEnv {
+		tgtKeys = append(tgtKeys, k)
+	}
+	sort.Strings(tgtKeys)
+	for _, k := range tgtKeys {
+		envSettings = append(envSettings, fmt.Sprintf("%s=%s", k, tgtEnv[k]))
+	}
+
 	coreRepo := project.GetProject().FindRepo("apache-mynewt-core")
-	envSettings := []string{
+	envSettings = append(envSettings,
 		fmt.Sprintf("CORE_PATH=%s", coreRepo.Path()),
 		fmt.Sprintf("BSP_PATH=%s", bspPath),
 		fmt.Sprintf("BIN_BASENAME=%s", binBaseName),
 		fmt.Sprintf("FEATURES=%s", featureString),
+	)
+	extraJtagCmd, err = b.targetBuilder.extraJtagCmd(extraJtagCmd)
+	if err != nil {
+		return err
 	}
 	if extraJtagCmd != "" {
 		envSettings = append(envSettings,
 			fmt.Sprintf("EXTRA_JTAG_CMD=%s", extraJtagCmd))
 	}
+	if gdbCmds := b.targetBuilder.extraGdbCmds(); len(gdbCmds) > 0 {
+		envSettings = append(envSettings,
+			fmt.Sprintf("EXTRA_GDB_CMDS=%s", strings.Join(gdbCmds, "\n")))
+	}
+	if b.targetBuilder.target.Semihosting {
+		envSettings = append(envSettings, "SEMIHOSTING=1")
+	}
+	if attach {
+		envSettings = append(envSettings, "ATTACH=1")
+	}
 	if reset == true {
 		envSettings = append(envSettings, fmt.Sprintf("RESET=true"))
 	}
@@ -224,5 +382,5 @@ func (b *Builder) Debug(extraJtagCmd string, reset bool, noGDB bool) error {
 	// Convert the binary path from absolute to relative.  This is required for
 	// Windows compatibility.
 	binPath := util.TryRelPath(b.AppBinBasePath())
-	return b.debugBin(binPath, extraJtagCmd, reset, noGDB)
+	return b.debugBin(binPath, extraJtagCmd, reset, false, noGDB)
 }
@@ -0,0 +1,295 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/apache/mynewt-artifact/flash"
+
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+// OpenOCD.  A target can select its own adapter (`target.openocd_adapter`),
+// transport (`target.openocd_transport`), speed (`target.openocd_speed`), and
+// additional configuration files (`target.openocd_cfg`) without editing its
+// BSP's scripts.  BSP scripts receive the overrides as OpenOCD commands in
+// EXTRA_JTAG_CMD.
+//
+// The openocd debugger backend runs OpenOCD directly, configured entirely by
+// the BSP's and target's YAML settings, so that boards can be loaded and
+// debugged without a shell (e.g., on Windows).
+
+// openocdAdapterCfg returns the configuration file of the target's adapter.
+// An adapter can be specified by name (e.g., "stlink") or by file.
+func (t *TargetBuilder) openocdAdapterCfg() string {
+	a := t.target.OpenocdAdapter
+	if a == "" || strings.HasSuffix(a, ".cfg") {
+		return a
+	}
+
+	return "interface/" + a + ".cfg"
+}
+
+// openocdCmds returns the OpenOCD commands that apply the target's transport
+// and speed overrides.
+func (t *TargetBuilder) openocdCmds() ([]string, error) {
+	var cmds []string
+
+	if t.target.OpenocdTransport != "" {
+		cmds = append(cmds, "transport select "+t.target.OpenocdTransport)
+	}
+
+	if t.target.OpenocdSpeed != "" {
+		if _, err := strconv.Atoi(t.target.OpenocdSpeed); err != nil {
+			return nil, util.FmtNewtError(
+				"invalid target.openocd_speed \"%s\"; must be a number of kHz",
+				t.target.OpenocdSpeed)
+		}
+		cmds = append(cmds, "adapter speed "+t.target.OpenocdSpeed)
+	}
+
+	return cmds, nil
+}
+
+// openocdArgs returns the arguments that configure OpenOCD for the target:
+// the target's adapter, the BSP's configuration files, the target's, and
+// then the target's overrides.
+//
+// @param probeId               The serial number of the probe to use; "" for
+//                                  any.
+func (t *TargetBuilder) openocdArgs(probeId string) ([]string, error) {
+	if len(t.bspPkg.OpenocdCfg) == 0 && len(t.target.OpenocdCfg) == 0 {
+		return nil, util.FmtNewtError(
+			"target %s does not specify any OpenOCD configuration files "+
+				"(openocd_cfg)", t.target.FullName())
+	}
+
+	args := []string{
+		"-s", t.bspPkg.BasePath(),
+		"-s", project.GetProject().Path(),
+	}
+	if adapter := t.openocdAdapterCfg(); adapter != "" {
+		args = append(args, "-f", adapter)
+	}
+	for _, cfg := range t.bspPkg.OpenocdCfg {
+		args = append(args, "-f", cfg)
+	}
+	for _, cfg := range t.target.OpenocdCfg {
+		args = append(args, "-f", cfg)
+	}
+
+	cmds, err := t.openocdCmds()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cmds {
+		args = append(args, "-c", c)
+	}
+	if probeId != "" {
+		args = append(args, "-c", "adapter serial "+probeId)
+	}
+
+	return args, nil
+}
+
+// extraJtagCmd returns the commands that BSP scripts pass to OpenOCD: the
+// target's overrides, followed by the user's extra commands.  The BSP's
+// configuration is read before these commands, so an adapter override only
+// works with a BSP that does not select an adapter itself.
+//
+// @param extraJtagCmd          The user's extra commands; may be "".
+func (t *TargetBuilder) extraJtagCmd(extraJtagCmd string) (string, error) {
+	var cmds []string
+
+	if adapter := t.openocdAdapterCfg(); adapter != "" {
+		cmds = append(cmds, fmt.Sprintf("source [find %s]", adapter))
+	}
+	for _, cfg := range t.target.OpenocdCfg {
+		cmds = append(cmds, fmt.Sprintf("source [find %s]", cfg))
+	}
+
+	overrides, err := t.openocdCmds()
+	if err != nil {
+		return "", err
+	}
+	cmds = append(cmds, overrides...)
+
+	if extraJtagCmd != "" {
+		cmds = append(cmds, extraJtagCmd)
+	}
+
+	return strings.Join(cmds, "; "), nil
+}
+
+// openocdPath expresses a path in the form that OpenOCD's Tcl commands
+// expect.
+func openocdPath(path string) string {
+	return filepath.ToSlash(util.TryRelPath(path))
+}
+
+// openocdProbe drives a probe with OpenOCD, configured by the BSP's OpenOCD
+// scripts and the target's overrides.
+type openocdProbe struct {
+	b       *Builder
+	probeId string
+}
+
+// run runs OpenOCD with the target's configuration, followed by the
+// specified commands.
+//
+// @param cmds                  The OpenOCD commands to run.
+func (p *openocdProbe) run(cmds []string) error {
+	args, err := p.b.targetBuilder.openocdArgs(p.probeId)
+	if err != nil {
+		return err
+	}
+
+	cmd := append([]string{"openocd"}, args...)
+	for _, c := range cmds {
+		cmd = append(cmd, "-c", c)
+	}
+
+	if _, err := util.ShellCommand(cmd, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *openocdProbe) Program(binPath string, offset int) error {
+	err := p.run([]string{
+		fmt.Sprintf("program %s verify reset exit 0x%x",
+			openocdPath(binPath), offset),
+	})
+	if err != nil {
+		return err
+	}
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Successfully loaded image.\n")
+
+	return nil
+}
+
+// Erase erases the specified flash areas, or the entire chip if none are
+// specified.
+func (p *openocdProbe) Erase(areas []flash.FlashArea) error {
+	cmds := []string{"init", "reset halt"}
+	if len(areas) == 0 {
+		cmds = append(cmds, "flash erase_sector 0 0 last")
+	}
+	for _, area := range areas {
+		cmds = append(cmds, fmt.Sprintf("flash erase_address 0x%x 0x%x",
+			area.Offset, area.Size))
+	}
+	cmds = append(cmds, "exit")
+
+	return p.run(cmds)
+}
+
+func (p *openocdProbe) ReadMem(area flash.FlashArea, dst string) error {
+	return p.run([]string{
+		"init",
+		fmt.Sprintf("dump_image %s 0x%x 0x%x",
+			openocdPath(dst), area.Offset, area.Size),
+		"exit",
+	})
+}
+
+func (p *openocdProbe) Reset() error {
+	return p.run([]string{"init", "reset run", "exit"})
+}
+
+func (p *openocdProbe) StartGdbServer(reset bool, attach bool,
+	noGDB bool) error {
+
+	args, err := p.b.targetBuilder.openocdArgs(p.probeId)
+	if err != nil {
+		return err
+	}
+
+	server := append([]string{"openocd"}, args...)
+	server = append(server,
+		"-c", fmt.Sprintf("gdb_port %d", GDB_SERVER_PORT),
+		"-c", "init")
+
+	gdbCmds := []string{fmt.Sprintf("target remote :%d", GDB_SERVER_PORT)}
+	if reset {
+		gdbCmds = append(gdbCmds, "monitor reset halt")
+	}
+	if p.b.targetBuilder.target.Semihosting {
+		// OpenOCD prints semihosting output on its console.
+		gdbCmds = append(gdbCmds, "monitor arm semihosting enable")
+	}
+
+	return p.b.runGdbServer(server, gdbCmds, noGDB)
+}
+
+// rttServerCmd returns the command that runs OpenOCD as a server for an RTT
+// channel.
+func (p *openocdProbe) rttServerCmd(channel int) ([]string, error) {
+	addr, size, err := p.b.rttControlBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := p.b.targetBuilder.openocdArgs(p.probeId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverCmd := append([]string{"openocd"}, args...)
+	serverCmd = append(serverCmd,
+		"-c", "init",
+		"-c", fmt.Sprintf("rtt setup 0x%x %d \"SEGGER RTT\"", addr, size),
+		"-c", "rtt start",
+		"-c", fmt.Sprintf("rtt server start %d %d", RTT_SERVER_PORT, channel))
+
+	return serverCmd, nil
+}
+
+func (p *openocdProbe) ConsoleStream(channel int) error {
+	serverCmd, err := p.rttServerCmd(channel)
+	if err != nil {
+		return err
+	}
+
+	stop, err := startServer(serverCmd)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	return streamRtt(fmt.Sprintf("localhost:%d", RTT_SERVER_PORT))
+}
+
+func (p *openocdProbe) ConsoleReader(channel int) (io.ReadCloser, error) {
+	serverCmd, err := p.rttServerCmd(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return openServerConn(serverCmd,
+		fmt.Sprintf("localhost:%d", RTT_SERVER_PORT))
+}
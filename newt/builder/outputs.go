@@ -0,0 +1,184 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Additional output formats.  A target's `target.output_formats` setting lists
+// formats that flashing tools and drag-and-drop bootloaders require.  Each
+// output is placed at the offset of the flash area it is destined for.
+
+const (
+	OUTPUT_FORMAT_HEX = "hex"
+	OUTPUT_FORMAT_UF2 = "uf2"
+)
+
+var outputFormats = []string{OUTPUT_FORMAT_HEX, OUTPUT_FORMAT_UF2}
+
+// UF2 block format; see https://github.com/microsoft/uf2.
+const (
+	UF2_MAGIC_START0        = 0x0a324655
+	UF2_MAGIC_START1        = 0x9e5d5157
+	UF2_MAGIC_END           = 0x0ab16f30
+	UF2_FLAG_FAMILY_PRESENT = 0x00002000
+	UF2_BLOCK_SIZE          = 512
+	UF2_PAYLOAD_SIZE        = 256
+	UF2_DATA_SIZE           = 476
+)
+
+func (t *TargetBuilder) checkOutputFormats() error {
+	for _, f := range t.target.OutputFormats {
+		known := false
+		for _, of := range outputFormats {
+			if f == of {
+				known = true
+			}
+		}
+		if !known {
+			return util.FmtNewtError(
+				"target %s specifies unknown output format \"%s\"; must be "+
+					"one of: %s", t.target.FullName(), f,
+				strings.Join(outputFormats, ", "))
+		}
+	}
+
+	return nil
+}
+
+// OutputPath returns the path of a file's output in the specified format;
+// the file's extension is replaced with the format name.
+func OutputPath(srcPath string, format string) string {
+	ext := filepath.Ext(srcPath)
+	return srcPath[:len(srcPath)-len(ext)] + "." + format
+}
+
+// writeUf2 converts a binary file to UF2.
+//
+// @param srcPath               The path of the binary file.
+// @param dstPath               The path of the UF2 file to write.
+// @param addr                  The flash address of the start of the binary.
+// @param familyId              The UF2 family ID of the MCU; 0 for none.
+func writeUf2(srcPath string, dstPath string, addr int,
+	familyId uint32) error {
+
+	data, err := ioutil.ReadFile(srcPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	numBlocks := (len(data) + UF2_PAYLOAD_SIZE - 1) / UF2_PAYLOAD_SIZE
+
+	var flags uint32
+	if familyId != 0 {
+		flags |= UF2_FLAG_FAMILY_PRESENT
+	}
+
+	buf := bytes.Buffer{}
+	for i := 0; i < numBlocks; i++ {
+		off := i * UF2_PAYLOAD_SIZE
+		end := off + UF2_PAYLOAD_SIZE
+		if end > len(data) {
+			end = len(data)
+		}
+
+		block := make([]byte, UF2_BLOCK_SIZE)
+		hdr := []uint32{
+			UF2_MAGIC_START0,
+			UF2_MAGIC_START1,
+			flags,
+			uint32(addr + off),
+			UF2_PAYLOAD_SIZE,
+			uint32(i),
+			uint32(numBlocks),
+			familyId,
+		}
+		for j, v := range hdr {
+			binary.LittleEndian.PutUint32(block[j*4:], v)
+		}
+		copy(block[32:32+UF2_DATA_SIZE], data[off:end])
+		binary.LittleEndian.PutUint32(block[UF2_BLOCK_SIZE-4:],
+			UF2_MAGIC_END)
+
+		buf.Write(block)
+	}
+
+	if err := ioutil.WriteFile(dstPath, buf.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// EmitOutputs writes a file in each of the target's additional output
+// formats (`target.output_formats`).  The outputs are written alongside the
+// source file.
+//
+// @param srcPath               The path of the binary or image file.
+// @param areaName              The flash area that the file is written to.
+func (t *TargetBuilder) EmitOutputs(srcPath string, areaName string) error {
+	if len(t.target.OutputFormats) == 0 {
+		return nil
+	}
+
+	area, ok := t.bspPkg.FlashMap.Areas[areaName]
+	if !ok {
+		return util.FmtNewtError(
+			"cannot emit outputs for %s: BSP flash map does not define %s",
+			srcPath, areaName)
+	}
+
+	for _, f := range t.target.OutputFormats {
+		dstPath := OutputPath(srcPath, f)
+
+		switch f {
+		case OUTPUT_FORMAT_HEX:
+			c, err := t.NewCompiler("", "")
+			if err != nil {
+				return err
+			}
+			if err := c.ConvertBinToHex(srcPath, dstPath,
+				area.Offset); err != nil {
+
+				return err
+			}
+
+		case OUTPUT_FORMAT_UF2:
+			if err := writeUf2(srcPath, dstPath, area.Offset,
+				t.target.Uf2FamilyId); err != nil {
+
+				return err
+			}
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"%s file successfully generated: %s\n",
+			strings.ToUpper(f), dstPath)
+	}
+
+	return nil
+}
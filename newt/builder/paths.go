@@ -32,7 +32,7 @@ const BUILD_NAME_APP = "app"
 const BUILD_NAME_LOADER = "loader"
 
 func BinRoot() string {
-	return project.GetProject().Path() + "/bin"
+	return project.GetProject().BinPath()
 }
 
 func TargetBinDir(targetName string) string {
@@ -0,0 +1,132 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io"
+
+	"mynewt.apache.org/newt/util"
+
+	"github.com/apache/mynewt-artifact/flash"
+)
+
+// Probe performs flash and debug operations on an MCU through a debug probe.
+// Each debugger backend implements this interface.
+type Probe interface {
+	// Program writes a binary to flash and then resets the MCU.
+	//
+	// @param binPath           The path of the binary to write.
+	// @param offset            The flash address to write it to.
+	Program(binPath string, offset int) error
+
+	// Erase erases the specified flash areas, or the entire chip if none are
+	// specified.
+	Erase(areas []flash.FlashArea) error
+
+	// ReadMem saves the contents of a flash area to a file.
+	//
+	// @param area              The flash area to read.
+	// @param dst               The path of the file to write.
+	ReadMem(area flash.FlashArea, dst string) error
+
+	// Reset resets the MCU and lets it run.
+	Reset() error
+
+	// StartGdbServer starts the probe's GDB server and, unless noGDB is set,
+	// connects gdb to it.
+	//
+	// @param reset             Whether to reset the MCU once gdb connects.
+	// @param attach            Whether to leave the MCU running when the
+	//                              GDB server connects to it.
+	// @param noGDB             Whether to run the GDB server without gdb.
+	StartGdbServer(reset bool, attach bool, noGDB bool) error
+
+	// ConsoleStream streams an RTT channel to stdout until interrupted.
+	//
+	// @param channel           The RTT channel to stream.
+	ConsoleStream(channel int) error
+
+	// ConsoleReader opens an RTT channel for reading.  Closing the reader
+	// stops the tool that reads the channel.
+	//
+	// @param channel           The RTT channel to read.
+	ConsoleReader(channel int) (io.ReadCloser, error)
+}
+
+// newProbe creates a probe for the specified debugger backend.
+//
+// @param debugger              The debugger backend.
+// @param probeId               The serial number of the probe to use; "" for
+//                                  the target's probe_id setting.
+func (b *Builder) newProbe(debugger string, probeId string) (Probe, error) {
+	explicit := probeId != ""
+	if probeId == "" {
+		probeId = b.targetBuilder.target.ProbeId
+	}
+
+	switch debugger {
+	case DEBUGGER_PYOCD:
+		return &pyocdProbe{b: b, probeId: probeId}, nil
+	case DEBUGGER_BMP:
+		if explicit {
+			return nil, util.NewNewtError(
+				"Black Magic Probes are selected by their serial port " +
+					"(BMP_PORT), not by serial number")
+		}
+		return &bmpProbe{b: b}, nil
+	case DEBUGGER_JLINK:
+		return &jlinkProbe{b: b, probeId: probeId}, nil
+	case DEBUGGER_OPENOCD:
+		return &openocdProbe{b: b, probeId: probeId}, nil
+	default:
+		return nil, util.FmtNewtError("unknown debugger \"%s\"", debugger)
+	}
+}
+
+// Reset resets the MCU of the target's board through its debugger backend
+// and lets the app run.
+//
+// @param probeId               The serial number of the probe to use; "" for
+//                                  the target's probe_id setting.
+func (t *TargetBuilder) Reset(probeId string) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	debugger, err := t.Debugger()
+	if err != nil {
+		return err
+	}
+	if debugger == "" {
+		return util.FmtNewtError(
+			"target %s does not select a debugger backend; BSP scripts "+
+				"cannot reset the board", t.target.FullName())
+	}
+
+	p, err := t.AppBuilder.newProbe(debugger, probeId)
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Resetting %s\n",
+		t.target.FullName())
+
+	return p.Reset()
+}
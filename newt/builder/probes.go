@@ -0,0 +1,183 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Multi-probe loading.  Labs often have several identical boards attached to
+// one machine; each is identified by the serial number of its probe.
+
+var jlinkSerialRe = regexp.MustCompile(`Serial number:\s*(\d+)`)
+
+// ListProbes returns the serial numbers of the attached probes that the
+// target's debugger backend can use.
+func (t *TargetBuilder) ListProbes() ([]string, error) {
+	debugger, err := t.Debugger()
+	if err != nil {
+		return nil, err
+	}
+
+	var probes []string
+	switch debugger {
+	case DEBUGGER_PYOCD:
+		probes, err = listPyocdProbes()
+	case DEBUGGER_JLINK:
+		probes, err = listJlinkProbes()
+	default:
+		return nil, util.FmtNewtError(
+			"cannot list the probes attached for target %s; its debugger "+
+				"backend must be %s or %s", t.target.FullName(),
+			DEBUGGER_PYOCD, DEBUGGER_JLINK)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(probes)
+	return probes, nil
+}
+
+func listPyocdProbes() ([]string, error) {
+	out, err := util.ShellCommand([]string{"pyocd", "json", "--probes"}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Boards []struct {
+			UniqueId string `json:"unique_id"`
+		} `json:"boards"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, util.FmtNewtError(
+			"cannot parse pyocd probe list: %s", err.Error())
+	}
+
+	var probes []string
+	for _, b := range list.Boards {
+		probes = append(probes, b.UniqueId)
+	}
+
+	return probes, nil
+}
+
+func listJlinkProbes() ([]string, error) {
+	f, err := ioutil.TempFile("", "newt-jlink")
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("ShowEmuList\nexit\n")
+	f.Close()
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	out, err := util.ShellCommand([]string{
+		"JLinkExe", "-nogui", "1", "-CommanderScript", f.Name(),
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var probes []string
+	for _, m := range jlinkSerialRe.FindAllStringSubmatch(string(out), -1) {
+		probes = append(probes, m[1])
+	}
+
+	return probes, nil
+}
+
+// loadProbe loads the target's images through one probe.
+func (t *TargetBuilder) loadProbe(extraJtagCmd string, probeId string) error {
+	if t.LoaderBuilder != nil {
+		err := t.AppBuilder.loadProbe(1, extraJtagCmd, probeId)
+		if err != nil {
+			return err
+		}
+		return t.LoaderBuilder.loadProbe(0, extraJtagCmd, probeId)
+	}
+
+	return t.AppBuilder.loadProbe(0, extraJtagCmd, probeId)
+}
+
+// LoadProbes loads the target's images onto several boards in parallel, each
+// identified by the serial number of its probe.
+//
+// @param extraJtagCmd          Extra commands for the BSP's download script.
+// @param probeIds              The serial numbers of the probes to use.
+//
+// @return error                Error listing the probes that failed.
+func (t *TargetBuilder) LoadProbes(extraJtagCmd string,
+	probeIds []string) error {
+
+	if len(probeIds) == 0 {
+		return util.NewNewtError("no probes attached")
+	}
+
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	if len(probeIds) == 1 {
+		return t.loadProbe(extraJtagCmd, probeIds[0])
+	}
+
+	errs := make([]error, len(probeIds))
+
+	var wg sync.WaitGroup
+	for i, id := range probeIds {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			errs[i] = t.loadProbe(extraJtagCmd, id)
+		}(i, id)
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures,
+				fmt.Sprintf("probe %s: %s", probeIds[i], err.Error()))
+		}
+	}
+
+	if len(failures) > 0 {
+		return util.FmtNewtError("failed to load %d of %d boards:\n%s",
+			len(failures), len(probeIds), strings.Join(failures, "\n"))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Loaded %d boards\n",
+		len(probeIds))
+	return nil
+}
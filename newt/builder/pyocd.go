@@ -0,0 +1,193 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/apache/mynewt-artifact/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// pyOCD backend.  Boards with CMSIS-DAP (e.g., DAPLink) probes are loaded and
+// debugged with pyOCD, given the pyOCD target type of the MCU.
+
+// pyocdArgs returns the arguments that select the target's MCU and probe.
+//
+// @param probeId               The serial number of the probe; "" for any.
+func (t *TargetBuilder) pyocdArgs(probeId string) ([]string, error) {
+	pt := t.target.PyocdTarget
+	if pt == "" {
+		pt = t.bspPkg.PyocdTarget
+	}
+	if pt == "" {
+		return nil, util.FmtNewtError(
+			"target %s uses pyOCD but neither the target nor its BSP "+
+				"specifies a pyOCD target type (pyocd_target)",
+			t.target.FullName())
+	}
+
+	args := []string{"-t", pt}
+	if probeId != "" {
+		args = append(args, "-u", probeId)
+	}
+
+	return args, nil
+}
+
+// pyocdProbe drives a CMSIS-DAP probe with pyOCD.
+type pyocdProbe struct {
+	b       *Builder
+	probeId string
+}
+
+// args returns the arguments that select the MCU and the probe.
+func (p *pyocdProbe) args() ([]string, error) {
+	return p.b.targetBuilder.pyocdArgs(p.probeId)
+}
+
+func (p *pyocdProbe) Program(binPath string, offset int) error {
+	args, err := p.args()
+	if err != nil {
+		return err
+	}
+
+	cmd := []string{"pyocd", "flash"}
+	cmd = append(cmd, args...)
+	cmd = append(cmd,
+		"--base-address", "0x"+strconv.FormatInt(int64(offset), 16),
+		util.TryRelPath(binPath))
+
+	if _, err := util.ShellCommand(cmd, nil); err != nil {
+		return err
+	}
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Successfully loaded image.\n")
+
+	return nil
+}
+
+func (p *pyocdProbe) Erase(areas []flash.FlashArea) error {
+	args, err := p.args()
+	if err != nil {
+		return err
+	}
+
+	cmd := []string{"pyocd", "erase"}
+	cmd = append(cmd, args...)
+	if len(areas) == 0 {
+		cmd = append(cmd, "--chip")
+	} else {
+		cmd = append(cmd, "--sector")
+		for _, area := range areas {
+			cmd = append(cmd,
+				fmt.Sprintf("0x%x+0x%x", area.Offset, area.Size))
+		}
+	}
+
+	_, err = util.ShellCommand(cmd, nil)
+	return err
+}
+
+func (p *pyocdProbe) ReadMem(area flash.FlashArea, dst string) error {
+	args, err := p.args()
+	if err != nil {
+		return err
+	}
+
+	cmd := []string{"pyocd", "cmd"}
+	cmd = append(cmd, args...)
+	cmd = append(cmd, "-c",
+		fmt.Sprintf("savemem 0x%x %d %s", area.Offset, area.Size, dst))
+
+	_, err = util.ShellCommand(cmd, nil)
+	return err
+}
+
+func (p *pyocdProbe) Reset() error {
+	args, err := p.args()
+	if err != nil {
+		return err
+	}
+
+	_, err = util.ShellCommand(append([]string{"pyocd", "reset"}, args...),
+		nil)
+	return err
+}
+
+func (p *pyocdProbe) StartGdbServer(reset bool, attach bool,
+	noGDB bool) error {
+
+	args, err := p.args()
+	if err != nil {
+		return err
+	}
+
+	server := []string{"pyocd", "gdbserver"}
+	server = append(server, args...)
+	server = append(server, "--port", strconv.Itoa(GDB_SERVER_PORT))
+	if attach {
+		server = append(server, "-O", "connect_mode=attach")
+	}
+	if p.b.targetBuilder.target.Semihosting {
+		// pyOCD prints semihosting output on its console.
+		server = append(server, "--semihosting")
+	}
+
+	gdbCmds := []string{fmt.Sprintf("target remote :%d", GDB_SERVER_PORT)}
+	if reset {
+		gdbCmds = append(gdbCmds, "monitor reset halt")
+	}
+
+	return p.b.runGdbServer(server, gdbCmds, noGDB)
+}
+
+// rttCmd returns the command that streams an RTT channel to stdout.
+func (p *pyocdProbe) rttCmd(channel int) ([]string, error) {
+	if channel != 0 {
+		return nil, util.NewNewtError("pyOCD only streams RTT channel 0")
+	}
+
+	args, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{"pyocd", "rtt"}, args...), nil
+}
+
+func (p *pyocdProbe) ConsoleStream(channel int) error {
+	cmd, err := p.rttCmd(channel)
+	if err != nil {
+		return err
+	}
+
+	return runRttCmd(cmd)
+}
+
+func (p *pyocdProbe) ConsoleReader(channel int) (io.ReadCloser, error) {
+	cmd, err := p.rttCmd(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return startCmdReader(cmd)
+}
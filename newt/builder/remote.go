@@ -0,0 +1,156 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"net"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Remote GDB servers.  A board attached to another machine (e.g., in a lab)
+// is debugged by connecting gdb to a GDB server running there, rather than
+// running a probe's server locally.  Images are transferred to the server by
+// gdb's `load` command, which requires the server to support flash writes
+// (OpenOCD, pyOCD, and J-Link's GDB servers do).
+
+// checkRemoteAddr verifies that a remote GDB server address has the form
+// host:port.
+func checkRemoteAddr(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return util.FmtNewtError(
+			"invalid remote GDB server address \"%s\"; must be host:port",
+			addr)
+	}
+
+	return nil
+}
+
+// remoteHexPath returns the path of the Intel HEX file that is transferred
+// to a remote GDB server.
+func (b *Builder) remoteHexPath() string {
+	return b.AppBinBasePath() + ".remote.hex"
+}
+
+// loadRemote writes the app to flash through a remote GDB server.
+//
+// @param imageSlot             The slot to load the image into.
+// @param addr                  The server's address (host:port).
+func (b *Builder) loadRemote(imageSlot int, addr string) error {
+	b.loadMessage(imageSlot, fmt.Sprintf(" (remote %s)", addr))
+
+	area, err := b.loadArea(imageSlot)
+	if err != nil {
+		return err
+	}
+
+	// gdb only loads files that carry their own addresses; place the image
+	// at its flash area's offset.
+	c, err := b.targetBuilder.NewCompiler("", "")
+	if err != nil {
+		return err
+	}
+	hexPath := b.remoteHexPath()
+	if err := c.ConvertBinToHex(b.loadFile(), hexPath,
+		area.Offset); err != nil {
+
+		return err
+	}
+
+	gdb, err := b.gdbPath()
+	if err != nil {
+		return err
+	}
+
+	cmd := []string{gdb, "-nx", "-batch"}
+	for _, c := range []string{
+		"target remote " + addr,
+		"monitor halt",
+		"load " + util.TryRelPath(hexPath),
+		"monitor reset",
+		"detach",
+	} {
+		cmd = append(cmd, "-ex", c)
+	}
+
+	if _, err := util.ShellCommand(cmd, nil); err != nil {
+		return err
+	}
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Successfully loaded image.\n")
+
+	return nil
+}
+
+// LoadRemote loads the target's images through a remote GDB server.
+//
+// @param addr                  The server's address (host:port).
+func (t *TargetBuilder) LoadRemote(addr string) error {
+	if err := checkRemoteAddr(addr); err != nil {
+		return err
+	}
+
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	if t.LoaderBuilder != nil {
+		if err := t.AppBuilder.loadRemote(1, addr); err != nil {
+			return err
+		}
+		return t.LoaderBuilder.loadRemote(0, addr)
+	}
+
+	return t.AppBuilder.loadRemote(0, addr)
+}
+
+// DebugRemote debugs the target's app with gdb connected to a remote GDB
+// server.
+//
+// @param addr                  The server's address (host:port).
+// @param reset                 Whether to reset the MCU once gdb connects.
+func (t *TargetBuilder) DebugRemote(addr string, reset bool) error {
+	if err := checkRemoteAddr(addr); err != nil {
+		return err
+	}
+
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	b := t.AppBuilder
+	if t.LoaderBuilder != nil {
+		b = t.LoaderBuilder
+	}
+	if b.appPkg == nil {
+		return util.NewNewtError("app package not specified")
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Connecting to remote GDB server %s\n", addr)
+
+	gdbCmds := []string{"target remote " + addr}
+	if reset {
+		// Servers differ in how they reset and halt in one command.
+		gdbCmds = append(gdbCmds, "monitor reset", "monitor halt")
+	}
+
+	return b.runGdb(gdbCmds)
+}
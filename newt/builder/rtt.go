@@ -0,0 +1,277 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"debug/elf"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// RTT (SEGGER Real Time Transfer) console.  The console is streamed by the
+// tool that matches the target's probe: JLinkRTTLogger for J-Link, `pyocd
+// rtt` for pyOCD, and OpenOCD's RTT server for targets with OpenOCD
+// configuration files (`bsp.openocd_cfg`, `target.openocd_cfg`).
+
+const (
+	RTT_CB_SYMBOL   = "_SEGGER_RTT"
+	RTT_SERVER_PORT = 19021
+
+	// How long to wait for an RTT server to accept connections.
+	RTT_CONNECT_TIMEOUT = 10 * time.Second
+)
+
+// rttControlBlock finds the address and size of the app's RTT control block.
+func (b *Builder) rttControlBlock() (uint64, uint64, error) {
+	elfPath := b.elfPath()
+	f, err := elf.Open(elfPath)
+	if err != nil {
+		return 0, 0, util.FmtNewtError(
+			"cannot read %s; build the target first: %s",
+			elfPath, err.Error())
+	}
+	defer f.Close()
+
+	syms, err := f.Symbols()
+	if err != nil {
+		return 0, 0, util.ChildNewtError(err)
+	}
+
+	for _, s := range syms {
+		if s.Name == RTT_CB_SYMBOL {
+			return s.Value, s.Size, nil
+		}
+	}
+
+	return 0, 0, util.FmtNewtError(
+		"%s does not contain an RTT control block (%s); is the RTT "+
+			"console enabled?", elfPath, RTT_CB_SYMBOL)
+}
+
+// rttBackend returns the name of the tool that streams the target's RTT
+// console.
+func (t *TargetBuilder) rttBackend() (string, error) {
+	debugger, err := t.Debugger()
+	if err != nil {
+		return "", err
+	}
+
+	switch debugger {
+	case DEBUGGER_JLINK, DEBUGGER_PYOCD, DEBUGGER_OPENOCD:
+		return debugger, nil
+	case "":
+		if len(t.bspPkg.OpenocdCfg) > 0 || len(t.target.OpenocdCfg) > 0 {
+			return "openocd", nil
+		}
+		return "", util.FmtNewtError(
+			"target %s does not select a debugger backend or OpenOCD "+
+				"configuration; cannot stream its RTT console",
+			t.target.FullName())
+	default:
+		return "", util.FmtNewtError(
+			"debugger \"%s\" does not support RTT", debugger)
+	}
+}
+
+// Rtt streams the target's RTT console to stdout until interrupted.  Input
+// from stdin is sent to the device's down channel where supported.
+//
+// @param channel               The RTT channel to stream.
+func (t *TargetBuilder) Rtt(channel int) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	backend, err := t.rttBackend()
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Streaming RTT channel %d of %s via %s; press Ctrl-C to quit\n",
+		channel, t.target.FullName(), backend)
+
+	p, err := t.AppBuilder.newProbe(backend, "")
+	if err != nil {
+		return err
+	}
+
+	return p.ConsoleStream(channel)
+}
+
+// startServer starts a debugger tool that serves data over TCP in the
+// background.  Its output is displayed if verbose output is enabled.
+//
+// @param serverCmd             The command that runs the server.
+//
+// @return func()               Stops the server.
+// @return error                Error if the server cannot be started.
+func startServer(serverCmd []string) (func(), error) {
+	serverCmd, err := lookPath(serverCmd)
+	if err != nil {
+		return nil, err
+	}
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Server command: %s\n",
+		strings.Join(serverCmd, " "))
+
+	server := exec.Command(serverCmd[0], serverCmd[1:]...)
+	if util.Verbosity >= util.VERBOSITY_VERBOSE {
+		server.Stdout = os.Stdout
+		server.Stderr = os.Stderr
+	}
+	if err := server.Start(); err != nil {
+		return nil, util.FmtNewtError("failed to start %s: %s",
+			serverCmd[0], err.Error())
+	}
+
+	return func() {
+		if err := server.Process.Kill(); err != nil {
+			log.Debugf("failed to stop %s: %s", serverCmd[0], err.Error())
+		}
+		server.Wait()
+	}, nil
+}
+
+// dialServer connects to a TCP server that a debugger tool runs.  The server
+// accepts connections once the probe is initialized.
+func dialServer(addr string) (net.Conn, error) {
+	deadline := time.Now().Add(RTT_CONNECT_TIMEOUT)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			return conn, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, util.FmtNewtError(
+				"failed to connect to server at %s: %s", addr, err.Error())
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// streamRtt connects to an RTT server and copies its output to stdout, and
+// stdin to the server, until the connection is closed.
+func streamRtt(addr string) error {
+	conn, err := dialServer(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go io.Copy(conn, os.Stdin)
+
+	if _, err := io.Copy(os.Stdout, conn); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// serverConn is a connection to a server that a debugger tool runs.  Closing
+// the connection stops the server.
+type serverConn struct {
+	net.Conn
+	stop func()
+}
+
+func (c *serverConn) Close() error {
+	err := c.Conn.Close()
+	c.stop()
+
+	return err
+}
+
+// openServerConn starts a debugger tool that serves data over TCP and
+// connects to it.
+//
+// @param serverCmd             The command that runs the server.
+// @param addr                  The address (host:port) the server listens on.
+func openServerConn(serverCmd []string, addr string) (io.ReadCloser, error) {
+	stop, err := startServer(serverCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialServer(addr)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+
+	return &serverConn{Conn: conn, stop: stop}, nil
+}
+
+// cmdReader reads the output of a tool that runs in the background.  Closing
+// the reader stops the tool.
+type cmdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *cmdReader) Close() error {
+	if err := r.cmd.Process.Kill(); err != nil {
+		log.Debugf("failed to stop %s: %s", r.cmd.Path, err.Error())
+	}
+	r.cmd.Wait()
+
+	return nil
+}
+
+// startCmdReader runs an RTT tool in the background and reads its stdout.
+func startCmdReader(cmd []string) (io.ReadCloser, error) {
+	cmd, err := lookPath(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "RTT command: %s\n",
+		strings.Join(cmd, " "))
+
+	c := exec.Command(cmd[0], cmd[1:]...)
+	out, err := c.StdoutPipe()
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	if err := c.Start(); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return &cmdReader{ReadCloser: out, cmd: c}, nil
+}
+
+// runRttCmd runs an RTT tool in the foreground.
+func runRttCmd(cmd []string) error {
+	cmd, err := lookPath(cmd)
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "RTT command: %s\n",
+		strings.Join(cmd, " "))
+	return util.ShellInteractiveCommand(cmd, nil)
+}
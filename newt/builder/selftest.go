@@ -20,20 +20,146 @@
 package builder
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/benchmark"
+	"mynewt.apache.org/newt/newt/coverage"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/resolve"
+	"mynewt.apache.org/newt/newt/testreport"
 	"mynewt.apache.org/newt/util"
 )
 
-func (b *Builder) SelfTestLink(rpkg *resolve.ResolvePackage) error {
+// The environment variable that passes a test filter to the test harness.
+const TEST_FILTER_ENV = "TESTUTIL_FILTER"
+
+// The environment variable that passes a random seed to the test harness
+// when a test is run repeatedly.
+const TEST_SEED_ENV = "TESTUTIL_SEED"
+
+// TestConfigSetting returns the name of the setting that newt defines when a
+// unit test package is built with the named test configuration.  A package
+// applies the configuration's overrides by conditioning on this setting, e.g.,
+// "syscfg.vals.TEST_CONFIG_SMALL_BUFS" or "pkg.deps.TEST_CONFIG_SMALL_BUFS".
+func TestConfigSetting(config string) string {
+	return "TEST_CONFIG_" + strings.ToUpper(util.CIdentifier(config))
+}
+
+// SetTestConfig builds the test package with one of its test configurations
+// (see LocalPackage.TestConfigs).  This must be called before the target is
+// resolved.
+func (t *TargetBuilder) SetTestConfig(config string) {
+	t.InjectSetting("TEST_CONFIG", "\""+config+"\"")
+	t.InjectSetting(TestConfigSetting(config), "1")
+}
+
+// How long simulated tests may run by default.  A test that runs longer is
+// assumed to be hung.
+const TEST_DFLT_SIM_TIMEOUT = 10 * time.Minute
+
+// TestOpts controls how a unit test executable is run.
+type TestOpts struct {
+	// A regular expression that selects the test suites and cases to run; ""
+	// runs all of them.  The harness matches it against each suite name and
+	// each "<suite>/<case>" name.
+	Filter string
+
+	// Collects the results of each test case; nil if no report is written.
+	Report *testreport.Report
+
+	// Simulated tests only: collects the coverage of the tests; nil if
+	// coverage is not measured.
+	Coverage *coverage.Data
+
+	// Simulated tests only: runs the benchmark cases, and collects their
+	// results; nil if benchmarks are not run.
+	Bench *benchmark.Data
+
+	// Simulated tests only: runs the tests under valgrind, failing them if
+	// they leak or access memory invalidly.
+	Valgrind bool
+
+	// Simulated tests only: how many times to re-run a package's failed test
+	// cases.  A case that passes on a retry is reported as flaky, and does not
+	// fail the package.
+	Retries int
+
+	// Simulated tests only: how many times to run each package's test
+	// executable; 0 or 1 runs it once.  Each run gets its own seed.  If
+	// UntilFailure is set, the runs stop at the first failure.
+	Repeat       int
+	UntilFailure bool
+
+	// Simulated tests only: runs the tests even if they passed the last time
+	// they were run, and nothing has changed since.  Tests are always run
+	// when coverage is measured or benchmarks are run.
+	Force bool
+
+	// On-target tests only: the serial port and baud rate of the console
+	// that results are read from ("" and 0 to detect them), or whether to
+	// read results from the RTT console instead.
+	Port string
+	Baud int
+	Rtt  bool
+
+	// How long each package's tests may run, unless the package specifies
+	// its own limit (`pkg.test_timeout`); 0 for TEST_DFLT_SIM_TIMEOUT or
+	// TEST_DFLT_HW_TIMEOUT.
+	Timeout time.Duration
+}
+
+// timeout returns how long a test package's tests may run.
+func (o TestOpts) timeout(lpkg *pkg.LocalPackage,
+	dflt time.Duration) time.Duration {
+
+	if secs := lpkg.TestTimeout(); secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if o.Timeout > 0 {
+		return o.Timeout
+	}
+	return dflt
+}
+
+// env returns the environment settings that pass the options to the test
+// harness.
+func (o TestOpts) env() []string {
+	var env []string
+	if o.Filter != "" {
+		env = append(env, TEST_FILTER_ENV+"="+o.Filter)
+	}
+	if o.Bench != nil {
+		env = append(env, benchmark.BENCH_ENV+"=1")
+	}
+
+	return env
+}
+
+// SelfTestLink links the test executable.
+//
+// @param rpkg                  The package under test.
+// @param linkerScripts         The linker scripts to use; nil for a
+//                                  simulated target.
+func (b *Builder) SelfTestLink(rpkg *resolve.ResolvePackage,
+	linkerScripts []string) error {
+
 	testPath := b.TestExePath()
-	if err := b.link(testPath, nil, nil); err != nil {
+	if err := b.link(testPath, linkerScripts, nil); err != nil {
 		return err
 	}
 
@@ -51,10 +177,26 @@ func (t *TargetBuilder) getTestRpkg() (*resolve.ResolvePackage, error) {
 }
 
 func (t *TargetBuilder) SelfTestCreateExe() error {
+	return t.selfTestCreateExe(nil, false)
+}
+
+// selfTestCreateExe builds and links the test executable.
+//
+// @param linkerScripts         The linker scripts to use; nil for a
+//                                  simulated target.
+// @param coverage              Whether to instrument the executable for
+//                                  gcov.
+func (t *TargetBuilder) selfTestCreateExe(linkerScripts []string,
+	coverage bool) error {
+
 	if err := t.PrepBuild(); err != nil {
 		return err
 	}
 
+	if coverage {
+		t.AppBuilder.AddCompilerInfo(coverageCompilerInfo())
+	}
+
 	testRpkg, err := t.getTestRpkg()
 	if err != nil {
 		return err
@@ -70,15 +212,20 @@ func (t *TargetBuilder) SelfTestCreateExe() error {
 		return err
 	}
 
-	if err := t.AppBuilder.SelfTestLink(testRpkg); err != nil {
+	if err := t.AppBuilder.SelfTestLink(testRpkg, linkerScripts); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (t *TargetBuilder) SelfTestExecute() error {
-	if err := t.SelfTestCreateExe(); err != nil {
+func (t *TargetBuilder) SelfTestExecute(opts TestOpts) error {
+	start := time.Now()
+	if err := t.selfTestCreateExe(nil, opts.Coverage != nil); err != nil {
+		if opts.Report != nil {
+			opts.Report.Add(testreport.ErrorSuite(t.testPkg.FullName(),
+				t.target.FullName(), start, "build", err))
+		}
 		return err
 	}
 
@@ -87,7 +234,7 @@ func (t *TargetBuilder) SelfTestExecute() error {
 		return err
 	}
 
-	if err := t.AppBuilder.SelfTestExecute(testRpkg); err != nil {
+	if err := t.AppBuilder.SelfTestExecute(testRpkg, opts); err != nil {
 		return err
 	}
 
@@ -112,11 +259,11 @@ func (t *TargetBuilder) SelfTestDebug() error {
 
 	return t.AppBuilder.debugBin(
 		strings.TrimSuffix(t.AppBuilder.TestExePath(), ".elf"),
-		"", false, false)
+		"", false, false, false)
 }
 
 func (b *Builder) testOwner(bpkg *BuildPackage) *BuildPackage {
-	if bpkg.rpkg.Lpkg.Type() != pkg.PACKAGE_TYPE_UNITTEST {
+	if !pkg.IsTestType(bpkg.rpkg.Lpkg.Type()) {
 		panic("Expected unittest package; got: " + bpkg.rpkg.Lpkg.Name())
 	}
 
@@ -131,7 +278,7 @@ func (b *Builder) testOwner(bpkg *BuildPackage) *BuildPackage {
 
 		parentPkg := b.pkgWithPath(parentPath)
 		if parentPkg != nil &&
-			parentPkg.rpkg.Lpkg.Type() != pkg.PACKAGE_TYPE_UNITTEST {
+			!pkg.IsTestType(parentPkg.rpkg.Lpkg.Type()) {
 
 			return parentPkg
 		}
@@ -140,21 +287,402 @@ func (b *Builder) testOwner(bpkg *BuildPackage) *BuildPackage {
 	}
 }
 
-func (b *Builder) SelfTestExecute(testRpkg *resolve.ResolvePackage) error {
+// gdbBacktrace attaches gdb to a running process and captures the stack of
+// each of its threads.
+func gdbBacktrace(gdb string, pid int) string {
+	cmdStrs := []string{
+		gdb, "-batch", "-nx", "-p", strconv.Itoa(pid),
+		"-ex", "thread apply all bt",
+	}
+	util.LogShellCmd(cmdStrs, nil)
+
+	out, err := exec.Command(cmdStrs[0], cmdStrs[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Sprintf("could not capture stack: %s\n%s",
+			err.Error(), out)
+	}
+
+	return string(out)
+}
+
+// runTestExe runs a test executable, recording each line of its output
+// along with the time it was written.  An executable that runs too long is
+// assumed to be hung; its stack is captured, and it is killed.
+//
+// @param cmdStrs               The command that runs the test executable.
+// @param env                   Additional key=value pairs to inject into the
+//                                  executable's environment.
+// @param timeout               How long the executable may run; 0 for no
+//                                  limit.
+// @param gdb                   The debugger that captures the stack of a
+//                                  hung executable; "" to not capture it.
+//
+// @return []testreport.Line    The executable's output.
+// @return bool                 Whether the executable was killed for
+//                                  running too long.
+// @return error                NewtError containing the output if the
+//                                  executable fails.
+func runTestExe(cmdStrs []string, env []string, timeout time.Duration,
+	gdb string) ([]testreport.Line, bool, error) {
+
+	util.LogShellCmd(cmdStrs, env)
+
+	cmd := exec.Command(cmdStrs[0], cmdStrs[1:]...)
+	if env != nil {
+		cmd.Env = append(env, os.Environ()...)
+	}
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return nil, false, util.ChildNewtError(err)
+	}
+
+	var timedOut int32
+	stackChan := make(chan string, 1)
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			stack := ""
+			if gdb != "" {
+				stack = gdbBacktrace(gdb, cmd.Process.Pid)
+			}
+			stackChan <- stack
+			atomic.StoreInt32(&timedOut, 1)
+			cmd.Process.Kill()
+		})
+		defer timer.Stop()
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		errChan <- err
+	}()
+
+	var lines []testreport.Line
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, testreport.Line{
+			Text: scanner.Text(),
+			Time: time.Now(),
+		})
+	}
+	// Don't block the executable if its output could not be parsed.
+	io.Copy(ioutil.Discard, pr)
+
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	out := strings.Join(texts, "\n")
+	log.Debugf("o=%s", out)
+
+	err := <-errChan
+	if atomic.LoadInt32(&timedOut) != 0 {
+		msg := fmt.Sprintf("Test timed out after %s and was killed", timeout)
+		if stack := <-stackChan; stack != "" {
+			msg += "; stack at timeout:\n" + stack
+		}
+		if out != "" {
+			msg = out + "\n" + msg
+		}
+		return lines, true, util.NewNewtError(msg)
+	}
+
+	if err != nil {
+		newtErr := util.ChildNewtError(err)
+		if out != "" {
+			newtErr.Text = out
+		}
+		return lines, false, newtErr
+	}
+
+	return lines, false, nil
+}
+
+// retryFilter produces a test filter that selects only the specified
+// "<suite>/<case>" names.
+func retryFilter(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+// writeRepeatLog saves the output of a failed iteration of a repeated test,
+// so that it can be examined after later iterations have run.
+//
+// @return string               The path of the log file.
+// @return error                Error.
+func writeRepeatLog(testPath string, iter int, seed uint32,
+	lines []testreport.Line) (string, error) {
+
+	path := fmt.Sprintf("%s/repeat-%d.log", filepath.Dir(testPath), iter)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# iteration %d, %s=%d\n", iter, TEST_SEED_ENV, seed)
+	for _, line := range lines {
+		sb.WriteString(line.Text + "\n")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return path, nil
+}
+
+// runTestRepeatedly runs a test executable the number of times that the
+// options specify.  The results of the first failing iteration are returned,
+// or those of the last iteration if none failed.
+//
+// @return time.Time            The time the returned iteration started.
+// @return []testreport.Line    The iteration's output.
+// @return bool                 Whether the iteration timed out.
+// @return string               A summary of the failed iterations; "" if
+//                                  the executable was only run once or
+//                                  never failed.
+// @return error                The iteration's error.
+func (b *Builder) runTestRepeatedly(cmdStrs []string, opts TestOpts,
+	timeout time.Duration, gdb string) (
+	time.Time, []testreport.Line, bool, string, error) {
+
+	if opts.Repeat <= 1 {
+		start := time.Now()
+		lines, timedOut, err := runTestExe(cmdStrs, opts.env(), timeout, gdb)
+		return start, lines, timedOut, "", err
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	var start time.Time
+	var lines []testreport.Line
+	var timedOut bool
+	var err error
+
+	var failed []string
+	iter := 1
+	for ; iter <= opts.Repeat; iter++ {
+		seed := rng.Uint32()
+		env := append(opts.env(), fmt.Sprintf("%s=%d", TEST_SEED_ENV, seed))
+
+		iterStart := time.Now()
+		iterLines, iterTimedOut, iterErr := runTestExe(cmdStrs, env, timeout,
+			gdb)
+		if iterErr == nil {
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"Iteration %d of %d passed\n", iter, opts.Repeat)
+			if len(failed) == 0 {
+				start, lines, timedOut = iterStart, iterLines, iterTimedOut
+			}
+			continue
+		}
+
+		desc := fmt.Sprintf("iteration %d (%s=%d)", iter, TEST_SEED_ENV, seed)
+		if path, werr := writeRepeatLog(b.TestExePath(), iter, seed,
+			iterLines); werr == nil {
+
+			desc += "; log: " + path
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Iteration %d of %d failed: %s\n", iter, opts.Repeat, desc)
+
+		if len(failed) == 0 {
+			start, lines, timedOut, err = iterStart, iterLines, iterTimedOut,
+				iterErr
+		}
+		failed = append(failed, desc)
+
+		if opts.UntilFailure {
+			break
+		}
+	}
+
+	if len(failed) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"All %d iterations passed\n", opts.Repeat)
+		return start, lines, timedOut, "", err
+	}
+
+	ran := iter - 1
+	if iter <= opts.Repeat {
+		ran = iter
+	}
+	msg := fmt.Sprintf("Failed %d of %d iterations:", len(failed), ran)
+	for _, f := range failed {
+		msg += "\n    " + f
+	}
+
+	return start, lines, timedOut, msg, err
+}
+
+func (b *Builder) SelfTestExecute(testRpkg *resolve.ResolvePackage,
+	opts TestOpts) error {
+
 	testPath := b.TestExePath()
 	if err := os.Chdir(filepath.Dir(testPath)); err != nil {
 		return err
 	}
 
+	pkgName := testRpkg.Lpkg.FullName()
+	tgtName := b.targetBuilder.target.FullName()
+
+	cacheKey, err := b.testCacheKey(opts)
+	if err != nil {
+		return err
+	}
+	if !opts.Force && opts.Coverage == nil && opts.Bench == nil &&
+		opts.Repeat <= 1 {
+
+		if entry := b.readTestCache(cacheKey); entry != nil {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Test passed (cached; unchanged since last run): %s\n",
+				testPath)
+			if opts.Report != nil {
+				opts.Report.Add(testreport.Parse(pkgName, tgtName,
+					entry.Start, entry.Lines)...)
+			}
+			return nil
+		}
+	}
+	b.clearTestCache()
+
 	util.StatusMessage(util.VERBOSITY_DEFAULT, "Executing test: %s\n",
 		testPath)
-	cmd := []string{testPath}
-	if _, err := util.ShellCommand(cmd, nil); err != nil {
+	if opts.Filter != "" {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Running tests matching: %s\n", opts.Filter)
+	}
+
+	if opts.Coverage != nil {
+		// Discard the counts of previous runs.
+		if err := b.clearCoverage(); err != nil {
+			return err
+		}
+	}
+
+	cmdStrs := []string{testPath}
+	if opts.Valgrind {
+		var err error
+		if cmdStrs, err = b.valgrindCmd(testPath); err != nil {
+			return err
+		}
+	}
+
+	timeout := opts.timeout(testRpkg.Lpkg, TEST_DFLT_SIM_TIMEOUT)
+	gdb, err := b.gdbPath()
+	if err != nil {
+		// The stack of a hung test just isn't captured.
+		gdb = ""
+	}
+
+	start, lines, timedOut, repeatMsg, err := b.runTestRepeatedly(cmdStrs,
+		opts, timeout, gdb)
+	memErr := err != nil && valgrindFailed(err)
+	suites := testreport.Parse(pkgName, tgtName, start, lines)
+
+	if opts.Bench != nil {
+		opts.Bench.Add(benchmark.Parse(pkgName, tgtName, lines)...)
+	}
+
+	firstErr := err
+	attempts := 0
+	for err != nil && attempts < opts.Retries {
+		attempts++
+
+		// Only re-run the cases that failed.  If the executable failed
+		// without reporting a failed case (e.g., it crashed), re-run all of
+		// it.
+		retryOpts := opts
+		if failed := testreport.FailedCases(suites); len(failed) > 0 {
+			retryOpts.Filter = retryFilter(failed)
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Test failed; retrying (%d of %d): %s\n",
+			attempts, opts.Retries, testPath)
+
+		retryStart := time.Now()
+		lines, timedOut, err = runTestExe(cmdStrs, retryOpts.env(), timeout,
+			gdb)
+		memErr = err != nil && valgrindFailed(err)
+		testreport.MarkRetried(suites,
+			testreport.Parse(pkgName, tgtName, retryStart, lines), attempts)
+	}
+
+	if attempts > 0 && err == nil {
+		if len(testreport.FlakyCases(suites)) == 0 {
+			// The failure wasn't attributed to a case; record it against the
+			// executable.
+			es := testreport.ErrorSuite(pkgName, tgtName, start, "run",
+				firstErr)
+			es.Cases[0].Flaky = es.Cases[0].Error
+			es.Cases[0].Error = ""
+			es.Cases[0].Retries = attempts
+			suites = append(suites, es)
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Test passed on retry %d (flaky): %s\n", attempts, testPath)
+	}
+
+	// A failing test still measures what it executed.
+	if opts.Coverage != nil {
+		if err := b.collectCoverage(opts.Coverage); err != nil {
+			return err
+		}
+	}
+
+	if opts.Report != nil {
+		opts.Report.Add(suites...)
+
+		// Record a failure that the harness did not report, e.g., a crash
+		// or a memory error.
+		if timedOut {
+			opts.Report.Add(testreport.ErrorSuite(pkgName, tgtName, start,
+				"timeout", err))
+		} else if memErr {
+			opts.Report.Add(testreport.ErrorSuite(pkgName, tgtName, start,
+				"valgrind", err))
+		} else if err != nil && !testreport.HasFailure(suites) {
+			opts.Report.Add(testreport.ErrorSuite(pkgName, tgtName, start,
+				"run", err))
+		}
+	}
+
+	if err != nil {
 		newtError := err.(*util.NewtError)
-		newtError.Text = fmt.Sprintf("Test failure (%s):\n%s",
-			testRpkg.Lpkg.Name(), newtError.Text)
+		if memErr {
+			newtError.Text = fmt.Sprintf(
+				"Test failure (%s): valgrind detected memory errors:\n%s",
+				testRpkg.Lpkg.Name(), newtError.Text)
+		} else {
+			newtError.Text = fmt.Sprintf("Test failure (%s):\n%s",
+				testRpkg.Lpkg.Name(), newtError.Text)
+		}
+		if repeatMsg != "" {
+			newtError.Text += "\n" + repeatMsg
+		}
 		return newtError
 	}
 
+	// A flaky test is run again next time, as is a repeated one.
+	if attempts > 0 || opts.Repeat > 1 {
+		return nil
+	}
+
+	if err := b.writeTestCache(testCacheEntry{
+		Key:   cacheKey,
+		Start: start,
+		Lines: lines,
+	}); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,95 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/newt/parse"
+	"mynewt.apache.org/newt/newt/smp"
+	"mynewt.apache.org/newt/util"
+)
+
+const SERIAL_DFLT_BAUD = 115200
+
+// LoadSerial uploads the target's app image to a device through the SMP
+// server on its serial port (the serial bootloader, or an app that includes
+// the image manager), and then resets the device.  No debug probe is needed.
+//
+// @param port                  The device's serial port.
+// @param baud                  The port's baud rate.
+func (t *TargetBuilder) LoadSerial(port string, baud int) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	if t.LoaderBuilder != nil {
+		return util.NewNewtError(
+			"split image targets cannot be loaded over a serial port")
+	}
+
+	b := t.AppBuilder
+	if parse.ValueIsTrue(b.cfg.SettingValues()["BOOT_LOADER"]) {
+		return util.FmtNewtError(
+			"%s is a bootloader; it cannot be loaded over a serial port",
+			t.target.FullName())
+	}
+
+	imgPath := b.AppImgPath()
+	data, err := ioutil.ReadFile(imgPath)
+	if err != nil {
+		return util.FmtNewtError(
+			"cannot read image \"%s\"; run `newt create-image` first: %s",
+			imgPath, err.Error())
+	}
+
+	c, err := smp.Open(port, baud)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Uploading %s (%d bytes) via %s\n",
+		util.TryRelPath(imgPath), len(data), port)
+
+	lastPct := -1
+	progress := func(off int) {
+		pct := off * 100 / len(data)
+		if pct/10 != lastPct/10 {
+			util.StatusMessage(util.VERBOSITY_VERBOSE, "%d%%\n", pct)
+		}
+		lastPct = pct
+	}
+
+	if err := c.UploadImage(data, progress); err != nil {
+		return err
+	}
+
+	// The image has been written even if the device does not acknowledge
+	// the reset.
+	if err := c.Reset(); err != nil {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"* Warning: failed to reset device: %s\n", err.Error())
+	}
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Successfully loaded image.\n")
+
+	return nil
+}
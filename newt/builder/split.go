@@ -0,0 +1,166 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/resolve"
+	"mynewt.apache.org/newt/newt/symbol"
+	"mynewt.apache.org/newt/util"
+)
+
+// Split images.  A target that specifies both a loader and an app produces two
+// images: the loader, which is self-contained, and the app, which links
+// against code in the loader.  The loader and app packages are resolved
+// together in a single pass so that both images share one syscfg
+// configuration and one set of API providers.  The checks below catch
+// inconsistencies before any compiling, and verify the shared symbols once the
+// loader is linked.
+
+// validateSplit checks a split image configuration after dependency
+// resolution.  It returns nil for non-split targets.
+func (t *TargetBuilder) validateSplit() error {
+	if t.res.LoaderSet == nil {
+		return nil
+	}
+
+	if t.appPkg == nil {
+		return util.FmtNewtError(
+			"target %s specifies a loader but no app; split images require "+
+				"both (target.loader and target.app)", t.target.FullName())
+	}
+
+	if t.appPkg.FullName() == t.loaderPkg.FullName() {
+		return util.FmtNewtError(
+			"target %s uses %s as both its loader and its app",
+			t.target.FullName(), t.appPkg.FullName())
+	}
+
+	if len(t.bspPkg.Part2LinkerScripts) == 0 {
+		return util.FmtNewtError(
+			"BSP %s does not support split images; it does not specify "+
+				"a second-partition linker script (bsp.part2linkerscript)",
+			t.bspPkg.FullName())
+	}
+
+	loaderPkgs := map[string]struct{}{}
+	for _, rpkg := range t.res.LoaderSet.Rpkgs {
+		loaderPkgs[rpkg.Lpkg.FullName()] = struct{}{}
+	}
+
+	// The app image cannot contain the loader package, and vice versa;
+	// each would then define a second main().
+	for _, rpkg := range t.res.AppSet.Rpkgs {
+		if rpkg.Lpkg.FullName() == t.loaderPkg.FullName() {
+			return util.FmtNewtError(
+				"split image app %s depends on its loader %s",
+				t.appPkg.FullName(), t.loaderPkg.FullName())
+		}
+	}
+	if _, ok := loaderPkgs[t.appPkg.FullName()]; ok {
+		return util.FmtNewtError(
+			"split image loader %s depends on its app %s",
+			t.loaderPkg.FullName(), t.appPkg.FullName())
+	}
+
+	shared := 0
+	for _, rpkg := range t.res.AppSet.Rpkgs {
+		if _, ok := loaderPkgs[rpkg.Lpkg.FullName()]; ok {
+			shared++
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Split image: %d loader packages, %d app packages, %d shared\n",
+		len(t.res.LoaderSet.Rpkgs), len(t.res.AppSet.Rpkgs), shared)
+	logSplitPkgs("Loader-only packages", t.res.LoaderSet.Rpkgs,
+		t.res.AppSet.Rpkgs)
+	logSplitPkgs("App-only packages", t.res.AppSet.Rpkgs,
+		t.res.LoaderSet.Rpkgs)
+
+	return nil
+}
+
+// logSplitPkgs logs the packages in one image that are absent from the other.
+func logSplitPkgs(title string, rpkgs []*resolve.ResolvePackage,
+	other []*resolve.ResolvePackage) {
+
+	otherNames := map[string]struct{}{}
+	for _, rpkg := range other {
+		otherNames[rpkg.Lpkg.FullName()] = struct{}{}
+	}
+
+	names := []string{}
+	for _, rpkg := range rpkgs {
+		if _, ok := otherNames[rpkg.Lpkg.FullName()]; !ok {
+			names = append(names, rpkg.Lpkg.FullName())
+		}
+	}
+	sort.Strings(names)
+
+	log.Debugf("%s:", title)
+	for _, name := range names {
+		log.Debugf("    * %s", name)
+	}
+}
+
+// verifyLoaderSymbols ensures that the final loader ELF file defines every
+// symbol that the app expects to find in the loader.
+//
+// @param required              The app's symbols that belong to packages
+//                                  shared with the loader.
+//
+// @return error                Error if any symbol is missing from the
+//                                  loader.
+func (t *TargetBuilder) verifyLoaderSymbols(required *symbol.SymbolMap) error {
+	err, loaderElfSym := t.LoaderBuilder.ParseObjectElf(
+		t.LoaderBuilder.AppElfPath())
+	if err != nil {
+		return err
+	}
+
+	missing := []string{}
+	for name, sym := range *required {
+		lsym, ok := (*loaderElfSym)[name]
+		if !ok || lsym.Section == "*UND*" {
+			missing = append(missing, fmt.Sprintf("%s (%s)", name, sym.Bpkg))
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return util.FmtNewtError(
+			"split image loader %s does not define %d symbols that app %s "+
+				"expects from shared packages:\n    %s",
+			t.loaderPkg.FullName(), len(missing), t.appPkg.FullName(),
+			strings.Join(missing, "\n    "))
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Verified %d symbols shared between loader and app\n",
+		len(*required))
+
+	return nil
+}
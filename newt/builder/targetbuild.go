@@ -26,6 +26,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 
@@ -33,6 +34,8 @@ import (
 	"github.com/apache/mynewt-artifact/sec"
 	"mynewt.apache.org/newt/newt/flashmap"
 	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/parse"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/resolve"
@@ -59,8 +62,12 @@ type TargetBuilder struct {
 
 	keyFile          string
 	injectedSettings map[string]string
+	overrideSettings map[string]string
 
 	res *resolve.Resolution
+
+	// Guards the builders while several probes are loaded in parallel.
+	loadMtx sync.Mutex
 }
 
 func NewTargetTester(target *target.Target,
@@ -70,6 +77,15 @@ func NewTargetTester(target *target.Target,
 		return nil, err
 	}
 
+	// Merge settings inherited from base targets into the target package.
+	if err := target.ApplyInheritance(); err != nil {
+		return nil, err
+	}
+
+	if err := target.ApplyVars(); err != nil {
+		return nil, err
+	}
+
 	bspPkg, err := pkg.NewBspPackage(target.Bsp())
 	if err != nil {
 		return nil, err
@@ -90,6 +106,7 @@ func NewTargetTester(target *target.Target,
 		keyFile:          target.KeyFile,
 		testPkg:          testPkg,
 		injectedSettings: map[string]string{},
+		overrideSettings: map[string]string{},
 	}
 
 	return t, nil
@@ -103,6 +120,21 @@ func (t *TargetBuilder) BspPkg() *pkg.BspPackage {
 	return t.bspPkg
 }
 
+func (t *TargetBuilder) CompilerPkg() *pkg.LocalPackage {
+	return t.compilerPkg
+}
+
+// CompilerVersion identifies the C compiler that the target is built with on
+// this OS.  See toolchain.CompilerVersion for details.
+func (t *TargetBuilder) CompilerVersion() (string, string, error) {
+	buildProfile := t.target.BuildProfile
+	if bp := project.GetProject().BuildProfile(buildProfile); bp != nil {
+		buildProfile = bp.Base
+	}
+
+	return toolchain.CompilerVersion(t.compilerPkg.BasePath(), buildProfile)
+}
+
 func (t *TargetBuilder) NewCompiler(dstDir string, buildProfile string) (
 	*toolchain.Compiler, error) {
 
@@ -110,10 +142,30 @@ func (t *TargetBuilder) NewCompiler(dstDir string, buildProfile string) (
 		buildProfile = t.target.BuildProfile
 	}
 
+	// A custom build profile extends one of the compiler's profiles.
+	bp := project.GetProject().BuildProfile(buildProfile)
+	if bp != nil {
+		buildProfile = bp.Base
+	}
+
 	c, err := toolchain.NewCompiler(
 		t.compilerPkg.BasePath(), dstDir, buildProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	if bp != nil {
+		// The profile's flags replace any conflicting flags of the base
+		// profile, e.g., a different optimization level.
+		ci := toolchain.NewCompilerInfo()
+		ci.Cflags = append(ci.Cflags, bp.Cflags...)
+		ci.CXXflags = append(ci.CXXflags, bp.CXXflags...)
+		ci.Lflags = append(ci.Lflags, bp.Lflags...)
+		ci.Aflags = append(ci.Aflags, bp.Aflags...)
+		c.OverrideLocalInfo(ci)
+	}
 
-	return c, err
+	return c, nil
 }
 
 func (t *TargetBuilder) injectNewtSettings() {
@@ -193,15 +245,22 @@ func (t *TargetBuilder) ensureResolved() error {
 		//     * TEST:      lets packages know that this is a test app
 		//     * SELFTEST:  indicates that the "newt test" command is used;
 		//                  causes a package to define a main() function.
+		//     * FUZZ:      replaces SELFTEST when a fuzz target is built;
+		//                  the fuzzing engine provides main().
 		t.InjectSetting("TEST", "1")
-		t.InjectSetting("SELFTEST", "1")
+		if t.testPkg.Type() == pkg.PACKAGE_TYPE_FUZZ {
+			t.InjectSetting("FUZZ", "1")
+		} else {
+			t.InjectSetting("SELFTEST", "1")
+		}
 
 		appSeeds = append(appSeeds, t.testPkg)
 	}
 
 	var err error
 	t.res, err = resolve.ResolveFull(
-		loaderSeeds, appSeeds, t.injectedSettings, t.bspPkg.FlashMap)
+		loaderSeeds, appSeeds, t.injectedSettings, t.overrideSettings,
+		t.bspPkg.FlashMap)
 	if err != nil {
 		return err
 	}
@@ -242,6 +301,12 @@ func (t *TargetBuilder) validateAndWriteCfg() error {
 		return err
 	}
 
+	if err := syscfg.EnsureReportWritten(t.res.Cfg,
+		GeneratedBaseDir(t.target.Name())); err != nil {
+
+		return err
+	}
+
 	if err := t.res.LCfg.EnsureWritten(incDir); err != nil {
 		return err
 	}
@@ -311,6 +376,10 @@ func (t *TargetBuilder) PrepBuild() error {
 		return err
 	}
 
+	if err := t.validateSplit(); err != nil {
+		return err
+	}
+
 	var err error
 	if t.res.LoaderSet != nil {
 		t.LoaderBuilder, err = NewBuilder(t, BUILD_NAME_LOADER,
@@ -402,7 +471,7 @@ func (t *TargetBuilder) buildLoader() error {
 ///
 /// The input filename should be supplied by the user in the target.yml file,
 /// using the `target.key_file` option. This file can be either a private key
-/// in PEM format, an extracted public key in PEM format or a DER file.
+/// in PEM or DER format, an extracted public key in PEM format or a DER file.
 ///
 /// To extract a PEM public key from the private key:
 ///   `openssl ec -in ec_pk.pem -pubout -out pubkey.pub`
@@ -413,18 +482,17 @@ func (t *TargetBuilder) autogenKeys() error {
 		return util.NewNewtError(fmt.Sprintf("Error reading key file: %s", err))
 	}
 
-	var pubKey sec.PubSignKey
-	privKey, err := sec.ParsePrivSignKey(keyBytes)
+	var pubBytes []byte
+	privKey, err := newtutil.ParseSignKey(keyBytes)
 	if err != nil {
-		pubKey, err = sec.ParsePubSignKey(keyBytes)
+		pubKey, err := sec.ParsePubSignKey(keyBytes)
 		if err != nil {
 			return err
 		}
+		pubBytes, err = pubKey.Bytes()
 	} else {
-		pubKey = privKey.PubKey()
+		pubBytes, err = privKey.PubBytes()
 	}
-
-	pubBytes, err := pubKey.Bytes()
 	if err != nil {
 		return err
 	}
@@ -460,6 +528,10 @@ func (t *TargetBuilder) autogenKeys() error {
 }
 
 func (t *TargetBuilder) Build() error {
+	if err := t.checkOutputFormats(); err != nil {
+		return err
+	}
+
 	if err := t.PrepBuild(); err != nil {
 		return err
 	}
@@ -478,6 +550,10 @@ func (t *TargetBuilder) Build() error {
 		}
 	}
 
+	if err := t.RunHooks(HOOK_PRE_BUILD, nil); err != nil {
+		return err
+	}
+
 	if err := t.AppBuilder.Build(); err != nil {
 		return err
 	}
@@ -497,6 +573,19 @@ func (t *TargetBuilder) Build() error {
 		return err
 	}
 
+	// A bootloader is flashed as is rather than as an image.
+	if parse.ValueIsTrue(t.AppBuilder.cfg.SettingValues()["BOOT_LOADER"]) {
+		err := t.EmitOutputs(t.AppBuilder.AppBinPath(),
+			flash.FLASH_AREA_NAME_BOOTLOADER)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := t.RunHooks(HOOK_POST_BUILD, nil); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -599,12 +688,17 @@ func (t *TargetBuilder) RelinkLoader() (error, map[string]bool,
 	/* for each symbol in the elf of the app, if that symbol is in
 	 * a common package, keep that symbol in the loader */
 	preserveElf := symbol.NewSymbolMap()
+	requiredSyms := symbol.NewSymbolMap()
 
 	/* go through each symbol in the app */
 	for _, elfsym := range *appElfSym {
 		name := elfsym.Name
 		if libsym, ok := (*appLibSym)[name]; ok {
 			if _, ok := commonPkgs[libsym.Bpkg]; ok {
+				if !libsym.IsLocal() {
+					requiredSyms.Add(libsym)
+				}
+
 				/* if its not in the loader elf, add it as undefined */
 				if _, ok := (*loaderElfSym)[name]; !ok {
 					preserveElf.Add(elfsym)
@@ -624,6 +718,12 @@ func (t *TargetBuilder) RelinkLoader() (error, map[string]bool,
 	if err != nil {
 		return err, nil, nil
 	}
+
+	/* make sure the app will find everything it expects in the loader */
+	if err := t.verifyLoaderSymbols(requiredSyms); err != nil {
+		return err, nil, nil
+	}
+
 	return err, commonPkgs, smMatch
 }
 
@@ -639,9 +739,21 @@ func (t *TargetBuilder) InjectSetting(key string, value string) {
 	t.injectedSettings[key] = value
 }
 
-// Calculates the size of a single boot trailer.  This is the amount of flash
-// that must be reserved at the end of each image slot.
-func (t *TargetBuilder) bootTrailerSize() int {
+// Overrides the value of a syscfg setting for this build only.  An override
+// takes precedence over the values specified by every package, including the
+// target.
+func (t *TargetBuilder) OverrideSetting(key string, value string) {
+	t.overrideSettings[key] = value
+}
+
+func (t *TargetBuilder) OverrideSettings() map[string]string {
+	return t.overrideSettings
+}
+
+// Retrieves the target's flash minimum write size (the
+// MCU_FLASH_MIN_WRITE_SIZE setting).  The boot trailer fields are aligned to
+// this size.
+func (t *TargetBuilder) MinWriteSize() int {
 	var minWriteSz int
 
 	entry, ok := t.res.Cfg.Settings["MCU_FLASH_MIN_WRITE_SIZE"]
@@ -663,6 +775,14 @@ func (t *TargetBuilder) bootTrailerSize() int {
 		}
 	}
 
+	return minWriteSz
+}
+
+// Calculates the size of a single boot trailer.  This is the amount of flash
+// that must be reserved at the end of each image slot.
+func (t *TargetBuilder) BootTrailerSize() int {
+	minWriteSz := t.MinWriteSize()
+
 	/* Mynewt boot trailer format:
 	 *
 	 *  0                   1                   2                   3
@@ -690,12 +810,21 @@ func (t *TargetBuilder) bootTrailerSize() int {
 	return tsize
 }
 
+// Retrieves the size of each image slot.
+func (t *TargetBuilder) SlotSizes() []int {
+	return []int{
+		t.bspPkg.FlashMap.Areas[flash.FLASH_AREA_NAME_IMAGE_0].Size,
+		t.bspPkg.FlashMap.Areas[flash.FLASH_AREA_NAME_IMAGE_1].Size,
+	}
+}
+
 // Calculates the size of the largest image that can be written to each image
 // slot.
 func (t *TargetBuilder) MaxImgSizes() []int {
-	sz0 := t.bspPkg.FlashMap.Areas[flash.FLASH_AREA_NAME_IMAGE_0].Size
-	sz1 := t.bspPkg.FlashMap.Areas[flash.FLASH_AREA_NAME_IMAGE_1].Size
-	trailerSz := t.bootTrailerSize()
+	slotSizes := t.SlotSizes()
+	sz0 := slotSizes[0]
+	sz1 := slotSizes[1]
+	trailerSz := t.BootTrailerSize()
 
 	return []int{
 		sz0 - trailerSz,
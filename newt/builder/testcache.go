@@ -0,0 +1,119 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/testreport"
+	"mynewt.apache.org/newt/util"
+)
+
+// Records the last passing run of a test executable, in the executable's
+// directory.  A test is not run again until its executable or the options
+// it is run with change.  The executable captures the test's sources, its
+// dependencies, and its configuration.
+const TEST_CACHE_FILENAME = "test-cache.json"
+
+type testCacheEntry struct {
+	// Identifies the executable and the options it was run with.
+	Key string
+
+	// When the run started, and the executable's output.  The output is kept
+	// so that test reports can include cached results.
+	Start time.Time
+	Lines []testreport.Line
+}
+
+func (b *Builder) testCachePath() string {
+	return filepath.Join(filepath.Dir(b.TestExePath()), TEST_CACHE_FILENAME)
+}
+
+// testCacheKey calculates the key of a run of the test executable with the
+// specified options.
+func (b *Builder) testCacheKey(opts TestOpts) (string, error) {
+	f, err := os.Open(b.TestExePath())
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	for _, e := range opts.env() {
+		fmt.Fprintf(h, "\x00env=%s", e)
+	}
+	fmt.Fprintf(h, "\x00valgrind=%s", strconv.FormatBool(opts.Valgrind))
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// readTestCache retrieves the last passing run of the test executable.  It
+// returns nil if the test has not passed with the specified key.
+func (b *Builder) readTestCache(key string) *testCacheEntry {
+	data, err := ioutil.ReadFile(b.testCachePath())
+	if err != nil {
+		return nil
+	}
+
+	entry := &testCacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		log.Debugf("ignoring invalid test cache %s: %s",
+			b.testCachePath(), err.Error())
+		return nil
+	}
+	if entry.Key != key {
+		return nil
+	}
+
+	return entry
+}
+
+// writeTestCache records a passing run of the test executable.
+func (b *Builder) writeTestCache(entry testCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := ioutil.WriteFile(b.testCachePath(), data, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// clearTestCache forgets the last passing run of the test executable.
+func (b *Builder) clearTestCache() {
+	os.Remove(b.testCachePath())
+}
@@ -0,0 +1,196 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/coverage"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+// coverageCompilerInfo returns the flags that instrument a build for gcov.
+func coverageCompilerInfo() *toolchain.CompilerInfo {
+	ci := toolchain.NewCompilerInfo()
+	ci.Cflags = append(ci.Cflags, "--coverage")
+	ci.Lflags = append(ci.Lflags, "--coverage")
+
+	return ci
+}
+
+// coveredPkgs returns the packages whose coverage is measured: all but the
+// unit test packages themselves and generated code.
+func (b *Builder) coveredPkgs() []*BuildPackage {
+	var bpkgs []*BuildPackage
+	for _, bpkg := range b.sortedBuildPackages() {
+		switch bpkg.rpkg.Lpkg.Type() {
+		case pkg.PACKAGE_TYPE_UNITTEST, pkg.PACKAGE_TYPE_FUZZ,
+			pkg.PACKAGE_TYPE_GENERATED:
+		default:
+			bpkgs = append(bpkgs, bpkg)
+		}
+	}
+
+	return bpkgs
+}
+
+// gcdaFiles returns the gcov data files in a directory tree.
+func gcdaFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".gcda") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return paths, nil
+}
+
+// clearCoverage deletes the gcov data that previous runs of the test
+// executable wrote.
+func (b *Builder) clearCoverage() error {
+	for _, bpkg := range b.sortedBuildPackages() {
+		paths, err := gcdaFiles(b.PkgBinDir(bpkg))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil {
+				return util.ChildNewtError(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Builder) gcovPath() (string, error) {
+	c, err := b.targetBuilder.NewCompiler("", "")
+	if err != nil {
+		return "", err
+	}
+
+	return c.GetGcovPath(), nil
+}
+
+// runGcov runs gcov on a data file in a scratch directory, and parses the
+// coverage of each source file that it reports.
+func runGcov(gcov string, gcda string, dir string) ([]*coverage.File, error) {
+	cmd := []string{gcov, "-b", "-c", "-p", "-o", filepath.Dir(gcda), gcda}
+	util.LogShellCmd(cmd, nil)
+
+	c := exec.Command(cmd[0], cmd[1:]...)
+	c.Dir = dir
+	if out, err := c.CombinedOutput(); err != nil {
+		return nil, util.FmtNewtError("%s failed: %s\n%s",
+			gcov, err.Error(), string(out))
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.gcov"))
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	var files []*coverage.File
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+		cf, err := coverage.ParseGcov(f)
+		f.Close()
+		os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, cf)
+	}
+
+	return files, nil
+}
+
+// collectCoverage runs gcov on the data that the test executable wrote, and
+// adds the coverage of each package's source files.  Sources outside a
+// package's directory (e.g., headers of other packages) are not counted.
+func (b *Builder) collectCoverage(cov *coverage.Data) error {
+	gcov, err := b.gcovPath()
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "newt-gcov")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	projPath := project.GetProject().Path()
+	for _, bpkg := range b.coveredPkgs() {
+		lpkg := bpkg.rpkg.Lpkg
+		pkgDir := filepath.Clean(lpkg.BasePath()) + string(filepath.Separator)
+
+		gcdas, err := gcdaFiles(b.PkgBinDir(bpkg))
+		if err != nil {
+			return err
+		}
+
+		for _, gcda := range gcdas {
+			files, err := runGcov(gcov, gcda, tmpDir)
+			if err != nil {
+				return err
+			}
+
+			for _, f := range files {
+				if !filepath.IsAbs(f.Path) {
+					f.Path = filepath.Join(projPath, f.Path)
+				}
+				f.Path = filepath.Clean(f.Path)
+				if !strings.HasPrefix(f.Path, pkgDir) {
+					continue
+				}
+
+				f.Package = lpkg.FullName()
+				cov.Add(f)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"mynewt.apache.org/newt/newt/itm"
+	"mynewt.apache.org/newt/util"
+)
+
+// SWO trace.  The MCU's ITM stimulus ports are captured from its SWO pin
+// through the target's probe, and decoded.  The SWO pin's frequency is
+// derived from the MCU's trace clock, which the BSP specifies
+// (`bsp.swo_cpu_freq`), along with a default SWO frequency
+// (`bsp.swo_freq`).
+
+const (
+	SWO_DFLT_FREQ = 2000000
+
+	// The TCP port that trace servers send the raw SWO stream to.
+	SWO_SERVER_PORT = 3443
+)
+
+type swoCfg struct {
+	CpuFreq int
+	SwoFreq int
+}
+
+// swoSettings returns the target's SWO clock settings.
+//
+// @param swoFreq               The SWO frequency (Hz); 0 for the BSP's.
+func (t *TargetBuilder) swoSettings(swoFreq int) (swoCfg, error) {
+	s := swoCfg{
+		CpuFreq: t.bspPkg.SwoCpuFreq,
+		SwoFreq: swoFreq,
+	}
+	if s.SwoFreq == 0 {
+		s.SwoFreq = t.bspPkg.SwoFreq
+	}
+	if s.SwoFreq == 0 {
+		s.SwoFreq = SWO_DFLT_FREQ
+	}
+
+	if s.CpuFreq == 0 {
+		return s, util.FmtNewtError(
+			"BSP %s does not specify its trace clock frequency "+
+				"(bsp.swo_cpu_freq)", t.bspPkg.FullName())
+	}
+
+	// The SWO frequency is the trace clock divided by an integer prescaler.
+	if s.SwoFreq > s.CpuFreq || s.CpuFreq%s.SwoFreq != 0 {
+		return s, util.FmtNewtError(
+			"SWO frequency %d Hz is not an integer fraction of the trace "+
+				"clock (%d Hz)", s.SwoFreq, s.CpuFreq)
+	}
+
+	return s, nil
+}
+
+// traceBackend returns the name of the tool that captures the target's SWO
+// trace.
+func (t *TargetBuilder) traceBackend() (string, error) {
+	debugger, err := t.Debugger()
+	if err != nil {
+		return "", err
+	}
+
+	switch debugger {
+	case DEBUGGER_JLINK, DEBUGGER_PYOCD, DEBUGGER_OPENOCD:
+		return debugger, nil
+	case "":
+		if len(t.bspPkg.OpenocdCfg) > 0 || len(t.target.OpenocdCfg) > 0 {
+			return DEBUGGER_OPENOCD, nil
+		}
+		return "", util.FmtNewtError(
+			"target %s does not select a debugger backend or OpenOCD "+
+				"configuration; cannot capture its SWO trace",
+			t.target.FullName())
+	default:
+		return "", util.FmtNewtError(
+			"debugger \"%s\" does not support SWO trace", debugger)
+	}
+}
+
+// itmMask returns the bitmask of the specified ITM stimulus ports.
+func itmMask(ports []int) (uint32, error) {
+	var mask uint32
+	for _, p := range ports {
+		if p < 0 || p > 31 {
+			return 0, util.FmtNewtError(
+				"invalid ITM stimulus port %d; must be 0-31", p)
+		}
+		mask |= 1 << uint(p)
+	}
+
+	return mask, nil
+}
+
+// Trace captures the MCU's ITM stimulus ports over SWO until interrupted.
+//
+// @param ports                 The stimulus ports to capture.
+// @param swoFreq               The SWO frequency (Hz); 0 for the BSP's.
+// @param outPath               The file to write the decoded data to; "" for
+//                                  stdout.
+func (t *TargetBuilder) Trace(ports []int, swoFreq int, outPath string) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	if err := t.bspPkg.Reload(t.AppBuilder.cfg.SettingValues()); err != nil {
+		return err
+	}
+
+	s, err := t.swoSettings(swoFreq)
+	if err != nil {
+		return err
+	}
+
+	mask, err := itmMask(ports)
+	if err != nil {
+		return err
+	}
+
+	backend, err := t.traceBackend()
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Capturing ITM ports %v of %s via %s (SWO %d Hz); press Ctrl-C to "+
+			"quit\n", ports, t.target.FullName(), backend, s.SwoFreq)
+
+	b := t.AppBuilder
+	if backend == DEBUGGER_JLINK {
+		return b.jlinkTrace(s, mask, outPath)
+	}
+
+	out := os.Stdout
+	if outPath != "" {
+		out, err = os.Create(outPath)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+		defer out.Close()
+	}
+
+	if backend == DEBUGGER_PYOCD {
+		return b.pyocdTrace(s, mask, out)
+	}
+	return b.openocdTrace(s, mask, out)
+}
+
+// decodeTrace connects to a trace server and writes the payload of the
+// selected stimulus ports to the specified writer.
+func decodeTrace(addr string, mask uint32, out io.Writer) error {
+	conn, err := dialServer(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var werr error
+	err = itm.Decode(conn, func(port int, data []byte) {
+		if mask&(1<<uint(port)) != 0 && werr == nil {
+			_, werr = out.Write(data)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if werr != nil {
+		return util.ChildNewtError(werr)
+	}
+
+	return nil
+}
+
+func (b *Builder) jlinkTrace(s swoCfg, mask uint32, outPath string) error {
+	js, err := b.targetBuilder.jlinkSettings()
+	if err != nil {
+		return err
+	}
+
+	// JLinkSWOViewerCL decodes the stimulus ports itself.
+	cmd := []string{
+		"JLinkSWOViewerCL",
+		"-device", js.Device,
+		"-cpufreq", strconv.Itoa(s.CpuFreq),
+		"-swofreq", strconv.Itoa(s.SwoFreq),
+		"-itmmask", fmt.Sprintf("0x%x", mask),
+	}
+	if js.Serial != "" {
+		cmd = append(cmd, "-USB", js.Serial)
+	}
+	if outPath != "" {
+		cmd = append(cmd, "-outputfile", outPath)
+	}
+
+	return runRttCmd(cmd)
+}
+
+func (b *Builder) pyocdTrace(s swoCfg, mask uint32, out io.Writer) error {
+	args, err := b.targetBuilder.pyocdArgs(b.targetBuilder.target.ProbeId)
+	if err != nil {
+		return err
+	}
+
+	server := []string{"pyocd", "gdbserver"}
+	server = append(server, args...)
+	server = append(server,
+		"-O", "enable_swv=true",
+		"-O", fmt.Sprintf("swv_system_clock=%d", s.CpuFreq),
+		"-O", fmt.Sprintf("swv_clock=%d", s.SwoFreq),
+		"-O", "swv_raw_enable=true",
+		"-O", fmt.Sprintf("swv_raw_port=%d", SWO_SERVER_PORT))
+
+	stop, err := startServer(server)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	return decodeTrace(fmt.Sprintf("localhost:%d", SWO_SERVER_PORT), mask,
+		out)
+}
+
+func (b *Builder) openocdTrace(s swoCfg, mask uint32, out io.Writer) error {
+	args, err := b.targetBuilder.openocdArgs(b.targetBuilder.target.ProbeId)
+	if err != nil {
+		return err
+	}
+
+	// The target's configuration must create a TPIU (OpenOCD 0.12 or
+	// later); the first one is used.  The formatter is bypassed so that the
+	// stream contains only ITM packets.
+	server := append([]string{"openocd"}, args...)
+	server = append(server,
+		"-c", "init",
+		"-c", fmt.Sprintf("[lindex [tpiu names] 0] configure "+
+			"-protocol uart -output :%d -traceclk %d -pin-freq %d "+
+			"-formatter 0", SWO_SERVER_PORT, s.CpuFreq, s.SwoFreq),
+		"-c", "[lindex [tpiu names] 0] enable")
+	for p := 0; p < 32; p++ {
+		if mask&(1<<uint(p)) != 0 {
+			server = append(server, "-c", fmt.Sprintf("itm port %d on", p))
+		}
+	}
+
+	stop, err := startServer(server)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	return decodeTrace(fmt.Sprintf("localhost:%d", SWO_SERVER_PORT), mask,
+		out)
+}
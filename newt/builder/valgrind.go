@@ -0,0 +1,140 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+// The exit status that valgrind uses to report memory errors.  It
+// distinguishes them from the test's own failures.
+const VALGRIND_ERROR_EXITCODE = 97
+
+// A project, or a unit test package, can provide its own suppressions in a
+// file with this name at the top of its directory.
+const VALGRIND_SUPP_FILENAME = "valgrind.supp"
+
+// Suppressions for errors that the code under test is not responsible for:
+// allocations that the C library and dynamic loader never free.
+const valgrindDfltSupp = `{
+   newt-dl-init
+   Memcheck:Leak
+   ...
+   fun:_dl_init
+}
+{
+   newt-dl-allocate-tls
+   Memcheck:Leak
+   ...
+   fun:_dl_allocate_tls
+}
+{
+   newt-libc-freeres
+   Memcheck:Leak
+   ...
+   fun:__libc_freeres
+}
+{
+   newt-stdio-buffer
+   Memcheck:Leak
+   fun:malloc
+   fun:_IO_file_doallocate
+   ...
+}
+`
+
+// valgrindSuppPaths returns the suppression files to apply to a test: newt's
+// defaults, followed by the project's and the test package's, if they exist.
+func (b *Builder) valgrindSuppPaths() ([]string, error) {
+	dfltPath := filepath.Join(filepath.Dir(b.TestExePath()),
+		"newt-"+VALGRIND_SUPP_FILENAME)
+	if err := ioutil.WriteFile(dfltPath, []byte(valgrindDfltSupp),
+		0644); err != nil {
+
+		return nil, util.ChildNewtError(err)
+	}
+
+	paths := []string{dfltPath}
+	for _, dir := range []string{
+		project.GetProject().BasePath,
+		b.testPkg.rpkg.Lpkg.BasePath(),
+	} {
+		path := filepath.Join(dir, VALGRIND_SUPP_FILENAME)
+		if util.NodeExist(path) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
+
+// valgrindCmd returns the command that runs a test executable under
+// valgrind's memcheck tool.  The command fails with VALGRIND_ERROR_EXITCODE
+// if the test accesses memory invalidly or leaks memory.
+func (b *Builder) valgrindCmd(testPath string) ([]string, error) {
+	valgrind, err := exec.LookPath("valgrind")
+	if err != nil {
+		return nil, util.NewNewtError(
+			"valgrind not found; install valgrind to use --valgrind")
+	}
+
+	supps, err := b.valgrindSuppPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := []string{
+		valgrind,
+		"--tool=memcheck",
+		"--quiet",
+		"--leak-check=full",
+		"--show-leak-kinds=definite,indirect",
+		"--errors-for-leak-kinds=definite,indirect",
+		"--track-origins=yes",
+		"--error-exitcode=" + strconv.Itoa(VALGRIND_ERROR_EXITCODE),
+	}
+	for _, supp := range supps {
+		cmd = append(cmd, "--suppressions="+supp)
+	}
+
+	return append(cmd, testPath), nil
+}
+
+// valgrindFailed indicates whether a test executable's error is valgrind
+// reporting memory errors.
+func valgrindFailed(err error) bool {
+	newtErr, ok := err.(*util.NewtError)
+	if !ok {
+		return false
+	}
+
+	exitErr, ok := newtErr.Parent.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+
+	return exitErr.ExitCode() == VALGRIND_ERROR_EXITCODE
+}
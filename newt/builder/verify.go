@@ -0,0 +1,180 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/apache/mynewt-artifact/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// Post-load verification.  The flash that was just programmed is read back
+// through the target's debugger backend and compared with the file that was
+// loaded, catching flaky probes and write-protected sectors.
+
+// The maximum number of mismatched regions that are reported individually.
+const VERIFY_MAX_REGIONS = 10
+
+// A range of flash whose contents do not match the loaded file.
+type verifyMismatch struct {
+	Off  int
+	Size int
+}
+
+// verifyMismatches compares flash contents with the loaded file, and returns
+// the ranges that differ.
+func verifyMismatches(expected []byte, actual []byte) []verifyMismatch {
+	var mms []verifyMismatch
+
+	for i := 0; i < len(expected); i++ {
+		if i < len(actual) && expected[i] == actual[i] {
+			continue
+		}
+
+		// Extend the previous range if this byte is adjacent to it.
+		if n := len(mms); n > 0 && mms[n-1].Off+mms[n-1].Size == i {
+			mms[n-1].Size++
+		} else {
+			mms = append(mms, verifyMismatch{Off: i, Size: 1})
+		}
+	}
+
+	return mms
+}
+
+// verifyPath returns the path of the file that programmed flash is read
+// into.
+func (b *Builder) verifyPath(probeId string) string {
+	if probeId == "" {
+		return b.AppBinBasePath() + ".verify.bin"
+	}
+	return b.AppBinBasePath() + "." + probeId + ".verify.bin"
+}
+
+// verifyProbe verifies the app's flash area against the file that was
+// loaded into it.
+//
+// @param imageSlot             The slot the image was loaded into.
+// @param probeId               The serial number of the probe to use; "" for
+//                                  the target's probe_id setting.
+func (b *Builder) verifyProbe(imageSlot int, probeId string) error {
+	debugger, err := b.targetBuilder.Debugger()
+	if err != nil {
+		return err
+	}
+	if debugger == "" {
+		return util.FmtNewtError(
+			"target %s does not select a debugger backend; BSP scripts "+
+				"cannot read back flash", b.targetBuilder.target.FullName())
+	}
+
+	area, err := b.loadArea(imageSlot)
+	if err != nil {
+		return err
+	}
+
+	loadPath := b.loadFile()
+	expected, err := ioutil.ReadFile(loadPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	if len(expected) > area.Size {
+		return util.FmtNewtError("%s (%d bytes) does not fit in %s",
+			util.TryRelPath(loadPath), len(expected), area.Name)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Verifying %s\n",
+		util.TryRelPath(loadPath))
+
+	// Only read back as much flash as was programmed.
+	readArea := flash.FlashArea{
+		Name:   area.Name,
+		Id:     area.Id,
+		Device: area.Device,
+		Offset: area.Offset,
+		Size:   len(expected),
+	}
+
+	p, err := b.newProbe(debugger, probeId)
+	if err != nil {
+		return err
+	}
+
+	readPath := b.verifyPath(probeId)
+	if err := p.ReadMem(readArea, readPath); err != nil {
+		return err
+	}
+	defer os.Remove(readPath)
+
+	actual, err := ioutil.ReadFile(readPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	mms := verifyMismatches(expected, actual)
+	if len(mms) == 0 {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "Verified %d bytes.\n",
+			len(expected))
+		return nil
+	}
+
+	var lines []string
+	total := 0
+	for i, mm := range mms {
+		total += mm.Size
+		if i < VERIFY_MAX_REGIONS {
+			lines = append(lines, fmt.Sprintf("    0x%08x-0x%08x (%d bytes)",
+				area.Offset+mm.Off, area.Offset+mm.Off+mm.Size, mm.Size))
+		}
+	}
+	if len(mms) > VERIFY_MAX_REGIONS {
+		lines = append(lines, fmt.Sprintf("    ... and %d more regions",
+			len(mms)-VERIFY_MAX_REGIONS))
+	}
+
+	return util.FmtNewtError(
+		"flash verification failed: %d of %d bytes in %s differ from %s:\n%s",
+		total, len(expected), area.Name, util.TryRelPath(loadPath),
+		strings.Join(lines, "\n"))
+}
+
+// Verify reads back the flash that the target's images were loaded into and
+// compares it with the images.
+//
+// @param probeId               The serial number of the probe to use; "" for
+//                                  the target's probe_id setting.
+func (t *TargetBuilder) Verify(probeId string) error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	if t.LoaderBuilder != nil {
+		if err := t.AppBuilder.verifyProbe(1, probeId); err != nil {
+			return err
+		}
+		return t.LoaderBuilder.verifyProbe(0, probeId)
+	}
+
+	return t.AppBuilder.verifyProbe(0, probeId)
+}
@@ -0,0 +1,304 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/util"
+)
+
+// VS Code configuration.  A target's launch configuration (for the
+// cortex-debug extension) and C/C++ configuration are written to the
+// project's .vscode directory.  Each is named after the target; existing
+// configurations for other targets are preserved.
+
+const VSCODE_DIR = ".vscode"
+
+// A cortex-debug launch configuration.
+type vscodeLaunchCfg struct {
+	Name            string   `json:"name"`
+	Type            string   `json:"type"`
+	Request         string   `json:"request"`
+	Cwd             string   `json:"cwd"`
+	Executable      string   `json:"executable"`
+	ServerType      string   `json:"servertype"`
+	GdbPath         string   `json:"gdbPath"`
+	RunToEntryPoint string   `json:"runToEntryPoint"`
+	SvdFile         string   `json:"svdFile,omitempty"`
+	Device          string   `json:"device,omitempty"`
+	Interface       string   `json:"interface,omitempty"`
+	SerialNumber    string   `json:"serialNumber,omitempty"`
+	TargetId        string   `json:"targetId,omitempty"`
+	ConfigFiles     []string `json:"configFiles,omitempty"`
+	SearchDir       []string `json:"searchDir,omitempty"`
+	OpenocdCmds     []string `json:"openOCDLaunchCommands,omitempty"`
+	BmpPort         string   `json:"BMPGDBSerialPort,omitempty"`
+}
+
+// A C/C++ extension configuration.
+type vscodeCppCfg struct {
+	Name             string   `json:"name"`
+	IncludePath      []string `json:"includePath"`
+	Defines          []string `json:"defines"`
+	CompilerPath     string   `json:"compilerPath"`
+	CStandard        string   `json:"cStandard"`
+	IntelliSenseMode string   `json:"intelliSenseMode"`
+}
+
+func VSCodeLaunchPath() string {
+	return interfaces.GetProject().Path() + "/" + VSCODE_DIR + "/launch.json"
+}
+
+func VSCodeCppPropertiesPath() string {
+	return interfaces.GetProject().Path() + "/" + VSCODE_DIR +
+		"/c_cpp_properties.json"
+}
+
+// vscodePath expresses a path relative to the VS Code workspace (the project
+// directory).
+func vscodePath(path string) string {
+	if filepath.IsAbs(path) {
+		trimmed := trimProjectPath(path)
+		if trimmed == path {
+			return path
+		}
+		path = trimmed
+	}
+	return "${workspaceFolder}/" + filepath.ToSlash(path)
+}
+
+func (t *TargetBuilder) vscodeLaunchCfg() (vscodeLaunchCfg, error) {
+	b := t.AppBuilder
+
+	gdb, err := b.gdbPath()
+	if err != nil {
+		return vscodeLaunchCfg{}, err
+	}
+
+	cfg := vscodeLaunchCfg{
+		Name:            t.target.FullName(),
+		Type:            "cortex-debug",
+		Request:         "launch",
+		Cwd:             "${workspaceFolder}",
+		Executable:      vscodePath(b.AppElfPath()),
+		GdbPath:         gdb,
+		RunToEntryPoint: "main",
+	}
+	if t.bspPkg.SvdFile != "" {
+		cfg.SvdFile = vscodePath(t.bspPkg.SvdFile)
+	}
+
+	debugger, err := t.Debugger()
+	if err != nil {
+		return cfg, err
+	}
+
+	switch debugger {
+	case DEBUGGER_JLINK:
+		s, err := t.jlinkSettings()
+		if err != nil {
+			return cfg, err
+		}
+		cfg.ServerType = "jlink"
+		cfg.Device = s.Device
+		cfg.Interface = strings.ToLower(s.Interface)
+		cfg.SerialNumber = s.Serial
+
+	case DEBUGGER_PYOCD:
+		args, err := t.pyocdArgs(t.target.ProbeId)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.ServerType = "pyocd"
+		cfg.TargetId = args[1]
+		cfg.SerialNumber = t.target.ProbeId
+
+	case DEBUGGER_BMP:
+		if _, err := t.bmpGdbCmds(); err != nil {
+			return cfg, err
+		}
+		cfg.ServerType = "bmp"
+		cfg.BmpPort = t.target.Env[BMP_ENV_PORT]
+		if scan := t.target.Env[BMP_ENV_SCAN]; scan == "jtag_scan" {
+			cfg.Interface = "jtag"
+		} else {
+			cfg.Interface = "swd"
+		}
+
+	default:
+		if len(t.bspPkg.OpenocdCfg) == 0 && len(t.target.OpenocdCfg) == 0 {
+			return cfg, util.FmtNewtError(
+				"target %s does not select a debugger backend or OpenOCD "+
+					"configuration; cannot generate a launch configuration",
+				t.target.FullName())
+		}
+		cmds, err := t.openocdCmds()
+		if err != nil {
+			return cfg, err
+		}
+		cfg.ServerType = "openocd"
+		if adapter := t.openocdAdapterCfg(); adapter != "" {
+			cfg.ConfigFiles = append(cfg.ConfigFiles, adapter)
+		}
+		cfg.ConfigFiles = append(cfg.ConfigFiles, t.bspPkg.OpenocdCfg...)
+		cfg.ConfigFiles = append(cfg.ConfigFiles, t.target.OpenocdCfg...)
+		cfg.SearchDir = []string{
+			vscodePath(t.bspPkg.BasePath()),
+			"${workspaceFolder}",
+		}
+		cfg.OpenocdCmds = cmds
+	}
+
+	return cfg, nil
+}
+
+func (t *TargetBuilder) vscodeCppCfg() (vscodeCppCfg, error) {
+	b := t.AppBuilder
+
+	var includes []string
+	var defines []string
+
+	addInfo := func(flags []string, incls []string) {
+		includes = append(includes, incls...)
+		for _, f := range flags {
+			if strings.HasPrefix(f, "-I") {
+				includes = append(includes, strings.TrimPrefix(f, "-I"))
+			} else if strings.HasPrefix(f, "-D") {
+				defines = append(defines, strings.TrimPrefix(f, "-D"))
+			}
+		}
+	}
+
+	var ccPath string
+	for _, bpkg := range b.sortedBuildPackages() {
+		c, err := b.newCompiler(bpkg, b.PkgBinDir(bpkg))
+		if err != nil {
+			return vscodeCppCfg{}, err
+		}
+		ccPath = c.GetCcPath()
+
+		addInfo(c.GetCompilerInfo().Cflags, c.GetCompilerInfo().Includes)
+		addInfo(c.GetLocalCompilerInfo().Cflags,
+			c.GetLocalCompilerInfo().Includes)
+	}
+
+	includes = util.SortFields(includes...)
+	for i, incl := range includes {
+		includes[i] = vscodePath(incl)
+	}
+
+	return vscodeCppCfg{
+		Name:             t.target.FullName(),
+		IncludePath:      includes,
+		Defines:          util.SortFields(defines...),
+		CompilerPath:     ccPath,
+		CStandard:        "c11",
+		IntelliSenseMode: "gcc-arm",
+	}, nil
+}
+
+// writeVSCodeCfg adds a configuration to a VS Code configuration file,
+// replacing any existing configuration with the same name.
+//
+// @param path                  The path of the configuration file.
+// @param version               The file format version, used if the file
+//                                  does not exist yet.
+// @param name                  The name of the configuration.
+// @param cfg                   The configuration.
+func writeVSCodeCfg(path string, version interface{}, name string,
+	cfg interface{}) error {
+
+	doc := map[string]interface{}{
+		"version": version,
+	}
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return util.FmtNewtError(
+				"cannot parse existing %s (comments are not supported): %s",
+				path, err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return util.ChildNewtError(err)
+	}
+
+	var cfgs []interface{}
+	if existing, ok := doc["configurations"].([]interface{}); ok {
+		for _, c := range existing {
+			if m, ok := c.(map[string]interface{}); ok && m["name"] == name {
+				continue
+			}
+			cfgs = append(cfgs, c)
+		}
+	}
+	doc["configurations"] = append(cfgs, cfg)
+
+	data, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Wrote %s\n",
+		util.TryRelPath(path))
+
+	return nil
+}
+
+// WriteVSCodeCfg writes the target's VS Code launch and C/C++ configurations.
+func (t *TargetBuilder) WriteVSCodeCfg() error {
+	if err := t.PrepBuild(); err != nil {
+		return err
+	}
+
+	if err := t.bspPkg.Reload(t.AppBuilder.cfg.SettingValues()); err != nil {
+		return err
+	}
+
+	launch, err := t.vscodeLaunchCfg()
+	if err != nil {
+		return err
+	}
+
+	cpp, err := t.vscodeCppCfg()
+	if err != nil {
+		return err
+	}
+
+	if err := writeVSCodeCfg(VSCodeLaunchPath(), "0.2.0", launch.Name,
+		launch); err != nil {
+
+		return err
+	}
+
+	return writeVSCodeCfg(VSCodeCppPropertiesPath(), 4, cpp.Name, cpp)
+}
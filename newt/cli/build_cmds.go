@@ -23,15 +23,22 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"mynewt.apache.org/newt/newt/benchmark"
 	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/coverage"
 	"mynewt.apache.org/newt/newt/imgprod"
 	"mynewt.apache.org/newt/newt/manifest"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/syscfg"
 	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/newt/testreport"
 	"mynewt.apache.org/newt/util"
 )
 
@@ -102,21 +109,113 @@ func pkgToUnitTests(pack *pkg.LocalPackage) []*pkg.LocalPackage {
 }
 
 var extraJtagCmd string
+
+// Syscfg overrides specified with -D (e.g., "-DSHELL_TASK=1").
+var buildDefines []string
+
+// The address (host:port) of a remote GDB server.
+var gdbRemote string
+
+// Load method flags.
+var loadMethod string
+var loadPort string
+var loadBaud int
+
+// Multi-probe load flags.
+var loadProbeSerial string
+var loadAllProbes bool
+
+// Erase and verify flags.
+var loadErase bool
+var loadVerify bool
+var eraseAreas []string
+
+var rttChannel int
+
+// Test flags.
+var testFilter string
+var testReports []string
+var testProfile string
+var testValgrind bool
+var testForce bool
+var testRetries int
+var testRepeat int
+var testUntilFailure bool
+
+// On-target test flags.
+var testHwTarget string
+var testPort string
+var testBaud int
+var testRtt bool
+var testTimeout string
+
+// Parallel test flags.
+var testParallel int
+var testWorkerBase string
+var testWorkerConfig string
+var testWorkerOut string
+
+// Coverage flags.
+var testCoverage bool
+var testCoverageHtml string
+var testCoverageMin float64
+
+// Benchmark flags.
+var testBench bool
+var testBenchBaseline string
+var testBenchSave string
+var testBenchThreshold float64
+
+// Trace flags.
+var tracePorts []int
+var traceSwoFreq int
+var traceFile string
+var coredumpGdb bool
 var noGDB_flag bool
+var semihosting_flag bool
+var gdbFrontend string
 var diffFriendly_flag bool
 
-func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, executeShell bool) {
-	if len(args) < 1 {
-		NewtUsage(cmd, nil)
+// parseBuildDefines converts a set of -D arguments into a map of setting
+// overrides.  An argument without a value (e.g., "-DSHELL_TASK") sets the
+// setting to 1.
+func parseBuildDefines(defines []string) (map[string]string, error) {
+	overrides := make(map[string]string, len(defines))
+
+	for _, d := range defines {
+		kv := strings.SplitN(d, "=", 2)
+		name := strings.TrimSpace(kv[0])
+		if name == "" {
+			return nil, util.FmtNewtError(
+				"invalid setting override: \"%s\"; "+
+					"expected -DSETTING=value", d)
+		}
+
+		val := "1"
+		if len(kv) > 1 {
+			val = kv[1]
+		}
+		overrides[name] = val
 	}
 
+	return overrides, nil
+}
+
+func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, executeShell bool) {
 	util.PrintShellCmds = printShellCmds
 	util.ExecuteShell = executeShell
 
 	TryGetProject()
 
+	args = targetArgsOrDefault(cmd, args)
+
 	// Verify and resolve each specified package.
-	targets, all, err := ResolveTargetsOrAll(args...)
+	targets, all, err := ResolvePartialTargetsOrAll(args...)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	overrides, err := parseBuildDefines(buildDefines)
 	if err != nil {
 		NewtUsage(cmd, err)
 	}
@@ -152,12 +251,21 @@ func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, execute
 
 		util.StatusMessage(util.VERBOSITY_DEFAULT, "Building target %s\n",
 			t.FullName())
+		if len(overrides) > 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Overriding syscfg settings: %s\n",
+				syscfg.KeyValueToStr(overrides))
+		}
 
 		b, err := builder.NewTargetBuilder(t)
 		if err != nil {
 			NewtUsage(nil, err)
 		}
 
+		for k, v := range overrides {
+			b.OverrideSetting(k, v)
+		}
+
 		if err := b.Build(); err != nil {
 			NewtUsage(nil, err)
 		}
@@ -226,21 +334,179 @@ func pkgnames(pkgs []*pkg.LocalPackage) string {
 	return s
 }
 
+// parseTestTimeout parses the argument of --timeout: a whole number of
+// seconds, or a duration such as "1m30s".  An empty argument means the
+// default timeout.
+func parseTestTimeout(arg string) (time.Duration, error) {
+	if arg == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		secs, serr := strconv.Atoi(arg)
+		if serr != nil {
+			return 0, util.FmtNewtError(
+				"invalid --timeout \"%s\"; must be a number of seconds "+
+					"or a duration such as 1m30s", arg)
+		}
+		d = time.Duration(secs) * time.Second
+	}
+
+	if d < 0 {
+		return 0, util.NewNewtError("--timeout cannot be negative")
+	}
+
+	return d, nil
+}
+
 func testRunCmd(cmd *cobra.Command, args []string, exclude string, executeShell bool) {
+	proj := TryGetProject()
+
+	// A test profile supplies the packages to test and exclude.
+	if testProfile != "" {
+		tp, err := proj.TestProfile(testProfile)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+
+		args = append(args, tp.Include...)
+		excls := tp.Exclude
+		if exclude != "" {
+			excls = append(excls, exclude)
+		}
+		exclude = strings.Join(excls, ",")
+
+		if testHwTarget == "" {
+			testHwTarget = tp.Target
+		}
+	}
+
 	if len(args) < 1 {
 		NewtUsage(cmd, nil)
 	}
 
 	util.ExecuteShell = executeShell
 
-	proj := TryGetProject()
+	if testFilter != "" {
+		if _, err := regexp.Compile(testFilter); err != nil {
+			NewtUsage(cmd, util.FmtNewtError(
+				"invalid test filter \"%s\": %s", testFilter, err.Error()))
+		}
+	}
+	timeout, err := parseTestTimeout(testTimeout)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
 
-	// Verify and resolve each specified package.
+	testOpts := builder.TestOpts{
+		Filter:       testFilter,
+		Valgrind:     testValgrind,
+		Retries:      testRetries,
+		Repeat:       testRepeat,
+		UntilFailure: testUntilFailure,
+		Force:        testForce,
+		Port:         testPort,
+		Baud:         testBaud,
+		Rtt:          testRtt,
+		Timeout:      timeout,
+	}
+	if testHwTarget != "" && testFilter != "" {
+		NewtUsage(cmd, util.NewNewtError(
+			"--filter is not supported with --target"))
+	}
+	if testHwTarget != "" && testValgrind {
+		NewtUsage(cmd, util.NewNewtError(
+			"--valgrind is only supported for simulated tests"))
+	}
+	if testRetries < 0 {
+		NewtUsage(cmd, util.NewNewtError("--retries cannot be negative"))
+	}
+	if testHwTarget != "" && testRetries > 0 {
+		NewtUsage(cmd, util.NewNewtError(
+			"--retries is only supported for simulated tests"))
+	}
+	if testRepeat < 0 {
+		NewtUsage(cmd, util.NewNewtError("--repeat cannot be negative"))
+	}
+	if testUntilFailure && testRepeat < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"--until-failure requires --repeat of at least 2"))
+	}
+	if testRepeat > 1 {
+		if testHwTarget != "" {
+			NewtUsage(cmd, util.NewNewtError(
+				"--repeat is only supported for simulated tests"))
+		}
+		if testRetries > 0 {
+			NewtUsage(cmd, util.NewNewtError(
+				"--repeat cannot be combined with --retries"))
+		}
+	}
+	if testHwTarget == "" && (testPort != "" || testBaud != 0 || testRtt) {
+		NewtUsage(cmd, util.NewNewtError(
+			"--port, --baud, and --rtt require --target"))
+	}
+	if testParallel < 1 {
+		NewtUsage(cmd, util.NewNewtError("--parallel must be at least 1"))
+	}
+	if testHwTarget != "" && testParallel > 1 {
+		NewtUsage(cmd, util.NewNewtError(
+			"--parallel cannot be combined with --target"))
+	}
+	if testCoverageHtml != "" || testCoverageMin > 0 {
+		testCoverage = true
+	}
+	if testCoverage {
+		if testHwTarget != "" {
+			NewtUsage(cmd, util.NewNewtError(
+				"coverage is only measured for simulated tests"))
+		}
+		testOpts.Coverage = coverage.NewData()
+	}
+	if testBenchBaseline != "" || testBenchSave != "" {
+		testBench = true
+	}
+	if testBench {
+		if testHwTarget != "" {
+			NewtUsage(cmd, util.NewNewtError(
+				"benchmarks are only run for simulated tests"))
+		}
+		if testValgrind || testCoverage {
+			NewtUsage(cmd, util.NewNewtError(
+				"benchmarks cannot be combined with --valgrind or coverage"))
+		}
+		testOpts.Bench = benchmark.NewData()
+	}
+	if len(testReports) > 0 {
+		report, err := testreport.NewReport(testReports)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		testOpts.Report = report
+	}
+	if testOpts.Report == nil && testRetries > 0 {
+		// The summary lists the flaky cases that the results record.
+		testOpts.Report, _ = testreport.NewReport(nil)
+	}
+
+	// Verify and resolve each specified package.  A "@<tag>" argument
+	// selects the targets to run the tests on in place of the default unit
+	// test target.
 	testAll := false
 	packs := []*pkg.LocalPackage{}
+	baseNames := []string{}
 	for _, pkgName := range args {
 		if pkgName == "all" {
 			testAll = true
+		} else if tag, ok := targetTagArg(pkgName); ok {
+			targets, err := ResolveTaggedTargets(tag)
+			if err != nil {
+				NewtUsage(cmd, err)
+			}
+			for _, t := range targets {
+				baseNames = append(baseNames, t.FullName())
+			}
 		} else {
 			pack, err := proj.ResolvePackage(proj.LocalRepo(), pkgName)
 			if err != nil {
@@ -257,6 +523,31 @@ func testRunCmd(cmd *cobra.Command, args []string, exclude string, executeShell
 		}
 	}
 
+	// --target runs the tests on a hardware target's board.
+	if testHwTarget != "" {
+		if len(baseNames) > 0 {
+			NewtUsage(cmd, util.NewNewtError(
+				"--target cannot be combined with target tags"))
+		}
+		hwTarget := ResolveTarget(testHwTarget)
+		if hwTarget == nil {
+			NewtUsage(cmd, util.FmtNewtError(
+				"Can't find target: %s", testHwTarget))
+		}
+		baseNames = []string{hwTarget.FullName()}
+	}
+
+	// If only tags were specified, run all tests on the tagged targets.
+	if len(packs) == 0 && len(baseNames) > 0 && testHwTarget == "" {
+		testAll = true
+	}
+	if len(baseNames) == 0 {
+		baseNames = []string{TARGET_TEST_NAME}
+	}
+	if testWorkerBase != "" {
+		baseNames = []string{testWorkerBase}
+	}
+
 	if testAll {
 		packItfs := proj.PackagesOfType(pkg.PACKAGE_TYPE_UNITTEST)
 		packs = make([]*pkg.LocalPackage, len(packItfs))
@@ -290,59 +581,269 @@ func testRunCmd(cmd *cobra.Command, args []string, exclude string, executeShell
 		NewtUsage(nil, util.NewNewtError("No testable packages found"))
 	}
 
-	passedPkgs := []*pkg.LocalPackage{}
-	failedPkgs := []*pkg.LocalPackage{}
-	for _, pack := range packs {
-		// Reset the global state for the next test.
-		if err := ResetGlobalState(); err != nil {
-			NewtUsage(nil, err)
+	// A worker process tests a single package for a parallel run.
+	if testWorkerOut != "" {
+		runTestWorker(testJob{
+			baseName: testWorkerBase,
+			pack:     packs[0],
+			config:   testWorkerConfig,
+		}, testOpts)
+		return
+	}
+
+	var jobs []testJob
+	for _, baseName := range baseNames {
+		for _, pack := range packs {
+			packJobs, err := testJobsFor(baseName, pack)
+			if err != nil {
+				NewtUsage(nil, err)
+			}
+			jobs = append(jobs, packJobs...)
 		}
+	}
 
-		t, err := ResolveUnittest(pack.Name())
-		if err != nil {
-			NewtUsage(nil, err)
+	passedTests := []string{}
+	failedTests := []string{}
+	if testParallel > 1 && len(jobs) > 1 {
+		passedTests, failedTests = runTestJobsParallel(jobs, testOpts)
+	} else {
+		for _, job := range jobs {
+			if err := runTestJob(job, testOpts); err == nil {
+				passedTests = append(passedTests, job.name())
+			} else {
+				newtError := err.(*util.NewtError)
+				util.StatusMessage(util.VERBOSITY_QUIET, newtError.Text)
+				failedTests = append(failedTests, job.name())
+			}
 		}
+	}
 
-		b, err := builder.NewTargetTester(t, pack)
-		if err != nil {
+	if testOpts.Report != nil {
+		if err := testOpts.Report.Write(); err != nil {
 			NewtUsage(nil, err)
 		}
+	}
 
-		util.StatusMessage(util.VERBOSITY_DEFAULT, "Testing package %s\n",
-			pack.FullName())
+	var covErr error
+	if testOpts.Coverage != nil {
+		covErr = reportCoverage(testOpts.Coverage)
+	}
 
-		err = b.SelfTestExecute()
-		if err == nil {
-			passedPkgs = append(passedPkgs, pack)
-		} else {
-			newtError := err.(*util.NewtError)
-			util.StatusMessage(util.VERBOSITY_QUIET, newtError.Text)
-			failedPkgs = append(failedPkgs, pack)
+	var benchErr error
+	if testOpts.Bench != nil {
+		benchErr = reportBenchmarks(testOpts.Bench)
+	}
+
+	if testOpts.Report != nil {
+		if flaky := testreport.FlakyCases(testOpts.Report.Suites); len(flaky) > 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Flaky tests (passed on retry): [%s]\n",
+				strings.Join(flaky, ", "))
 		}
 	}
 
-	passStr := fmt.Sprintf("Passed tests: [%s]", PackageNameList(passedPkgs))
-	failStr := fmt.Sprintf("Failed tests: [%s]", PackageNameList(failedPkgs))
+	passStr := fmt.Sprintf("Passed tests: [%s]", strings.Join(passedTests, " "))
+	failStr := fmt.Sprintf("Failed tests: [%s]", strings.Join(failedTests, " "))
 
-	if len(failedPkgs) > 0 {
+	if len(failedTests) > 0 {
 		NewtUsage(nil, util.FmtNewtError("Test failure(s):\n%s\n%s", passStr,
 			failStr))
 	} else {
 		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", passStr)
 		util.StatusMessage(util.VERBOSITY_DEFAULT, "All tests passed\n")
 	}
+
+	if covErr != nil {
+		NewtUsage(nil, covErr)
+	}
+	if benchErr != nil {
+		NewtUsage(nil, benchErr)
+	}
+}
+
+// reportBenchmarks displays the benchmark results, compares them against the
+// baseline, and saves them as a new baseline.
+//
+// @return error                Error if any benchmark regressed.
+func reportBenchmarks(bench *benchmark.Data) error {
+	var base *benchmark.Data
+	if testBenchBaseline != "" {
+		var err error
+		base, err = benchmark.Load(testBenchBaseline)
+		if err != nil {
+			return err
+		}
+	}
+
+	var sb strings.Builder
+	bench.WriteTable(&sb, base, testBenchThreshold)
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Benchmarks:\n%s", sb.String())
+
+	if testBenchSave != "" {
+		if err := bench.Save(testBenchSave); err != nil {
+			return err
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Wrote benchmark baseline: %s\n", testBenchSave)
+	}
+
+	if base == nil {
+		return nil
+	}
+
+	regs := bench.Compare(base, testBenchThreshold)
+	if len(regs) == 0 {
+		return nil
+	}
+
+	s := fmt.Sprintf("%d benchmark(s) regressed by more than %.1f%%:",
+		len(regs), testBenchThreshold)
+	for _, r := range regs {
+		s += "\n    " + r.String()
+	}
+	return util.NewNewtError(s)
+}
+
+// reportCoverage displays the coverage that the tests measured and writes
+// the HTML report.
+//
+// @return error                Error if the coverage is below the threshold.
+func reportCoverage(cov *coverage.Data) error {
+	var sb strings.Builder
+	cov.WriteSummary(&sb)
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Coverage:\n%s", sb.String())
+
+	if testCoverageHtml != "" {
+		err := cov.WriteHtml(testCoverageHtml, TryGetProject().Path())
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Wrote coverage report: %s\n",
+			filepath.Join(testCoverageHtml, "index.html"))
+	}
+
+	total := cov.Total()
+	if total.LinePct() < testCoverageMin {
+		return util.FmtNewtError(
+			"line coverage %.1f%% is below the minimum of %.1f%%",
+			total.LinePct(), testCoverageMin)
+	}
+
+	return nil
 }
 
 func loadRunCmd(cmd *cobra.Command, args []string) {
-	if len(args) < 1 {
-		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+	TryGetProject()
+
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolvePartialTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if loadProbeSerial != "" && loadAllProbes {
+		NewtUsage(cmd, util.NewNewtError(
+			"--probe-serial and --all-probes are mutually exclusive"))
+	}
+
+	switch loadMethod {
+	case "", "probe":
+		if loadPort != "" {
+			NewtUsage(cmd, util.NewNewtError(
+				"--port requires --method serial"))
+		}
+
+		if gdbRemote != "" {
+			if loadProbeSerial != "" || loadAllProbes || loadErase ||
+				loadVerify {
+
+				NewtUsage(cmd, util.NewNewtError(
+					"--remote does not use local probes; --probe-serial, "+
+						"--all-probes, --erase, and --verify are invalid"))
+			}
+			err = b.LoadRemote(gdbRemote)
+			break
+		}
+
+		var probes []string
+		if loadAllProbes {
+			probes, err = b.ListProbes()
+			if err != nil {
+				NewtUsage(nil, err)
+			}
+		} else if loadProbeSerial != "" {
+			probes = []string{loadProbeSerial}
+		}
+
+		if loadErase {
+			eraseProbes := probes
+			if len(eraseProbes) == 0 {
+				eraseProbes = []string{""}
+			}
+			for _, p := range eraseProbes {
+				if err := b.Erase(nil, p); err != nil {
+					NewtUsage(nil, err)
+				}
+			}
+		}
+
+		if probes != nil {
+			err = b.LoadProbes(extraJtagCmd, probes)
+		} else {
+			err = b.Load(extraJtagCmd)
+		}
+
+		if err == nil && loadVerify {
+			verifyProbes := probes
+			if len(verifyProbes) == 0 {
+				verifyProbes = []string{""}
+			}
+			for _, p := range verifyProbes {
+				if err = b.Verify(p); err != nil {
+					break
+				}
+			}
+		}
+
+	case "serial":
+		if loadProbeSerial != "" || loadAllProbes || loadErase ||
+			loadVerify || gdbRemote != "" {
+			NewtUsage(cmd, util.NewNewtError(
+				"--method serial does not use probes; --probe-serial, "+
+					"--all-probes, --erase, --verify, and --remote are "+
+					"invalid"))
+		}
+		if loadPort == "" {
+			NewtUsage(cmd, util.NewNewtError(
+				"--method serial requires --port"))
+		}
+		err = b.LoadSerial(loadPort, loadBaud)
+
+	default:
+		NewtUsage(cmd, util.FmtNewtError(
+			"invalid load method \"%s\"; must be probe or serial",
+			loadMethod))
+	}
+	if err != nil {
+		NewtUsage(cmd, err)
 	}
+}
 
+func eraseRunCmd(cmd *cobra.Command, args []string) {
 	TryGetProject()
 
-	t := ResolveTarget(args[0])
-	if t == nil {
-		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
 	}
 
 	b, err := builder.NewTargetBuilder(t)
@@ -350,21 +851,71 @@ func loadRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(nil, err)
 	}
 
-	if err := b.Load(extraJtagCmd); err != nil {
+	if err := b.Erase(eraseAreas, loadProbeSerial); err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func resetRunCmd(cmd *cobra.Command, args []string) {
+	TryGetProject()
+
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
 		NewtUsage(cmd, err)
 	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := b.Reset(loadProbeSerial); err != nil {
+		NewtUsage(nil, err)
+	}
 }
 
 func debugRunCmd(cmd *cobra.Command, args []string) {
-	if len(args) < 1 {
-		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+	TryGetProject()
+
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolvePartialTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if semihosting_flag {
+		b.GetTarget().Semihosting = true
+	}
+	if gdbFrontend != "" {
+		b.GetTarget().GdbFrontend = gdbFrontend
 	}
 
+	if gdbRemote != "" {
+		err = b.DebugRemote(gdbRemote, false)
+	} else {
+		err = b.Debug(extraJtagCmd, false, noGDB_flag)
+	}
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+}
+
+func attachRunCmd(cmd *cobra.Command, args []string) {
 	TryGetProject()
 
-	t := ResolveTarget(args[0])
-	if t == nil {
-		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
 	}
 
 	b, err := builder.NewTargetBuilder(t)
@@ -372,21 +923,100 @@ func debugRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(nil, err)
 	}
 
-	if err := b.Debug(extraJtagCmd, false, noGDB_flag); err != nil {
+	if gdbFrontend != "" {
+		b.GetTarget().GdbFrontend = gdbFrontend
+	}
+
+	if err := b.Attach(extraJtagCmd, noGDB_flag); err != nil {
 		NewtUsage(cmd, err)
 	}
 }
 
-func sizeRunCmd(cmd *cobra.Command, args []string, ram bool, flash bool, section string) {
-	if len(args) < 1 {
-		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+func rttRunCmd(cmd *cobra.Command, args []string) {
+	TryGetProject()
+
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := b.Rtt(rttChannel); err != nil {
+		NewtUsage(cmd, err)
+	}
+}
+
+func coredumpRunCmd(cmd *cobra.Command, args []string) {
+	TryGetProject()
+
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	// A serial port selects SMP; otherwise, the debugger backend reads the
+	// dump from flash.
+	if loadPort != "" {
+		err = b.ReadCoreDumpSerial(loadPort, loadBaud)
+	} else {
+		err = b.ReadCoreDump()
 	}
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := b.ConvertCoreDump(); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if coredumpGdb {
+		if err := b.DebugCoreDump(); err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+}
 
+func traceRunCmd(cmd *cobra.Command, args []string) {
 	TryGetProject()
 
-	t := ResolveTarget(args[0])
-	if t == nil {
-		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+args[0]))
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := b.Trace(tracePorts, traceSwoFreq, traceFile); err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func sizeRunCmd(cmd *cobra.Command, args []string, ram bool, flash bool, section string) {
+	TryGetProject()
+
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
 	}
 
 	b, err := builder.NewTargetBuilder(t)
@@ -428,8 +1058,10 @@ func AddBuildCommands(cmd *cobra.Command) {
 	var executeShell bool
 
 	buildCmd := &cobra.Command{
-		Use:   "build <target-name> [target-names...]",
+		Use:   "build [target-name | @tag] [target-names...]",
 		Short: "Build one or more targets",
+		Long: "Build one or more targets.  If no target is specified, the " +
+			"project's default\ntarget is built.",
 		Run: func(cmd *cobra.Command, args []string) {
 			buildRunCmd(cmd, args, printShellCmds, executeShell)
 		},
@@ -441,6 +1073,10 @@ func AddBuildCommands(cmd *cobra.Command) {
 	buildCmd.Flags().BoolVar(&executeShell, "executeShell", false,
 		"Execute build command using /bin/sh (Linux and MacOS only)")
 
+	buildCmd.Flags().StringArrayVarP(&buildDefines, "define", "D", nil,
+		"Override a syscfg setting for this build only (-DSETTING=value); "+
+			"may be repeated")
+
 	cmd.AddCommand(buildCmd)
 	AddTabCompleteFn(buildCmd, func() []string {
 		return append(targetList(), "all")
@@ -459,13 +1095,67 @@ func AddBuildCommands(cmd *cobra.Command) {
 
 	var exclude string
 	testCmd := &cobra.Command{
-		Use:   "test <package-name> [package-names...] | all",
+		Use:   "test <package-name> [package-names...] | all [@tag...]",
 		Short: "Executes unit tests for one or more packages",
 		Run: func(cmd *cobra.Command, args []string) {
 			testRunCmd(cmd, args, exclude, executeShell)
 		},
 	}
 	testCmd.Flags().StringVarP(&exclude, "exclude", "e", "", "Comma separated list of packages to exclude")
+	testCmd.Flags().StringVarP(&testProfile, "profile", "", "",
+		"Test the packages listed in this project.yml test profile")
+	testCmd.Flags().StringVarP(&testFilter, "filter", "f", "",
+		"Only run test suites and cases matching this regular expression")
+	testCmd.Flags().StringSliceVarP(&testReports, "report", "", nil,
+		"Write a test report: junit=<file> or tap=<file> (may be repeated)")
+	testCmd.Flags().BoolVarP(&testForce, "force", "", false,
+		"Run tests even if they are unchanged since they last passed")
+	testCmd.Flags().IntVarP(&testRetries, "retries", "", 0,
+		"Re-run failed test cases up to this many times; report flaky passes")
+	testCmd.Flags().IntVarP(&testRepeat, "repeat", "", 0,
+		"Run each package's tests this many times, each with its own seed")
+	testCmd.Flags().BoolVarP(&testUntilFailure, "until-failure", "", false,
+		"With --repeat, stop at the first failing iteration")
+	testCmd.Flags().BoolVarP(&testValgrind, "valgrind", "", false,
+		"Run the tests under valgrind; fail on leaks and invalid accesses")
+	testCmd.Flags().StringVarP(&testHwTarget, "target", "t", "",
+		"Run the tests on the board of this hardware target")
+	testCmd.Flags().StringVarP(&testPort, "port", "", "",
+		"Serial port that on-target test results are read from")
+	testCmd.Flags().IntVarP(&testBaud, "baud", "", 0,
+		"Baud rate of the serial port; default: CONSOLE_UART_BAUD")
+	testCmd.Flags().BoolVarP(&testRtt, "rtt", "", false,
+		"Read on-target test results from the RTT console")
+	testCmd.Flags().StringVarP(&testTimeout, "timeout", "", "",
+		"How long each package's tests may run, in seconds or as a "+
+			"duration such as 90s or 1m30s (default 600; 60 on target)")
+	testCmd.Flags().BoolVarP(&testCoverage, "coverage", "", false,
+		"Measure line and branch coverage with gcov")
+	testCmd.Flags().StringVarP(&testCoverageHtml, "coverage-html", "", "",
+		"Write an HTML coverage report to this directory")
+	testCmd.Flags().Float64VarP(&testCoverageMin, "coverage-min", "", 0,
+		"Fail if the total line coverage is below this percentage")
+	testCmd.Flags().BoolVarP(&testBench, "bench", "", false,
+		"Run benchmark cases and report their results")
+	testCmd.Flags().StringVarP(&testBenchBaseline, "bench-baseline", "", "",
+		"Compare benchmark results against this saved baseline")
+	testCmd.Flags().StringVarP(&testBenchSave, "bench-save", "", "",
+		"Save the benchmark results to this file as a new baseline")
+	testCmd.Flags().Float64VarP(&testBenchThreshold, "bench-threshold", "",
+		10, "Percentage by which a benchmark may regress before failing")
+	testCmd.Flags().IntVarP(&testParallel, "parallel", "p", 1,
+		"Number of test packages to build and run concurrently")
+
+	// Used by the worker processes of a parallel run.
+	testCmd.Flags().StringVarP(&testWorkerBase, "worker-base", "",
+		"", "Base target of the package that a worker tests")
+	testCmd.Flags().StringVarP(&testWorkerConfig, "worker-config", "",
+		"", "Test configuration of the package that a worker tests")
+	testCmd.Flags().StringVarP(&testWorkerOut, "worker-out", "",
+		"", "File that a worker writes its results to")
+	testCmd.Flags().MarkHidden("worker-base")
+	testCmd.Flags().MarkHidden("worker-config")
+	testCmd.Flags().MarkHidden("worker-out")
 	testCmd.Flags().BoolVar(&executeShell, "executeShell", false,
 		"Execute build command using /bin/sh (Linux and MacOS only)")
 	cmd.AddCommand(testCmd)
@@ -473,10 +1163,12 @@ func AddBuildCommands(cmd *cobra.Command) {
 		return append(testablePkgList(), "all", "allexcept")
 	})
 
-	loadHelpText := "Load application image on to the board for <target-name>"
+	loadHelpText := "Load application image on to the board for " +
+		"<target-name>.\nIf no target is specified, the project's default " +
+		"target is used."
 
 	loadCmd := &cobra.Command{
-		Use:   "load <target-name>",
+		Use:   "load [target-name]",
 		Short: "Load built target to board",
 		Long:  loadHelpText,
 		Run:   loadRunCmd,
@@ -487,11 +1179,67 @@ func AddBuildCommands(cmd *cobra.Command) {
 
 	loadCmd.PersistentFlags().StringVarP(&extraJtagCmd, "extrajtagcmd", "", "",
 		"Extra commands to send to JTAG software")
+	loadCmd.PersistentFlags().StringVarP(&loadMethod, "method", "", "",
+		"How to load the image: probe (default) or serial")
+	loadCmd.PersistentFlags().StringVarP(&loadPort, "port", "", "",
+		"Serial port of the device (--method serial)")
+	loadCmd.PersistentFlags().IntVarP(&loadBaud, "baud", "",
+		builder.SERIAL_DFLT_BAUD, "Baud rate of the serial port")
+	loadCmd.PersistentFlags().StringVarP(&loadProbeSerial, "probe-serial",
+		"", "", "Serial number of the probe to load through")
+	loadCmd.PersistentFlags().BoolVarP(&loadAllProbes, "all-probes", "",
+		false, "Load through all attached probes in parallel")
+	loadCmd.PersistentFlags().StringVarP(&gdbRemote, "remote", "", "",
+		"Load through a remote GDB server (host:port)")
+	loadCmd.PersistentFlags().BoolVarP(&loadErase, "erase", "", false,
+		"Erase the entire chip before loading")
+	loadCmd.PersistentFlags().BoolVarP(&loadVerify, "verify", "", false,
+		"Read back the programmed flash and compare it with the image")
+
+	eraseHelpText := "Erase the flash of the board for <target-name>, " +
+		"either entirely or the specified flash areas.\nIf no target is " +
+		"specified, the project's default target is used."
+	eraseHelpEx := "  newt erase my_target\n" +
+		"  newt erase my_target --area FLASH_AREA_NFFS\n"
+
+	eraseCmd := &cobra.Command{
+		Use:     "erase [target-name]",
+		Short:   "Erase flash of target's board",
+		Long:    eraseHelpText,
+		Example: eraseHelpEx,
+		Run:     eraseRunCmd,
+	}
+
+	eraseCmd.PersistentFlags().StringSliceVarP(&eraseAreas, "area", "a",
+		nil, "Flash area to erase (may be repeated); default: entire chip")
+	eraseCmd.PersistentFlags().StringVarP(&loadProbeSerial, "probe-serial",
+		"", "", "Serial number of the probe to erase through")
+
+	cmd.AddCommand(eraseCmd)
+	AddTabCompleteFn(eraseCmd, targetList)
+
+	resetHelpText := "Reset the board for <target-name> and let its app " +
+		"run.\nIf no target is specified, the project's default target is " +
+		"used."
+
+	resetCmd := &cobra.Command{
+		Use:   "reset [target-name]",
+		Short: "Reset target's board",
+		Long:  resetHelpText,
+		Run:   resetRunCmd,
+	}
+
+	resetCmd.PersistentFlags().StringVarP(&loadProbeSerial, "probe-serial",
+		"", "", "Serial number of the probe to reset through")
+
+	cmd.AddCommand(resetCmd)
+	AddTabCompleteFn(resetCmd, targetList)
 
-	debugHelpText := "Open a debugger session for <target-name>"
+	debugHelpText := "Open a debugger session for <target-name>.\nIf no " +
+		"target is specified, the project's default target is used."
 
 	debugCmd := &cobra.Command{
-		Use:   "debug <target-name>",
+		Use:   "debug [target-name]",
 		Short: "Open debugger session to target",
 		Long:  debugHelpText,
 		Run:   debugRunCmd,
@@ -501,17 +1249,107 @@ func AddBuildCommands(cmd *cobra.Command) {
 		"", "Extra commands to send to JTAG software")
 	debugCmd.PersistentFlags().BoolVarP(&noGDB_flag, "noGDB", "n", false,
 		"Do not start GDB from command line")
+	debugCmd.PersistentFlags().BoolVarP(&semihosting_flag, "semihosting",
+		"", false, "Enable semihosting in the debug session")
+	debugCmd.PersistentFlags().StringVarP(&gdbFrontend, "frontend", "", "",
+		"gdb frontend: tui, gdbgui, or a command template")
+	debugCmd.PersistentFlags().StringVarP(&gdbRemote, "remote", "", "",
+		"Connect to a remote GDB server (host:port)")
 
 	cmd.AddCommand(debugCmd)
 	AddTabCompleteFn(debugCmd, targetList)
 
+	attachHelpText := "Attach a debugger to the board for <target-name> " +
+		"without loading or resetting it, to diagnose the device in its " +
+		"current state.\nIf no target is specified, the project's default " +
+		"target is used."
+
+	attachCmd := &cobra.Command{
+		Use:   "attach [target-name]",
+		Short: "Attach debugger to running target",
+		Long:  attachHelpText,
+		Run:   attachRunCmd,
+	}
+
+	attachCmd.PersistentFlags().StringVarP(&extraJtagCmd, "extrajtagcmd", "",
+		"", "Extra commands to send to JTAG software")
+	attachCmd.PersistentFlags().BoolVarP(&noGDB_flag, "noGDB", "n", false,
+		"Do not start GDB from command line")
+	attachCmd.PersistentFlags().StringVarP(&gdbFrontend, "frontend", "", "",
+		"gdb frontend: tui, gdbgui, or a command template")
+
+	cmd.AddCommand(attachCmd)
+	AddTabCompleteFn(attachCmd, targetList)
+
+	rttHelpText := "Stream the RTT console of the board for <target-name>.\n" +
+		"If no target is specified, the project's default target is used."
+
+	rttCmd := &cobra.Command{
+		Use:   "rtt [target-name]",
+		Short: "Stream RTT console output from target",
+		Long:  rttHelpText,
+		Run:   rttRunCmd,
+	}
+
+	rttCmd.PersistentFlags().IntVarP(&rttChannel, "channel", "c", 0,
+		"RTT channel to stream")
+
+	cmd.AddCommand(rttCmd)
+	AddTabCompleteFn(rttCmd, targetList)
+
+	traceHelpText := "Capture the ITM stimulus ports of the board for " +
+		"<target-name> over SWO, and decode them to the console or a " +
+		"file.\nIf no target is specified, the project's default target " +
+		"is used."
+
+	traceCmd := &cobra.Command{
+		Use:   "trace [target-name]",
+		Short: "Capture SWO/ITM trace output from target",
+		Long:  traceHelpText,
+		Run:   traceRunCmd,
+	}
+
+	traceCmd.PersistentFlags().IntSliceVarP(&tracePorts, "port", "p",
+		[]int{0}, "ITM stimulus port to capture (may be repeated)")
+	traceCmd.PersistentFlags().IntVarP(&traceSwoFreq, "swo-freq", "", 0,
+		"SWO frequency in Hz (default: bsp.swo_freq, or 2000000)")
+	traceCmd.PersistentFlags().StringVarP(&traceFile, "file", "f", "",
+		"Write the decoded trace to a file instead of the console")
+
+	cmd.AddCommand(traceCmd)
+	AddTabCompleteFn(traceCmd, targetList)
+
+	coredumpHelpText := "Download the core dump stored on the board for " +
+		"<target-name> and convert it to an ELF core file.\nThe dump is " +
+		"read through the target's debugger backend, or over the SMP " +
+		"server on the board's serial port if --port is specified.\nIf no " +
+		"target is specified, the project's default target is used."
+
+	coredumpCmd := &cobra.Command{
+		Use:   "coredump [target-name]",
+		Short: "Download and convert a core dump from target",
+		Long:  coredumpHelpText,
+		Run:   coredumpRunCmd,
+	}
+
+	coredumpCmd.PersistentFlags().StringVarP(&loadPort, "port", "", "",
+		"Serial port of the device; download the dump over SMP")
+	coredumpCmd.PersistentFlags().IntVarP(&loadBaud, "baud", "",
+		builder.SERIAL_DFLT_BAUD, "Baud rate of the serial port")
+	coredumpCmd.PersistentFlags().BoolVarP(&coredumpGdb, "gdb", "g", false,
+		"Open the core dump in gdb")
+
+	cmd.AddCommand(coredumpCmd)
+	AddTabCompleteFn(coredumpCmd, targetList)
+
 	sizeHelpText := "Calculate the size of target components specified by " +
-		"<target-name>."
+		"<target-name>.\nIf no target is specified, the project's default " +
+		"target is used."
 
 	var ram, flash bool
 	var section string
 	sizeCmd := &cobra.Command{
-		Use:   "size <target-name>",
+		Use:   "size [target-name]",
 		Short: "Size of target components",
 		Long:  sizeHelpText,
 		Run: func(cmd *cobra.Command, args []string) {
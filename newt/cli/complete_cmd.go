@@ -104,6 +104,12 @@ func unittestList() []string {
 	})
 }
 
+func fuzzList() []string {
+	return pkgNameList(func(pack *pkg.LocalPackage) bool {
+		return pack.Type() == pkg.PACKAGE_TYPE_FUZZ
+	})
+}
+
 func mfgList() []string {
 	targetNames := pkgNameList(func(pack *pkg.LocalPackage) bool {
 		return pack.Type() == pkg.PACKAGE_TYPE_MFG
@@ -0,0 +1,133 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+)
+
+// The base target that fuzz targets are built on, if the project defines it;
+// otherwise, the unit test target is used.
+const TARGET_FUZZ_NAME = "fuzz"
+
+// Options for `newt fuzz`.
+var fuzzDuration time.Duration
+var fuzzEngine string
+var fuzzBase string
+
+func fuzzRunCmd(cmd *cobra.Command, args []string) {
+	// Arguments after "--" are passed to the fuzzing engine.
+	var engineArgs []string
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		engineArgs = args[dash:]
+		args = args[:dash]
+	}
+
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify exactly one fuzz target package"))
+	}
+
+	if fuzzEngine != builder.FUZZ_ENGINE_LIBFUZZER &&
+		fuzzEngine != builder.FUZZ_ENGINE_AFL {
+
+		NewtUsage(cmd, util.FmtNewtError(
+			"Invalid fuzzing engine \"%s\"; must be one of: %s, %s",
+			fuzzEngine, builder.FUZZ_ENGINE_LIBFUZZER,
+			builder.FUZZ_ENGINE_AFL))
+	}
+
+	proj := TryGetProject()
+
+	pack, err := proj.ResolvePackage(proj.LocalRepo(), args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if pack.Type() != pkg.PACKAGE_TYPE_FUZZ {
+		NewtUsage(cmd, util.FmtNewtError(
+			"Package \"%s\" is of type %s; must be fuzz", pack.FullName(),
+			pkg.PackageTypeNames[pack.Type()]))
+	}
+
+	baseName := fuzzBase
+	if baseName == "" {
+		baseName = TARGET_TEST_NAME
+		if ResolveTarget(TARGET_FUZZ_NAME) != nil {
+			baseName = TARGET_FUZZ_NAME
+		}
+	}
+
+	t, err := ResolveUnittestOn(baseName, pack.Name(), "")
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	b, err := builder.NewTargetTester(t, pack)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	opts := builder.FuzzOpts{
+		Engine:   fuzzEngine,
+		Duration: fuzzDuration,
+		Args:     engineArgs,
+	}
+	if err := b.Fuzz(opts); err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func AddFuzzCommands(cmd *cobra.Command) {
+	fuzzHelpText := "Build a fuzz target package for the simulator with " +
+		"sanitizers, and run a fuzzing campaign on it.  The package " +
+		"defines LLVMFuzzerTestOneInput(); the fuzzing engine provides " +
+		"main().  Seed inputs are read from the package's corpus " +
+		"directory.  The campaign's corpus and crashing inputs are kept " +
+		"in the package's bin directory.  Arguments after \"--\" are " +
+		"passed to the fuzzing engine."
+	fuzzHelpEx := "  newt fuzz encoding/cborattr/fuzz --duration 10m\n"
+	fuzzHelpEx += "  newt fuzz mgmt/fuzz --engine afl\n"
+	fuzzHelpEx += "  newt fuzz encoding/cborattr/fuzz -- -max_len=256"
+
+	fuzzCmd := &cobra.Command{
+		Use:     "fuzz <fuzz-pkg> [-- <engine-args>]",
+		Short:   "Run a fuzzing campaign on a fuzz target package",
+		Long:    fuzzHelpText,
+		Example: fuzzHelpEx,
+		Run:     fuzzRunCmd,
+	}
+
+	fuzzCmd.Flags().DurationVarP(&fuzzDuration, "duration", "d", 0,
+		"How long to fuzz (e.g., 30s, 10m); default: until interrupted")
+	fuzzCmd.Flags().StringVarP(&fuzzEngine, "engine", "",
+		builder.FUZZ_ENGINE_LIBFUZZER, "Fuzzing engine: libfuzzer or afl")
+	fuzzCmd.Flags().StringVarP(&fuzzBase, "target", "t", "",
+		"Target to build the fuzz target on; default: "+
+			"targets/fuzz if it exists, otherwise targets/unittest")
+
+	cmd.AddCommand(fuzzCmd)
+	AddTabCompleteFn(fuzzCmd, fuzzList)
+}
@@ -0,0 +1,73 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/builder"
+)
+
+func ideVSCodeRunCmd(cmd *cobra.Command, args []string) {
+	TryGetProject()
+
+	args = targetArgsOrDefault(cmd, args)
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := b.WriteVSCodeCfg(); err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func AddIdeCommands(cmd *cobra.Command) {
+	ideCmd := &cobra.Command{
+		Use:   "ide",
+		Short: "Generate IDE configuration for a target",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(ideCmd)
+
+	vscodeHelpText := "Write the VS Code launch (cortex-debug) and C/C++ " +
+		"configurations for <target-name> to the project's .vscode " +
+		"directory.\nIf no target is specified, the project's default " +
+		"target is used."
+
+	vscodeCmd := &cobra.Command{
+		Use:   "vscode [target-name]",
+		Short: "Generate VS Code configuration for a target",
+		Long:  vscodeHelpText,
+		Run:   ideVSCodeRunCmd,
+	}
+
+	ideCmd.AddCommand(vscodeCmd)
+	AddTabCompleteFn(vscodeCmd, targetList)
+}
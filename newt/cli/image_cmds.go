@@ -20,25 +20,34 @@
 package cli
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 
 	"github.com/spf13/cobra"
 
 	"github.com/apache/mynewt-artifact/image"
-	"github.com/apache/mynewt-artifact/sec"
 	"mynewt.apache.org/newt/newt/builder"
 	"mynewt.apache.org/newt/newt/imgprod"
 	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
 )
 
 var useV1 bool
 var useV2 bool
 var encKeyFilename string
+var signCmd string
+var exportPayload bool
+var compressAlg string
+var padImage bool
+var padTest bool
+var padConfirm bool
+var suitManifest bool
+var rawFilename string
 
 // @return                      keys, key ID, error
-func parseKeyArgs(args []string) ([]sec.PrivSignKey, uint8, error) {
+func parseKeyArgs(args []string) ([]newtutil.SignKey, uint8, error) {
 	if len(args) == 0 {
 		return nil, 0, nil
 	}
@@ -60,7 +69,12 @@ func parseKeyArgs(args []string) ([]sec.PrivSignKey, uint8, error) {
 		keyFilenames = args
 	}
 
-	keys, err := sec.ReadPrivSignKeys(keyFilenames)
+	cmd := signCmd
+	if cmd == "" {
+		cmd = TryGetProject().SignCmd()
+	}
+
+	keys, err := newtutil.ReadSignKeys(keyFilenames, cmd)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -68,12 +82,99 @@ func parseKeyArgs(args []string) ([]sec.PrivSignKey, uint8, error) {
 	return keys, keyId, nil
 }
 
+// signKeyArgs returns the signing keys for a target's images: those
+// specified on the command line, or if there are none, the target's
+// `target.sign_keys` setting.
+func signKeyArgs(args []string, t *target.Target) ([]string, error) {
+	if len(args) > 0 || t == nil || len(t.SignKeys) == 0 {
+		return args, nil
+	}
+
+	if useV1 && len(t.SignKeys) > 1 {
+		return nil, util.FmtNewtError(
+			"target %s specifies %d signing keys; version 1 images support "+
+				"a single signing key", t.FullName(), len(t.SignKeys))
+	}
+
+	return t.SignKeys, nil
+}
+
+// useImageV1 determines whether to produce version 1 images for a target.
+// The -1 and -2 flags take precedence over the target's `target.image_format`
+// setting.  Version 2 is the default.
+func useImageV1(cmd *cobra.Command, t *target.Target) bool {
+	if cmd.Flags().Changed("1") || cmd.Flags().Changed("2") {
+		return useV1
+	}
+
+	return t != nil && t.ImageFormat == 1
+}
+
+// applyTargetRsaPss selects RSA-PSS signatures if the target requests them
+// with the `target.rsa_pss` setting.  The --rsa-pss flag enables them
+// regardless of the target.
+func applyTargetRsaPss(t *target.Target) {
+	if t != nil && t.RsaPss {
+		image.UseRsaPss = true
+	}
+}
+
+// createRawImageRunCmd wraps the binary specified with --raw in an image.
+// The arguments are the version and signing keys; no target is involved.
+func createRawImageRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify version"))
+	}
+
+	if useV1 {
+		NewtUsage(cmd, util.NewNewtError(
+			"--raw requires version 2 of the image format"))
+	}
+	if padImage || padTest || padConfirm || suitManifest || compressAlg != "" {
+		NewtUsage(cmd, util.NewNewtError(
+			"--raw cannot be combined with --pad, --test, --confirm, --suit, "+
+				"or --compress; these require a target"))
+	}
+
+	ver, err := image.ParseVersion(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	keys, err := newtutil.ReadSignKeys(args[1:], signCmd)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	if encKeyFilename != "" {
+		if err := newtutil.CheckEncKey(encKeyFilename); err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
+	pi, err := imgprod.ProduceRaw(rawFilename, ver, keys, encKeyFilename)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if exportPayload {
+		if _, err := imgprod.ExportPayload(pi.Filename); err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+}
+
 func createImageRunCmd(cmd *cobra.Command, args []string) {
 	var verAsTimestamp bool
 	var ver image.ImageVersion
 	var err error
 
-	if len(args) < 2 {
+	if rawFilename != "" {
+		createRawImageRunCmd(cmd, args)
+		return
+	}
+
+	if len(args) < 1 {
 		NewtUsage(cmd, util.NewNewtError("Must specify target and version"))
 	}
 
@@ -81,19 +182,59 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, util.NewNewtError("Either -1, or -2, but not both"))
 	}
 
-	if !useV1 {
-		useV2 = true
-	}
-
 	TryGetProject()
 
 	targetName := args[0]
-	t := ResolveTarget(targetName)
-	if t == nil {
-		NewtUsage(cmd, util.NewNewtError("Invalid target name: "+targetName))
+	t, err := ResolveTargetArg(targetName)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	useV1 = useImageV1(cmd, t)
+	useV2 = !useV1
+
+	// --compress overrides the target's `target.image_compression` setting.
+	if compressAlg != "" {
+		t.ImageCompression = compressAlg
+	}
+	if err := imgprod.CheckCompression(t.ImageCompression); err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	// --test and --confirm populate the trailer of a padded image.
+	if padTest && padConfirm {
+		NewtUsage(cmd, util.NewNewtError(
+			"Either --test, or --confirm, but not both"))
 	}
+	padImage = padImage || padTest || padConfirm
 
-	if args[1] == "timestamp" {
+	if exportPayload {
+		if padImage {
+			NewtUsage(cmd, util.NewNewtError(
+				"--export-payload produces an unsigned image; it cannot be "+
+					"padded"))
+		}
+		if useV1 {
+			NewtUsage(cmd, util.NewNewtError(
+				"--export-payload requires version 2 of the image format"))
+		}
+		if len(args) > 2 {
+			NewtUsage(cmd, util.NewNewtError(
+				"--export-payload produces an unsigned image; signing keys "+
+					"cannot be specified"))
+		}
+	}
+
+	// The version is derived from the target's `target.image_version`
+	// setting if it is omitted or "auto".
+	verAuto := len(args) < 2 || args[1] == "auto"
+	if verAuto {
+		if t.ImageVersion == "" {
+			NewtUsage(cmd, util.FmtNewtError(
+				"Must specify version; target %s does not specify "+
+					"`target.image_version`", t.FullName()))
+		}
+	} else if args[1] == "timestamp" {
 		verAsTimestamp = true
 	} else {
 		verAsTimestamp = false
@@ -103,20 +244,55 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	var keyArgs []string
+	if len(args) > 2 {
+		keyArgs = args[2:]
+	}
+
 	b, err := builder.NewTargetBuilder(t)
 	if err != nil {
 		NewtUsage(nil, err)
 	}
 
-	keys, _, err := parseKeyArgs(args[2:])
+	// A payload is exported from an unsigned image.
+	if !exportPayload {
+		keyArgs, err = signKeyArgs(keyArgs, t)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+	}
+	keys, _, err := parseKeyArgs(keyArgs)
 	if err != nil {
 		NewtUsage(cmd, err)
 	}
+	if len(keys) > 1 {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Signing image with %d keys\n", len(keys))
+	}
+	applyTargetRsaPss(t)
+
+	if encKeyFilename == "" {
+		encKeyFilename = t.EncKeyFile
+	}
+	if encKeyFilename != "" {
+		if err := newtutil.CheckEncKey(encKeyFilename); err != nil {
+			NewtUsage(nil, err)
+		}
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Encrypting image with key %s\n", encKeyFilename)
+	}
 
 	if err := b.Build(); err != nil {
 		NewtUsage(nil, err)
 	}
 
+	if verAuto {
+		ver, err = imgprod.AutoVersion(b)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
 	if verAsTimestamp {
 		stat, err := os.Stat(b.AppBuilder.AppElfPath())
 		if err != nil {
@@ -130,6 +306,16 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 			stat.ModTime().Minute()*100 + stat.ModTime().Second())
 	}
 
+	verStr := fmt.Sprintf("%d.%d.%d.%d",
+		ver.Major, ver.Minor, ver.Rev, ver.BuildNum)
+	hookEnv := map[string]string{
+		"MYNEWT_IMAGE_VERSION": verStr,
+		"MYNEWT_IMAGE_PATH":    b.AppBuilder.AppImgPath(),
+	}
+	if err := b.RunHooks(builder.HOOK_PRE_IMAGE, hookEnv); err != nil {
+		NewtUsage(nil, err)
+	}
+
 	if useV1 {
 		err = imgprod.ProduceAllV1(b, ver, keys, encKeyFilename)
 	} else {
@@ -138,6 +324,36 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 	if err != nil {
 		NewtUsage(nil, err)
 	}
+
+	if suitManifest {
+		if _, err := imgprod.ProduceSuitManifest(b, ver); err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
+	if padImage {
+		popts := imgprod.PadOptsFromTgtBldr(b, padTest, padConfirm)
+		_, err := imgprod.PadImage(b.AppBuilder.AppImgPath(), popts)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
+	if exportPayload {
+		imgPaths := []string{b.AppBuilder.AppImgPath()}
+		if b.LoaderBuilder != nil {
+			imgPaths = append(imgPaths, b.LoaderBuilder.AppImgPath())
+		}
+		for _, path := range imgPaths {
+			if _, err := imgprod.ExportPayload(path); err != nil {
+				NewtUsage(nil, err)
+			}
+		}
+	}
+
+	if err := b.RunHooks(builder.HOOK_POST_IMAGE, hookEnv); err != nil {
+		NewtUsage(nil, err)
+	}
 }
 
 func AddImageCommands(cmd *cobra.Command) {
@@ -154,19 +370,80 @@ func AddImageCommands(cmd *cobra.Command) {
 	createImageHelpText += "To sign version 2 of the image format give private " +
 		"key as <signing-key> (no key-id needed).\n\n"
 
-	createImageHelpText += "Default image format is version 1.\n"
-
-	createImageHelpText += "To encrypt the image, specify -e passing it a public" +
-		"key\n\n"
+	createImageHelpText += "Default image format is version 2, unless the " +
+		"target selects version 1\nwith `target.image_format: 1`, e.g., " +
+		"for devices with older bootloaders.\n\n"
+
+	createImageHelpText += "If <version> is omitted or \"auto\", it is " +
+		"derived from the target's\n`target.image_version` setting: \"git\" " +
+		"uses the most recent git tag of the app,\nanything else names a " +
+		"version file.  The build number is a counter that is\nincremented " +
+		"for each image.\n\n"
+
+	createImageHelpText += "Signing keys can be RSA, EC P-256, or Ed25519 " +
+		"private keys in PEM or DER\nformat.  An EC key produces an " +
+		"ECDSA-SHA256 signature.  Ed25519 keys require\nversion 2 of the " +
+		"image format.\n\n"
+
+	createImageHelpText += "RSA keys sign version 1 images with PKCS#1 v1.5 " +
+		"unless --rsa-pss is\nspecified or the target sets " +
+		"`target.rsa_pss: 1`.\n\n"
+
+	createImageHelpText += "Each signing key adds a signature to the " +
+		"image, e.g., a development key and\na release key during key " +
+		"rotation.  If no keys are specified, the target's\n" +
+		"`target.sign_keys` setting is used.\n\n"
+
+	createImageHelpText += "A signing key can also be a PKCS#11 URI " +
+		"(pkcs11:...) or KMS key reference\n(kms:...); images are signed " +
+		"with such keys by running --sign-cmd or the\nproject's " +
+		"`project.sign_cmd` setting.\n\n"
+
+	createImageHelpText += "To sign the image elsewhere, specify " +
+		"--export-payload.  The unsigned image's\nsigned payload and its " +
+		"hash are written next to the image; attach the\nresulting " +
+		"signature with `newt image attach-sig`.\n\n"
+
+	createImageHelpText += "To reduce the size of over-the-air updates, " +
+		"specify --compress lzma2 or\nset `target.image_compression: lzma2`.  " +
+		"Compression requires the xz tool.\n\n"
+
+	createImageHelpText += "To describe the images for a standards-based " +
+		"update service, specify\n--suit.  An unsigned SUIT (CBOR) manifest " +
+		"is written alongside the app image\n(<app>.suit).\n\n"
+
+	createImageHelpText += "To flash the image directly to the secondary " +
+		"slot, specify --pad.  A\ncopy of the app image padded to the full " +
+		"slot size is written alongside\nit (<app>.padded.img).  With " +
+		"--test, the padded image's boot trailer requests\na test swap; " +
+		"with --confirm, it requests a permanent swap.\n\n"
+
+	createImageHelpText += "To wrap a binary that newt did not build, e.g., " +
+		"co-processor firmware or\nan FPGA bitstream, specify --raw <file>; " +
+		"the arguments are then the version\nand signing keys.  The image is " +
+		"written next to the binary with an .img\nextension.\n\n"
+
+	createImageHelpText += "To encrypt the image, specify -e passing it the " +
+		"device's RSA public key\n(PEM) or a base64-encoded 128-bit AES " +
+		"key.  A target can specify a default\nencryption key with the " +
+		"`target.enc_key_file` setting.\n\n"
 
 	createImageHelpEx := "  newt create-image my_target1 1.3.0\n"
 	createImageHelpEx += "  newt create-image my_target1 1.3.0.3\n"
+	createImageHelpEx += "  newt create-image my_target1 auto private.pem\n"
 	createImageHelpEx += "  newt create-image my_target1 1.3.0.3 private.pem\n"
+	createImageHelpEx += "  newt create-image my_target1 1.3.0.3 ec256.der\n"
 	createImageHelpEx +=
 		"  newt create-image -2 my_target1 1.3.0.3 private-1.pem private-2.pem\n"
+	createImageHelpEx += "  newt create-image --test my_target1 1.3.0.3 " +
+		"private.pem\n"
+	createImageHelpEx += "  newt create-image --raw fpga.bit 2.1.0 " +
+		"private.pem\n"
+	createImageHelpEx += "  newt create-image -2 --sign-cmd hsm-sign " +
+		"my_target1 1.3.0.3 \"pkcs11:token=rel;object=img\"\n"
 
 	createImageCmd := &cobra.Command{
-		Use: "create-image <target-name> <version> [signing-key-1] " +
+		Use: "create-image <target-name> [version] [signing-key-1] " +
 			"[signing-key-2] [...]",
 		Short:   "Add image header to target binary",
 		Long:    createImageHelpText,
@@ -180,13 +457,42 @@ func AddImageCommands(cmd *cobra.Command) {
 	createImageCmd.PersistentFlags().BoolVar(&image.UseRsaPss,
 		"rsa-pss", false,
 		"Use RSA-PSS instead of PKCS#1 v1.5 for RSA sig. "+
-			"Meaningful for version 1 image format.")
+			"Meaningful for version 1 image format.  Can also be "+
+			"enabled per target with target.rsa_pss.")
 	createImageCmd.PersistentFlags().BoolVarP(&useV1,
 		"1", "1", false, "Use old image header format")
 	createImageCmd.PersistentFlags().BoolVarP(&useV2,
 		"2", "2", false, "Use new image header format (default)")
 	createImageCmd.PersistentFlags().StringVarP(&encKeyFilename,
-		"encrypt", "e", "", "Encrypt image using this public key")
+		"encrypt", "e", "",
+		"Encrypt image using this public key (default: the target's "+
+			"enc_key_file)")
+	createImageCmd.PersistentFlags().StringVar(&signCmd,
+		"sign-cmd", "",
+		"Command that signs with PKCS#11 / KMS keys (default: "+
+			"project.sign_cmd)")
+	createImageCmd.PersistentFlags().StringVar(&compressAlg,
+		"compress", "",
+		"Compress the app image with this algorithm (lzma2) (default: "+
+			"the target's image_compression)")
+	createImageCmd.PersistentFlags().BoolVar(&exportPayload,
+		"export-payload", false,
+		"Export the unsigned image's signing payload for detached signing")
+	createImageCmd.PersistentFlags().StringVar(&rawFilename,
+		"raw", "",
+		"Create an image from this binary file instead of a target")
+	createImageCmd.PersistentFlags().BoolVar(&suitManifest,
+		"suit", false,
+		"Also write a SUIT manifest describing the images")
+	createImageCmd.PersistentFlags().BoolVar(&padImage,
+		"pad", false,
+		"Also write a copy of the app image padded to the slot size")
+	createImageCmd.PersistentFlags().BoolVar(&padTest,
+		"test", false,
+		"Pad the image and mark it for a test swap (implies --pad)")
+	createImageCmd.PersistentFlags().BoolVar(&padConfirm,
+		"confirm", false,
+		"Pad the image and mark it for a permanent swap (implies --pad)")
 
 	cmd.AddCommand(createImageCmd)
 	AddTabCompleteFn(createImageCmd, targetList)
@@ -204,4 +510,30 @@ func AddImageCommands(cmd *cobra.Command) {
 	}
 
 	cmd.AddCommand(resignImageCmd)
+
+	imageHelpText := "Commands for manipulating images created by " +
+		"`newt create-image`."
+	imageCmd := &cobra.Command{
+		Use:   "image",
+		Short: "Command for manipulating images",
+		Long:  imageHelpText,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	for _, c := range imageSigCmdAll() {
+		imageCmd.AddCommand(c)
+	}
+	for _, c := range imageManifestCmdAll() {
+		imageCmd.AddCommand(c)
+	}
+	for _, c := range imageCombineCmdAll() {
+		imageCmd.AddCommand(c)
+	}
+	for _, c := range imageVerifyCmdAll() {
+		imageCmd.AddCommand(c)
+	}
+
+	cmd.AddCommand(imageCmd)
 }
@@ -0,0 +1,108 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/imgprod"
+	"mynewt.apache.org/newt/util"
+)
+
+var imageCombineFs string
+var imageCombineFsArea string
+
+func imageCombineCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify target and bootloader target"))
+	}
+
+	TryGetProject()
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	bootT, err := ResolveTargetArg(args[1])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	bootB, err := builder.NewTargetBuilder(bootT)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	parts, err := imgprod.CombineParts(b, bootB, imageCombineFs,
+		imageCombineFsArea)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	binPath, err := imgprod.CombineImages(b, parts)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for _, p := range parts {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    0x%08x %-22s %8d bytes  %s\n",
+			p.Area.Offset, p.Area.Name, p.Size, p.Filename)
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Combined image successfully generated: %s\n", binPath)
+}
+
+func imageCombineCmdAll() []*cobra.Command {
+	combineHelpText := "Combine a target's bootloader and images into a " +
+		"single binary and Intel HEX\nfile for factory programming.  Each " +
+		"part is placed at the offset of its flash\narea in the BSP's flash " +
+		"map: the bootloader target's binary at\nFLASH_AREA_BOOTLOADER, and " +
+		"the target's image at FLASH_AREA_IMAGE_0 (for a\nsplit image " +
+		"target, the loader at FLASH_AREA_IMAGE_0 and the app at\n" +
+		"FLASH_AREA_IMAGE_1).  A file system image can be added with --fs.\n\n" +
+		"The bootloader target must already be built, and the target's " +
+		"images created\nwith create-image.  The output is written to the " +
+		"target's bin directory as\n<target-name>-combined.bin and " +
+		"<target-name>-combined.hex."
+	combineHelpEx := "  newt image combine my_blinky my_boot\n"
+	combineHelpEx += "  newt image combine --fs fs.bin my_blinky my_boot"
+
+	combineCmd := &cobra.Command{
+		Use:     "combine <target-name> <boot-target-name>",
+		Short:   "Combine bootloader and images for factory programming",
+		Long:    combineHelpText,
+		Example: combineHelpEx,
+		Run:     imageCombineCmd,
+	}
+	combineCmd.Flags().StringVar(&imageCombineFs, "fs", "",
+		"File system image to include")
+	combineCmd.Flags().StringVar(&imageCombineFsArea, "fs-area",
+		"FLASH_AREA_NFFS", "Flash area of the file system image")
+	AddTabCompleteFn(combineCmd, targetList)
+
+	return []*cobra.Command{combineCmd}
+}
@@ -0,0 +1,149 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/manifest"
+	"mynewt.apache.org/newt/util"
+)
+
+var imageManifestLoader bool
+var imageManifestJson bool
+
+func printImageManifest(m manifest.ImageManifest) {
+	field := func(name string, val string) {
+		if val != "" {
+			util.StatusMessage(util.VERBOSITY_QUIET, "%-12s %s\n",
+				name+":", val)
+		}
+	}
+
+	field("Target", m.Name)
+	field("Date", m.Date)
+	field("Version", m.Version)
+	field("Build ID", m.BuildID)
+	field("Image", m.Image)
+	field("Image hash", m.ImageHash)
+	field("Loader", m.Loader)
+	field("Loader hash", m.LoaderHash)
+	field("Toolchain", m.Toolchain)
+
+	if len(m.SignKeys) == 0 {
+		field("Sign keys", "(unsigned)")
+	}
+	for i, k := range m.SignKeys {
+		if i == 0 {
+			field("Sign keys", k)
+		} else {
+			field("", k)
+		}
+	}
+
+	if len(m.Repos) > 0 {
+		util.StatusMessage(util.VERBOSITY_QUIET, "Repos:\n")
+		for _, r := range m.Repos {
+			dirty := ""
+			if r.Dirty {
+				dirty = " (dirty)"
+			}
+			util.StatusMessage(util.VERBOSITY_QUIET, "    %-24s %s%s\n",
+				r.Name, r.Commit, dirty)
+		}
+	}
+
+	if len(m.Syscfg) > 0 {
+		names := make([]string, 0, len(m.Syscfg))
+		for name := range m.Syscfg {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		util.StatusMessage(util.VERBOSITY_QUIET, "Syscfg:\n")
+		for _, name := range names {
+			util.StatusMessage(util.VERBOSITY_QUIET, "    %s=%s\n",
+				name, m.Syscfg[name])
+		}
+	}
+}
+
+func imageManifestCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify image or target"))
+	}
+
+	imgPath, err := imageArgPath(args[0], imageManifestLoader)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	mpath := filepath.Dir(imgPath) + "/manifest.json"
+	if util.NodeNotExist(mpath) {
+		NewtUsage(nil, util.FmtNewtError(
+			"no manifest alongside image %s", imgPath))
+	}
+
+	m, err := manifest.ReadImageManifest(mpath)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if imageManifestJson {
+		if _, err := m.Write(os.Stdout); err != nil {
+			NewtUsage(nil, err)
+		}
+		util.StatusMessage(util.VERBOSITY_QUIET, "\n")
+		return
+	}
+
+	printImageManifest(m)
+}
+
+func imageManifestCmdAll() []*cobra.Command {
+	manifestHelpText := "Display the manifest that was generated alongside " +
+		"an image.  The image is either\nan image file or the name of a " +
+		"target, in which case the target's app (or\nloader) image is used.  " +
+		"The manifest records the image hash and version, the\nkeys the " +
+		"image is signed with, the syscfg values, the repo commits, and the\n" +
+		"toolchain that the image was built with."
+	manifestHelpEx := "  newt image manifest my_target1\n"
+	manifestHelpEx += "  newt image manifest --json " +
+		"bin/targets/my_target1/app/apps/blinky/blinky.img"
+
+	manifestCmd := &cobra.Command{
+		Use:     "manifest <image-file | target-name>",
+		Short:   "Display an image's manifest",
+		Long:    manifestHelpText,
+		Example: manifestHelpEx,
+		Run:     imageManifestCmd,
+	}
+	manifestCmd.Flags().BoolVar(&imageManifestLoader, "loader", false,
+		"Display the manifest of the target's loader image")
+	manifestCmd.Flags().BoolVar(&imageManifestJson, "json", false,
+		"Display the manifest as JSON")
+	AddTabCompleteFn(manifestCmd, targetList)
+
+	return []*cobra.Command{manifestCmd}
+}
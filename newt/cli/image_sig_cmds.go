@@ -0,0 +1,147 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/imgprod"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+var attachSigLoader bool
+
+// imageArgPath resolves a `newt image` argument to an image file.  The
+// argument is either the path of an image file or the name of a target, in
+// which case the target's app (or loader) image is used.
+func imageArgPath(arg string, loader bool) (string, error) {
+	if util.NodeExist(arg) {
+		return arg, nil
+	}
+
+	TryGetProject()
+
+	t, err := ResolveTargetArg(arg)
+	if err != nil {
+		return "", util.FmtNewtError(
+			"\"%s\" is neither an image file nor a target", arg)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		return "", err
+	}
+
+	if !loader {
+		return b.AppBuilder.AppImgPath(), nil
+	}
+	if b.LoaderBuilder == nil {
+		return "", util.FmtNewtError("target %s does not have a loader",
+			t.FullName())
+	}
+
+	return b.LoaderBuilder.AppImgPath(), nil
+}
+
+// readSigFile reads a detached signature.  The file contains either the raw
+// signature or its base64 encoding.
+func readSigFile(filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, util.FmtNewtError("Error reading signature file: %s",
+			err.Error())
+	}
+
+	if sig, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(data))); err == nil {
+
+		return sig, nil
+	}
+
+	return data, nil
+}
+
+func imageAttachSigCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 3 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify image, signature file, and public key"))
+	}
+
+	imgPath, err := imageArgPath(args[0], attachSigLoader)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	sig, err := readSigFile(args[1])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	pubData, err := ioutil.ReadFile(args[2])
+	if err != nil {
+		NewtUsage(nil, util.FmtNewtError("Error reading key file: %s",
+			err.Error()))
+	}
+	pub, err := newtutil.ParsePubSignKey(pubData)
+	if err != nil {
+		NewtUsage(nil, util.FmtNewtError("%s: %s", args[2],
+			err.(*util.NewtError).Text))
+	}
+
+	if err := imgprod.AttachSig(imgPath, pub, sig); err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func imageSigCmdAll() []*cobra.Command {
+	attachSigHelpText := "Attach a detached signature to an image.  The " +
+		"image is either an image file\nor a target's image created with " +
+		"`newt create-image --export-payload`.\nThe signature covers the " +
+		"exported payload's SHA256 hash; it can be raw or\nbase64-encoded.  " +
+		"The public key (PEM) identifies the signing key and is used\nto " +
+		"verify the signature before it is added.  RSA signatures must use " +
+		"RSASSA-PSS;\nEC signatures must be ASN.1 DER encoded."
+	attachSigHelpEx := "  newt image attach-sig my_target1 app.sig " +
+		"release-pub.pem\n"
+	attachSigHelpEx += "  newt image attach-sig --loader my_target1 " +
+		"loader.sig release-pub.pem\n"
+	attachSigHelpEx += "  newt image attach-sig blinky.img blinky.sig " +
+		"release-pub.pem"
+
+	attachSigCmd := &cobra.Command{
+		Use: "attach-sig <image-file | target-name> <signature-file> " +
+			"<public-key>",
+		Short:   "Attach a detached signature to an image",
+		Long:    attachSigHelpText,
+		Example: attachSigHelpEx,
+		Run:     imageAttachSigCmd,
+	}
+	attachSigCmd.Flags().BoolVar(&attachSigLoader, "loader", false,
+		"Attach the signature to the target's loader image")
+	AddTabCompleteFn(attachSigCmd, targetList)
+
+	return []*cobra.Command{attachSigCmd}
+}
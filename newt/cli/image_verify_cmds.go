@@ -0,0 +1,158 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/imgprod"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+var imageVerifyLoader bool
+
+// The number of bytes of TLV data to display.
+const IMAGE_VERIFY_MAX_TLV_DATA = 32
+
+func printImageCheck(ic imgprod.ImageCheck) {
+	hdr := ic.Image.Header
+	v := hdr.Vers
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "Header:\n")
+	util.StatusMessage(util.VERBOSITY_QUIET, "    %-12s 0x%08x\n",
+		"magic:", hdr.Magic)
+	util.StatusMessage(util.VERBOSITY_QUIET, "    %-12s %d\n",
+		"header size:", hdr.HdrSz)
+	util.StatusMessage(util.VERBOSITY_QUIET, "    %-12s %d\n",
+		"image size:", hdr.ImgSz)
+	util.StatusMessage(util.VERBOSITY_QUIET, "    %-12s 0x%08x (%s)\n",
+		"flags:", hdr.Flags, imgprod.ImageFlagsString(hdr.Flags))
+	util.StatusMessage(util.VERBOSITY_QUIET, "    %-12s %d.%d.%d.%d\n",
+		"version:", v.Major, v.Minor, v.Rev, v.BuildNum)
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "TLVs:\n")
+	for _, tlv := range ic.Image.Tlvs {
+		data := fmt.Sprintf("%x", tlv.Data)
+		if len(tlv.Data) > IMAGE_VERIFY_MAX_TLV_DATA {
+			data = fmt.Sprintf("%x...",
+				tlv.Data[:IMAGE_VERIFY_MAX_TLV_DATA])
+		}
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"    0x%02x %-16s len=%-5d %s\n", tlv.Header.Type,
+			imgprod.ImageTlvName(tlv.Header.Type), len(tlv.Data), data)
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "Verification:\n")
+	if ic.HashSkipped != "" {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"    hash:        not checked (%s)\n", ic.HashSkipped)
+	} else if ic.HashValid {
+		util.StatusMessage(util.VERBOSITY_QUIET, "    hash:        OK (%x)\n",
+			ic.ComputedHash)
+	} else {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"    hash:        MISMATCH (computed %x)\n", ic.ComputedHash)
+	}
+
+	if len(ic.Sigs) == 0 {
+		util.StatusMessage(util.VERBOSITY_QUIET, "    signatures:  none\n")
+	}
+	for _, sc := range ic.Sigs {
+		result := "no matching public key"
+		if sc.KeyKnown && sc.Valid {
+			result = "OK"
+		} else if sc.KeyKnown {
+			result = "INVALID"
+		}
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"    signature:   %s key=%x: %s\n",
+			imgprod.ImageTlvName(sc.TlvType), sc.KeyHash, result)
+	}
+}
+
+func imageVerifyCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify image or target"))
+	}
+
+	imgPath, err := imageArgPath(args[0], imageVerifyLoader)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	var pubs []interface{}
+	for _, filename := range args[1:] {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			NewtUsage(nil, util.FmtNewtError("Error reading key file: %s",
+				err.Error()))
+		}
+		pub, err := newtutil.ParsePubSignKey(data)
+		if err != nil {
+			NewtUsage(nil, util.FmtNewtError("%s: %s", filename,
+				err.(*util.NewtError).Text))
+		}
+		pubs = append(pubs, pub)
+	}
+
+	ic, err := imgprod.VerifyImage(imgPath, pubs)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	printImageCheck(ic)
+
+	if !ic.Ok(len(pubs)) {
+		NewtUsage(nil, util.FmtNewtError("image %s failed verification",
+			imgPath))
+	}
+}
+
+func imageVerifyCmdAll() []*cobra.Command {
+	verifyHelpText := "Parse an image and check its header, hash, and " +
+		"signatures.  The image is either\nan image file or the name of a " +
+		"target, in which case the target's app (or\nloader) image is used.  " +
+		"The decoded header and TLVs are displayed.\n\n" +
+		"Each signature is checked against the specified public keys (PEM).  " +
+		"The command\nfails if the image hash is wrong, if a signature made " +
+		"by one of the keys is\ninvalid, or if keys are specified and none " +
+		"of them signed the image.\n\n" +
+		"The hash of an encrypted image or a split app image cannot be " +
+		"computed from the\nimage alone; it is reported as not checked."
+	verifyHelpEx := "  newt image verify my_target1\n"
+	verifyHelpEx += "  newt image verify blinky.img release-pub.pem"
+
+	verifyCmd := &cobra.Command{
+		Use:     "verify <image-file | target-name> [public-key...]",
+		Short:   "Check an image's hash and signatures",
+		Long:    verifyHelpText,
+		Example: verifyHelpEx,
+		Run:     imageVerifyCmd,
+	}
+	verifyCmd.Flags().BoolVar(&imageVerifyLoader, "loader", false,
+		"Verify the target's loader image")
+	AddTabCompleteFn(verifyCmd, targetList)
+
+	return []*cobra.Command{verifyCmd}
+}
@@ -27,6 +27,7 @@ import (
 
 	"github.com/apache/mynewt-artifact/image"
 	"mynewt.apache.org/newt/newt/mfg"
+	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/util"
 )
@@ -113,8 +114,12 @@ func mfgCreateRunCmd(cmd *cobra.Command, args []string) {
 	if err != nil {
 		NewtUsage(nil, err)
 	}
+	if len(newtutil.NewtSignKeys(keys)) > 0 {
+		NewtUsage(nil, util.NewNewtError(
+			"external keys cannot sign manufacturing images"))
+	}
 
-	me, err := mfg.LoadMfgEmitter(lpkg, ver, keys)
+	me, err := mfg.LoadMfgEmitter(lpkg, ver, newtutil.SecSignKeys(keys))
 	if err != nil {
 		NewtUsage(nil, err)
 	}
@@ -24,10 +24,12 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/mock"
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
@@ -35,6 +37,8 @@ import (
 )
 
 var NewTypeStr = "pkg"
+var MockStyleStr = "weak"
+var MockProviderName string
 
 func pkgNewCmd(cmd *cobra.Command, args []string) {
 
@@ -116,17 +120,15 @@ func pkgCloneOrMoveCmd(cmd *cobra.Command, args []string, dirOpFn dirOperation,
 		NewtUsage(cmd, err)
 	}
 
-	dstPath := proj.Path() + "/"
 	repo := proj.LocalRepo()
 	if repoName != "" {
-		dstPath += "repos/" + repoName + "/"
 		repo = proj.FindRepo(repoName)
 		if repo == nil {
 			NewtUsage(cmd, util.NewNewtError("Destination repo "+
 				repoName+" does not exist"))
 		}
 	}
-	dstPath += pkgName + "/"
+	dstPath := repo.Path() + "/" + pkgName + "/"
 
 	if util.NodeExist(dstPath) {
 		NewtUsage(cmd, util.NewNewtError("Cannot overwrite existing package, "+
@@ -211,6 +213,107 @@ func pkgRemoveCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Finds the packages that provide the specified API.  If a provider name is
+// specified, only that package is considered.
+func apiProviders(proj *project.Project, api string,
+	providerName string) []*pkg.LocalPackage {
+
+	lpkgs := []*pkg.LocalPackage{}
+	for _, p := range proj.PackagesOfType(-1) {
+		lpkg := p.(*pkg.LocalPackage)
+		if providerName != "" && lpkg.FullName() != providerName &&
+			lpkg.Name() != providerName {
+
+			continue
+		}
+
+		for _, a := range lpkg.PkgY.GetValStringSlice("pkg.apis", nil) {
+			if a == api {
+				lpkgs = append(lpkgs, lpkg)
+				break
+			}
+		}
+	}
+
+	sort.Slice(lpkgs, func(i int, j int) bool {
+		return lpkgs[i].FullName() < lpkgs[j].FullName()
+	})
+
+	return lpkgs
+}
+
+func pkgMockCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Exactly two arguments required: <api> <dst-pkg>"))
+	}
+
+	api := args[0]
+	dstLoc := args[1]
+
+	style, err := mock.ParseStyle(MockStyleStr)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	proj := TryGetProject()
+	interfaces.SetProject(proj)
+
+	providers := apiProviders(proj, api, MockProviderName)
+	if len(providers) == 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"No package provides API \"%s\"", api))
+	}
+	if len(providers) > 1 {
+		names := make([]string, len(providers))
+		for i, p := range providers {
+			names[i] = p.FullName()
+		}
+		NewtUsage(cmd, util.FmtNewtError(
+			"API \"%s\" has multiple providers: %s; "+
+				"use --provider to select one", api,
+			strings.Join(names, ", ")))
+	}
+	provider := providers[0]
+
+	repoName, pkgName, err := newtutil.ParsePackageString(dstLoc)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	repo := proj.LocalRepo()
+	if repoName != "" {
+		repo = proj.FindRepo(repoName)
+		if repo == nil {
+			NewtUsage(cmd, util.NewNewtError("Destination repo "+
+				repoName+" does not exist"))
+		}
+	}
+	dstPath := repo.Path() + "/" + pkgName
+
+	hdrs, err := mock.FindHeaders(provider.BasePath())
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if len(hdrs) == 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"Package %s has no headers to mock", provider.FullName()))
+	}
+
+	m, err := mock.NewMock(api, provider.FullName(), pkgName, style, hdrs)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := m.Write(dstPath); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Generated %s mock package %s from %s (%d functions)\n",
+		style.String(), dstLoc, provider.FullName(), len(m.Funcs))
+}
+
 func AddPackageCommands(cmd *cobra.Command) {
 	/* Add the base package command, on top of which other commands are
 	 * keyed
@@ -285,4 +388,33 @@ func AddPackageCommands(cmd *cobra.Command) {
 	}
 
 	pkgCmd.AddCommand(removeCmd)
+
+	mockCmdHelpText := "Generate a stub package <dst-pkg> that provides " +
+		"<api>.  Stubs are generated for each function declared in the " +
+		"headers of the package that provides the API.  Unit tests can " +
+		"depend on the stub package in place of the real provider, so " +
+		"that testing a mid-layer package does not pull in the whole " +
+		"driver stack.\n\n" +
+		"With --style=weak, each stub is a weak function returning zero; " +
+		"a test overrides a stub by defining the function itself.  With " +
+		"--style=fptr, each function <fn> calls through the pointer " +
+		"<fn>_mock if it is set, and counts its calls in <fn>_mock_calls."
+	mockCmdHelpEx := "  newt pkg mock log test/mock/log_mock\n"
+	mockCmdHelpEx += "  newt pkg mock --style=fptr --provider=hw/hal " +
+		"hal test/mock/hal_mock"
+
+	mockCmd := &cobra.Command{
+		Use:     "mock <api> <dst-pkg>",
+		Short:   "Generate a stub package for an API",
+		Long:    mockCmdHelpText,
+		Example: mockCmdHelpEx,
+		Run:     pkgMockCmd,
+	}
+
+	mockCmd.PersistentFlags().StringVarP(&MockStyleStr, "style", "",
+		"weak", "Stub style: weak or fptr")
+	mockCmd.PersistentFlags().StringVarP(&MockProviderName, "provider", "",
+		"", "Package to mock, if several provide the API")
+
+	pkgCmd.AddCommand(mockCmd)
 }
@@ -20,20 +20,72 @@
 package cli
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/install"
 	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/newt/toolchain"
 	"mynewt.apache.org/newt/util"
 )
 
 var infoRemote bool
+var upgradeDryRun bool
+var vendorForce bool
+var newTemplate string
+
+// Resolves a `newt new` template specifier to a downloader and the commit to
+// check out.  A specifier is one of:
+//     * "blinky" (default): the apache/mynewt-blinky skeleton.
+//     * The name of a template defined in the `project_templates` section of
+//       $HOME/.newt/newtrc.yml.  Each entry has a "url" and an optional
+//       "commit" (default: master).
+//     * A git URL.
+//
+// @return downloader.Downloader    The downloader for the template, or nil if
+//                                      the specifier isn't a remote template.
+// @return string                   The commit to check out.
+func templateDownloader(tmpl string) (downloader.Downloader, string) {
+	if tmpl == "" || tmpl == "blinky" {
+		dl := downloader.NewGithubDownloader()
+		dl.User = "apache"
+		dl.Repo = "mynewt-blinky"
+		return dl, newtutil.NewtBlinkyTag
+	}
+
+	newtrc := settings.Newtrc()
+	entry := newtrc.GetValStringMapString("project_templates."+tmpl, nil)
+	if entry != nil && entry["url"] != "" {
+		dl := downloader.NewGitDownloader()
+		dl.Url = entry["url"]
+
+		commit := entry["commit"]
+		if commit == "" {
+			commit = "master"
+		}
+		return dl, commit
+	}
+
+	if strings.Contains(tmpl, "://") || strings.HasPrefix(tmpl, "git@") ||
+		strings.HasSuffix(tmpl, ".git") {
+
+		dl := downloader.NewGitDownloader()
+		dl.Url = tmpl
+		return dl, "master"
+	}
+
+	return nil, ""
+}
 
 func newRunCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
@@ -48,20 +100,33 @@ func newRunCmd(cmd *cobra.Command, args []string) {
 			"directory already exists"))
 	}
 
-	util.StatusMessage(util.VERBOSITY_DEFAULT, "Downloading "+
-		"project skeleton from apache/mynewt-blinky...\n")
-	dl := downloader.NewGithubDownloader()
-	dl.User = "apache"
-	dl.Repo = "mynewt-blinky"
-
 	tmpdir, err := newtutil.MakeTempRepoDir()
 	if err != nil {
 		NewtUsage(nil, err)
 	}
 	defer os.RemoveAll(tmpdir)
 
-	if err := dl.Clone(newtutil.NewtBlinkyTag, tmpdir); err != nil {
-		NewtUsage(nil, err)
+	dl, commit := templateDownloader(newTemplate)
+	if dl != nil {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Downloading "+
+			"project skeleton from %s...\n", newTemplateName(newTemplate))
+
+		if err := dl.Clone(commit, tmpdir); err != nil {
+			NewtUsage(nil, err)
+		}
+	} else if util.NodeExist(newTemplate) {
+		// The template is a local directory.
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Copying "+
+			"project skeleton from %s...\n", newTemplate)
+
+		if err := util.CopyDir(newTemplate, tmpdir); err != nil {
+			NewtUsage(nil, err)
+		}
+	} else {
+		NewtUsage(cmd, util.FmtNewtError(
+			"Unknown project template \"%s\"; must be a git URL, a local "+
+				"directory, or a template defined in newtrc.yml",
+			newTemplate))
 	}
 
 	util.StatusMessage(util.VERBOSITY_DEFAULT, "Installing "+
@@ -75,10 +140,62 @@ func newRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, err)
 	}
 
+	if err := gitignoreLocalFile(newDir); err != nil {
+		NewtUsage(cmd, err)
+	}
+
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
 		"Project %s successfully created.\n", newDir)
 }
 
+// Adds the machine-specific project override file and the deleted target
+// directory to a new project's `.gitignore` file.
+func gitignoreLocalFile(dir string) error {
+	path := dir + "/.gitignore"
+
+	present := map[string]bool{}
+	var lines []string
+	if util.NodeExist(path) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		for _, line := range lines {
+			present[strings.TrimSpace(line)] = true
+		}
+	}
+
+	added := false
+	for _, name := range []string{
+		project.PROJECT_LOCAL_FILE_NAME, TARGET_TRASH_DIR,
+	} {
+		if !present[name] {
+			lines = append(lines, name)
+			added = true
+		}
+	}
+	if !added {
+		return nil
+	}
+
+	s := strings.Join(lines, "\n") + "\n"
+	if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+func newTemplateName(tmpl string) string {
+	if tmpl == "" || tmpl == "blinky" {
+		return "apache/mynewt-blinky"
+	}
+
+	return tmpl
+}
+
 // Builds a repo selection predicate based on the specified names.  If no names
 // are specified, the resulting function selects all non-local repos.
 // Otherwise, the function selects each non-local repo whose name is specified.
@@ -93,7 +210,7 @@ func makeRepoPredicate(repoNames []string) func(r *repo.Repo) bool {
 	return func(r *repo.Repo) bool {
 		if !r.IsLocal() {
 			for _, arg := range repoNames {
-				if strings.TrimPrefix(r.Name(), "@") == arg {
+				if r.Name() == strings.TrimPrefix(arg, "@") {
 					return true
 				}
 			}
@@ -102,14 +219,37 @@ func makeRepoPredicate(repoNames []string) func(r *repo.Repo) bool {
 	}
 }
 
+// Ensures each specified name corresponds to a non-local repo in the project.
+func verifyRepoNames(proj *project.Project, repoNames []string) error {
+	for _, name := range repoNames {
+		r := proj.FindRepo(strings.TrimPrefix(name, "@"))
+		if r == nil || r.IsLocal() {
+			return util.FmtNewtError("unknown repo: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// Builds the set of upgrade options from the command line.
+func upgradeOpts() install.UpgradeOpts {
+	return install.UpgradeOpts{
+		Force:  newtutil.NewtForce,
+		Ask:    newtutil.NewtAsk,
+		DryRun: upgradeDryRun,
+	}
+}
+
 func installRunCmd(cmd *cobra.Command, args []string) {
 	proj := TryGetProject()
 	interfaces.SetProject(proj)
 
-	pred := makeRepoPredicate(args)
-	if err := proj.UpgradeIf(
-		newtutil.NewtForce, newtutil.NewtAsk, pred); err != nil {
+	if err := verifyRepoNames(proj, args); err != nil {
+		NewtUsage(cmd, err)
+	}
 
+	pred := makeRepoPredicate(args)
+	if err := proj.UpgradeIf(upgradeOpts(), pred); err != nil {
 		NewtUsage(nil, err)
 	}
 }
@@ -118,24 +258,102 @@ func upgradeRunCmd(cmd *cobra.Command, args []string) {
 	proj := TryGetProject()
 	interfaces.SetProject(proj)
 
-	pred := makeRepoPredicate(args)
-	if err := proj.UpgradeIf(
-		newtutil.NewtForce, newtutil.NewtAsk, pred); err != nil {
+	if err := verifyRepoNames(proj, args); err != nil {
+		NewtUsage(cmd, err)
+	}
 
+	// If the user named specific repos, all other installed repos are left at
+	// their current versions.
+	opts := upgradeOpts()
+	opts.PinUnselected = len(args) > 0
+
+	pred := makeRepoPredicate(args)
+	if err := proj.UpgradeIf(opts, pred); err != nil {
 		NewtUsage(nil, err)
 	}
 }
 
+// Prints the project's targets, one per line, along with each target's app and
+// BSP.
+func printTargetInfo() {
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Targets:\n")
+
+	names := targetList()
+	if len(names) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    (none)\n")
+	}
+
+	for _, name := range names {
+		t := ResolveTarget(name)
+		if t == nil {
+			continue
+		}
+
+		s := fmt.Sprintf("    * %s", name)
+		if t.AppName != "" {
+			s += fmt.Sprintf(" (app: %s, bsp: %s)", t.AppName, t.BspName)
+		} else {
+			s += fmt.Sprintf(" (bsp: %s)", t.BspName)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", s)
+	}
+}
+
+// Prints each compiler package in the project along with the version of the
+// compiler it invokes on this machine.
+func printToolchainInfo() {
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Toolchains:\n")
+
+	packs := project.GetProject().PackagesOfType(pkg.PACKAGE_TYPE_COMPILER)
+	names := make([]string, 0, len(packs))
+	dirs := map[string]string{}
+	for _, pack := range packs {
+		names = append(names, pack.FullName())
+		dirs[pack.FullName()] = pack.BasePath()
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    (none)\n")
+	}
+
+	for _, name := range names {
+		s := fmt.Sprintf("    * %s: ", name)
+
+		cc, ver, err := toolchain.CompilerVersion(dirs[name], "default")
+		if err != nil {
+			s += fmt.Sprintf("unknown (%s)", err.Error())
+		} else if cc == "" {
+			s += "not supported on this OS"
+		} else if ver == "" {
+			s += fmt.Sprintf("%s (not found)", cc)
+		} else {
+			s += ver
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", s)
+	}
+}
+
 func infoRunCmd(cmd *cobra.Command, args []string) {
 	proj := TryGetProject()
 
-	// If no arguments specified, print status of all installed repos.
+	// If no arguments specified, print a snapshot of the whole project.
 	if len(args) == 0 {
-		pred := func(r *repo.Repo) bool { return !r.IsLocal() }
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Project: %s (%s)\n",
+			proj.Name(), proj.Path())
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Newt version: %s (git hash: %s, build date: %s)\n",
+			newtutil.NewtVersionStr, newtutil.NewtGitHash,
+			newtutil.NewtDate)
 
+		pred := func(r *repo.Repo) bool { return !r.IsLocal() }
 		if err := proj.InfoIf(pred, infoRemote); err != nil {
 			NewtUsage(nil, err)
 		}
+
+		printTargetInfo()
+		printToolchainInfo()
 		return
 	}
 
@@ -181,11 +399,44 @@ func infoRunCmd(cmd *cobra.Command, args []string) {
 
 func syncRunCmd(cmd *cobra.Command, args []string) {
 	proj := TryGetProject()
+
+	if err := verifyRepoNames(proj, args); err != nil {
+		NewtUsage(cmd, err)
+	}
+
 	pred := makeRepoPredicate(args)
+	if err := proj.UpgradeIf(upgradeOpts(), pred); err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func statusRunCmd(cmd *cobra.Command, args []string) {
+	proj := TryGetProject()
+	interfaces.SetProject(proj)
+
+	if err := verifyRepoNames(proj, args); err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	pred := func(r *repo.Repo) bool { return !r.IsLocal() }
+	if len(args) > 0 {
+		pred = makeRepoPredicate(args)
+	}
+
+	if err := proj.StatusIf(pred); err != nil {
+		NewtUsage(nil, err)
+	}
+}
 
-	if err := proj.UpgradeIf(
-		newtutil.NewtForce, newtutil.NewtAsk, pred); err != nil {
+func vendorRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		NewtUsage(cmd, util.NewNewtError("vendor takes no arguments"))
+	}
+
+	proj := TryGetProject()
+	interfaces.SetProject(proj)
 
+	if err := proj.Vendor(vendorForce); err != nil {
 		NewtUsage(nil, err)
 	}
 }
@@ -216,7 +467,12 @@ func AddProjectCommands(cmd *cobra.Command) {
 	upgradeHelpEx := "  newt upgrade\n"
 	upgradeHelpEx += "    Upgrades all repositories specified in project.yml.\n\n"
 	upgradeHelpEx += "  newt upgrade apache-mynewt-core\n"
-	upgradeHelpEx += "    Upgrades the apache-mynewt-core repository."
+	upgradeHelpEx += "    Upgrades the apache-mynewt-core repository; all " +
+		"other repositories\n"
+	upgradeHelpEx += "    remain at their installed versions.\n\n"
+	upgradeHelpEx += "  newt upgrade --dry-run\n"
+	upgradeHelpEx += "    Shows which repositories would be upgraded " +
+		"without changing anything."
 	upgradeCmd := &cobra.Command{
 		Use:     "upgrade [repo-1] [repo-2] [...]",
 		Short:   "Upgrade project dependencies",
@@ -229,6 +485,9 @@ func AddProjectCommands(cmd *cobra.Command) {
 		"Force upgrade of the repositories to latest state in project.yml")
 	upgradeCmd.PersistentFlags().BoolVarP(&newtutil.NewtAsk,
 		"ask", "a", false, "Prompt user before upgrading any repos")
+	upgradeCmd.PersistentFlags().BoolVarP(&upgradeDryRun,
+		"dry-run", "n", false,
+		"Display the changes that would be made without upgrading any repos")
 
 	cmd.AddCommand(upgradeCmd)
 
@@ -236,7 +495,10 @@ func AddProjectCommands(cmd *cobra.Command) {
 	syncHelpEx := "  newt sync\n"
 	syncHelpEx += "    Syncs all repositories specified in project.yml.\n\n"
 	syncHelpEx += "  newt sync apache-mynewt-core\n"
-	syncHelpEx += "    Syncs the apache-mynewt-core repository."
+	syncHelpEx += "    Syncs the apache-mynewt-core repository.\n\n"
+	syncHelpEx += "  newt sync --dry-run\n"
+	syncHelpEx += "    Lists each repository's current and target commits " +
+		"without syncing."
 	syncCmd := &cobra.Command{
 		Use:        "sync [repo-1] [repo-2] [...]",
 		Deprecated: "use \"upgrade\" instead",
@@ -249,10 +511,27 @@ func AddProjectCommands(cmd *cobra.Command) {
 		"Force overwrite of existing remote repositories.")
 	syncCmd.PersistentFlags().BoolVarP(&newtutil.NewtAsk,
 		"ask", "a", false, "Prompt user before syncing any repos")
+	syncCmd.PersistentFlags().BoolVarP(&upgradeDryRun,
+		"dry-run", "n", false,
+		"Display the changes that would be made without syncing any repos")
 	cmd.AddCommand(syncCmd)
 
-	newHelpText := ""
-	newHelpEx := ""
+	newHelpText := "Create a new project from a skeleton.  By default, the " +
+		"apache/mynewt-blinky\nskeleton is used.  A different skeleton can be " +
+		"specified with --template;\nthe template is a git URL, a local " +
+		"directory, or the name of an entry in\nthe project_templates section " +
+		"of ~/.newt/newtrc.yml:\n\n" +
+		"    project_templates:\n" +
+		"        acme:\n" +
+		"            url: https://git.example.com/acme/project-skeleton.git\n" +
+		"            commit: v1.0.0"
+	newHelpEx := "  newt new myproj\n"
+	newHelpEx += "    Creates myproj from the default blinky skeleton.\n\n"
+	newHelpEx += "  newt new myproj --template acme\n"
+	newHelpEx += "    Creates myproj from the \"acme\" template in newtrc.yml.\n\n"
+	newHelpEx += "  newt new myproj --template " +
+		"https://git.example.com/acme/project-skeleton.git\n"
+	newHelpEx += "    Creates myproj from the specified git repository."
 	newCmd := &cobra.Command{
 		Use:     "new <project-dir>",
 		Short:   "Create a new project",
@@ -260,11 +539,19 @@ func AddProjectCommands(cmd *cobra.Command) {
 		Example: newHelpEx,
 		Run:     newRunCmd,
 	}
+	newCmd.PersistentFlags().StringVarP(&newTemplate,
+		"template", "t", "",
+		"Project skeleton to use (git URL, directory, or newtrc template name)")
 
 	cmd.AddCommand(newCmd)
 
-	infoHelpText := "Show information about the current project."
+	infoHelpText := "Show information about the current project: the newt " +
+		"version, the state of\neach repository, the targets, and the " +
+		"installed toolchains.  This is useful\nto include in bug " +
+		"reports.\n\nIf a repository name is specified, list the " +
+		"packages it contains instead."
 	infoHelpEx := "  newt info\n"
+	infoHelpEx += "  newt info apache-mynewt-core\n"
 
 	infoCmd := &cobra.Command{
 		Use:     "info",
@@ -278,4 +565,48 @@ func AddProjectCommands(cmd *cobra.Command) {
 		"Fetch latest repos to determine if upgrades are required")
 
 	cmd.AddCommand(infoCmd)
+
+	statusHelpText := "Show the version control state of each repository: " +
+		"its installed version,\nchecked out commit and branch, and whether " +
+		"it contains local changes or\nunpushed commits.  Repositories with " +
+		"local changes or unpushed commits block\n`newt upgrade` unless the " +
+		"-f (force) option is specified, in which case the\nchanges are " +
+		"saved (git stash or a backup branch) before upgrading."
+	statusHelpEx := "  newt status\n"
+	statusHelpEx += "    Shows the state of all repositories.\n\n"
+	statusHelpEx += "  newt status apache-mynewt-core\n"
+	statusHelpEx += "    Shows the state of the apache-mynewt-core repository."
+
+	statusCmd := &cobra.Command{
+		Use:     "status [repo-1] [repo-2] [...]",
+		Short:   "Show repository version control state",
+		Long:    statusHelpText,
+		Example: statusHelpEx,
+		Run:     statusRunCmd,
+	}
+
+	cmd.AddCommand(statusCmd)
+
+	vendorHelpText := "Copy all installed repositories into the project's " +
+		"vendor directory and\nrewrite project.yml to use the copies.  " +
+		"Version control metadata is\nremoved from the copies, so the " +
+		"project can be committed as a single\nself-contained tree."
+	vendorHelpEx := "  newt vendor\n"
+	vendorHelpEx += "    Vendors all installed repositories.\n\n"
+	vendorHelpEx += "  newt vendor -f\n"
+	vendorHelpEx += "    Vendors all installed repositories, overwriting " +
+		"any existing copies."
+
+	vendorCmd := &cobra.Command{
+		Use:     "vendor",
+		Short:   "Copy project dependencies into the project tree",
+		Long:    vendorHelpText,
+		Example: vendorHelpEx,
+		Run:     vendorRunCmd,
+	}
+	vendorCmd.PersistentFlags().BoolVarP(&vendorForce,
+		"force", "f", false,
+		"Overwrite previously vendored repositories")
+
+	cmd.AddCommand(vendorCmd)
 }
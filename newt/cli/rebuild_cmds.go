@@ -0,0 +1,331 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	amanifest "github.com/apache/mynewt-artifact/manifest"
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/install"
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/manifest"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+// Options for `newt rebuild`.
+var rebuildManifestPath string
+var rebuildDir string
+
+// manifestRepoMap indexes the repos recorded in a build manifest by name.
+// An error is reported if the commit of any repo is unknown.
+func manifestRepoMap(man amanifest.Manifest) (
+	map[string]*amanifest.ManifestRepo, error) {
+
+	m := map[string]*amanifest.ManifestRepo{}
+	for _, r := range man.Repos {
+		if r.Commit == "" || r.Commit == "UNKNOWN" {
+			return nil, util.FmtNewtError(
+				"manifest does not record the commit of repo \"%s\"; the "+
+					"build cannot be reproduced", r.Name)
+		}
+		if r.Dirty {
+			util.OneTimeWarning(
+				"repo \"%s\" had uncommitted changes when the image was "+
+					"built; the rebuild may differ", r.Name)
+		}
+		m[r.Name] = r
+	}
+
+	if m[repo.REPO_NAME_LOCAL] == nil {
+		return nil, util.NewNewtError(
+			"manifest does not record the commit of the project's local repo")
+	}
+
+	return m, nil
+}
+
+// pinProjectFile rewrites a `project.yml` file so that each repo is pinned to
+// the commit recorded in a build manifest.  Repos that the manifest records
+// but the file does not specify (i.e., repos that were pulled in as
+// dependencies) are added.  A shared repos directory is not used, as its
+// repos would need to be checked out at different commits.
+func pinProjectFile(path string,
+	repos map[string]*amanifest.ManifestRepo) error {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	settings := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return util.FmtNewtError("Failure parsing \"%s\": %s",
+			path, err.Error())
+	}
+
+	delete(settings, "project.repos_dir")
+
+	names := make([]string, 0, len(repos))
+	for name, _ := range repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == repo.REPO_NAME_LOCAL {
+			continue
+		}
+		r := repos[name]
+
+		key := "repository." + name
+		fields, ok := settings[key].(map[interface{}]interface{})
+		if !ok {
+			if r.URL == "" {
+				util.OneTimeWarning(
+					"manifest does not record the URL of repo \"%s\"; "+
+						"using the project's version", name)
+				continue
+			}
+			fields = map[interface{}]interface{}{
+				"type": "git",
+				"url":  r.URL,
+			}
+		}
+
+		delete(fields, "branch")
+		delete(fields, "tag")
+		fields["commit"] = r.Commit
+		settings[key] = fields
+	}
+
+	s := yaml.MapToYaml(settings)
+	if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// checkoutProject clones the current project into a scratch directory at the
+// specified commit.
+func checkoutProject(srcDir string, dstDir string, commit string) error {
+	cmds := [][]string{
+		{"git", "clone", "--no-checkout", "--quiet", srcDir, dstDir},
+		{"git", "-C", dstDir, "checkout", "--quiet", commit},
+	}
+
+	for _, cmd := range cmds {
+		if _, err := util.ShellCommand(cmd, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compareRebuild reports the differences between a build manifest and the
+// manifest of a reproduced build.
+//
+// @return bool                 Whether the manifests differ.
+func compareRebuild(orig amanifest.Manifest, rebuilt amanifest.Manifest) bool {
+	diff := util.UnifiedDiff("original", "rebuild",
+		orig.TgtVars, rebuilt.TgtVars, 1)
+
+	syscfgLines := func(vals map[string]string) []string {
+		lines := make([]string, 0, len(vals))
+		for k, v := range vals {
+			lines = append(lines, k+"="+v)
+		}
+		sort.Strings(lines)
+		return lines
+	}
+	diff += util.UnifiedDiff("original syscfg", "rebuild syscfg",
+		syscfgLines(orig.Syscfg), syscfgLines(rebuilt.Syscfg), 1)
+
+	pkgLines := func(pkgs []*amanifest.ManifestPkg) []string {
+		lines := make([]string, len(pkgs))
+		for i, p := range pkgs {
+			lines[i] = p.Name
+		}
+		sort.Strings(lines)
+		return lines
+	}
+	diff += util.UnifiedDiff("original packages", "rebuild packages",
+		pkgLines(orig.Pkgs), pkgLines(rebuilt.Pkgs), 1)
+
+	if diff == "" {
+		return false
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "%s", diff)
+	return true
+}
+
+func rebuildRunCmd(cmd *cobra.Command, args []string) {
+	if rebuildManifestPath == "" {
+		NewtUsage(cmd, util.NewNewtError("Must specify a manifest (--manifest)"))
+	}
+
+	proj := TryGetProject()
+
+	orig, err := amanifest.ReadManifest(rebuildManifestPath)
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	repos, err := manifestRepoMap(orig)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	dir := rebuildDir
+	if dir == "" {
+		dir = builder.BinRoot() + "/rebuild/" + filepath.Base(orig.Name)
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	if util.NodeExist(dir) {
+		if !newtutil.NewtForce {
+			NewtUsage(nil, util.FmtNewtError(
+				"%s already exists; specify -f to replace it", dir))
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Checking out project at %s into %s\n",
+		repos[repo.REPO_NAME_LOCAL].Commit, dir)
+	if err := checkoutProject(proj.Path(), dir,
+		repos[repo.REPO_NAME_LOCAL].Commit); err != nil {
+
+		NewtUsage(nil, err)
+	}
+
+	if err := pinProjectFile(dir+"/"+project.PROJECT_FILE_NAME,
+		repos); err != nil {
+
+		NewtUsage(nil, err)
+	}
+
+	// Switch to the scratch project.
+	if err := os.Chdir(dir); err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+	target.ResetTargets()
+	project.ResetProject()
+
+	proj = TryGetProject()
+	interfaces.SetProject(proj)
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Checking out repos at recorded commits\n")
+	opts := install.UpgradeOpts{Force: true}
+	if err := proj.UpgradeIf(opts, func(r *repo.Repo) bool {
+		return proj.RepoIsRoot(r.Name())
+	}); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	// Reload the project now that its repos are installed.
+	if err := ResetGlobalState(); err != nil {
+		NewtUsage(nil, err)
+	}
+	TryGetProject()
+
+	t := ResolveTarget(orig.Name)
+	if t == nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"target %s is not present at commit %s", orig.Name,
+			repos[repo.REPO_NAME_LOCAL].Commit))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Building target %s\n",
+		t.FullName())
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := b.Build(); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	mopts, err := manifest.OptsForNonImage(b)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	rebuilt, err := manifest.CreateManifest(mopts)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if compareRebuild(orig, rebuilt) {
+		NewtUsage(nil, util.FmtNewtError(
+			"rebuild of %s does not match the manifest", t.FullName()))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Target %s successfully rebuilt in %s; configuration matches "+
+			"the manifest\n", t.FullName(), dir)
+}
+
+func AddRebuildCommands(cmd *cobra.Command) {
+	rebuildHelpText := "Reproduce the build recorded in a build manifest.  " +
+		"The project is checked\nout at the recorded commit into a scratch " +
+		"directory, each repo is pinned to\nits recorded commit, and the " +
+		"target is built.  The target settings, syscfg\nvalues, and " +
+		"packages of the rebuild are then compared with the manifest.\nThe " +
+		"scratch directory defaults to bin/rebuild/<target-name>."
+	rebuildHelpEx := "  newt rebuild --manifest manifest.json\n"
+	rebuildHelpEx += "  newt rebuild --manifest manifest.json --dir /tmp/audit"
+
+	rebuildCmd := &cobra.Command{
+		Use:     "rebuild --manifest <file>",
+		Short:   "Reproduce a build from its manifest",
+		Long:    rebuildHelpText,
+		Example: rebuildHelpEx,
+		Run:     rebuildRunCmd,
+	}
+	rebuildCmd.Flags().StringVar(&rebuildManifestPath, "manifest", "",
+		"Build manifest (manifest.json) of the build to reproduce")
+	rebuildCmd.Flags().StringVar(&rebuildDir, "dir", "",
+		"Scratch directory to check the project out into")
+	rebuildCmd.Flags().BoolVarP(&newtutil.NewtForce, "force", "f", false,
+		"Replace an existing scratch directory")
+
+	cmd.AddCommand(rebuildCmd)
+}
@@ -25,13 +25,17 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/apache/mynewt-artifact/image"
-	"github.com/apache/mynewt-artifact/sec"
 	"mynewt.apache.org/newt/newt/imgprod"
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/parse"
 	"mynewt.apache.org/newt/util"
 )
 
+// Console flags.
+var runConsole bool
+var runConsolePort string
+var runConsoleBaud int
+
 func runRunCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
 		NewtUsage(cmd, util.NewNewtError("Must specify target"))
@@ -40,9 +44,6 @@ func runRunCmd(cmd *cobra.Command, args []string) {
 	if useV1 && useV2 {
 		NewtUsage(cmd, util.NewNewtError("Either -1, or -2, but not both"))
 	}
-	if !useV1 {
-		useV2 = true
-	}
 
 	TryGetProject()
 
@@ -51,8 +52,21 @@ func runRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, err)
 	}
 
+	useV1 = useImageV1(cmd, b.GetTarget())
+	useV2 = !useV1
+
+	if (runConsolePort != "" || runConsoleBaud != 0) && !runConsole {
+		NewtUsage(cmd, util.NewNewtError(
+			"--console-port and --console-baud require --console"))
+	}
+
 	testPkg := b.GetTestPkg()
 	if testPkg != nil {
+		if runConsole {
+			NewtUsage(cmd, util.NewNewtError(
+				"--console cannot be used with unit tests"))
+		}
+
 		b.InjectSetting("TESTUTIL_SYSTEM_ASSERT", "1")
 		if err := b.SelfTestCreateExe(); err != nil {
 			NewtUsage(nil, err)
@@ -95,14 +109,23 @@ func runRunCmd(cmd *cobra.Command, args []string) {
 				NewtUsage(cmd, err)
 			}
 
-			var keys []sec.PrivSignKey
+			var keys []newtutil.SignKey
 
+			var keyArgs []string
 			if len(args) > 2 {
-				keys, _, err = parseKeyArgs(args[2:])
+				keyArgs = args[2:]
+			}
+			keyArgs, err = signKeyArgs(keyArgs, b.GetTarget())
+			if err != nil {
+				NewtUsage(cmd, err)
+			}
+			if len(keyArgs) > 0 {
+				keys, _, err = parseKeyArgs(keyArgs)
 				if err != nil {
 					NewtUsage(cmd, err)
 				}
 			}
+			applyTargetRsaPss(b.GetTarget())
 
 			if useV1 {
 				err = imgprod.ProduceAllV1(b, ver, keys, "")
@@ -114,11 +137,36 @@ func runRunCmd(cmd *cobra.Command, args []string) {
 			}
 		}
 
-		if err := b.Load(extraJtagCmd); err != nil {
+		if gdbRemote != "" {
+			err = b.LoadRemote(gdbRemote)
+		} else {
+			err = b.Load(extraJtagCmd)
+		}
+		if err != nil {
 			NewtUsage(nil, err)
 		}
 
-		if err := b.Debug(extraJtagCmd, true, noGDB_flag); err != nil {
+		// Watch the app run instead of debugging it.
+		if runConsole {
+			if err := b.Console(runConsolePort, runConsoleBaud); err != nil {
+				NewtUsage(nil, err)
+			}
+			return
+		}
+
+		if semihosting_flag {
+			b.GetTarget().Semihosting = true
+		}
+		if gdbFrontend != "" {
+			b.GetTarget().GdbFrontend = gdbFrontend
+		}
+
+		if gdbRemote != "" {
+			err = b.DebugRemote(gdbRemote, true)
+		} else {
+			err = b.Debug(extraJtagCmd, true, noGDB_flag)
+		}
+		if err != nil {
 			NewtUsage(nil, err)
 		}
 	}
@@ -130,6 +178,8 @@ func AddRunCommands(cmd *cobra.Command) {
 		" - create-image <target> <version>\n" +
 		" - load <target>\n" +
 		" - debug <target>\n\n" +
+		"With --console, the board's serial console is opened instead of " +
+		"the debugger.\n" +
 		"Note if version number is omitted, create-image step is skipped\n"
 	runHelpEx := "  newt run <target-name> [<version>]\n"
 	runHelpEx +=
@@ -147,6 +197,18 @@ func AddRunCommands(cmd *cobra.Command) {
 		"Extra commands to send to JTAG software")
 	runCmd.PersistentFlags().BoolVarP(&noGDB_flag, "noGDB", "n", false,
 		"Do not start GDB from command line")
+	runCmd.PersistentFlags().BoolVarP(&semihosting_flag, "semihosting",
+		"", false, "Enable semihosting in the debug session")
+	runCmd.PersistentFlags().StringVarP(&gdbFrontend, "frontend", "", "",
+		"gdb frontend: tui, gdbgui, or a command template")
+	runCmd.PersistentFlags().StringVarP(&gdbRemote, "remote", "", "",
+		"Load and debug through a remote GDB server (host:port)")
+	runCmd.PersistentFlags().BoolVarP(&runConsole, "console", "c", false,
+		"Open the board's serial console instead of debugging")
+	runCmd.PersistentFlags().StringVarP(&runConsolePort, "console-port", "",
+		"", "Serial port of the console (default: detected)")
+	runCmd.PersistentFlags().IntVarP(&runConsoleBaud, "console-baud", "", 0,
+		"Baud rate of the console (default: CONSOLE_UART_BAUD)")
 	runCmd.PersistentFlags().BoolVarP(&newtutil.NewtForce,
 		"force", "f", false,
 		"Ignore flash overflow errors during image creation")
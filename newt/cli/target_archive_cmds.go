@@ -0,0 +1,299 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+// The path of the zip file to write (`newt target archive --output`).
+var archiveOutPath string
+
+// archiveFile is a single file to include in a target archive.
+type archiveFile struct {
+	// Path of the file on disk.
+	src string
+
+	// Path of the file within the archive.
+	dst string
+}
+
+// targetDefFiles lists the files that define a target, i.e., the regular
+// files in the target's package directory.
+func targetDefFiles(t *target.Target, dstDir string) ([]archiveFile, error) {
+	dir := t.Package().BasePath()
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	files := []archiveFile{}
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			files = append(files, archiveFile{
+				src: dir + "/" + info.Name(),
+				dst: dstDir + "/" + info.Name(),
+			})
+		}
+	}
+
+	return files, nil
+}
+
+// targetInheritedFiles lists the files that a target's definition depends
+// on: the files of each base target, under "base/<base-target-name>", and
+// the target's override files, under "overrides/".  An override file is
+// placed at its path relative to the project.
+func targetInheritedFiles(t *target.Target, dstDir string) (
+	[]archiveFile, error) {
+
+	files := []archiveFile{}
+	for _, name := range t.BaseTargets() {
+		base := ResolveTarget(name)
+		if base == nil {
+			return nil, util.FmtNewtError(
+				"target %s: cannot resolve base target %s",
+				t.FullName(), name)
+		}
+
+		baseFiles, err := targetDefFiles(base,
+			dstDir+"/base/"+base.Package().Name())
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, baseFiles...)
+	}
+
+	projDir := TryGetProject().Path()
+	for _, path := range t.Overrides {
+		rel, err := filepath.Rel(projDir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(path)
+		}
+
+		files = append(files, archiveFile{
+			src: path,
+			dst: dstDir + "/overrides/" + filepath.ToSlash(rel),
+		})
+	}
+
+	return files, nil
+}
+
+// targetBuildFiles lists the artifacts that a build of the specified
+// package produced: the `.elf` file and its `.bin` and `.map` files, the
+// image, the hex file, and the manifest.  Artifacts that were not produced are
+// omitted.
+func targetBuildFiles(t *target.Target, buildName string, appName string,
+	dstDir string) []archiveFile {
+
+	elfPath := builder.AppElfPath(t.Name(), buildName, appName)
+	imgPath := builder.AppImgPath(t.Name(), buildName, appName)
+
+	paths := []string{
+		elfPath,
+		elfPath + ".bin",
+		elfPath + ".map",
+		imgPath,
+		filepath.Dir(imgPath) + "/" + filepath.Base(appName) + ".hex",
+		builder.ManifestPath(t.Name(), buildName, appName),
+	}
+
+	files := []archiveFile{}
+	for _, path := range paths {
+		if util.NodeExist(path) {
+			files = append(files, archiveFile{
+				src: path,
+				dst: dstDir + "/" + filepath.Base(path),
+			})
+		}
+	}
+
+	return files
+}
+
+// writeArchive writes a zip file containing the specified files.  If the
+// archive cannot be written completely, the partial file is removed.
+func writeArchive(path string, files []archiveFile) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	err = writeArchiveFiles(f, files)
+	if cerr := f.Close(); cerr != nil && err == nil {
+		err = util.ChildNewtError(cerr)
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+func writeArchiveFiles(w io.Writer, files []archiveFile) error {
+	zw := zip.NewWriter(w)
+
+	for _, af := range files {
+		if err := addArchiveFile(zw, af); err != nil {
+			zw.Close()
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+func addArchiveFile(zw *zip.Writer, af archiveFile) error {
+	src, err := os.Open(af.src)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	hdr.Name = af.dst
+	hdr.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+func targetArchiveCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify exactly one target"))
+	}
+
+	TryGetProject()
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	if err := t.Validate(true); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	topDir := t.ShortName()
+
+	files, err := targetDefFiles(t, topDir+"/target")
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	inherited, err := targetInheritedFiles(t, topDir+"/target")
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	files = append(files, inherited...)
+
+	appFiles := targetBuildFiles(t, builder.BUILD_NAME_APP, t.App().Name(),
+		topDir+"/"+builder.BUILD_NAME_APP)
+	if len(appFiles) == 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"target %s has not been built; run `newt build %s` first",
+			t.FullName(), t.ShortName()))
+	}
+	files = append(files, appFiles...)
+
+	if t.Loader() != nil {
+		loaderFiles := targetBuildFiles(t, builder.BUILD_NAME_LOADER,
+			t.Loader().Name(), topDir+"/"+builder.BUILD_NAME_LOADER)
+		if len(loaderFiles) == 0 {
+			util.OneTimeWarning("target %s: loader has not been built",
+				t.FullName())
+		}
+		files = append(files, loaderFiles...)
+	}
+
+	outPath := archiveOutPath
+	if outPath == "" {
+		outPath = t.ShortName() + ".zip"
+	}
+
+	if err := writeArchive(outPath, files); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Target %s archived to %s (%d files)\n",
+		t.FullName(), outPath, len(files))
+	for _, af := range files {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "    %s\n", af.dst)
+	}
+}
+
+func targetArchiveCmdAll() []*cobra.Command {
+	archiveHelpText := "Create a zip file containing a target's definition " +
+		"(including its base targets\nand override files) and the " +
+		"artifacts of its most recent build: the .elf,\n.bin, .img, and " +
+		".hex files, the map file, and the manifest.  The target must\n" +
+		"already be built.  The archive is written to <target-name>.zip " +
+		"unless an\noutput file is specified."
+	archiveHelpEx := "  newt target archive my_target\n"
+	archiveHelpEx += "  newt target archive --output /tmp/my_target-1.2.zip my_target"
+
+	archiveCmd := &cobra.Command{
+		Use:     "archive <target-name>",
+		Short:   "Bundle a target with its build artifacts",
+		Long:    archiveHelpText,
+		Example: archiveHelpEx,
+		Run:     targetArchiveCmd,
+	}
+	archiveCmd.Flags().StringVar(&archiveOutPath, "output", "",
+		"Path of the zip file to create")
+	AddTabCompleteFn(archiveCmd, targetList)
+
+	return []*cobra.Command{archiveCmd}
+}
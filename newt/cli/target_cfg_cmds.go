@@ -314,6 +314,51 @@ func targetConfigFlatCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Format of the documentation produced by "newt target config doc".
+var configDocFormat string
+
+func targetConfigDocCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify target or unittest name"))
+	}
+
+	if configDocFormat != syscfg.DOC_FORMAT_MARKDOWN &&
+		configDocFormat != syscfg.DOC_FORMAT_HTML {
+
+		NewtUsage(cmd, util.FmtNewtError(
+			"invalid format: \"%s\"; must be one of: %s, %s",
+			configDocFormat, syscfg.DOC_FORMAT_MARKDOWN,
+			syscfg.DOC_FORMAT_HTML))
+	}
+
+	TryGetProject()
+
+	for i, arg := range args {
+		b, err := TargetBuilderForTargetOrUnittest(arg)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+
+		res := targetBuilderConfigResolve(b)
+		if errText := res.Cfg.ErrorText(); errText != "" {
+			NewtUsage(nil, util.NewNewtError(errText))
+		}
+
+		buf := bytes.Buffer{}
+		err = syscfg.WriteDoc(res.Cfg, b.GetTarget().FullName(),
+			configDocFormat, &buf)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", buf.String())
+
+		if i < len(args)-1 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "\n")
+		}
+	}
+}
+
 func valSettingString(vs val.ValSetting) string {
 	intVal, _ := vs.IntVal()
 
@@ -469,6 +514,10 @@ func printStage(sf stage.StageFunc) {
 		sf.Pkg.FullName())
 	util.StatusMessage(util.VERBOSITY_DEFAULT, "    Stage:  %s\n",
 		valSettingString(sf.Stage))
+	if len(sf.After) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    After:  %s\n",
+			strings.Join(sf.After, ", "))
+	}
 }
 
 func printStageBriefOne(sf stage.StageFunc,
@@ -815,6 +864,23 @@ func targetCfgCmdAll() []*cobra.Command {
 		return append(targetList(), unittestList()...)
 	})
 
+	configDocCmd := &cobra.Command{
+		Use:   "doc <target> [target...]",
+		Short: "Generate documentation for a target's system configuration",
+		Long: "Generate documentation for every setting in a target's " +
+			"system configuration.\nFor each setting, the description, " +
+			"type, default value, current value, and the\npackage that set " +
+			"the value are listed.",
+		Run: targetConfigDocCmd,
+	}
+	configDocCmd.Flags().StringVarP(&configDocFormat, "format", "", "md",
+		"Output format (md or html)")
+
+	configCmd.AddCommand(configDocCmd)
+	AddTabCompleteFn(configDocCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
 	configInitCmd := &cobra.Command{
 		Use:   "init",
 		Short: "Populate a target's system configuration file",
@@ -21,17 +21,20 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
 
 	"mynewt.apache.org/newt/newt/builder"
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/resolve"
 	"mynewt.apache.org/newt/newt/syscfg"
 	"mynewt.apache.org/newt/newt/target"
@@ -40,11 +43,101 @@ import (
 
 var amendDelete bool = false
 
+// Whether the show command lists the origin of each flag and syscfg value.
+var showProvenance bool
+
+// Options for selecting and formatting the show command's output.
+var showFilters []string
+var showJson bool
+
+// Whether the default command removes the project's default target.
+var clearDefaultTarget bool
+
 // target variables that can have values amended with the amend command.
 var amendVars = []string{"aflags", "cflags", "cxxflags", "lflags", "syscfg"}
 
 var setVars = []string{"aflags", "app", "build_profile", "bsp", "cflags",
-	"cxxflags", "lflags", "loader", "syscfg"}
+	"console_port", "cxxflags", "debugger", "enc_key_file", "gdb_frontend",
+	"image_compression", "image_format", "image_version", "inherits",
+	"jlink_device", "jlink_interface", "jlink_speed", "lflags", "loader",
+	"openocd_adapter", "openocd_speed", "openocd_transport", "probe_id",
+	"pyocd_target", "rsa_pss", "semihosting", "syscfg", "uf2_family_id"}
+
+// Target variables whose values are checked against the list that
+// "newt vals" displays ([target-variable] => vals-element-type).
+var setVarValTypes = map[string]string{
+	"app":           "app",
+	"bsp":           "bsp",
+	"build_profile": "build_profile",
+	"inherits":      "target",
+	"loader":        "app",
+}
+
+// validateSetValue ensures the value being assigned to a target variable is
+// one that newt knows about.  This catches typos in "newt target set" before
+// they surface as build failures.
+func validateSetValue(t *target.Target, key string, val string) error {
+	valType := setVarValTypes[key]
+	if valType == "" || val == "" {
+		return nil
+	}
+
+	// Package names can be specified relative to the target's repo;
+	// normalize them before comparing.
+	if valType != "build_profile" {
+		lpkg, err := project.GetProject().ResolvePackage(
+			t.Package().Repo(), val)
+		if err == nil && lpkg != nil {
+			val = lpkg.FullName()
+		}
+	}
+
+	// If newt doesn't know of any values (e.g., dependencies haven't been
+	// installed yet), there is nothing to check against.
+	vals, err := VarValues(valType)
+	if err != nil || len(vals) == 0 {
+		return err
+	}
+
+	for _, v := range vals {
+		if v == val {
+			return nil
+		}
+	}
+
+	return util.FmtNewtError(
+		"invalid %s: \"%s\"; run \"newt vals %s\" to list valid values",
+		key, val, valType)
+}
+
+// warnUnknownSettings displays a warning for each syscfg setting that no
+// package in the project defines.  Settings defined under a conditional key
+// are not known until build time, so this is not an error.
+func warnUnknownSettings(kv map[string]string) {
+	known, err := VarValues("syscfg")
+	if err != nil {
+		return
+	}
+
+	knownMap := make(map[string]struct{}, len(known))
+	for _, name := range known {
+		knownMap[name] = struct{}{}
+	}
+
+	names := make([]string, 0, len(kv))
+	for name, _ := range kv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := knownMap[name]; !ok {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Warning: syscfg setting %s is not defined by any package; "+
+					"run \"newt vals syscfg\" to list known settings\n", name)
+		}
+	}
+}
 
 func resolveExistingTargetArg(arg string) (*target.Target, error) {
 	t := ResolveTarget(arg)
@@ -98,6 +191,10 @@ func amendSysCfg(value string, t *target.Target) error {
 	if err != nil {
 		return err
 	}
+	if !amendDelete {
+		warnUnknownSettings(amendSysVals)
+	}
+
 	// Have current syscfg.vals in syscfg.yml file
 	if sysVals != nil {
 		// Either delete syscfg variable or replace with new value
@@ -166,8 +263,147 @@ func amendBuildFlags(kv []string, t *target.Target) error {
 	return nil
 }
 
+// showTargetProvenance prints each flag and syscfg value of a target along
+// with the target that specified it.
+func showTargetProvenance(t *target.Target) error {
+	for _, name := range []string{"aflags", "cflags", "cxxflags", "lflags",
+		"syscfg"} {
+
+		key := "pkg." + name
+		if name == "syscfg" {
+			key = "syscfg.vals"
+		}
+
+		entries, err := t.SettingEntries(key)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s:\n", name)
+		for _, e := range entries {
+			val := e.Value
+			if e.Name != "" {
+				val = e.Name + "=" + e.Value
+			}
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"        %-32s (%s)\n", val, e.Source)
+		}
+	}
+
+	return nil
+}
+
+// showFilter is a single `--filter <var>=<value>` argument to the show
+// command.
+type showFilter struct {
+	name  string
+	value string
+}
+
+func parseShowFilters(args []string) ([]showFilter, error) {
+	filters := make([]showFilter, 0, len(args))
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, util.FmtNewtError(
+				"Invalid filter \"%s\"; must have the form <var>=<value>",
+				arg)
+		}
+
+		filters = append(filters, showFilter{kv[0], kv[1]})
+	}
+
+	return filters, nil
+}
+
+// matches indicates whether a target's variables satisfy the filter.  A
+// variable matches if its value is equal to the filter value, if the last
+// element of its package name is (e.g., "bsp=nrf52dk"), or if one of the
+// entries in a list value is (e.g., "cflags=-DNDEBUG" or "tags=nightly").
+// "syscfg.<setting>=<value>" matches a single syscfg override.
+func (f showFilter) matches(t *target.Target, kvPairs map[string]string) bool {
+	if strings.HasPrefix(f.name, "syscfg.") {
+		vals := t.Package().SyscfgY.GetValStringMapString("syscfg.vals", nil)
+		val, ok := vals[strings.TrimPrefix(f.name, "syscfg.")]
+		return ok && val == f.value
+	}
+
+	val, ok := kvPairs[f.name]
+	if !ok {
+		return false
+	}
+
+	if val == f.value || filepath.Base(val) == f.value {
+		return true
+	}
+
+	for _, field := range strings.Fields(strings.Trim(val, "[]")) {
+		if field == f.value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonValue converts a value read from a YAML file to a form that can be
+// encoded as JSON.  YAML maps are decoded with interface{} keys, which the
+// JSON encoder doesn't support.
+func jsonValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(tv))
+		for k, v := range tv {
+			m[fmt.Sprintf("%v", k)] = jsonValue(v)
+		}
+		return m
+
+	case []interface{}:
+		s := make([]interface{}, len(tv))
+		for i, v := range tv {
+			s[i] = jsonValue(v)
+		}
+		return s
+
+	default:
+		return v
+	}
+}
+
+// targetJsonMap produces the JSON representation of a target's variables.
+// Flags are represented as arrays and syscfg overrides as an object.
+func targetJsonMap(t *target.Target) map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, v := range t.EffectiveY().AllSettings() {
+		m[strings.TrimPrefix(k, "target.")] = jsonValue(v)
+	}
+
+	for _, name := range []string{"aflags", "cflags", "cxxflags", "lflags"} {
+		flags := t.Package().PkgY.GetValStringSlice("pkg."+name, nil)
+		if len(flags) > 0 {
+			m[name] = flags
+		}
+	}
+
+	vals := t.Package().SyscfgY.GetValStringMapString("syscfg.vals", nil)
+	if len(vals) > 0 {
+		m["syscfg"] = vals
+	}
+
+	return m
+}
+
 func targetShowCmd(cmd *cobra.Command, args []string) {
 	TryGetProject()
+
+	filters, err := parseShowFilters(showFilters)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
 	targetNames := []string{}
 	if len(args) == 0 {
 		for name, _ := range target.GetTargets() {
@@ -192,13 +428,20 @@ func targetShowCmd(cmd *cobra.Command, args []string) {
 
 	sort.Strings(targetNames)
 
+	jsonTargets := map[string]interface{}{}
+
+targetLoop:
 	for _, name := range targetNames {
 		kvPairs := map[string]string{}
 
-		util.StatusMessage(util.VERBOSITY_DEFAULT, name+"\n")
-
 		target := target.GetTargets()[name]
-		settings := target.TargetY.AllSettingsAsStrings()
+
+		// Show the settings the target is built with, including inherited
+		// ones.
+		if err := target.ApplyInheritance(); err != nil {
+			NewtUsage(nil, err)
+		}
+		settings := target.EffectiveY().AllSettingsAsStrings()
 		for k, v := range settings {
 			kvPairs[strings.TrimPrefix(k, "target.")] = v
 		}
@@ -211,6 +454,29 @@ func targetShowCmd(cmd *cobra.Command, args []string) {
 		kvPairs["lflags"] = pkgVarSliceString(target.Package(), "pkg.lflags")
 		kvPairs["aflags"] = pkgVarSliceString(target.Package(), "pkg.aflags")
 
+		for _, f := range filters {
+			if !f.matches(target, kvPairs) {
+				continue targetLoop
+			}
+		}
+
+		if showJson {
+			jsonTargets[name] = targetJsonMap(target)
+			continue
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, name+"\n")
+
+		// With --provenance, the flags and syscfg values are listed
+		// separately, one entry per line.
+		if showProvenance {
+			for _, k := range []string{
+				"aflags", "cflags", "cxxflags", "lflags", "syscfg",
+			} {
+				delete(kvPairs, k)
+			}
+		}
+
 		keys := []string{}
 		for k, _ := range kvPairs {
 			keys = append(keys, k)
@@ -223,6 +489,20 @@ func targetShowCmd(cmd *cobra.Command, args []string) {
 					k, kvPairs[k])
 			}
 		}
+
+		if showProvenance {
+			if err := showTargetProvenance(target); err != nil {
+				NewtUsage(nil, err)
+			}
+		}
+	}
+
+	if showJson {
+		b, err := json.MarshalIndent(jsonTargets, "", "    ")
+		if err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+		fmt.Println(string(b))
 	}
 }
 
@@ -295,6 +575,10 @@ func targetSetCmd(cmd *cobra.Command, args []string) {
 		// completion is used to fill in the value.
 		kv[1] = strings.TrimSuffix(kv[1], "/")
 
+		if err := validateSetValue(t, key, kv[1]); err != nil {
+			NewtUsage(cmd, err)
+		}
+
 		vars = append(vars, kv)
 	}
 
@@ -308,6 +592,7 @@ func targetSetCmd(cmd *cobra.Command, args []string) {
 			if err != nil {
 				NewtUsage(cmd, err)
 			}
+			warnUnknownSettings(kv)
 
 			itfMap := util.StringMapStringToItfMapItf(kv)
 			t.Package().SyscfgY.Replace("syscfg.vals", itfMap)
@@ -397,6 +682,7 @@ func targetAmendCmd(cmd *cobra.Command, args []string) {
 		// Trim trailing slash from value.  This is necessary when tab
 		// completion is used to fill in the value.
 		kv[1] = strings.TrimSuffix(kv[1], "/")
+
 		vars = append(vars, kv)
 	}
 	for _, kv := range vars {
@@ -455,6 +741,16 @@ func targetCreateCmd(cmd *cobra.Command, args []string) {
 
 func targetDelOne(t *target.Target) error {
 	if !newtutil.NewtForce {
+		// Deleting a target whose build artifacts remain would make it
+		// difficult to tell which definition produced them.
+		binDir := builder.TargetBinDir(t.Name())
+		if util.NodeExist(binDir) {
+			return util.FmtNewtError(
+				"target %s has build artifacts in %s; run `newt clean %s` "+
+					"first or specify -f", t.FullName(), binDir,
+				t.ShortName())
+		}
+
 		// Determine if the target directory contains extra user files.  If it
 		// does, a prompt (or force) is required to delete it.
 		userFiles, err := targetContainsUserFiles(t)
@@ -472,12 +768,13 @@ func targetDelOne(t *target.Target) error {
 		}
 	}
 
-	if err := os.RemoveAll(t.Package().BasePath()); err != nil {
-		return util.NewNewtError(err.Error())
+	if err := trashTarget(t); err != nil {
+		return err
 	}
 
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
-		"Target %s successfully deleted.\n", t.FullName())
+		"Target %s successfully deleted; restore it with `newt target "+
+			"restore %s`.\n", t.FullName(), t.FullName())
 
 	return nil
 }
@@ -503,6 +800,11 @@ func targetDelCmd(cmd *cobra.Command, args []string) {
 }
 
 func targetCopyCmd(cmd *cobra.Command, args []string) {
+	if copyFromProject != "" {
+		targetCopyFromCmd(copyFromProject, args)
+		return
+	}
+
 	if len(args) != 2 {
 		NewtUsage(cmd, util.NewNewtError("Must specify exactly one "+
 			"source target and one destination target"))
@@ -639,6 +941,138 @@ func targetRevdepCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// targetSettingLines produces a sorted listing of the settings a target is
+// built with, one setting per line.  Inherited settings are included and
+// variable references are expanded.
+func targetSettingLines(t *target.Target) ([]string, error) {
+	if err := t.ApplyInheritance(); err != nil {
+		return nil, err
+	}
+	if err := t.ApplyVars(); err != nil {
+		return nil, err
+	}
+
+	kvPairs := map[string]string{}
+	for k, v := range t.EffectiveY().AllSettingsAsStrings() {
+		kvPairs[strings.TrimPrefix(k, "target.")] = v
+	}
+
+	// Use the expanded values of the main target variables.
+	kvPairs["app"] = t.AppName
+	kvPairs["bsp"] = t.BspName
+	kvPairs["loader"] = t.LoaderName
+	kvPairs["build_profile"] = t.BuildProfile
+
+	pack := t.Package()
+	for _, name := range []string{"aflags", "cflags", "cxxflags", "lflags",
+		"deps"} {
+
+		kvPairs[name] = strings.TrimSpace(pkgVarSliceString(pack, "pkg."+name))
+	}
+
+	// List each syscfg override separately so that differences are easy to
+	// spot.  Overrides in conditional blocks are listed with their
+	// conditions.
+	if node := pack.SyscfgY.Tree()["syscfg"]; node != nil {
+		if vals := node.Children["vals"]; vals != nil {
+			for k, v := range cast.ToStringMapString(vals.Value) {
+				kvPairs["syscfg."+k] = v
+			}
+			for expr, child := range vals.Children {
+				for k, v := range cast.ToStringMapString(child.Value) {
+					kvPairs[fmt.Sprintf("syscfg.%s (if %s)", k, expr)] = v
+				}
+			}
+		}
+	}
+
+	lines := []string{}
+	for k, v := range kvPairs {
+		if v != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", k, v))
+		}
+	}
+	sort.Strings(lines)
+
+	return lines, nil
+}
+
+func targetDefaultCmd(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		NewtUsage(cmd, util.NewNewtError("Too many arguments"))
+	}
+	if clearDefaultTarget && len(args) > 0 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Cannot specify a target with --clear"))
+	}
+
+	proj := TryGetProject()
+
+	if clearDefaultTarget {
+		if err := proj.SetDefaultTarget(""); err != nil {
+			NewtUsage(nil, err)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Default target cleared\n")
+		return
+	}
+
+	if len(args) == 0 {
+		name := proj.DefaultTarget()
+		if name == "" {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"No default target\n")
+		} else {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	t, err := ResolveTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	if err := proj.SetDefaultTarget(t.FullName()); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Default target set to %s\n", t.FullName())
+}
+
+func targetDiffCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError("Must specify exactly two targets"))
+	}
+
+	TryGetProject()
+
+	targets, err := ResolveTargets(args...)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	lines := make([][]string, len(targets))
+	for i, t := range targets {
+		lines[i], err = targetSettingLines(t)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
+	diff := util.UnifiedDiff(targets[0].FullName(), targets[1].FullName(),
+		lines[0], lines[1], 3)
+	if diff == "" {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Targets %s and %s have identical settings\n",
+			targets[0].FullName(), targets[1].FullName())
+		return
+	}
+
+	fmt.Print(diff)
+}
+
 func AddTargetCommands(cmd *cobra.Command) {
 	targetHelpText := ""
 	targetHelpEx := ""
@@ -657,7 +1091,9 @@ func AddTargetCommands(cmd *cobra.Command) {
 	showHelpText := "Show all the variables for the target specified " +
 		"by <target-name>."
 	showHelpEx := "  newt target show <target-name>\n"
-	showHelpEx += "  newt target show my_target1"
+	showHelpEx += "  newt target show my_target1\n"
+	showHelpEx += "  newt target show --provenance my_target1\n"
+	showHelpEx += "  newt target show --filter bsp=nrf52dk --json"
 
 	showCmd := &cobra.Command{
 		Use:     "show",
@@ -666,6 +1102,14 @@ func AddTargetCommands(cmd *cobra.Command) {
 		Example: showHelpEx,
 		Run:     targetShowCmd,
 	}
+	showCmd.Flags().BoolVarP(&showProvenance, "provenance", "p", false,
+		"List each flag and syscfg value along with the target that "+
+			"specified it")
+	showCmd.Flags().StringArrayVar(&showFilters, "filter", nil,
+		"Only show targets whose variable has the specified value "+
+			"(<var>=<value>); can be repeated")
+	showCmd.Flags().BoolVar(&showJson, "json", false,
+		"Write the targets' variables to standard output as JSON")
 	targetCmd.AddCommand(showCmd)
 	AddTabCompleteFn(showCmd, targetList)
 
@@ -750,7 +1194,10 @@ func AddTargetCommands(cmd *cobra.Command) {
 
 	targetCmd.AddCommand(createCmd)
 
-	delHelpText := "Delete the target specified by <target-name>."
+	delHelpText := "Delete the target specified by <target-name>.  The " +
+		"target's definition is\nmoved to the project's " + TARGET_TRASH_DIR +
+		" directory and can be restored with\n`newt target restore`.  A " +
+		"target that has build artifacts is only deleted if\n-f is specified."
 	delHelpEx := "  newt target delete <target-name>\n"
 	delHelpEx += "  newt target delete my_target1"
 
@@ -763,12 +1210,16 @@ func AddTargetCommands(cmd *cobra.Command) {
 	}
 	delCmd.PersistentFlags().BoolVarP(&newtutil.NewtForce,
 		"force", "f", false,
-		"Force delete of targets with user files without prompt")
+		"Force delete of targets with user files or build artifacts "+
+			"without prompt")
 
 	targetCmd.AddCommand(delCmd)
 
-	copyHelpText := "Create a new target <dst-target> by cloning <src-target>"
-	copyHelpEx := "  newt target copy blinky_sim my_target"
+	copyHelpText := "Create a new target <dst-target> by cloning " +
+		"<src-target>.\nWith --from, <src-target> is read from another " +
+		"project and <dst-target>\ndefaults to the same name."
+	copyHelpEx := "  newt target copy blinky_sim my_target\n"
+	copyHelpEx += "  newt target copy --from ../other_proj blinky_nrf52"
 
 	copyCmd := &cobra.Command{
 		Use:     "copy <src-target> <dst-target>",
@@ -777,10 +1228,52 @@ func AddTargetCommands(cmd *cobra.Command) {
 		Example: copyHelpEx,
 		Run:     targetCopyCmd,
 	}
+	copyCmd.Flags().StringVar(&copyFromProject, "from", "",
+		"Path of another project to copy the target from")
+	copyCmd.Flags().BoolVarP(&newtutil.NewtForce, "force", "f", false,
+		"Overwrite an existing target (with --from)")
 
 	targetCmd.AddCommand(copyCmd)
 	AddTabCompleteFn(copyCmd, targetList)
 
+	diffHelpText := "Show the differences between the settings of two " +
+		"targets as a unified\ndiff.  The comparison includes settings " +
+		"inherited from base targets, flags,\ndependencies, and syscfg " +
+		"overrides."
+	diffHelpEx := "  newt target diff blinky_nrf52 blinky_nrf52_dbg"
+
+	diffCmd := &cobra.Command{
+		Use:     "diff <target-1> <target-2>",
+		Short:   "Show the differences between two targets",
+		Long:    diffHelpText,
+		Example: diffHelpEx,
+		Run:     targetDiffCmd,
+	}
+
+	targetCmd.AddCommand(diffCmd)
+	AddTabCompleteFn(diffCmd, targetList)
+
+	defaultHelpText := "Set the project's default target.  Commands such " +
+		"as `newt build`, `newt load`,\n`newt debug`, and `newt size` " +
+		"operate on the default target when no target\nis specified.  The " +
+		"default is saved in the machine-specific project.local.yml\nfile.  " +
+		"With no arguments, the current default target is displayed."
+	defaultHelpEx := "  newt target default my_target\n"
+	defaultHelpEx += "  newt target default --clear"
+
+	defaultCmd := &cobra.Command{
+		Use:     "default [target-name]",
+		Short:   "Set or show the project's default target",
+		Long:    defaultHelpText,
+		Example: defaultHelpEx,
+		Run:     targetDefaultCmd,
+	}
+	defaultCmd.Flags().BoolVar(&clearDefaultTarget, "clear", false,
+		"Remove the default target")
+
+	targetCmd.AddCommand(defaultCmd)
+	AddTabCompleteFn(defaultCmd, targetList)
+
 	depHelpText := "View a target's dependency graph."
 
 	depCmd := &cobra.Command{
@@ -812,4 +1305,24 @@ func AddTargetCommands(cmd *cobra.Command) {
 	for _, cmd := range targetCfgCmdAll() {
 		targetCmd.AddCommand(cmd)
 	}
+
+	for _, cmd := range targetExportCmdAll() {
+		targetCmd.AddCommand(cmd)
+	}
+
+	for _, cmd := range targetValidateCmdAll() {
+		targetCmd.AddCommand(cmd)
+	}
+
+	for _, cmd := range targetArchiveCmdAll() {
+		targetCmd.AddCommand(cmd)
+	}
+
+	for _, cmd := range targetGenerateCmdAll() {
+		targetCmd.AddCommand(cmd)
+	}
+
+	for _, cmd := range targetRestoreCmdAll() {
+		targetCmd.AddCommand(cmd)
+	}
 }
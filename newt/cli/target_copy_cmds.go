@@ -0,0 +1,265 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/config"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+// The project to copy a target from (`newt target copy --from`).
+var copyFromProject string
+
+// The target variables that refer to packages.  These need to be adjusted
+// when a target is copied from another project.
+var copyPkgRefVars = []string{"app", "bsp", "loader", "inherits"}
+
+// repoIdentities reads the repository descriptors in a `project.yml` file and
+// produces a map of repo name to a string identifying the repo's upstream
+// source.  Two projects that refer to the same upstream repo by different
+// names produce the same identity.
+func repoIdentities(projDir string) (map[string]string, string, error) {
+	yc, err := config.ReadFile(projDir + "/" + project.PROJECT_FILE_NAME)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ids := map[string]string{}
+	for k, v := range yc.AllSettings() {
+		// Repo names can contain dots, so every map-valued key with the
+		// "repository." prefix is a repo descriptor.
+		repoName := strings.TrimPrefix(k, "repository.")
+		if repoName == k {
+			continue
+		}
+		if _, ok := v.(map[interface{}]interface{}); !ok {
+			continue
+		}
+
+		fields := yc.GetValStringMapString(k, nil)
+		switch fields["type"] {
+		case "github":
+			ids[repoName] = fmt.Sprintf("github:%s/%s",
+				fields["user"], fields["repo"])
+		default:
+			ids[repoName] = fields["type"] + ":" +
+				strings.TrimSuffix(fields["url"], ".git")
+		}
+	}
+
+	return ids, yc.GetValString("project.name", nil), nil
+}
+
+// pkgRefMapper converts package references that are valid in a source
+// project to references that are valid in the current project.
+type pkgRefMapper struct {
+	srcProjName string
+
+	// Source repo name --> current project repo name.
+	repoMap map[string]string
+}
+
+func newPkgRefMapper(srcDir string) (*pkgRefMapper, error) {
+	srcIds, srcName, err := repoIdentities(srcDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dstIds, _, err := repoIdentities(project.GetProject().Path())
+	if err != nil {
+		return nil, err
+	}
+
+	m := &pkgRefMapper{
+		srcProjName: srcName,
+		repoMap:     map[string]string{},
+	}
+
+	for srcRepo, srcId := range srcIds {
+		for dstRepo, dstId := range dstIds {
+			if srcId == dstId {
+				m.repoMap[srcRepo] = dstRepo
+				break
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// mapRef converts a single package reference.  Unqualified references and
+// references to the source project's local repo become references to the
+// current project's local repo; references to other repos use the current
+// project's name for the same upstream repo.
+func (m *pkgRefMapper) mapRef(ref string) string {
+	if !strings.HasPrefix(ref, "@") {
+		return ref
+	}
+
+	repoName, rest := ref[1:], ""
+	slash := strings.Index(repoName, "/")
+	if slash != -1 {
+		repoName, rest = repoName[:slash], repoName[slash+1:]
+	}
+
+	if repoName == m.srcProjName {
+		if slash == -1 {
+			return "@" + project.GetProject().Name()
+		}
+		return rest
+	}
+
+	dstRepo, ok := m.repoMap[repoName]
+	if !ok {
+		util.OneTimeWarning(
+			"repo \"%s\" is not used by this project; \"%s\" will not "+
+				"resolve until it is added to project.yml", repoName, ref)
+		return ref
+	}
+
+	if slash == -1 {
+		return "@" + dstRepo
+	}
+	return "@" + dstRepo + "/" + rest
+}
+
+// readTargetFromProject reads a target definition from another project's
+// files and produces its portable representation (see `newt target export`).
+// The syscfg settings are represented by the target's `syscfg.yml` contents
+// rather than by a flat map, so that conditional settings are preserved.
+func readTargetFromProject(srcDir string, name string) (
+	map[string]interface{}, error) {
+
+	if !strings.Contains(name, "/") {
+		name = TARGET_DEFAULT_DIR + "/" + name
+	}
+	targetDir := srcDir + "/" + name
+
+	ty, err := config.ReadFile(targetDir + "/" + target.TARGET_FILENAME)
+	if err != nil {
+		if util.IsNotExist(err) {
+			return nil, util.FmtNewtError(
+				"project %s does not contain target %s", srcDir, name)
+		}
+		return nil, err
+	}
+
+	mapper, err := newPkgRefMapper(srcDir)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	for k, v := range ty.AllSettings() {
+		m[strings.TrimPrefix(k, "target.")] = v
+	}
+	for _, k := range copyPkgRefVars {
+		if ref, ok := m[k].(string); ok && ref != "" {
+			m[k] = mapper.mapRef(ref)
+		}
+	}
+
+	py, err := config.ReadFile(targetDir + "/" + pkg.PACKAGE_FILE_NAME)
+	if err != nil && !util.IsNotExist(err) {
+		return nil, err
+	}
+	for _, k := range exportPkgVars {
+		flags := py.GetValStringSlice("pkg."+k, nil)
+		if k == "deps" {
+			for i, dep := range flags {
+				flags[i] = mapper.mapRef(dep)
+			}
+		}
+		if len(flags) > 0 {
+			m[k] = strings.Join(flags, " ")
+		}
+	}
+
+	files := map[interface{}]interface{}{}
+	for _, o := range ty.GetValStringSlice(target.TARGET_OVERRIDES_KEY, nil) {
+		if strings.HasPrefix(o, "@") {
+			continue
+		}
+
+		contents, err := readOverrideFile(srcDir + "/" + o)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"target %s: cannot copy override file \"%s\": %s",
+				name, o, err.Error())
+		}
+		files[o] = contents
+	}
+	if len(files) > 0 {
+		m[exportOverrideFilesKey] = files
+	}
+
+	sy, err := config.ReadFile(targetDir + "/" + pkg.SYSCFG_YAML_FILENAME)
+	if err != nil && !util.IsNotExist(err) {
+		return nil, err
+	}
+	// Copy the syscfg settings as they are so that conditional blocks are
+	// preserved.
+	if len(sy.AllSettings()) > 0 {
+		m["syscfg"] = sy
+	}
+
+	return m, nil
+}
+
+// targetCopyFromCmd implements `newt target copy --from <project>`.
+func targetCopyFromCmd(srcProj string, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		NewtUsage(nil, util.NewNewtError("Must specify a source target and "+
+			"an optional destination target"))
+	}
+
+	TryGetProject()
+
+	srcDir, err := filepath.Abs(srcProj)
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	srcName := args[0]
+	dstName := srcName
+	if len(args) > 1 {
+		dstName = args[1]
+	}
+
+	m, err := readTargetFromProject(srcDir, srcName)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	pkgName, err := importTarget(dstName, m)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Target successfully copied; %s:%s --> %s\n", srcDir, srcName, pkgName)
+}
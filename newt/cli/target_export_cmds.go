@@ -0,0 +1,457 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/newt/ycfg"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+// Exported targets use the same variable names as `newt target set`:
+//
+//     targets/my_blinky:
+//         app: apps/blinky
+//         bsp: "@apache-mynewt-core/hw/bsp/nordic_pca10040"
+//         build_profile: debug
+//         cflags: "-DFOO -DBAR"
+//         deps: "@apache-mynewt-core/sys/shell"
+//         overrides:
+//             - cfg/debug-logging.yml
+//         syscfg:
+//             SHELL_TASK: 1
+//         override_files:
+//             cfg/debug-logging.yml:
+//                 syscfg.vals:
+//                     LOG_LEVEL: 0
+//
+// The contents of the target's project-local override files are embedded in
+// `override_files` so that the target can be recreated in another project.
+// Override files in repos are not embedded; the importing project gets them
+// from the repo.
+
+var exportAll bool
+
+// The target variables that are stored in the target's `pkg.yml` file.
+var exportPkgVars = []string{"aflags", "cflags", "cxxflags", "deps", "lflags"}
+
+const exportOverrideFilesKey = "override_files"
+
+func isExportPkgVar(name string) bool {
+	for _, v := range exportPkgVars {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exportTarget produces the portable representation of a single target.  Only
+// the target's own settings are exported; inherited settings are represented
+// by the target's `inherits` variable.
+func exportTarget(t *target.Target) (map[interface{}]interface{}, error) {
+	m := map[interface{}]interface{}{}
+
+	for k, v := range t.TargetY.AllSettings() {
+		m[strings.TrimPrefix(k, "target.")] = v
+	}
+
+	for _, name := range exportPkgVars {
+		flags := t.Package().PkgY.GetValStringSlice("pkg."+name, nil)
+		if len(flags) > 0 {
+			m[name] = strings.Join(flags, " ")
+		}
+	}
+
+	vals := t.Package().SyscfgY.GetValStringMapString("syscfg.vals", nil)
+	if len(vals) > 0 {
+		m["syscfg"] = util.StringMapStringToItfMapItf(vals)
+	}
+
+	files := map[interface{}]interface{}{}
+	for _, o := range t.TargetY.GetValStringSlice(
+		target.TARGET_OVERRIDES_KEY, nil) {
+
+		if strings.HasPrefix(o, "@") {
+			continue
+		}
+
+		contents, err := readOverrideFile(TryGetProject().Path() + "/" + o)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"target %s: cannot export override file \"%s\": %s",
+				t.FullName(), o, err.Error())
+		}
+		files[o] = contents
+	}
+	if len(files) > 0 {
+		m[exportOverrideFilesKey] = files
+	}
+
+	return m, nil
+}
+
+// readOverrideFile reads an override file's settings without processing its
+// `$import` directives.
+func readOverrideFile(path string) (map[interface{}]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	contents := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, contents); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	m := make(map[interface{}]interface{}, len(contents))
+	for k, v := range contents {
+		m[k] = v
+	}
+
+	return m, nil
+}
+
+func targetExportCmd(cmd *cobra.Command, args []string) {
+	if len(args) == 0 && !exportAll {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify at least one target or --all"))
+	}
+
+	TryGetProject()
+
+	var targets []*target.Target
+	if exportAll {
+		for _, name := range targetList() {
+			if t := ResolveTarget(name); t != nil {
+				targets = append(targets, t)
+			}
+		}
+	} else {
+		var err error
+		targets, err = ResolveTargets(args...)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+	}
+
+	m := make(map[string]interface{}, len(targets))
+	for _, t := range targets {
+		tm, err := exportTarget(t)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+		m[t.Name()] = tm
+	}
+
+	fmt.Print(yaml.MapToYaml(m))
+}
+
+// importOverrideFiles determines which of a target's embedded override files
+// need to be written.  An existing file with different contents is only
+// replaced if -f is specified.
+//
+// @return map[string]map...    [path] => contents of each file to write.
+// @return error                Error.
+func importOverrideFiles(name string,
+	v interface{}) (map[string]map[string]interface{}, error) {
+
+	files, err := cast.ToStringMapE(v)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"target %s: %s must be a map of paths to file contents",
+			name, exportOverrideFilesKey)
+	}
+
+	proj := TryGetProject()
+	writes := map[string]map[string]interface{}{}
+	for path, c := range files {
+		clean := filepath.ToSlash(filepath.Clean(path))
+		if filepath.IsAbs(path) || strings.HasPrefix(path, "@") ||
+			clean == ".." || strings.HasPrefix(clean, "../") {
+
+			return nil, util.FmtNewtError(
+				"target %s: override file \"%s\" is not a path within "+
+					"the project", name, path)
+		}
+
+		contents, err := cast.ToStringMapE(c)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"target %s: invalid contents for override file \"%s\"",
+				name, path)
+		}
+
+		dst := proj.Path() + "/" + clean
+		if util.NodeExist(dst) {
+			cur, err := readOverrideFile(dst)
+			if err == nil && reflect.DeepEqual(cast.ToStringMap(cur), contents) {
+				continue
+			}
+			if !newtutil.NewtForce {
+				return nil, util.FmtNewtError(
+					"target %s: override file %s already exists with "+
+						"different contents; specify -f to overwrite it",
+					name, clean)
+			}
+		}
+
+		writes[dst] = contents
+	}
+
+	return writes, nil
+}
+
+// replaceTarget moves a newly written target from its staging directory into
+// place.  The target it replaces, if any, is moved to the project's trash
+// directory, and is put back if the new target cannot be moved into place.
+func replaceTarget(old *target.Target, stagePath string, dst string) error {
+	if old != nil {
+		if err := trashTarget(old); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(stagePath, dst); err != nil {
+		if old != nil {
+			if _, rerr := restoreTarget(old.FullName()); rerr != nil {
+				util.ErrorMessage(util.VERBOSITY_QUIET,
+					"Warning: failed to restore %s: %s\n",
+					old.FullName(), rerr.Error())
+			}
+		}
+		return util.ChildNewtError(err)
+	}
+
+	if old != nil {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Previous definition of %s moved to %s; use `newt target "+
+				"restore` to recover it\n", old.FullName(), TARGET_TRASH_DIR)
+	}
+
+	return nil
+}
+
+// importTarget creates a single target from its portable representation.  The
+// target is written to a staging directory first; an existing target is only
+// replaced once the new one has been written successfully.
+//
+// @return string               The full name of the new target package.
+// @return error                Error.
+func importTarget(name string, m map[string]interface{}) (string, error) {
+	proj := TryGetProject()
+
+	if !strings.Contains(name, "/") {
+		name = TARGET_DEFAULT_DIR + "/" + name
+	}
+
+	old := target.GetTargets()[name]
+	if old != nil && !newtutil.NewtForce {
+		return "", util.FmtNewtError(
+			"target %s already exists; specify -f to overwrite it", name)
+	}
+
+	pkgName := name
+	if old == nil {
+		var err error
+		pkgName, err = ResolveNewTargetName(name)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	repo := proj.LocalRepo()
+	dst := repo.Path() + "/" + pkgName
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	stagePath, err := ioutil.TempDir(filepath.Dir(dst),
+		"."+filepath.Base(dst)+"-import-")
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	defer os.RemoveAll(stagePath)
+
+	pack := pkg.NewLocalPackage(repo, stagePath)
+	pack.SetName(pkgName)
+	pack.SetType(pkg.PACKAGE_TYPE_TARGET)
+
+	t := target.NewTarget(pack)
+
+	keys := make([]string, 0, len(m))
+	for k, _ := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var overrideFiles map[string]map[string]interface{}
+	for _, k := range keys {
+		v := m[k]
+
+		switch {
+		case k == "syscfg":
+			// A target copied from another project carries its syscfg
+			// settings as they were read from its `syscfg.yml` file.
+			if yc, ok := v.(ycfg.YCfg); ok {
+				pack.SyscfgY = yc
+				break
+			}
+
+			vals, err := cast.ToStringMapStringE(v)
+			if err != nil {
+				return "", util.FmtNewtError(
+					"target %s: syscfg must be a map of setting names to "+
+						"values", pkgName)
+			}
+			pack.SyscfgY.Replace("syscfg.vals",
+				util.StringMapStringToItfMapItf(vals))
+
+		case k == exportOverrideFilesKey:
+			overrideFiles, err = importOverrideFiles(pkgName, v)
+			if err != nil {
+				return "", err
+			}
+
+		case isExportPkgVar(k):
+			pack.PkgY.Replace("pkg."+k, strings.Fields(cast.ToString(v)))
+
+		default:
+			t.TargetY.Replace("target."+k, v)
+		}
+	}
+
+	if err := t.Save(); err != nil {
+		return "", err
+	}
+
+	if err := replaceTarget(old, stagePath, dst); err != nil {
+		return "", err
+	}
+
+	paths := make([]string, 0, len(overrideFiles))
+	for path, _ := range overrideFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return "", util.ChildNewtError(err)
+		}
+		err := ioutil.WriteFile(path,
+			[]byte(yaml.MapToYaml(overrideFiles[path])), 0644)
+		if err != nil {
+			return "", util.ChildNewtError(err)
+		}
+	}
+
+	return pkgName, nil
+}
+
+func targetImportCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify exactly one file"))
+	}
+
+	TryGetProject()
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	contents := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, contents); err != nil {
+		NewtUsage(nil, util.FmtNewtError("Failure parsing \"%s\": %s",
+			args[0], err.Error()))
+	}
+
+	names := make([]string, 0, len(contents))
+	for name, _ := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m, err := cast.ToStringMapE(contents[name])
+		if err != nil {
+			NewtUsage(nil, util.FmtNewtError(
+				"Invalid definition for target %s", name))
+		}
+
+		pkgName, err := importTarget(name, m)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Target %s successfully imported\n", pkgName)
+	}
+}
+
+func targetExportCmdAll() []*cobra.Command {
+	exportHelpText := "Write the definitions of the specified targets to " +
+		"standard output as YAML.\nThe output can be recreated in another " +
+		"project with `newt target import`."
+	exportHelpEx := "  newt target export my_target1 my_target2 > targets.yml\n"
+	exportHelpEx += "  newt target export --all > targets.yml"
+
+	exportCmd := &cobra.Command{
+		Use:     "export [target...]",
+		Short:   "Export target definitions as YAML",
+		Long:    exportHelpText,
+		Example: exportHelpEx,
+		Run:     targetExportCmd,
+	}
+	exportCmd.Flags().BoolVarP(&exportAll, "all", "a", false,
+		"Export all targets")
+	AddTabCompleteFn(exportCmd, targetList)
+
+	importHelpText := "Create targets from a YAML file produced by " +
+		"`newt target export`."
+	importHelpEx := "  newt target import targets.yml"
+
+	importCmd := &cobra.Command{
+		Use:     "import <file>",
+		Short:   "Import target definitions from YAML",
+		Long:    importHelpText,
+		Example: importHelpEx,
+		Run:     targetImportCmd,
+	}
+	importCmd.Flags().BoolVarP(&newtutil.NewtForce, "force", "f", false,
+		"Overwrite existing targets")
+
+	return []*cobra.Command{exportCmd, importCmd}
+}
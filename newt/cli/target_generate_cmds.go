@@ -0,0 +1,185 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+// The default naming convention for generated targets.
+const GENERATE_DEFAULT_NAME = "${APP}_${BSP}"
+
+// Options for `newt target generate`.
+var generateApp string
+var generateBsps string
+var generateName string
+var generateBuildProfile string
+
+// matchingBsps lists the full names of the BSP packages that match the
+// specified glob pattern, sorted by name.  The pattern is compared with each
+// BSP's full name, its name without a repo, and the last element of its name.
+func matchingBsps(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, util.FmtNewtError("invalid BSP pattern \"%s\": %s",
+			pattern, err.Error())
+	}
+
+	names := []string{}
+	packs := TryGetProject().PackagesOfType(pkg.PACKAGE_TYPE_BSP)
+	for _, pack := range packs {
+		for _, s := range []string{
+			pack.FullName(), pack.Name(), filepath.Base(pack.Name()),
+		} {
+			if ok, _ := path.Match(pattern, s); ok {
+				names = append(names, pack.FullName())
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// generatedTargetName applies a naming convention to an app and a BSP.  The
+// `${APP}` and `${BSP}` variables are replaced with the last element of the
+// app and BSP package names.
+func generatedTargetName(tmpl string, appName string, bspName string) string {
+	r := strings.NewReplacer(
+		"${APP}", filepath.Base(appName),
+		"${BSP}", filepath.Base(bspName))
+
+	return r.Replace(tmpl)
+}
+
+func targetGenerateCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		NewtUsage(cmd, util.NewNewtError("Unexpected arguments"))
+	}
+	if generateApp == "" {
+		NewtUsage(cmd, util.NewNewtError("Must specify an app (--app)"))
+	}
+	if generateBsps == "" {
+		NewtUsage(cmd, util.NewNewtError("Must specify a BSP pattern (--bsps)"))
+	}
+	if !strings.Contains(generateName, "${BSP}") {
+		NewtUsage(cmd, util.NewNewtError(
+			"Target name must contain ${BSP} to produce a unique name for "+
+				"each BSP"))
+	}
+
+	proj := TryGetProject()
+
+	app, err := proj.ResolvePackage(proj.LocalRepo(), generateApp)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if app.Type() != pkg.PACKAGE_TYPE_APP {
+		NewtUsage(nil, util.FmtNewtError("package %s is not an app",
+			app.FullName()))
+	}
+
+	bsps, err := matchingBsps(generateBsps)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if len(bsps) == 0 {
+		NewtUsage(nil, util.FmtNewtError("no BSPs match \"%s\"", generateBsps))
+	}
+
+	created := 0
+	for _, bsp := range bsps {
+		name := generatedTargetName(generateName, app.FullName(), bsp)
+		if !strings.Contains(name, "/") {
+			name = TARGET_DEFAULT_DIR + "/" + name
+		}
+
+		if target.GetTargets()[name] != nil && !newtutil.NewtForce {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Skipping %s; target already exists\n", name)
+			continue
+		}
+
+		m := map[string]interface{}{
+			"app": app.FullName(),
+			"bsp": bsp,
+		}
+		if generateBuildProfile != "" {
+			m["build_profile"] = generateBuildProfile
+		}
+
+		pkgName, err := importTarget(name, m)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Target %s successfully created\n", pkgName)
+		created++
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Created %d of %d target(s)\n", created, len(bsps))
+}
+
+func targetGenerateCmdAll() []*cobra.Command {
+	generateHelpText := "Create one target for each BSP that matches a " +
+		"glob pattern.  Each target\nbuilds the specified app.  The pattern " +
+		"is compared with each BSP's full\nname, its name without a repo, " +
+		"and the last element of its name.  Target\nnames are formed from " +
+		"a template in which ${APP} and ${BSP} are replaced with\nthe last " +
+		"element of the app and BSP names (default: " +
+		GENERATE_DEFAULT_NAME + ").\nExisting targets are skipped unless -f " +
+		"is specified."
+	generateHelpEx := "  newt target generate --app apps/blinky " +
+		"--bsps 'nordic_*'\n"
+	generateHelpEx += "  newt target generate --app apps/blinky " +
+		"--bsps '*' --name 'ci/${APP}-${BSP}'"
+
+	generateCmd := &cobra.Command{
+		Use:     "generate --app <app> --bsps <pattern>",
+		Short:   "Create a target for each matching BSP",
+		Long:    generateHelpText,
+		Example: generateHelpEx,
+		Run:     targetGenerateCmd,
+	}
+	generateCmd.Flags().StringVar(&generateApp, "app", "",
+		"App package that each target builds")
+	generateCmd.Flags().StringVar(&generateBsps, "bsps", "",
+		"Glob pattern that selects BSP packages")
+	generateCmd.Flags().StringVar(&generateName, "name",
+		GENERATE_DEFAULT_NAME, "Target name template")
+	generateCmd.Flags().StringVar(&generateBuildProfile, "build_profile", "",
+		"Build profile of each target")
+	generateCmd.Flags().BoolVarP(&newtutil.NewtForce, "force", "f", false,
+		"Overwrite existing targets")
+
+	return []*cobra.Command{generateCmd}
+}
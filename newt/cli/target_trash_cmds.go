@@ -0,0 +1,190 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+// Deleted targets are moved to this directory, relative to the project base
+// directory.  Package searches skip directories whose names begin with ".".
+const TARGET_TRASH_DIR = ".trash"
+
+func targetTrashPath() string {
+	return TryGetProject().Path() + "/" + TARGET_TRASH_DIR
+}
+
+// trashTarget moves a target's directory into the project's trash directory.
+// A previously deleted target with the same name is replaced.
+func trashTarget(t *target.Target) error {
+	proj := TryGetProject()
+	src := t.Package().BasePath()
+
+	rel, err := filepath.Rel(proj.Path(), src)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return util.FmtNewtError(
+			"target %s is not in the project directory; cannot delete it",
+			t.FullName())
+	}
+
+	dst := targetTrashPath() + "/" + filepath.ToSlash(rel)
+	if err := os.RemoveAll(dst); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// trashedTargets lists the names of the targets in the project's trash
+// directory, sorted.
+func trashedTargets() ([]string, error) {
+	trashDir := targetTrashPath()
+	if !util.NodeExist(trashDir) {
+		return nil, nil
+	}
+
+	names := []string{}
+	err := filepath.Walk(trashDir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || info.Name() != pkg.PACKAGE_FILE_NAME {
+				return nil
+			}
+
+			rel, err := filepath.Rel(trashDir, filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+			names = append(names, filepath.ToSlash(rel))
+			return nil
+		})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// restoreTarget moves a deleted target from the project's trash directory
+// back to its original location.  The "targets/" prefix is optional.
+//
+// @return string               The full name of the restored target.
+func restoreTarget(name string) (string, error) {
+	name = strings.TrimSuffix(name, "/")
+	candidates := []string{name}
+	if !strings.HasPrefix(name, TARGET_DEFAULT_DIR+"/") {
+		candidates = append(candidates, TARGET_DEFAULT_DIR+"/"+name)
+	}
+
+	for _, c := range candidates {
+		src := targetTrashPath() + "/" + c
+		if !util.NodeExist(src + "/" + pkg.PACKAGE_FILE_NAME) {
+			continue
+		}
+
+		dst := TryGetProject().Path() + "/" + c
+		if util.NodeExist(dst) {
+			return "", util.FmtNewtError(
+				"cannot restore %s; %s already exists", c, dst)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return "", util.ChildNewtError(err)
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return "", util.ChildNewtError(err)
+		}
+
+		return c, nil
+	}
+
+	return "", util.FmtNewtError("no deleted target named %s", name)
+}
+
+func targetRestoreCmd(cmd *cobra.Command, args []string) {
+	TryGetProject()
+
+	if len(args) == 0 {
+		names, err := trashedTargets()
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		if len(names) == 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"No deleted targets\n")
+		}
+		for _, name := range names {
+			util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", name)
+		}
+		return
+	}
+
+	for _, arg := range args {
+		name, err := restoreTarget(arg)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Target %s successfully restored\n", name)
+	}
+}
+
+func targetRestoreCmdAll() []*cobra.Command {
+	restoreHelpText := "Restore targets that were deleted with `newt target " +
+		"delete`.  Deleted\ntargets are kept in the project's " + TARGET_TRASH_DIR +
+		" directory until a target\nwith the same name is deleted again.  " +
+		"With no arguments, the deleted targets\nare listed."
+	restoreHelpEx := "  newt target restore\n"
+	restoreHelpEx += "  newt target restore my_target1"
+
+	restoreCmd := &cobra.Command{
+		Use:     "restore [target-name...]",
+		Short:   "Restore deleted targets",
+		Long:    restoreHelpText,
+		Example: restoreHelpEx,
+		Run:     targetRestoreCmd,
+	}
+	AddTabCompleteFn(restoreCmd, func() []string {
+		names, _ := trashedTargets()
+		return names
+	})
+
+	return []*cobra.Command{restoreCmd}
+}
@@ -0,0 +1,209 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+// validationProblem describes a single problem with a target, along with a
+// suggestion for fixing it.
+type validationProblem struct {
+	text string
+	hint string
+}
+
+func (vp validationProblem) String() string {
+	s := strings.TrimSpace(vp.text)
+	if vp.hint != "" {
+		s += "\n      hint: " + vp.hint
+	}
+
+	return s
+}
+
+func newtErrText(err error) string {
+	if nerr, ok := err.(*util.NewtError); ok {
+		return nerr.Text
+	}
+
+	return err.Error()
+}
+
+// validateTarget checks a target for problems that would prevent it from
+// being built.  The checks stop at the first problem that prevents the
+// remaining checks from running.
+func validateTarget(t *target.Target) []validationProblem {
+	name := t.ShortName()
+
+	if err := t.Validate(true); err != nil {
+		text := newtErrText(err)
+
+		var hint string
+		switch {
+		case strings.Contains(text, "(target.bsp)"):
+			hint = fmt.Sprintf("newt target set %s bsp=<bsp-package>", name)
+		case strings.Contains(text, "(target.app)"):
+			hint = fmt.Sprintf("newt target set %s app=<app-package>", name)
+		case strings.Contains(text, "Could not resolve"):
+			hint = "check the package name for typos; if the package is " +
+				"in an external repo, make sure the repo is listed in " +
+				"project.yml and run `newt upgrade`"
+		default:
+			hint = "use `newt target set` to point the target at a " +
+				"package of the correct type"
+		}
+
+		return []validationProblem{{text, hint}}
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		return []validationProblem{{
+			text: newtErrText(err),
+			hint: "the BSP's bsp.yml must specify its architecture " +
+				"(bsp.arch), compiler (bsp.compiler), linker script, and " +
+				"flash map; the compiler package must be installed",
+		}}
+	}
+
+	problems := []validationProblem{}
+
+	if _, err := b.NewCompiler("", ""); err != nil {
+		problems = append(problems, validationProblem{
+			text: newtErrText(err),
+			hint: fmt.Sprintf("choose a build profile that %s supports, "+
+				"e.g., newt target set %s build_profile=debug",
+				b.CompilerPkg().FullName(), name),
+		})
+	}
+
+	cc, ver, err := b.CompilerVersion()
+	if err != nil {
+		problems = append(problems, validationProblem{
+			text: newtErrText(err),
+		})
+	} else if cc != "" && ver == "" {
+		problems = append(problems, validationProblem{
+			text: fmt.Sprintf("compiler %s (from %s) is not installed",
+				cc, b.CompilerPkg().FullName()),
+			hint: fmt.Sprintf("install %s or add its directory to PATH", cc),
+		})
+	}
+
+	res, err := b.Resolve()
+	if err != nil {
+		problems = append(problems, validationProblem{
+			text: newtErrText(err),
+			hint: "check the dependencies of the target's packages",
+		})
+	} else if errText := res.ErrorText(); errText != "" {
+		problems = append(problems, validationProblem{
+			text: errText,
+			hint: "add a package that provides each unsatisfied API to the " +
+				"target or app (pkg.deps), and fix the listed syscfg " +
+				"settings; `newt target config show` lists the settings",
+		})
+	}
+
+	return problems
+}
+
+func targetValidateCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify at least one target"))
+	}
+
+	TryGetProject()
+
+	targets, err := ResolveTargets(args...)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.FullName()
+	}
+
+	failed := []string{}
+	for i, name := range names {
+		// Resolving a target modifies global state; reset it between
+		// targets.
+		if i > 0 {
+			if err := ResetGlobalState(); err != nil {
+				NewtUsage(nil, err)
+			}
+		}
+
+		t := ResolveTarget(name)
+		if t == nil {
+			NewtUsage(nil, util.NewNewtError("Failed to resolve target: "+
+				name))
+		}
+
+		problems := validateTarget(t)
+		if len(problems) == 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "%s: OK\n", name)
+			continue
+		}
+
+		failed = append(failed, name)
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s: %d problem(s)\n",
+			name, len(problems))
+		for _, p := range problems {
+			util.StatusMessage(util.VERBOSITY_QUIET, "    * %s\n",
+				strings.Replace(p.String(), "\n", "\n      ", -1))
+		}
+	}
+
+	if len(failed) > 0 {
+		NewtUsage(nil, util.FmtNewtError("Invalid target(s): %s",
+			strings.Join(failed, " ")))
+	}
+}
+
+func targetValidateCmdAll() []*cobra.Command {
+	validateHelpText := "Check one or more targets for problems before " +
+		"building: the app and BSP\nexist and have the correct types, the " +
+		"BSP's configuration is complete, the\ncompiler supports the " +
+		"target's build profile and is installed, and every\nrequired API " +
+		"has a provider."
+	validateHelpEx := "  newt target validate my_target\n"
+	validateHelpEx += "  newt target validate @nightly"
+
+	validateCmd := &cobra.Command{
+		Use:     "validate <target-name> [target-name...]",
+		Short:   "Check targets for problems before building",
+		Long:    validateHelpText,
+		Example: validateHelpEx,
+		Run:     targetValidateCmd,
+	}
+	AddTabCompleteFn(validateCmd, targetList)
+
+	return []*cobra.Command{validateCmd}
+}
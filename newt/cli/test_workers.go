@@ -0,0 +1,356 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"mynewt.apache.org/newt/newt/benchmark"
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/coverage"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/testreport"
+	"mynewt.apache.org/newt/util"
+)
+
+// Test configuration names become part of a setting name and a target name.
+var testConfigRe = regexp.MustCompile(`^\w+$`)
+
+// testJob is a test package to run on a base target.
+type testJob struct {
+	baseName string
+	pack     *pkg.LocalPackage
+
+	// The test configuration to build the package with; "" for the package's
+	// base configuration.
+	config string
+}
+
+// name returns the name that the test summary lists the job under.
+func (j testJob) name() string {
+	name := j.pack.Name()
+	if j.config != "" {
+		name += "[" + j.config + "]"
+	}
+	if j.baseName != TARGET_TEST_NAME {
+		name += "@" + j.baseName
+	}
+	return name
+}
+
+// testJobsFor creates a job for each configuration that a package is tested
+// with: its base configuration, followed by each of its test configurations.
+func testJobsFor(baseName string, pack *pkg.LocalPackage) ([]testJob, error) {
+	jobs := []testJob{{baseName: baseName, pack: pack}}
+
+	seen := map[string]struct{}{}
+	for _, config := range pack.TestConfigs() {
+		if !testConfigRe.MatchString(config) {
+			return nil, util.FmtNewtError(
+				"package %s has invalid test configuration name \"%s\"; "+
+					"names may only contain letters, digits, and underscores",
+				pack.FullName(), config)
+		}
+		if _, ok := seen[config]; ok {
+			return nil, util.FmtNewtError(
+				"package %s has duplicate test configuration \"%s\"",
+				pack.FullName(), config)
+		}
+		seen[config] = struct{}{}
+
+		jobs = append(jobs, testJob{
+			baseName: baseName,
+			pack:     pack,
+			config:   config,
+		})
+	}
+
+	return jobs, nil
+}
+
+// runTestJob builds and runs a test package in this process.
+func runTestJob(job testJob, opts builder.TestOpts) error {
+	// Reset the global state for the next test.
+	if err := ResetGlobalState(); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	t, err := ResolveUnittestOn(job.baseName, job.pack.Name(), job.config)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if testHwTarget != "" {
+		// The test package provides main(); don't build the target's app
+		// or bootloader with it.
+		t.AppName = ""
+		t.LoaderName = ""
+	}
+
+	b, err := builder.NewTargetTester(t, job.pack)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	desc := job.pack.FullName()
+	if job.config != "" {
+		b.SetTestConfig(job.config)
+		desc += " with configuration " + job.config
+	}
+	if job.baseName != TARGET_TEST_NAME {
+		desc += " on " + job.baseName
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Testing package %s\n", desc)
+
+	if testHwTarget != "" {
+		return b.SelfTestOnTarget(opts)
+	}
+	return b.SelfTestExecute(opts)
+}
+
+// testWorkerResult is the file that a worker process writes its results to.
+type testWorkerResult struct {
+	Suites   []*testreport.Suite
+	Coverage []*coverage.File
+	Bench    []*benchmark.Result
+}
+
+// runTestWorker tests a single package on behalf of a parallel run, and
+// writes the results for the parent process to collect.  The process exits
+// with a nonzero status if the test fails.
+func runTestWorker(job testJob, opts builder.TestOpts) {
+	report, _ := testreport.NewReport(nil)
+	opts.Report = report
+
+	testErr := runTestJob(job, opts)
+	if testErr != nil {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			testErr.(*util.NewtError).Text)
+	}
+
+	res := testWorkerResult{
+		Suites: report.Suites,
+	}
+	if opts.Coverage != nil {
+		for _, f := range opts.Coverage.Files {
+			res.Coverage = append(res.Coverage, f)
+		}
+	}
+	if opts.Bench != nil {
+		res.Bench = opts.Bench.Results
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+	if err := ioutil.WriteFile(testWorkerOut, b, 0644); err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	if testErr != nil {
+		os.Exit(1)
+	}
+}
+
+// testWorkerArgs returns the arguments that run a worker process for a job.
+// The worker inherits the options that affect how the test is built and run;
+// the build jobs are shared among the workers.
+func testWorkerArgs(job testJob, outPath string,
+	opts builder.TestOpts) []string {
+
+	numJobs := newtutil.NewtNumJobs / testParallel
+	if numJobs < 1 {
+		numJobs = 1
+	}
+
+	args := []string{
+		"test", job.pack.FullName(),
+		"--worker-base", job.baseName,
+		"--worker-config", job.config,
+		"--worker-out", outPath,
+		"-j", strconv.Itoa(numJobs),
+	}
+
+	switch util.Verbosity {
+	case util.VERBOSITY_SILENT:
+		args = append(args, "-s")
+	case util.VERBOSITY_QUIET:
+		args = append(args, "-q")
+	case util.VERBOSITY_VERBOSE:
+		args = append(args, "-v")
+	}
+
+	if opts.Filter != "" {
+		args = append(args, "-f", opts.Filter)
+	}
+	if opts.Coverage != nil {
+		args = append(args, "--coverage")
+	}
+	if opts.Bench != nil {
+		args = append(args, "--bench")
+	}
+	if opts.Valgrind {
+		args = append(args, "--valgrind")
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	if opts.Retries > 0 {
+		args = append(args, "--retries", strconv.Itoa(opts.Retries))
+	}
+	if opts.Repeat > 1 {
+		args = append(args, "--repeat", strconv.Itoa(opts.Repeat))
+	}
+	if opts.UntilFailure {
+		args = append(args, "--until-failure")
+	}
+	if opts.Timeout > 0 {
+		args = append(args, "--timeout", opts.Timeout.String())
+	}
+	if util.ExecuteShell {
+		args = append(args, "--executeShell")
+	}
+
+	return args
+}
+
+// runTestWorkerProcess runs a job in a worker process.
+//
+// @return []byte               The worker's output.
+// @return *testWorkerResult    The worker's results; nil if it did not
+//                                  write any.
+// @return error                Error if the test failed.
+func runTestWorkerProcess(job testJob, tmpDir string, idx int,
+	opts builder.TestOpts) ([]byte, *testWorkerResult, error) {
+
+	newt, err := os.Executable()
+	if err != nil {
+		return nil, nil, util.ChildNewtError(err)
+	}
+
+	outPath := filepath.Join(tmpDir, strconv.Itoa(idx)+".json")
+	cmd := exec.Command(newt, testWorkerArgs(job, outPath, opts)...)
+	cmd.Dir = project.GetProject().Path()
+
+	util.LogShellCmd(cmd.Args, nil)
+	out, runErr := cmd.CombinedOutput()
+
+	var res *testWorkerResult
+	if b, err := ioutil.ReadFile(outPath); err == nil {
+		res = &testWorkerResult{}
+		if err := json.Unmarshal(b, res); err != nil {
+			return out, nil, util.FmtNewtError(
+				"invalid worker results %s: %s", outPath, err.Error())
+		}
+	}
+
+	if runErr != nil {
+		return out, res, util.ChildNewtError(runErr)
+	}
+
+	return out, res, nil
+}
+
+// runTestJobsParallel runs the jobs in a pool of worker processes.  Each
+// worker's output is displayed in one piece when it finishes, so the output
+// of different packages is not interleaved.
+//
+// @return []string             The names of the jobs that passed.
+// @return []string             The names of the jobs that failed.
+func runTestJobsParallel(jobs []testJob,
+	opts builder.TestOpts) ([]string, []string) {
+
+	tmpDir, err := ioutil.TempDir("", "newt-test")
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+	defer os.RemoveAll(tmpDir)
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Running %d test builds, %d at a time\n", len(jobs), testParallel)
+
+	passed := make([]bool, len(jobs))
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	jobChan := make(chan int)
+
+	for w := 0; w < testParallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobChan {
+				out, res, err := runTestWorkerProcess(jobs[idx], tmpDir, idx,
+					opts)
+
+				mtx.Lock()
+				// The worker's output already reflects the verbosity.
+				util.StatusMessage(util.VERBOSITY_SILENT, "%s", out)
+				if err != nil && res == nil {
+					util.StatusMessage(util.VERBOSITY_QUIET, "%s\n",
+						err.Error())
+				}
+				if res != nil {
+					if opts.Report != nil {
+						opts.Report.Add(res.Suites...)
+					}
+					if opts.Coverage != nil {
+						for _, f := range res.Coverage {
+							opts.Coverage.Add(f)
+						}
+					}
+					if opts.Bench != nil {
+						opts.Bench.Add(res.Bench...)
+					}
+				}
+				passed[idx] = err == nil
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	for idx := range jobs {
+		jobChan <- idx
+	}
+	close(jobChan)
+	wg.Wait()
+
+	// List the results in the order of the jobs, as a serial run does.
+	var passedNames []string
+	var failedNames []string
+	for idx, job := range jobs {
+		if passed[idx] {
+			passedNames = append(passedNames, job.name())
+		} else {
+			failedNames = append(failedNames, job.name())
+		}
+	}
+
+	return passedNames, failedNames
+}
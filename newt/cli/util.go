@@ -101,6 +101,19 @@ func ResolveTarget(name string) *target.Target {
 		return t
 	}
 
+	// Check the project's target aliases.
+	if alias := targetAlias(name); alias != "" {
+		if t := targetMap[alias]; t != nil {
+			return t
+		}
+		if t := targetMap[TARGET_DEFAULT_DIR+"/"+alias]; t != nil {
+			return t
+		}
+
+		util.OneTimeWarning("target alias \"%s\" refers to unknown "+
+			"target \"%s\"", name, alias)
+	}
+
 	// Check each repo alphabetically.
 	fullNames := []string{}
 	for fullName, _ := range targetMap {
@@ -115,18 +128,179 @@ func ResolveTarget(name string) *target.Target {
 	return nil
 }
 
+// targetAlias retrieves the target name that the specified alias refers to,
+// or "" if the name is not an alias.
+func targetAlias(name string) string {
+	return project.GetProject().TargetAliases()[name]
+}
+
+// fuzzyTargetMatches finds the targets whose names match the specified
+// string using the provided comparison function.  Both the full name and the
+// last element of each target's name are compared.
+func fuzzyTargetMatches(name string,
+	match func(s string, name string) bool) []string {
+
+	matches := []string{}
+	for _, fullName := range targetList() {
+		if match(fullName, name) || match(filepath.Base(fullName), name) {
+			matches = append(matches, fullName)
+		}
+	}
+
+	return matches
+}
+
+// fuzzyResolveTarget finds the targets that a partial target name refers to.
+// Prefix matches are preferred to substring matches.  The name is unambiguous
+// if exactly one target is returned.
+func fuzzyResolveTarget(name string) []string {
+	name = strings.TrimSuffix(name, "/")
+	if name == "" {
+		return nil
+	}
+
+	for _, match := range []func(string, string) bool{
+		strings.HasPrefix, strings.Contains,
+	} {
+		if matches := fuzzyTargetMatches(name, match); len(matches) > 0 {
+			return matches
+		}
+	}
+
+	return nil
+}
+
+// ResolveTargetArg resolves a target name specified on the command line.
+func ResolveTargetArg(name string) (*target.Target, error) {
+	t := ResolveTarget(name)
+	if t == nil {
+		return nil, util.NewNewtError("Unknown target: " + name)
+	}
+
+	return t, nil
+}
+
+// ResolvePartialTargetArg resolves a target name specified on the command
+// line of a command that only uses the target (build, load, and debug).  In
+// addition to the names that ResolveTarget accepts, an unambiguous prefix or
+// substring of a target's name is accepted.  If a prefix or substring matches
+// several targets, the error lists them.  Commands that modify or delete
+// targets must not accept partial names.
+func ResolvePartialTargetArg(name string) (*target.Target, error) {
+	if t := ResolveTarget(name); t != nil {
+		return t, nil
+	}
+
+	matches := fuzzyResolveTarget(name)
+	switch len(matches) {
+	case 0:
+		return nil, util.NewNewtError("Unknown target: " + name)
+
+	case 1:
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Target \"%s\" matches %s\n", name, matches[0])
+		return ResolveTarget(matches[0]), nil
+
+	default:
+		return nil, util.FmtNewtError(
+			"Target name \"%s\" is ambiguous; it matches:\n    %s",
+			name, strings.Join(matches, "\n    "))
+	}
+}
+
+// targetArgsOrDefault returns the target names specified on the command line,
+// or the project's default target if none were specified (see `newt target
+// default`).  The command's usage is printed if there is no default target.
+func targetArgsOrDefault(cmd *cobra.Command, args []string) []string {
+	if len(args) > 0 {
+		return args
+	}
+
+	name := TryGetProject().DefaultTarget()
+	if name == "" {
+		NewtUsage(cmd, util.NewNewtError("Must specify target; the project "+
+			"has no default target (see `newt target default`)"))
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Using default target %s\n", name)
+	return []string{name}
+}
+
+// targetTagArg determines whether a command-line argument refers to a target
+// tag (e.g., "@nightly").  Tag arguments are distinguished from repo-qualified
+// names (e.g., "@apache-mynewt-core/...") by the absence of a slash.
+//
+// @return string               The tag name.
+// @return bool                 Whether the argument is a tag.
+func targetTagArg(name string) (string, bool) {
+	if !strings.HasPrefix(name, "@") || strings.Contains(name, "/") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(name, "@"), true
+}
+
+// ResolveTaggedTargets retrieves all targets whose `target.tags` list
+// contains the specified tag, sorted by name.  An error is reported if no
+// target carries the tag.
+func ResolveTaggedTargets(tag string) ([]*target.Target, error) {
+	targets := []*target.Target{}
+	for _, name := range targetList() {
+		t := ResolveTarget(name)
+		if t != nil && t.HasTag(tag) {
+			targets = append(targets, t)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, util.FmtNewtError("No targets with tag \"%s\"", tag)
+	}
+
+	return targets, nil
+}
+
 // Resolves a list of target names and checks for the optional "all" keyword
 // among them.  Regardless of whether "all" is specified, all target names must
-// be valid, or an error is reported.
+// be valid, or an error is reported.  A "@<tag>" argument resolves to every
+// target carrying the tag.
 //
 // @return                      targets, all (t/f), err
 func ResolveTargetsOrAll(names ...string) ([]*target.Target, bool, error) {
+	return resolveTargetsOrAll(false, names...)
+}
+
+// ResolvePartialTargetsOrAll is like ResolveTargetsOrAll, but also accepts
+// partial target names (see ResolvePartialTargetArg).
+func ResolvePartialTargetsOrAll(names ...string) (
+	[]*target.Target, bool, error) {
+
+	return resolveTargetsOrAll(true, names...)
+}
+
+func resolveTargetsOrAll(partial bool, names ...string) (
+	[]*target.Target, bool, error) {
+
 	targets := []*target.Target{}
 	all := false
 
 	for _, name := range names {
 		if name == "all" {
 			all = true
+		} else if tag, ok := targetTagArg(name); ok {
+			tagged, err := ResolveTaggedTargets(tag)
+			if err != nil {
+				return nil, false, err
+			}
+
+			targets = append(targets, tagged...)
+		} else if partial {
+			t, err := ResolvePartialTargetArg(name)
+			if err != nil {
+				return nil, false, err
+			}
+
+			targets = append(targets, t)
 		} else {
 			t := ResolveTarget(name)
 			if t == nil {
@@ -170,6 +344,11 @@ func ResolveNewTargetName(name string) (string, error) {
 			" is reserved")
 	}
 
+	if alias := targetAlias(pkgName); alias != "" {
+		return "", util.FmtNewtError(
+			"Target name %s is an alias for %s", pkgName, alias)
+	}
+
 	// "Naked" target names translate to "targets/<name>".
 	if !strings.Contains(pkgName, "/") {
 		pkgName = TARGET_DEFAULT_DIR + "/" + pkgName
@@ -223,6 +402,15 @@ func TryGetProject() *project.Project {
 }
 
 func ResolveUnittest(pkgName string) (*target.Target, error) {
+	return ResolveUnittestOn(TARGET_TEST_NAME, pkgName, "")
+}
+
+// ResolveUnittestOn retrieves the target used to run a package's unit tests,
+// basing it on the specified target rather than the default unit test target.
+// A nonempty config selects one of the package's test configurations.
+func ResolveUnittestOn(baseName string, pkgName string, config string) (
+	*target.Target, error) {
+
 	// Each unit test package gets its own target.  This target is a copy
 	// of the base unit test package, just with an appropriate name.  The
 	// reason each test needs a unique target is: syscfg and sysinit are
@@ -230,15 +418,26 @@ func ResolveUnittest(pkgName string) (*target.Target, error) {
 	// overwrite these generated headers each time they are run.  Worse, if
 	// two tests are run back-to-back, the timestamps may indicate that the
 	// headers have not changed between tests, causing build failures.
-	baseTarget := ResolveTarget(TARGET_TEST_NAME)
+	baseTarget := ResolveTarget(baseName)
 	if baseTarget == nil {
 		return nil, util.FmtNewtError("Can't find unit test target: %s",
-			TARGET_TEST_NAME)
+			baseName)
+	}
+
+	testName := builder.TestTargetName(pkgName)
+	if config != "" {
+		// Each test configuration has its own syscfg.
+		testName += "-" + config
 	}
 
 	targetName := fmt.Sprintf("%s/%s/%s",
-		TARGET_DEFAULT_DIR, TARGET_TEST_NAME,
-		builder.TestTargetName(pkgName))
+		TARGET_DEFAULT_DIR, TARGET_TEST_NAME, testName)
+	if baseName != TARGET_TEST_NAME {
+		// Keep each base target's test builds separate.
+		targetName = fmt.Sprintf("%s/%s/%s/%s",
+			TARGET_DEFAULT_DIR, TARGET_TEST_NAME, baseTarget.ShortName(),
+			testName)
+	}
 
 	t := ResolveTarget(targetName)
 	if t == nil {
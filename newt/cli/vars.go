@@ -75,6 +75,30 @@ func settingValues(settingName string) ([]string, error) {
 	return values, nil
 }
 
+// syscfgSettingNames returns the names of all syscfg settings defined by
+// packages in the project.  Settings that are only defined under a
+// conditional key are not included.
+func syscfgSettingNames() ([]string, error) {
+	nameMap := map[string]struct{}{}
+
+	packs := project.GetProject().PackagesOfType(-1)
+	for _, pack := range packs {
+		lpkg := pack.(*pkg.LocalPackage)
+		defs := lpkg.SyscfgY.GetValStringMap("syscfg.defs", nil)
+		for name, _ := range defs {
+			nameMap[name] = struct{}{}
+		}
+	}
+
+	values := make([]string, 0, len(nameMap))
+	for name, _ := range nameMap {
+		values = append(values, name)
+	}
+	sort.Strings(values)
+
+	return values, nil
+}
+
 func buildProfileValues() ([]string, error) {
 	profileMap := map[string]struct{}{}
 
@@ -118,6 +142,9 @@ var varsMap = map[string]func() ([]string, error){
 	"compiler": func() ([]string, error) {
 		return varsFromPackageType(pkg.PACKAGE_TYPE_COMPILER, true)
 	},
+	"fuzz": func() ([]string, error) {
+		return varsFromPackageType(pkg.PACKAGE_TYPE_FUZZ, true)
+	},
 	"lib": func() ([]string, error) {
 		return varsFromPackageType(pkg.PACKAGE_TYPE_LIB, true)
 	},
@@ -133,6 +160,16 @@ var varsMap = map[string]func() ([]string, error){
 		return settingValues("pkg.apis")
 	},
 
+	// Syscfg settings.
+	"syscfg": func() ([]string, error) {
+		return syscfgSettingNames()
+	},
+
+	// Project settings.
+	"test_profile": func() ([]string, error) {
+		return project.GetProject().TestProfileNames(), nil
+	},
+
 	// Target settings.
 	"build_profile": func() ([]string, error) {
 		return buildProfileValues()
@@ -234,3 +234,34 @@ func ReadFile(path string) (ycfg.YCfg, error) {
 
 	return yc, nil
 }
+
+// ApplyOverrideFile reads a YAML file, processes its `$import` directives, and
+// applies its settings on top of an existing YCfg tree.  Unlike ReadFile,
+// which appends to lists and rejects conflicting scalars, an override file
+// replaces every value it specifies.  The one exception is maps: a map is
+// merged into the existing map so that the override file only needs to
+// specify the fields it changes.
+func ApplyOverrideFile(yc *ycfg.YCfg, path string) error {
+	entries, err := readLineage(path)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		for k, v := range e.Settings {
+			_, newIsMap := v.(map[interface{}]interface{})
+			_, curIsMap := yc.GetFirstVal(k, nil).(map[interface{}]interface{})
+
+			if newIsMap && curIsMap {
+				err = yc.MergeFromFile(k, v, e.FileInfo)
+			} else {
+				err = yc.ReplaceFromFile(k, v, e.FileInfo)
+			}
+			if err != nil {
+				return e.FileInfo.Parent.ErrTree(err)
+			}
+		}
+	}
+
+	return nil
+}
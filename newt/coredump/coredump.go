@@ -0,0 +1,171 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package coredump parses the core dumps that Mynewt's coredump package
+// writes to flash, and converts them to ELF core files that gdb can load.
+package coredump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const COREDUMP_MAGIC = 0x690c47c3
+
+// TLV types.
+const (
+	COREDUMP_TLV_IMAGE = 1
+	COREDUMP_TLV_MEM   = 2
+	COREDUMP_TLV_REGS  = 3
+)
+
+const (
+	coredumpHdrSz = 8
+	coredumpTlvSz = 8
+)
+
+type coredumpHdr struct {
+	Magic uint32
+	Size  uint32
+}
+
+type coredumpTlv struct {
+	Type uint8
+	Pad  uint8
+	Len  uint16
+	Off  uint32
+}
+
+// A region of memory captured in a core dump.
+type MemRegion struct {
+	Addr uint32
+	Data []byte
+}
+
+// A parsed core dump.
+type CoreDump struct {
+	// Hash of the image that was running when the dump was taken; nil if
+	// the dump does not record it.
+	ImageHash []byte
+
+	// Register values, in the order the MCU's fault handler saved them
+	// (r0-r12, sp, lr, pc, psr on Cortex-M).
+	Regs []uint32
+
+	Mem []MemRegion
+}
+
+// Parse parses a core dump.  Bytes following the dump (e.g., the rest of the
+// flash area it was read from) are ignored.
+//
+// @param data                  The raw core dump.
+//
+// @return *CoreDump            The parsed core dump.
+// @return error                Error if the data does not contain a valid
+//                                  core dump.
+func Parse(data []byte) (*CoreDump, error) {
+	if len(data) < coredumpHdrSz {
+		return nil, util.NewNewtError("core dump is truncated")
+	}
+
+	var hdr coredumpHdr
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &hdr)
+	if hdr.Magic != COREDUMP_MAGIC {
+		return nil, util.FmtNewtError(
+			"no core dump present (magic=0x%08x)", hdr.Magic)
+	}
+	if int(hdr.Size) > len(data) || hdr.Size < coredumpHdrSz {
+		return nil, util.FmtNewtError(
+			"invalid core dump size: %d (have %d bytes)", hdr.Size, len(data))
+	}
+	data = data[coredumpHdrSz:hdr.Size]
+
+	cd := &CoreDump{}
+	for len(data) > 0 {
+		if len(data) < coredumpTlvSz {
+			return nil, util.NewNewtError("core dump TLV is truncated")
+		}
+
+		var tlv coredumpTlv
+		binary.Read(bytes.NewReader(data), binary.LittleEndian, &tlv)
+		data = data[coredumpTlvSz:]
+
+		if int(tlv.Len) > len(data) {
+			return nil, util.FmtNewtError(
+				"core dump TLV (type=%d) is truncated", tlv.Type)
+		}
+		val := data[:tlv.Len]
+		data = data[tlv.Len:]
+
+		switch tlv.Type {
+		case COREDUMP_TLV_IMAGE:
+			cd.ImageHash = val
+		case COREDUMP_TLV_MEM:
+			cd.Mem = append(cd.Mem, MemRegion{
+				Addr: tlv.Off,
+				Data: val,
+			})
+		case COREDUMP_TLV_REGS:
+			cd.Regs = make([]uint32, len(val)/4)
+			binary.Read(bytes.NewReader(val), binary.LittleEndian, cd.Regs)
+		default:
+			return nil, util.FmtNewtError(
+				"core dump contains unknown TLV type %d", tlv.Type)
+		}
+	}
+
+	return cd, nil
+}
+
+// String summarizes the core dump's contents.
+func (cd *CoreDump) String() string {
+	var buf bytes.Buffer
+
+	if cd.ImageHash != nil {
+		fmt.Fprintf(&buf, "image hash: %x\n", cd.ImageHash)
+	}
+	if len(cd.Regs) >= 16 {
+		fmt.Fprintf(&buf, "pc: 0x%08x lr: 0x%08x sp: 0x%08x\n",
+			cd.Regs[15], cd.Regs[14], cd.Regs[13])
+	}
+	for _, m := range cd.Mem {
+		fmt.Fprintf(&buf, "memory: 0x%08x-0x%08x\n",
+			m.Addr, m.Addr+uint32(len(m.Data)))
+	}
+
+	return buf.String()
+}
+
+// MatchesImage indicates whether the core dump was taken while the image with
+// the specified hash was running.  A dump that does not record an image hash
+// matches any image.
+func (cd *CoreDump) MatchesImage(hash []byte) bool {
+	if cd.ImageHash == nil {
+		return true
+	}
+
+	n := len(cd.ImageHash)
+	if n > len(hash) {
+		return false
+	}
+	return bytes.Equal(cd.ImageHash, hash[:n])
+}
@@ -0,0 +1,167 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package coredump
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// ELF core file layout.  gdb reads the registers from an NT_PRSTATUS note
+// and the memory from PT_LOAD segments.
+const (
+	elfHdrSz   = 52
+	elfPhdrSz  = 32
+	elfNoteHdr = 12
+
+	// Size of the ARM Linux elf_prstatus structure, and the offset and
+	// number of registers within it.
+	armPrstatusSz   = 148
+	armPrstatusRegs = 72
+	armNumRegs      = 18
+)
+
+var elfNoteName = []byte("CORE\x00\x00\x00\x00")
+
+type elfHdr struct {
+	Ident     [elf.EI_NIDENT]byte
+	Type      uint16
+	Machine   uint16
+	Version   uint32
+	Entry     uint32
+	Phoff     uint32
+	Shoff     uint32
+	Flags     uint32
+	Ehsize    uint16
+	Phentsize uint16
+	Phnum     uint16
+	Shentsize uint16
+	Shnum     uint16
+	Shstrndx  uint16
+}
+
+type elfPhdr struct {
+	Type   uint32
+	Off    uint32
+	Vaddr  uint32
+	Paddr  uint32
+	Filesz uint32
+	Memsz  uint32
+	Flags  uint32
+	Align  uint32
+}
+
+// prstatus builds an NT_PRSTATUS note descriptor holding the dump's
+// registers.
+func (cd *CoreDump) prstatus() []byte {
+	desc := make([]byte, armPrstatusSz)
+
+	// r0-r15 map directly; psr takes the place of cpsr.
+	for i := 0; i < len(cd.Regs) && i < armNumRegs-1; i++ {
+		binary.LittleEndian.PutUint32(desc[armPrstatusRegs+i*4:], cd.Regs[i])
+	}
+
+	return desc
+}
+
+// ElfCore converts the core dump to a 32-bit ARM ELF core file.
+func (cd *CoreDump) ElfCore() ([]byte, error) {
+	if len(cd.Regs) < 16 {
+		return nil, util.FmtNewtError(
+			"core dump contains %d registers; need at least 16",
+			len(cd.Regs))
+	}
+
+	desc := cd.prstatus()
+	noteSz := elfNoteHdr + len(elfNoteName) + len(desc)
+	phnum := 1 + len(cd.Mem)
+
+	hdr := elfHdr{
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(elf.EM_ARM),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     elfHdrSz,
+		Ehsize:    elfHdrSz,
+		Phentsize: elfPhdrSz,
+		Phnum:     uint16(phnum),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	off := uint32(elfHdrSz + phnum*elfPhdrSz)
+	phdrs := []elfPhdr{{
+		Type:   uint32(elf.PT_NOTE),
+		Off:    off,
+		Filesz: uint32(noteSz),
+	}}
+	off += uint32(noteSz)
+
+	for _, m := range cd.Mem {
+		phdrs = append(phdrs, elfPhdr{
+			Type:   uint32(elf.PT_LOAD),
+			Off:    off,
+			Vaddr:  m.Addr,
+			Paddr:  m.Addr,
+			Filesz: uint32(len(m.Data)),
+			Memsz:  uint32(len(m.Data)),
+			Flags:  uint32(elf.PF_R | elf.PF_W | elf.PF_X),
+		})
+		off += uint32(len(m.Data))
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, hdr)
+	binary.Write(&buf, binary.LittleEndian, phdrs)
+
+	binary.Write(&buf, binary.LittleEndian, []uint32{
+		uint32(len("CORE") + 1),
+		uint32(len(desc)),
+		uint32(elf.NT_PRSTATUS),
+	})
+	buf.Write(elfNoteName)
+	buf.Write(desc)
+
+	for _, m := range cd.Mem {
+		buf.Write(m.Data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteElfCore converts the core dump to an ELF core file and writes it to
+// the specified path.
+func (cd *CoreDump) WriteElfCore(path string) error {
+	data, err := cd.ElfCore()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package coverage aggregates the line and branch coverage that gcov reports
+// for unit test executables.
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Summary counts the lines and branches of a set of source files, and how
+// many of them were executed.
+type Summary struct {
+	Lines       int
+	LinesHit    int
+	Branches    int
+	BranchesHit int
+}
+
+func pct(hit int, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(hit) / float64(total)
+}
+
+// LinePct returns the percentage of lines executed.
+func (s Summary) LinePct() float64 {
+	return pct(s.LinesHit, s.Lines)
+}
+
+// BranchPct returns the percentage of branches taken.
+func (s Summary) BranchPct() float64 {
+	return pct(s.BranchesHit, s.Branches)
+}
+
+func (s *Summary) add(other Summary) {
+	s.Lines += other.Lines
+	s.LinesHit += other.LinesHit
+	s.Branches += other.Branches
+	s.BranchesHit += other.BranchesHit
+}
+
+// File is the coverage of a source file.
+type File struct {
+	// The path of the source file.
+	Path string
+
+	// The package that contains the file.
+	Package string
+
+	// Line number => execution count, for each executable line.
+	Lines map[int]int64
+
+	// Line number => whether each of the line's branches was taken.
+	Branches map[int][]bool
+}
+
+func newFile(path string) *File {
+	return &File{
+		Path:     path,
+		Lines:    map[int]int64{},
+		Branches: map[int][]bool{},
+	}
+}
+
+// Summary counts the file's lines and branches.
+func (f *File) Summary() Summary {
+	s := Summary{}
+	for _, count := range f.Lines {
+		s.Lines++
+		if count > 0 {
+			s.LinesHit++
+		}
+	}
+	for _, taken := range f.Branches {
+		for _, t := range taken {
+			s.Branches++
+			if t {
+				s.BranchesHit++
+			}
+		}
+	}
+
+	return s
+}
+
+// merge adds the counts of another run of the same file.
+func (f *File) merge(other *File) {
+	for line, count := range other.Lines {
+		f.Lines[line] += count
+	}
+	for line, taken := range other.Branches {
+		cur := f.Branches[line]
+		for i, t := range taken {
+			if i >= len(cur) {
+				cur = append(cur, t)
+			} else {
+				cur[i] = cur[i] || t
+			}
+		}
+		f.Branches[line] = cur
+	}
+}
+
+// parseCount parses the execution count column of a .gcov file.
+//
+// @return int64                The count.
+// @return bool                 Whether the line is executable.
+func parseCount(s string) (int64, bool, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "*")
+	switch s {
+	case "-":
+		return 0, false, nil
+	case "#####", "=====", "$$$$$", "%%%%%":
+		return 0, true, nil
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false, util.FmtNewtError("invalid gcov count \"%s\"", s)
+	}
+
+	return n, true, nil
+}
+
+// ParseGcov parses a .gcov file that gcov produced with branch counts
+// (`gcov -b -c`).
+//
+// @return *File                The file's coverage; its path is the
+//                                  "Source" that gcov reports.
+func ParseGcov(r io.Reader) (*File, error) {
+	f := newFile("")
+
+	curLine := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+
+		// branch  0 taken 3 (fallthrough)
+		// branch  1 never executed
+		if strings.HasPrefix(text, "branch ") {
+			if curLine == 0 {
+				continue
+			}
+			fields := strings.Fields(text)
+			taken := len(fields) >= 4 && fields[2] == "taken" &&
+				fields[3] != "0" && fields[3] != "0%"
+			f.Branches[curLine] = append(f.Branches[curLine], taken)
+			continue
+		}
+
+		// <count>:<line>:<source>
+		parts := strings.SplitN(text, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		line, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			continue
+		}
+
+		if line == 0 {
+			if strings.HasPrefix(parts[2], "Source:") {
+				f.Path = strings.TrimPrefix(parts[2], "Source:")
+			}
+			continue
+		}
+
+		count, exec, err := parseCount(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		curLine = line
+		if exec {
+			f.Lines[line] += count
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	if f.Path == "" {
+		return nil, util.NewNewtError("gcov output does not name its source")
+	}
+
+	return f, nil
+}
+
+// Package is the coverage of a package's source files.
+type Package struct {
+	Name    string
+	Files   []*File
+	Summary Summary
+}
+
+// Data is the coverage of all the source files that tests executed.
+type Data struct {
+	// Source path => coverage.
+	Files map[string]*File
+}
+
+func NewData() *Data {
+	return &Data{
+		Files: map[string]*File{},
+	}
+}
+
+// Add records the coverage of a file.  If the file was already recorded
+// (e.g., because several test executables contain it), the counts are
+// combined.
+func (d *Data) Add(f *File) {
+	if cur := d.Files[f.Path]; cur != nil {
+		cur.merge(f)
+	} else {
+		d.Files[f.Path] = f
+	}
+}
+
+// Packages returns the coverage of each package, sorted by name.
+func (d *Data) Packages() []*Package {
+	pkgMap := map[string]*Package{}
+	for _, f := range d.Files {
+		p := pkgMap[f.Package]
+		if p == nil {
+			p = &Package{Name: f.Package}
+			pkgMap[f.Package] = p
+		}
+		p.Files = append(p.Files, f)
+		p.Summary.add(f.Summary())
+	}
+
+	var pkgs []*Package
+	for _, p := range pkgMap {
+		sort.Slice(p.Files, func(i int, j int) bool {
+			return p.Files[i].Path < p.Files[j].Path
+		})
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i int, j int) bool {
+		return pkgs[i].Name < pkgs[j].Name
+	})
+
+	return pkgs
+}
+
+// Total returns the combined coverage of all files.
+func (d *Data) Total() Summary {
+	s := Summary{}
+	for _, f := range d.Files {
+		s.add(f.Summary())
+	}
+
+	return s
+}
+
+// WriteSummary writes a table of each package's coverage, and the total.
+func (d *Data) WriteSummary(w io.Writer) {
+	pkgs := d.Packages()
+
+	width := len("Total")
+	for _, p := range pkgs {
+		if len(p.Name) > width {
+			width = len(p.Name)
+		}
+	}
+
+	fmt.Fprintf(w, "%-*s %19s %19s\n", width, "Package", "Lines",
+		"Branches")
+	row := func(name string, s Summary) {
+		fmt.Fprintf(w, "%-*s %6.1f%% %11s %6.1f%% %11s\n", width, name,
+			s.LinePct(), fmt.Sprintf("%d/%d", s.LinesHit, s.Lines),
+			s.BranchPct(), fmt.Sprintf("%d/%d", s.BranchesHit, s.Branches))
+	}
+	for _, p := range pkgs {
+		row(p.Name, p.Summary)
+	}
+	row("Total", d.Total())
+}
@@ -0,0 +1,248 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const htmlStyle = `
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { padding: 2px 8px; text-align: left; }
+td.num { text-align: right; }
+pre { margin: 0; }
+.hit { background-color: #dfd; }
+.miss { background-color: #fdd; }
+.partial { background-color: #ffd; }
+`
+
+var indexTmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Test coverage</title>
+<style>` + htmlStyle + `</style>
+</head>
+<body>
+<h1>Test coverage</h1>
+<table>
+<tr><th>Package / file</th><th>Lines</th><th></th><th>Branches</th><th></th></tr>
+{{range .Packages}}
+<tr><th>{{.Name}}</th>
+<td class="num">{{printf "%.1f%%" .Summary.LinePct}}</td>
+<td class="num">{{.Summary.LinesHit}}/{{.Summary.Lines}}</td>
+<td class="num">{{printf "%.1f%%" .Summary.BranchPct}}</td>
+<td class="num">{{.Summary.BranchesHit}}/{{.Summary.Branches}}</td></tr>
+{{range .Files}}
+<tr><td><a href="{{.Page}}">{{.Path}}</a></td>
+<td class="num">{{printf "%.1f%%" .Summary.LinePct}}</td>
+<td class="num">{{.Summary.LinesHit}}/{{.Summary.Lines}}</td>
+<td class="num">{{printf "%.1f%%" .Summary.BranchPct}}</td>
+<td class="num">{{.Summary.BranchesHit}}/{{.Summary.Branches}}</td></tr>
+{{end}}
+{{end}}
+<tr><th>Total</th>
+<td class="num">{{printf "%.1f%%" .Total.LinePct}}</td>
+<td class="num">{{.Total.LinesHit}}/{{.Total.Lines}}</td>
+<td class="num">{{printf "%.1f%%" .Total.BranchPct}}</td>
+<td class="num">{{.Total.BranchesHit}}/{{.Total.Branches}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+var fileTmpl = template.Must(template.New("file").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Path}}</title>
+<style>` + htmlStyle + `</style>
+</head>
+<body>
+<h1>{{.Path}}</h1>
+<p><a href="index.html">Index</a></p>
+<table>
+<tr><th>Line</th><th>Count</th><th>Branches</th><th>Source</th></tr>
+{{range .Lines}}
+<tr class="{{.Class}}"><td class="num">{{.Num}}</td>
+<td class="num">{{.Count}}</td><td>{{.Branches}}</td>
+<td><pre>{{.Text}}</pre></td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+type htmlFile struct {
+	Path    string
+	Page    string
+	Summary Summary
+}
+
+type htmlPackage struct {
+	Name    string
+	Summary Summary
+	Files   []htmlFile
+}
+
+type htmlLine struct {
+	Num      int
+	Count    string
+	Branches string
+	Class    string
+	Text     string
+}
+
+// pageName returns the name of the page that displays a source file.
+func pageName(path string) string {
+	r := strings.NewReplacer("/", "_", "\\", "_", ":", "_")
+	return r.Replace(strings.TrimPrefix(filepath.ToSlash(path), "/")) +
+		".html"
+}
+
+// htmlLines annotates each line of a source file with its coverage.
+func htmlLines(f *File) ([]htmlLine, error) {
+	src, err := os.Open(f.Path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	defer src.Close()
+
+	var lines []htmlLine
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(nil, 1024*1024)
+	for num := 1; scanner.Scan(); num++ {
+		hl := htmlLine{
+			Num:  num,
+			Text: scanner.Text(),
+		}
+
+		if count, ok := f.Lines[num]; ok {
+			hl.Count = fmt.Sprintf("%d", count)
+			if count > 0 {
+				hl.Class = "hit"
+			} else {
+				hl.Class = "miss"
+			}
+		}
+
+		if taken := f.Branches[num]; len(taken) > 0 {
+			n := 0
+			for _, t := range taken {
+				if t {
+					n++
+				}
+			}
+			hl.Branches = fmt.Sprintf("%d/%d", n, len(taken))
+			if n < len(taken) && hl.Class == "hit" {
+				hl.Class = "partial"
+			}
+		}
+
+		lines = append(lines, hl)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return lines, nil
+}
+
+func writeTmpl(path string, tmpl *template.Template,
+	data interface{}) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	if err := tmpl.Execute(f, data); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// WriteHtml writes an HTML report to the specified directory: an index of
+// each package's and file's coverage, and a page for each source file with
+// its lines annotated.
+//
+// @param dir                   The directory to write the report to; created
+//                                  if it does not exist.
+// @param relTo                 Source paths are displayed relative to this
+//                                  directory.
+func (d *Data) WriteHtml(dir string, relTo string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	var pkgs []htmlPackage
+	for _, p := range d.Packages() {
+		hp := htmlPackage{
+			Name:    p.Name,
+			Summary: p.Summary,
+		}
+
+		for _, f := range p.Files {
+			path := f.Path
+			if rel, err := filepath.Rel(relTo, f.Path); err == nil {
+				path = rel
+			}
+
+			lines, err := htmlLines(f)
+			if err != nil {
+				return err
+			}
+
+			page := pageName(path)
+			err = writeTmpl(filepath.Join(dir, page), fileTmpl,
+				struct {
+					Path  string
+					Lines []htmlLine
+				}{path, lines})
+			if err != nil {
+				return err
+			}
+
+			hp.Files = append(hp.Files, htmlFile{
+				Path:    path,
+				Page:    page,
+				Summary: f.Summary(),
+			})
+		}
+
+		pkgs = append(pkgs, hp)
+	}
+
+	return writeTmpl(filepath.Join(dir, "index.html"), indexTmpl,
+		struct {
+			Packages []htmlPackage
+			Total    Summary
+		}{pkgs, d.Total()})
+}
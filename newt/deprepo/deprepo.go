@@ -43,6 +43,13 @@ type RequirementMap map[string][]newtutil.RepoVersionReq
 type Conflict struct {
 	RepoName string
 	Filters  []Filter
+
+	// All known versions of the repo.
+	AllVers []newtutil.RepoVersion
+
+	// The version of the repo in the closest-match version set; nil if no
+	// version of the repo survived pruning.
+	Chosen *newtutil.RepoVersion
 }
 
 // Returns a sorted slice of all constituent repo names.
@@ -249,28 +256,91 @@ func PruneDepGraph(dg DepGraph, keep []*repo.Repo) {
 	}
 }
 
-// Produces an error describing the specified set of repo conflicts.
-func ConflictError(conflicts []Conflict) error {
-	s := ""
+func versionsString(vers []newtutil.RepoVersion) string {
+	if len(vers) == 0 {
+		return "none"
+	}
+
+	strs := make([]string, len(vers))
+	for i, v := range vers {
+		strs[i] = v.String()
+	}
+
+	return strings.Join(strs, ", ")
+}
 
-	for _, c := range conflicts {
-		if s != "" {
-			s += "\n\n"
+// Returns the subset of the specified versions that satisfy a filter.
+func filterVersions(vers []newtutil.RepoVersion,
+	f Filter) []newtutil.RepoVersion {
+
+	var good []newtutil.RepoVersion
+	for _, v := range vers {
+		if v.SatisfiesAll(f.Reqs) {
+			good = append(good, v)
 		}
+	}
 
-		s += fmt.Sprintf("    Installation of repo \"%s\" is blocked:",
-			c.RepoName)
+	return good
+}
 
-		lines := []string{}
-		for _, f := range c.Filters {
-			lines = append(lines, fmt.Sprintf("\n    %30s requires %s %s",
-				f.Name, c.RepoName, newtutil.RepoVerReqsString(f.Reqs)))
+// Produces a report describing how newt attempted to resolve a single conflict.
+// Each requirement is listed along with its origin and the versions that
+// satisfy it.
+func (c *Conflict) report() string {
+	s := fmt.Sprintf("    Installation of repo \"%s\" is blocked:", c.RepoName)
+
+	filters := make([]Filter, len(c.Filters))
+	copy(filters, c.Filters)
+	sort.Slice(filters, func(i int, j int) bool {
+		return filters[i].Name < filters[j].Name
+	})
+
+	failed := 0
+	for _, f := range filters {
+		status := ""
+		if c.Chosen != nil {
+			if c.Chosen.SatisfiesAll(f.Reqs) {
+				status = " [ok]"
+			} else {
+				status = " [FAILED]"
+				failed++
+			}
 		}
-		sort.Strings(lines)
-		s += strings.Join(lines, "")
+
+		s += fmt.Sprintf("\n    %30s requires %s %s%s",
+			f.Name, c.RepoName, newtutil.RepoVerReqsString(f.Reqs), status)
+		if len(c.AllVers) > 0 {
+			s += fmt.Sprintf("\n    %30s satisfied by: %s", "",
+				versionsString(filterVersions(c.AllVers, f)))
+		}
+	}
+
+	if len(c.AllVers) > 0 {
+		s += fmt.Sprintf("\n    %30s %s", "Available versions:",
+			versionsString(c.AllVers))
 	}
 
-	return util.NewNewtError("Repository conflicts:\n" + s)
+	if c.Chosen == nil {
+		s += fmt.Sprintf("\n    %30s failed; no version of %s satisfies "+
+			"all requirements", "Resolution:", c.RepoName)
+	} else {
+		s += fmt.Sprintf("\n    %30s failed; closest candidate is %s %s "+
+			"(violates %d of %d requirements)", "Resolution:",
+			c.RepoName, c.Chosen.String(), failed, len(filters))
+	}
+
+	return s
+}
+
+// Produces an error describing the specified set of repo conflicts.
+func ConflictError(conflicts []Conflict) error {
+	reports := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		reports[i] = c.report()
+	}
+
+	return util.NewNewtError("Repository conflicts:\n" +
+		strings.Join(reports, "\n\n"))
 }
 
 // Searches a version matrix for a set of acceptable repo versions.  If there
@@ -342,6 +412,13 @@ func FindAcceptableVersions(m Matrix, dg DepGraph) (VersionMap, []Conflict) {
 		conflict := Conflict{
 			RepoName: f,
 		}
+		if row := m.FindRow(f); row != nil {
+			conflict.AllVers = row.AllVers
+		}
+		if ver, ok := vm[f]; ok {
+			conflict.Chosen = &ver
+		}
+
 		for _, node := range rg[f] {
 			// Determine if this filter is responsible for any conflicts.
 			// Record the name of the filter if it applies.
@@ -365,6 +442,25 @@ func FindAcceptableVersions(m Matrix, dg DepGraph) (VersionMap, []Conflict) {
 				})
 			}
 		}
+
+		// Include filters that were applied directly to the matrix (e.g.,
+		// installed version pins).  These don't appear in the dependency
+		// graph.
+		if row := m.FindRow(f); row != nil {
+			for _, rf := range row.Filters {
+				dup := false
+				for _, cf := range conflict.Filters {
+					if cf.Name == rf.Name {
+						dup = true
+						break
+					}
+				}
+				if !dup {
+					conflict.Filters = append(conflict.Filters, rf)
+				}
+			}
+		}
+
 		conflicts[i] = conflict
 	}
 
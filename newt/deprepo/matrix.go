@@ -43,6 +43,10 @@ type MatrixRow struct {
 	// All normalized versions of the repo.
 	Vers []newtutil.RepoVersion
 
+	// All versions of the repo prior to filtering.  This is only used during
+	// reporting.
+	AllVers []newtutil.RepoVersion
+
 	// Indicates the version of this repo currently being evaluated for
 	// conflicts.
 	VerIdx int
@@ -132,9 +136,11 @@ func (m *Matrix) AddRow(repoName string,
 			repoName)
 	}
 
+	sorted := newtutil.SortedVersionsDesc(vers)
 	m.rows = append(m.rows, MatrixRow{
 		RepoName: repoName,
-		Vers:     newtutil.SortedVersionsDesc(vers),
+		Vers:     sorted,
+		AllVers:  sorted,
 	})
 
 	return nil
@@ -0,0 +1,167 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+// The repo cache holds pristine clones of remote repos under
+// $HOME/.newt/cache.  Each entry is keyed by the repo's URL and the commit
+// that was originally checked out.  When a project needs a repo that some
+// other project on the same machine has already downloaded, newt copies the
+// cached clone instead of cloning it again.  The copy is subsequently fetched
+// as usual, so a stale entry (e.g., a branch that has since moved) is brought
+// up to date.
+//
+// The cache can be disabled by setting `repo_cache: false` in
+// $HOME/.newt/newtrc.yml.
+
+const CACHE_DIR_NAME = "cache"
+
+// remoteUrl returns the URL that uniquely identifies the downloader's remote
+// repo, or "" if the downloader doesn't download anything.
+func remoteUrl(dl Downloader) string {
+	switch d := dl.(type) {
+	case *GithubDownloader:
+		_, publicUrl := d.remoteUrls()
+		return publicUrl
+
+	case *GitDownloader:
+		return d.Url
+
+	case *HgDownloader:
+		return d.Url
+
+	case *HttpDownloader:
+		return d.Url
+
+	default:
+		return ""
+	}
+}
+
+func sparseDirsOf(dl Downloader) []string {
+	switch d := dl.(type) {
+	case *GithubDownloader:
+		return d.sparseDirs()
+
+	case *GitDownloader:
+		return d.sparseDirs()
+
+	default:
+		return nil
+	}
+}
+
+func cacheEnabled() bool {
+	newtrc := settings.Newtrc()
+	return newtrc.GetValBoolDflt("repo_cache", nil, true)
+}
+
+// CachePath returns the repo cache directory corresponding to the specified
+// downloader and commit.  It returns "" if the repo cannot be cached.
+func CachePath(dl Downloader, commit string) string {
+	if !cacheEnabled() {
+		return ""
+	}
+
+	url := remoteUrl(dl)
+	if url == "" {
+		return ""
+	}
+
+	dir, err := settings.NewtrcDir()
+	if err != nil {
+		return ""
+	}
+
+	// A sparse clone is only usable by repos with the same sparse
+	// directories.
+	id := url + "\x00" + commit
+	if dirs := sparseDirsOf(dl); len(dirs) > 0 {
+		id += "\x00" + strings.Join(dirs, "\x00")
+	}
+
+	key := sha256.Sum256([]byte(id))
+	return fmt.Sprintf("%s/%s/%x", dir, CACHE_DIR_NAME, key)
+}
+
+// CloneCached populates the specified destination directory with a clone of
+// the repo checked out at the given commit.  If the repo cache contains a
+// matching entry, it is copied; otherwise the repo is cloned and the result
+// is added to the cache.
+func CloneCached(dl Downloader, commit string, dstPath string) error {
+	cachePath := CachePath(dl, commit)
+	if cachePath != "" && util.NodeExist(cachePath) {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Using cached repository %s (commit: %s)\n",
+			remoteUrl(dl), commit)
+
+		err := util.CopyDir(cachePath, dstPath)
+		if err == nil {
+			return nil
+		}
+
+		// Fall back to a regular clone.
+		log.Debugf("Failed to copy cached repo %s: %s",
+			cachePath, err.Error())
+		os.RemoveAll(dstPath)
+	}
+
+	if err := dl.Clone(commit, dstPath); err != nil {
+		return err
+	}
+
+	if cachePath != "" {
+		addToCache(dstPath, cachePath)
+	}
+
+	return nil
+}
+
+// addToCache copies a freshly cloned repo into the cache.  A failure to
+// populate the cache is not fatal; it only causes future downloads to miss.
+func addToCache(srcPath string, cachePath string) {
+	// Copy to a temporary directory first so that an interrupted copy doesn't
+	// leave a partial entry in the cache.
+	tmpPath := fmt.Sprintf("%s.tmp%d", cachePath, os.Getpid())
+	os.RemoveAll(tmpPath)
+
+	if err := util.CopyDir(srcPath, tmpPath); err != nil {
+		log.Debugf("Failed to cache repo %s: %s", srcPath, err.Error())
+		os.RemoveAll(tmpPath)
+		return
+	}
+
+	if err := os.Rename(tmpPath, cachePath); err != nil {
+		// Another newt process may have populated the entry first.
+		log.Debugf("Failed to cache repo %s: %s", srcPath, err.Error())
+		os.RemoveAll(tmpPath)
+	}
+}
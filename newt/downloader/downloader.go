@@ -29,9 +29,11 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/settings"
 	"mynewt.apache.org/newt/util"
 )
@@ -68,6 +70,14 @@ type Downloader interface {
 	// Indicates whether the repo is in a clean or dirty state.
 	DirtyState(path string) (string, error)
 
+	// Saves any local changes or commits that would be lost by checking out a
+	// different commit.  Returns a description of what was saved, or "" if
+	// there was nothing to save.
+	Stash(path string) (string, error)
+
+	// Lists the names of all tags in the repo.
+	Tags(path string) ([]string, error)
+
 	// Determines the type of the specified commit.
 	CommitType(path string, commit string) (DownloaderCommitType, error)
 
@@ -104,6 +114,9 @@ type GenericDownloader struct {
 
 	// Whether 'origin' has been fetched during this run.
 	fetched bool
+
+	// Directories to include in a sparse checkout; empty for a full checkout.
+	SparseDirs []string
 }
 
 type GithubDownloader struct {
@@ -135,6 +148,16 @@ type LocalDownloader struct {
 	Path string
 }
 
+// PathDownloader represents a repo that lives in a local directory outside the
+// project.  The directory is used as-is: newt never copies it, fetches it, or
+// changes the checked-out commit.  The repo's entry in the `repos` directory
+// is just a symlink to the external directory.
+type PathDownloader struct {
+	// Path to the repo's source directory.  A relative path is interpreted
+	// relative to the project's base directory.
+	Path string
+}
+
 func gitPath() (string, error) {
 	gitPath, err := exec.LookPath("git")
 	if err != nil {
@@ -145,26 +168,26 @@ func gitPath() (string, error) {
 	return filepath.ToSlash(gitPath), nil
 }
 
-func executeGitCommand(dir string, cmd []string, logCmd bool) ([]byte, error) {
+// executeInDir runs the specified command from within the specified
+// directory.  The working directory is restored before this function returns.
+func executeInDir(dir string, cmd []string, logCmd bool) ([]byte, error) {
 	wd, err := os.Getwd()
 	if err != nil {
 		return nil, util.NewNewtError(err.Error())
 	}
 
-	gp, err := gitPath()
-	if err != nil {
-		return nil, err
-	}
-
 	if err := os.Chdir(dir); err != nil {
 		return nil, util.ChildNewtError(err)
 	}
 
 	defer os.Chdir(wd)
 
-	gitCmd := []string{gp}
-	gitCmd = append(gitCmd, cmd...)
-	output, err := util.ShellCommandLimitDbgOutput(gitCmd, nil, logCmd, -1)
+	env, err := networkEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := util.ShellCommandLimitDbgOutput(cmd, env, logCmd, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -172,6 +195,17 @@ func executeGitCommand(dir string, cmd []string, logCmd bool) ([]byte, error) {
 	return output, nil
 }
 
+func executeGitCommand(dir string, cmd []string, logCmd bool) ([]byte, error) {
+	gp, err := gitPath()
+	if err != nil {
+		return nil, err
+	}
+
+	gitCmd := []string{gp}
+	gitCmd = append(gitCmd, cmd...)
+	return executeInDir(dir, gitCmd, logCmd)
+}
+
 func commitExists(repoDir string, commit string) bool {
 	cmd := []string{
 		"show-ref",
@@ -253,6 +287,31 @@ func upstreamFor(path string, commit string) (string, error) {
 	return strings.TrimSpace(string(up)), nil
 }
 
+// headIsPublished indicates whether the checked out commit is reachable from a
+// remote branch or a tag.  If it isn't, checking out a different commit in a
+// "detached head" state would orphan it.
+func headIsPublished(path string) (bool, error) {
+	for _, cmd := range [][]string{
+		{"branch", "-r", "--contains", "HEAD"},
+		{"tag", "--contains", "HEAD"},
+	} {
+		o, err := executeGitCommand(path, cmd, true)
+		if err != nil {
+			return false, err
+		}
+		if len(strings.TrimSpace(string(o))) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Generates a unique name for a stash or backup branch.
+func stashName() string {
+	return "newt-saved-" + time.Now().Format("20060102-150405")
+}
+
 func getRemoteUrl(path string, remote string) (string, error) {
 	cmd := []string{
 		"remote",
@@ -374,6 +433,10 @@ func (gd *GenericDownloader) Checkout(repoDir string, commit string) error {
 		return err
 	}
 
+	if err := gd.applySparse(repoDir); err != nil {
+		return err
+	}
+
 	util.StatusMessage(util.VERBOSITY_VERBOSE, "Will checkout %s\n", hash)
 	cmd := []string{
 		"checkout",
@@ -508,6 +571,27 @@ func (gd *GenericDownloader) CommitsFor(
 	return commits, nil
 }
 
+func (gd *GenericDownloader) Tags(path string) ([]string, error) {
+	if err := gd.ensureInited(path); err != nil {
+		return nil, err
+	}
+
+	return tagNames(gd.commits), nil
+}
+
+// tagNames returns the sorted names of all tags in the specified commit map.
+func tagNames(commits map[string]Commit) []string {
+	var tags []string
+	for _, c := range commits {
+		if c.typ == COMMIT_TYPE_TAG {
+			tags = append(tags, c.name)
+		}
+	}
+
+	sort.Strings(tags)
+	return tags
+}
+
 func (gd *GenericDownloader) CurrentBranch(path string) (string, error) {
 	// Check if there is a git ref (branch) for the current commit.  If there
 	// is none, git exits with a status of 1.  We need to distinguish this case
@@ -546,6 +630,8 @@ func (gd *GenericDownloader) cachedFetch(fn func() error) error {
 		return err
 	}
 
+	// The fetch may have introduced new tags and branches.
+	gd.commits = nil
 	gd.fetched = true
 	return nil
 }
@@ -614,11 +700,61 @@ func (gd *GenericDownloader) DirtyState(path string) (string, error) {
 		if len(o) > 0 {
 			return "unpushed commits", nil
 		}
+	} else {
+		// Otherwise, the repo has diverged if the checked out commit isn't
+		// known to the remote.
+		published, err := headIsPublished(path)
+		if err != nil {
+			return "", err
+		}
+
+		if !published {
+			return "unpushed commits", nil
+		}
 	}
 
 	return "", nil
 }
 
+// Saves the repo's local changes and commits so that a subsequent checkout
+// doesn't lose them:
+//     * Uncommitted changes are stashed (`git stash`).
+//     * If the checked out commit isn't reachable from any remote branch or
+//       tag, a local branch is created to keep it from being orphaned.
+func (gd *GenericDownloader) Stash(path string) (string, error) {
+	name := stashName()
+	var saved []string
+
+	o, err := executeGitCommand(path, []string{"status", "--porcelain",
+		"--untracked-files=no"}, true)
+	if err != nil {
+		return "", err
+	}
+	if len(o) > 0 {
+		cmd := []string{"stash", "push", "-m", name}
+		if _, err := executeGitCommand(path, cmd, true); err != nil {
+			return "", err
+		}
+		saved = append(saved,
+			fmt.Sprintf("local changes in stash \"%s\"", name))
+	}
+
+	published, err := headIsPublished(path)
+	if err != nil {
+		return "", err
+	}
+	if !published {
+		cmd := []string{"branch", name, "HEAD"}
+		if _, err := executeGitCommand(path, cmd, true); err != nil {
+			return "", err
+		}
+		saved = append(saved,
+			fmt.Sprintf("unpushed commits in branch \"%s\"", name))
+	}
+
+	return strings.Join(saved, "; "), nil
+}
+
 func (gd *GenericDownloader) LatestRc(path string,
 	base string) (string, error) {
 
@@ -626,6 +762,13 @@ func (gd *GenericDownloader) LatestRc(path string,
 		return "", err
 	}
 
+	return latestRc(gd.commits, base)
+}
+
+// latestRc searches the specified set of named commits for the latest release
+// candidate corresponding to the base commit string.  It returns "" if no
+// release candidate is found.
+func latestRc(commits map[string]Commit, base string) (string, error) {
 	// Example:
 	// [BASE] mynewt_1_7_0_tag
 	// [RC]   mynewt_1_7_0_rc1_tag
@@ -643,7 +786,7 @@ func (gd *GenericDownloader) LatestRc(path string,
 
 	bestNum := -1
 	bestStr := ""
-	for commit, _ := range gd.commits {
+	for commit, _ := range commits {
 		match := re.FindStringSubmatch(commit)
 		if len(match) >= 2 {
 			num, _ := strconv.Atoi(match[1])
@@ -774,16 +917,11 @@ func (gd *GithubDownloader) Clone(commit string, dstPath string) error {
 		"clone",
 		"-b",
 		branch,
-		url,
-		dstPath,
 	}
+	cmd = append(cmd, gd.sparseCloneArgs()...)
+	cmd = append(cmd, url, dstPath)
 
-	if util.Verbosity >= util.VERBOSITY_VERBOSE {
-		err = util.ShellInteractiveCommand(cmd, nil)
-	} else {
-		_, err = util.ShellCommand(cmd, nil)
-	}
-	if err != nil {
+	if err := runCloneCommand(cmd); err != nil {
 		return err
 	}
 	defer gd.clearRemoteAuth(dstPath)
@@ -854,16 +992,11 @@ func (gd *GitDownloader) Clone(commit string, dstPath string) error {
 		"clone",
 		"-b",
 		branch,
-		gd.Url,
-		dstPath,
 	}
+	cmd = append(cmd, gd.sparseCloneArgs()...)
+	cmd = append(cmd, gd.Url, dstPath)
 
-	if util.Verbosity >= util.VERBOSITY_VERBOSE {
-		err = util.ShellInteractiveCommand(cmd, nil)
-	} else {
-		_, err = util.ShellCommand(cmd, nil)
-	}
-	if err != nil {
+	if err := runCloneCommand(cmd); err != nil {
 		return err
 	}
 
@@ -939,6 +1072,182 @@ func NewLocalDownloader() *LocalDownloader {
 	return &LocalDownloader{}
 }
 
+// AbsPath converts the downloader's path to an absolute path.
+func (pd *PathDownloader) AbsPath() (string, error) {
+	path := pd.Path
+	if !filepath.IsAbs(path) {
+		proj := interfaces.GetProject()
+		if proj != nil {
+			path = filepath.Join(proj.Path(), path)
+		}
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return filepath.ToSlash(abs), nil
+}
+
+// srcDir retrieves the absolute path of the repo's source directory and
+// ensures the directory exists.
+func (pd *PathDownloader) srcDir() (string, error) {
+	path, err := pd.AbsPath()
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", util.FmtNewtError(
+			"cannot access local repo path \"%s\": %s", path, err.Error())
+	}
+	if !info.IsDir() {
+		return "", util.FmtNewtError(
+			"local repo path \"%s\" is not a directory", path)
+	}
+
+	return path, nil
+}
+
+func (pd *PathDownloader) FetchFile(
+	commit string, path string, filename string, dstDir string) error {
+
+	src, err := pd.srcDir()
+	if err != nil {
+		return err
+	}
+
+	srcPath := src + "/" + filename
+	dstPath := dstDir + "/" + filename
+
+	log.Debugf("Fetching file %s to %s", srcPath, dstPath)
+	if err := util.CopyFile(srcPath, dstPath); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Clone creates a symlink at the destination path pointing to the repo's
+// source directory.  The commit is ignored; the directory is used as-is.
+func (pd *PathDownloader) Clone(commit string, dstPath string) error {
+	src, err := pd.srcDir()
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Linking local repository %s\n", src)
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), os.ModePerm); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	// Replace a stale link whose target no longer exists.
+	if info, err := os.Lstat(dstPath); err == nil &&
+		info.Mode()&os.ModeSymlink != 0 {
+
+		if err := os.Remove(dstPath); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	if err := os.Symlink(src, dstPath); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+func (pd *PathDownloader) HashFor(path string, commit string) (string, error) {
+	return "", nil
+}
+
+func (pd *PathDownloader) CommitsFor(
+	path string, commit string) ([]string, error) {
+
+	return []string{commit}, nil
+}
+
+func (pd *PathDownloader) Fetch(path string) error {
+	return nil
+}
+
+func (pd *PathDownloader) Checkout(path string, commit string) error {
+	return nil
+}
+
+// DirtyState always reports a clean state.  Newt never modifies a local path
+// repo, so there is nothing for local changes to conflict with.
+func (pd *PathDownloader) DirtyState(path string) (string, error) {
+	return "", nil
+}
+
+// Tags always returns an empty list.  Versions of a local path repo are read
+// from its `version.yml` file.
+func (pd *PathDownloader) Tags(path string) ([]string, error) {
+	return nil, nil
+}
+
+// Stash is a no-op; newt never changes the checked out commit of a local path
+// repo.
+func (pd *PathDownloader) Stash(path string) (string, error) {
+	return "", nil
+}
+
+func (pd *PathDownloader) CommitType(
+	path string, commit string) (DownloaderCommitType, error) {
+
+	return COMMIT_TYPE_HASH, nil
+}
+
+// FixupOrigin ensures the repo's symlink points to the directory specified in
+// `project.yml`.  This is necessary in case the user changed the path.
+func (pd *PathDownloader) FixupOrigin(path string) error {
+	src, err := pd.srcDir()
+	if err != nil {
+		return err
+	}
+
+	cur, err := os.Readlink(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pd.Clone("", path)
+		}
+		return util.FmtNewtError(
+			"local repo \"%s\" is not a symlink; remove it and try again",
+			path)
+	}
+
+	if filepath.ToSlash(cur) == src {
+		return nil
+	}
+
+	util.OneTimeWarning(
+		"Repo link %s points to unexpected path: %s; correcting it to %s.",
+		path, cur, src)
+
+	if err := os.Remove(path); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return pd.Clone("", path)
+}
+
+func (pd *PathDownloader) CurrentBranch(path string) (string, error) {
+	return "", nil
+}
+
+func (pd *PathDownloader) LatestRc(path string, base string) (string, error) {
+	return "", nil
+}
+
+func NewPathDownloader() *PathDownloader {
+	return &PathDownloader{}
+}
+
 func loadError(format string, args ...interface{}) error {
 	return util.NewNewtError(
 		"error loading project.yml: " + fmt.Sprintf(format, args...))
@@ -950,6 +1259,7 @@ func LoadDownloader(repoName string, repoVars map[string]string) (
 	switch repoVars["type"] {
 	case "github":
 		gd := NewGithubDownloader()
+		gd.SparseDirs = strings.Fields(repoVars["sparse_dirs"])
 
 		gd.Server = repoVars["server"]
 		gd.User = repoVars["user"]
@@ -981,6 +1291,7 @@ func LoadDownloader(repoName string, repoVars map[string]string) (
 
 	case "git":
 		gd := NewGitDownloader()
+		gd.SparseDirs = strings.Fields(repoVars["sparse_dirs"])
 		gd.Url = repoVars["url"]
 		if gd.Url == "" {
 			return nil, loadError("repo \"%s\" missing required field \"url\"",
@@ -993,6 +1304,33 @@ func LoadDownloader(repoName string, repoVars map[string]string) (
 		ld.Path = repoVars["path"]
 		return ld, nil
 
+	case "hg":
+		hd := NewHgDownloader()
+		hd.Url = repoVars["url"]
+		if hd.Url == "" {
+			return nil, loadError("repo \"%s\" missing required field \"url\"",
+				repoName)
+		}
+		return hd, nil
+
+	case "http":
+		hd := NewHttpDownloader()
+		hd.Url = repoVars["url"]
+		if hd.Url == "" {
+			return nil, loadError("repo \"%s\" missing required field \"url\"",
+				repoName)
+		}
+		return hd, nil
+
+	case "path":
+		pd := NewPathDownloader()
+		pd.Path = repoVars["path"]
+		if pd.Path == "" {
+			return nil, loadError("repo \"%s\" missing required field \"path\"",
+				repoName)
+		}
+		return pd, nil
+
 	default:
 		return nil, loadError("invalid repository type: %s", repoVars["type"])
 	}
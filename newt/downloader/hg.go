@@ -0,0 +1,532 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// HgDownloader downloads repos hosted in Mercurial.  Mercurial tags and
+// bookmarks are treated like git tags and branches, respectively; named
+// Mercurial branches are also treated as branches.
+type HgDownloader struct {
+	Url string
+
+	// [name-of-branch-or-tag]commit
+	commits map[string]Commit
+
+	// Whether the default remote has been pulled during this run.
+	fetched bool
+}
+
+func hgPath() (string, error) {
+	hgPath, err := exec.LookPath("hg")
+	if err != nil {
+		return "", util.NewNewtError(fmt.Sprintf("Can't find hg binary: %s\n",
+			err.Error()))
+	}
+
+	return filepath.ToSlash(hgPath), nil
+}
+
+func executeHgCommand(dir string, cmd []string, logCmd bool) ([]byte, error) {
+	hp, err := hgPath()
+	if err != nil {
+		return nil, err
+	}
+
+	netArgs, err := hgNetworkArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	hgCmd := []string{hp}
+	hgCmd = append(hgCmd, netArgs...)
+	hgCmd = append(hgCmd, cmd...)
+	return executeInDir(dir, hgCmd, logCmd)
+}
+
+// hgRevision converts a git-style commit string to its Mercurial equivalent.
+func hgRevision(commit string) string {
+	if commit == "HEAD" {
+		return "."
+	}
+
+	return fixupCommitString(commit)
+}
+
+// hgNamedCommits runs an hg command that lists named commits (tags, branches,
+// or bookmarks) and inserts the results into the specified map.  The command
+// must produce output of the form "<name> <node>" on each line.
+func hgNamedCommits(path string, cmd []string, typ DownloaderCommitType,
+	m map[string]Commit) error {
+
+	o, err := executeHgCommand(path, cmd, true)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(o), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 2 {
+			return util.FmtNewtError(
+				"hg %s produced unexpected line: \"%s\"", cmd[0], line)
+		}
+
+		// "tip" is a moving pseudo-tag; it doesn't identify a release.
+		if typ == COMMIT_TYPE_TAG && f[0] == "tip" {
+			continue
+		}
+
+		m[f[0]] = Commit{
+			hash: f[1],
+			name: f[0],
+			typ:  typ,
+		}
+	}
+
+	return nil
+}
+
+// init populates the downloader with tag, branch, and bookmark information.
+func (hd *HgDownloader) init(path string) error {
+	m := map[string]Commit{}
+
+	err := hgNamedCommits(path,
+		[]string{"branches", "--template", "{branch} {node}\\n"},
+		COMMIT_TYPE_BRANCH, m)
+	if err != nil {
+		return err
+	}
+
+	err = hgNamedCommits(path,
+		[]string{"bookmarks", "--template", "{bookmark} {node}\\n"},
+		COMMIT_TYPE_BRANCH, m)
+	if err != nil {
+		return err
+	}
+
+	err = hgNamedCommits(path,
+		[]string{"tags", "--template", "{tag} {node}\\n"},
+		COMMIT_TYPE_TAG, m)
+	if err != nil {
+		return err
+	}
+
+	hd.commits = m
+	return nil
+}
+
+func (hd *HgDownloader) ensureInited(path string) error {
+	if hd.commits != nil {
+		// Already initialized.
+		return nil
+	}
+
+	return hd.init(path)
+}
+
+func (hd *HgDownloader) findCommit(s string) *Commit {
+	c, ok := hd.commits[fixupCommitString(s)]
+	if !ok {
+		return nil
+	} else {
+		return &c
+	}
+}
+
+// resolveRev asks Mercurial for the node ID corresponding to the specified
+// revision.
+func (hd *HgDownloader) resolveRev(path string, rev string) (string, error) {
+	cmd := []string{"log", "-r", rev, "--template", "{node}"}
+	o, err := executeHgCommand(path, cmd, true)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(o)), nil
+}
+
+func (hd *HgDownloader) HashFor(path string, commit string) (string, error) {
+	if err := hd.ensureInited(path); err != nil {
+		return "", err
+	}
+
+	if commit == "HEAD" {
+		return hd.resolveRev(path, ".")
+	}
+
+	if c := hd.findCommit(commit); c != nil {
+		return c.hash, nil
+	}
+
+	// Expand an abbreviated hash if possible.
+	if hash, err := hd.resolveRev(path, hgRevision(commit)); err == nil {
+		return hash, nil
+	}
+
+	return commit, nil
+}
+
+func (hd *HgDownloader) CommitsFor(
+	path string, commit string) ([]string, error) {
+
+	if err := hd.ensureInited(path); err != nil {
+		return nil, err
+	}
+
+	commit = fixupCommitString(commit)
+
+	var commits []string
+
+	// Always insert the specified string into the set.
+	commits = append(commits, commit)
+
+	if commit == "HEAD" {
+		hash, err := hd.HashFor(path, commit)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, hash)
+		commit = hash
+	}
+
+	// Add all commits that are equivalent to the specified string.
+	for _, c := range hd.commits {
+		if commit == c.hash {
+			commits = append(commits, c.name)
+		} else if commit == c.name {
+			commits = append(commits, c.hash)
+		}
+	}
+
+	sort.Strings(commits)
+	return commits, nil
+}
+
+func (hd *HgDownloader) Fetch(path string) error {
+	if hd.fetched {
+		return nil
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Pulling repo %s\n", hd.Url)
+
+	if _, err := executeHgCommand(path, []string{"pull"}, true); err != nil {
+		return err
+	}
+
+	// The pull may have introduced new tags and branches.
+	hd.commits = nil
+	hd.fetched = true
+
+	return nil
+}
+
+func (hd *HgDownloader) FetchFile(
+	commit string, path string, filename string, dstDir string) error {
+
+	if err := hd.Fetch(path); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	hash, err := hd.HashFor(path, commit)
+	if err != nil {
+		return err
+	}
+
+	dstPath := fmt.Sprintf("%s/%s", dstDir, filename)
+	log.Debugf("Fetching file %s to %s", filename, dstPath)
+
+	cmd := []string{"cat", "-r", hash, filename}
+	data, err := executeHgCommand(path, cmd, true)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(dstPath, data, os.ModePerm); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+func (hd *HgDownloader) Checkout(path string, commit string) error {
+	hash, err := hd.HashFor(path, commit)
+	if err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Will update to %s\n", hash)
+	cmd := []string{
+		"update",
+		"-r",
+		hash,
+	}
+
+	if _, err := executeHgCommand(path, cmd, true); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (hd *HgDownloader) Clone(commit string, dstPath string) error {
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Downloading repository %s (commit: %s)\n", hd.Url, commit)
+
+	hp, err := hgPath()
+	if err != nil {
+		return err
+	}
+
+	netArgs, err := hgNetworkArgs()
+	if err != nil {
+		return err
+	}
+
+	// Clone the repository without populating the working directory; the
+	// checkout below selects the requested commit.
+	cmd := []string{hp}
+	cmd = append(cmd, netArgs...)
+	cmd = append(cmd, "clone", "--noupdate", hd.Url, dstPath)
+
+	if err := runCloneCommand(cmd); err != nil {
+		return err
+	}
+
+	if err := hd.Checkout(dstPath, commit); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Indicates whether the specified hg repo is in a clean or dirty state.
+//
+// @param path                  The path of the hg repo to check.
+//
+// @return string               Text describing repo's dirty state, or "" if
+//                                  clean.
+// @return error                Error.
+func (hd *HgDownloader) DirtyState(path string) (string, error) {
+	// Check for modified, added, removed, or deleted files.
+	cmd := []string{
+		"status",
+		"-mard",
+	}
+
+	o, err := executeHgCommand(path, cmd, true)
+	if err != nil {
+		return "", err
+	}
+
+	if len(o) > 0 {
+		return "local changes", nil
+	}
+
+	// Changesets in the draft phase have not been pushed.
+	cmd = []string{
+		"log",
+		"-r",
+		"draft()",
+		"--template",
+		"{node}\\n",
+	}
+
+	o, err = executeHgCommand(path, cmd, true)
+	if err != nil {
+		return "", err
+	}
+
+	if len(o) > 0 {
+		return "unpushed commits", nil
+	}
+
+	return "", nil
+}
+
+func (hd *HgDownloader) Tags(path string) ([]string, error) {
+	if err := hd.ensureInited(path); err != nil {
+		return nil, err
+	}
+
+	return tagNames(hd.commits), nil
+}
+
+// Stash shelves any uncommitted changes.  Unpushed (draft) changesets don't
+// need saving; Mercurial never discards them when updating to a different
+// revision.
+func (hd *HgDownloader) Stash(path string) (string, error) {
+	o, err := executeHgCommand(path, []string{"status", "-mard"}, true)
+	if err != nil {
+		return "", err
+	}
+	if len(o) == 0 {
+		return "", nil
+	}
+
+	name := stashName()
+	cmd := []string{
+		"--config",
+		"extensions.shelve=",
+		"shelve",
+		"--name",
+		name,
+	}
+	if _, err := executeHgCommand(path, cmd, true); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("local changes in shelf \"%s\"", name), nil
+}
+
+func (hd *HgDownloader) CommitType(
+	path string, commit string) (DownloaderCommitType, error) {
+
+	if err := hd.ensureInited(path); err != nil {
+		return -1, err
+	}
+
+	if commit == "HEAD" {
+		return COMMIT_TYPE_HASH, nil
+	}
+
+	if c := hd.findCommit(commit); c != nil {
+		return c.typ, nil
+	}
+
+	if _, err := hd.resolveRev(path, hgRevision(commit)); err == nil {
+		return COMMIT_TYPE_HASH, nil
+	}
+
+	return -1, util.FmtNewtError(
+		"cannot determine commit type of \"%s\"", commit)
+}
+
+// setHgDefaultPath rewrites the "default" entry in the repo's `.hg/hgrc`
+// file.  Mercurial has no command for changing a path, so the file is edited
+// directly.
+func setHgDefaultPath(repoDir string, url string) error {
+	hgrc := repoDir + "/.hg/hgrc"
+
+	data, err := ioutil.ReadFile(hgrc)
+	if err != nil && !os.IsNotExist(err) {
+		return util.ChildNewtError(err)
+	}
+
+	entry := "default = " + url
+
+	var lines []string
+	inPaths := false
+	sawPaths := false
+	done := false
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if inPaths && !done {
+				lines = append(lines, entry)
+				done = true
+			}
+			inPaths = trimmed == "[paths]"
+			if inPaths {
+				sawPaths = true
+			}
+		} else if inPaths {
+			kv := strings.SplitN(trimmed, "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "default" {
+				if !done {
+					lines = append(lines, entry)
+					done = true
+				}
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	if !done {
+		if !sawPaths {
+			lines = append(lines, "[paths]")
+		}
+		lines = append(lines, entry)
+	}
+
+	s := strings.Join(lines, "\n")
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+
+	if err := ioutil.WriteFile(hgrc, []byte(s), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+func (hd *HgDownloader) FixupOrigin(path string) error {
+	o, err := executeHgCommand(path, []string{"paths", "default"}, true)
+	if err != nil && !util.IsExit(err) {
+		return err
+	}
+
+	curUrl := strings.TrimSpace(string(o))
+	if curUrl == hd.Url {
+		return nil
+	}
+
+	warnWrongOriginUrl(path, curUrl, hd.Url)
+	return setHgDefaultPath(path, hd.Url)
+}
+
+// CurrentBranch always returns "".  Mercurial has no equivalent of a checked
+// out git branch; an updated working directory is always treated as being in
+// a "detached head" state.
+func (hd *HgDownloader) CurrentBranch(path string) (string, error) {
+	return "", nil
+}
+
+func (hd *HgDownloader) LatestRc(path string, base string) (string, error) {
+	if err := hd.ensureInited(path); err != nil {
+		return "", err
+	}
+
+	return latestRc(hd.commits, base)
+}
+
+func NewHgDownloader() *HgDownloader {
+	return &HgDownloader{}
+}
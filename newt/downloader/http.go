@@ -0,0 +1,943 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+// HttpDownloader downloads repos from a plain HTTP(S) artifact server rather
+// than from a version control system.  The server hosts the following files
+// under the repo's base URL:
+//
+//     repository.yml       The repo descriptor, in the usual format.
+//     index.yml            Maps each commit name in the descriptor's
+//                          `repo.versions` map to a release archive.
+//     <archives>           Source archives (.tar.gz, .tgz, or .zip).
+//
+// Example `index.yml`:
+//
+//     commits:
+//         mynewt_1_7_0_tag:
+//             archive: apache-mynewt-core-1.7.0.tar.gz
+//             sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//         master:
+//             archive: apache-mynewt-core-master.tar.gz
+//             type: branch
+//
+// Commits are treated as tags unless they specify `type: branch`.  If every
+// file in an archive is inside a single top-level directory, that directory is
+// stripped when the archive is extracted.
+type HttpDownloader struct {
+	// Base URL of the repo on the artifact server.
+	Url string
+
+	// [commit-name]archive
+	index map[string]httpArchive
+
+	// Whether the index has been downloaded during this run.
+	fetched bool
+}
+
+type httpArchive struct {
+	commit Commit
+	file   string
+	sha256 string
+}
+
+const HTTP_INDEX_FILENAME = "index.yml"
+
+// Records which commit is extracted in a repo directory.
+const HTTP_CHECKOUT_FILENAME = ".newt-http-checkout"
+
+// Records the checksum of each extracted file so that local changes can be
+// detected.
+const HTTP_MANIFEST_FILENAME = ".newt-http-manifest"
+
+// The directory, alongside the repos, where local changes are saved before an
+// http repo is replaced.
+const HTTP_SAVED_DIR = ".newt-saved"
+
+// httpClient returns an HTTP client configured with newt's proxy and CA
+// settings.
+func httpClient() (*http.Client, error) {
+	// http.ProxyFromEnvironment only reads the environment, so export any
+	// proxies specified in newtrc.yml.
+	for _, name := range []string{"http_proxy", "https_proxy", "no_proxy"} {
+		if val := proxySetting(name); val != "" &&
+			os.Getenv(name) == "" && os.Getenv(strings.ToUpper(name)) == "" {
+
+			os.Setenv(name, val)
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+	}
+
+	bundle, err := CaBundle()
+	if err != nil {
+		return nil, err
+	}
+	if bundle != "" {
+		pem, err := ioutil.ReadFile(bundle)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, util.FmtNewtError(
+				"no valid certificates in CA bundle %s", bundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// httpGet downloads the specified URL to a local file.
+func httpGet(url string, dstPath string) error {
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Downloading %s to %s", url, dstPath)
+
+	rsp, err := client.Get(url)
+	if err != nil {
+		return util.FmtNewtError("failed to download %s: %s",
+			url, err.Error())
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return util.FmtNewtError("failed to download %s: %s",
+			url, rsp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), os.ModePerm); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	f, err := os.Create(dstPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, rsp.Body); err != nil {
+		return util.FmtNewtError("failed to download %s: %s",
+			url, err.Error())
+	}
+
+	return nil
+}
+
+func (hd *HttpDownloader) fileUrl(filename string) string {
+	return strings.TrimSuffix(hd.Url, "/") + "/" + filename
+}
+
+// Downloads and parses the repo's index file.
+func (hd *HttpDownloader) readIndex() error {
+	tmpdir, err := ioutil.TempDir("", "newt-http")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	indexPath := tmpdir + "/" + HTTP_INDEX_FILENAME
+	if err := httpGet(hd.fileUrl(HTTP_INDEX_FILENAME), indexPath); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	var contents map[string]interface{}
+	if err := yaml.Unmarshal(data, &contents); err != nil {
+		return util.FmtNewtError("invalid %s at %s: %s",
+			HTTP_INDEX_FILENAME, hd.Url, err.Error())
+	}
+
+	commits, err := cast.ToStringMapE(contents["commits"])
+	if err != nil {
+		return util.FmtNewtError("invalid %s at %s: missing \"commits\" map",
+			HTTP_INDEX_FILENAME, hd.Url)
+	}
+
+	index := map[string]httpArchive{}
+	for name, v := range commits {
+		fields := cast.ToStringMapString(v)
+		if fields["archive"] == "" {
+			return util.FmtNewtError(
+				"invalid %s at %s: commit \"%s\" missing \"archive\" field",
+				HTTP_INDEX_FILENAME, hd.Url, name)
+		}
+
+		typ := COMMIT_TYPE_TAG
+		if fields["type"] == "branch" {
+			typ = COMMIT_TYPE_BRANCH
+		}
+
+		index[name] = httpArchive{
+			commit: Commit{
+				hash: name,
+				name: name,
+				typ:  typ,
+			},
+			file:   fields["archive"],
+			sha256: strings.ToLower(fields["sha256"]),
+		}
+	}
+
+	hd.index = index
+	return nil
+}
+
+func (hd *HttpDownloader) ensureInited() error {
+	if hd.index != nil {
+		return nil
+	}
+
+	return hd.readIndex()
+}
+
+func (hd *HttpDownloader) commitMap() map[string]Commit {
+	m := make(map[string]Commit, len(hd.index))
+	for name, a := range hd.index {
+		m[name] = a.commit
+	}
+
+	return m
+}
+
+// Reads the name of the commit extracted in the specified repo directory.
+func (hd *HttpDownloader) checkedOut(path string) (string, error) {
+	data, err := ioutil.ReadFile(path + "/" + HTTP_CHECKOUT_FILENAME)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", util.ChildNewtError(err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Verifies the SHA256 checksum of a downloaded archive.
+func verifySha256(filename string, expected string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != expected {
+		return util.FmtNewtError(
+			"checksum mismatch for %s: expected %s, got %s",
+			filepath.Base(filename), expected, actual)
+	}
+
+	return nil
+}
+
+// Determines the destination of an archive entry, or "" if the entry should
+// be skipped.  Entries that would be extracted outside the destination
+// directory are rejected.
+func archiveEntryPath(dstPath string, prefix string,
+	name string) (string, error) {
+
+	name = path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "./"))
+	if name == "." || name == prefix {
+		return "", nil
+	}
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", util.FmtNewtError("archive entry escapes repo: %s", name)
+	}
+
+	if prefix != "" {
+		name = strings.TrimPrefix(name, prefix+"/")
+	}
+
+	return dstPath + "/" + name, nil
+}
+
+// Indicates whether the specified path is within the specified directory.
+// Both paths must be clean.
+func pathWithin(dir string, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Rejects symlink targets that point outside the repo.  The target is resolved
+// relative to the directory containing the link, so a link such as
+// "../include/foo.h" is accepted as long as it stays within the repo.
+func checkSymlinkTarget(dstPath string, linkPath string, name string,
+	target string) error {
+
+	if path.IsAbs(filepath.ToSlash(target)) || filepath.IsAbs(target) {
+		return util.FmtNewtError(
+			"archive entry %s: absolute symlink target: %s", name, target)
+	}
+
+	resolved := filepath.Join(filepath.Dir(linkPath), target)
+	if !pathWithin(filepath.Clean(dstPath), resolved) {
+		return util.FmtNewtError(
+			"archive entry %s: symlink target escapes repo: %s", name, target)
+	}
+
+	return nil
+}
+
+// Creates the symlinks found in an archive.  This happens after all other
+// entries are extracted, so that no entry can be written through a link.
+// Each link is then resolved on disk to ensure that a chain of links does not
+// lead outside the repo.
+func createArchiveSymlinks(dstPath string, links map[string]string) error {
+	for dst, target := range links {
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return util.ChildNewtError(err)
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(dstPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	for dst, target := range links {
+		// A dangling link can't lead anywhere.
+		resolved, err := filepath.EvalSymlinks(dst)
+		if err != nil {
+			continue
+		}
+		if !pathWithin(root, resolved) {
+			return util.FmtNewtError(
+				"symlink %s escapes repo: %s", dst, target)
+		}
+	}
+
+	return nil
+}
+
+// Determines the single top-level directory shared by all the specified
+// archive entries, or "" if there isn't one.
+func commonPrefix(names []string) string {
+	prefix := ""
+	nested := false
+	for _, name := range names {
+		name = strings.Trim(strings.TrimPrefix(filepath.ToSlash(name), "./"), "/")
+		if name == "" {
+			continue
+		}
+
+		parts := strings.SplitN(name, "/", 2)
+		if prefix == "" {
+			prefix = parts[0]
+		} else if prefix != parts[0] {
+			return ""
+		}
+
+		if len(parts) > 1 {
+			nested = true
+		}
+	}
+
+	// A lone top-level file is not a directory.
+	if !nested {
+		return ""
+	}
+
+	return prefix
+}
+
+func extractTarGz(archive string, dstPath string) error {
+	open := func() (*tar.Reader, func(), error) {
+		f, err := os.Open(archive)
+		if err != nil {
+			return nil, nil, util.ChildNewtError(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, util.ChildNewtError(err)
+		}
+		return tar.NewReader(gz), func() { gz.Close(); f.Close() }, nil
+	}
+
+	// First pass: determine whether there is a top-level directory to strip.
+	tr, closer, err := open()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closer()
+			return util.ChildNewtError(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	closer()
+	prefix := commonPrefix(names)
+
+	// Second pass: extract.
+	tr, closer, err = open()
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	links := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		dst, err := archiveEntryPath(dstPath, prefix, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if dst == "" {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+				return util.ChildNewtError(err)
+			}
+
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeArchiveFile(dst, tr,
+				os.FileMode(hdr.Mode)); err != nil {
+
+				return err
+			}
+
+		case tar.TypeSymlink:
+			if err := checkSymlinkTarget(dstPath, dst, hdr.Name,
+				hdr.Linkname); err != nil {
+
+				return err
+			}
+			links[dst] = hdr.Linkname
+
+		default:
+			log.Debugf("Skipping archive entry %s (type %c)",
+				hdr.Name, hdr.Typeflag)
+		}
+	}
+
+	return createArchiveSymlinks(dstPath, links)
+}
+
+func extractZip(archive string, dstPath string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer zr.Close()
+
+	names := make([]string, len(zr.File))
+	for i, f := range zr.File {
+		names[i] = f.Name
+	}
+	prefix := commonPrefix(names)
+
+	for _, f := range zr.File {
+		dst, err := archiveEntryPath(dstPath, prefix, f.Name)
+		if err != nil {
+			return err
+		}
+		if dst == "" {
+			continue
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+				return util.ChildNewtError(err)
+			}
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+		err = writeArchiveFile(dst, rc, f.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeArchiveFile(dst string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
+		mode.Perm()|0600)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Downloads the archive corresponding to the specified commit and extracts it
+// into the destination directory.  Any existing contents are replaced.
+func (hd *HttpDownloader) extract(commit string, dstPath string) error {
+	if err := hd.ensureInited(); err != nil {
+		return err
+	}
+
+	a, ok := hd.index[commit]
+	if !ok {
+		return util.FmtNewtError("commit \"%s\" not found in %s",
+			commit, hd.fileUrl(HTTP_INDEX_FILENAME))
+	}
+
+	tmpdir, err := ioutil.TempDir("", "newt-http")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	archive := tmpdir + "/" + path.Base(a.file)
+	if err := httpGet(hd.fileUrl(a.file), archive); err != nil {
+		return err
+	}
+
+	if a.sha256 != "" {
+		if err := verifySha256(archive, a.sha256); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(dstPath); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := os.MkdirAll(dstPath, os.ModePerm); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	switch {
+	case strings.HasSuffix(a.file, ".tar.gz"), strings.HasSuffix(a.file, ".tgz"):
+		err = extractTarGz(archive, dstPath)
+	case strings.HasSuffix(a.file, ".zip"):
+		err = extractZip(archive, dstPath)
+	default:
+		err = util.FmtNewtError("unsupported archive type: %s", a.file)
+	}
+	if err != nil {
+		return err
+	}
+
+	marker := dstPath + "/" + HTTP_CHECKOUT_FILENAME
+	if err := ioutil.WriteFile(marker, []byte(commit+"\n"), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return writeHttpManifest(dstPath)
+}
+
+// Calculates a checksum for each file in an extracted repo directory.
+// Symlinks are represented by their targets.
+//
+// @param path                  The repo directory to scan.
+//
+// @return map[string]string    [relative-path] => checksum.
+// @return error                Error.
+func httpTreeSums(path string) (map[string]string, error) {
+	sums := map[string]string{}
+
+	err := filepath.Walk(path,
+		func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == HTTP_CHECKOUT_FILENAME || rel == HTTP_MANIFEST_FILENAME {
+				return nil
+			}
+
+			switch {
+			case info.Mode()&os.ModeSymlink != 0:
+				target, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+				sums[rel] = "link:" + target
+
+			case info.Mode().IsRegular():
+				f, err := os.Open(p)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				h := sha256.New()
+				if _, err := io.Copy(h, f); err != nil {
+					return err
+				}
+				sums[rel] = hex.EncodeToString(h.Sum(nil))
+			}
+
+			return nil
+		})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return sums, nil
+}
+
+// Records the checksums of a freshly extracted repo directory.
+func writeHttpManifest(path string) error {
+	sums, err := httpTreeSums(path)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	for _, name := range names {
+		fmt.Fprintf(buf, "%s  %s\n", sums[name], name)
+	}
+
+	filename := path + "/" + HTTP_MANIFEST_FILENAME
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Reads the checksums recorded when a repo directory was extracted.  A nil map
+// is returned if the directory predates checksum manifests.
+func readHttpManifest(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path + "/" + HTTP_MANIFEST_FILENAME)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, util.ChildNewtError(err)
+	}
+
+	sums := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 {
+			return nil, util.FmtNewtError("invalid line in %s: %s",
+				HTTP_MANIFEST_FILENAME, line)
+		}
+		sums[parts[1]] = parts[0]
+	}
+
+	return sums, nil
+}
+
+// Lists the files in an extracted repo directory that have been modified,
+// added, or removed since extraction.
+func httpLocalChanges(path string) ([]string, error) {
+	want, err := readHttpManifest(path)
+	if err != nil || want == nil {
+		return nil, err
+	}
+
+	have, err := httpTreeSums(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for name, sum := range have {
+		if want[name] != sum {
+			changed = append(changed, name)
+		}
+	}
+	for name := range want {
+		if _, ok := have[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+func (hd *HttpDownloader) FetchFile(
+	commit string, path string, filename string, dstDir string) error {
+
+	if err := hd.Fetch(path); err != nil {
+		return err
+	}
+
+	// The server only publishes the latest descriptor.
+	return httpGet(hd.fileUrl(filename), dstDir+"/"+filename)
+}
+
+func (hd *HttpDownloader) Clone(commit string, dstPath string) error {
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Downloading repository %s (commit: %s)\n", hd.Url, commit)
+
+	return hd.extract(commit, dstPath)
+}
+
+func (hd *HttpDownloader) HashFor(path string, commit string) (string, error) {
+	if commit == "HEAD" {
+		return hd.checkedOut(path)
+	}
+
+	return commit, nil
+}
+
+func (hd *HttpDownloader) CommitsFor(
+	path string, commit string) ([]string, error) {
+
+	if commit == "HEAD" {
+		cur, err := hd.checkedOut(path)
+		if err != nil {
+			return nil, err
+		}
+		return []string{commit, cur}, nil
+	}
+
+	return []string{commit}, nil
+}
+
+func (hd *HttpDownloader) Fetch(path string) error {
+	if hd.fetched {
+		return nil
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Fetching index %s\n",
+		hd.fileUrl(HTTP_INDEX_FILENAME))
+
+	if err := hd.readIndex(); err != nil {
+		return err
+	}
+
+	hd.fetched = true
+	return nil
+}
+
+func (hd *HttpDownloader) Checkout(path string, commit string) error {
+	cur, err := hd.checkedOut(path)
+	if err != nil {
+		return err
+	}
+
+	// A branch may have been republished since it was extracted.
+	if cur == commit {
+		if a, ok := hd.index[commit]; !ok || a.commit.typ != COMMIT_TYPE_BRANCH {
+			return nil
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Will extract %s\n", commit)
+	return hd.extract(commit, path)
+}
+
+// DirtyState compares the repo directory against the checksums recorded when
+// it was extracted.  Directories extracted by older versions of newt have no
+// checksums and are always reported as clean.
+func (hd *HttpDownloader) DirtyState(path string) (string, error) {
+	changed, err := httpLocalChanges(path)
+	if err != nil {
+		return "", err
+	}
+
+	if len(changed) > 0 {
+		return "local changes", nil
+	}
+
+	return "", nil
+}
+
+// Stash copies locally modified and added files into a new directory under
+// `.newt-saved` in the project's repos directory.  Extracting a new archive replaces
+// the repo directory, so this is the only copy of the user's changes that
+// survives an upgrade.
+func (hd *HttpDownloader) Stash(path string) (string, error) {
+	changed, err := httpLocalChanges(path)
+	if err != nil {
+		return "", err
+	}
+	if len(changed) == 0 {
+		return "", nil
+	}
+
+	path = filepath.Clean(path)
+	dstDir := filepath.Join(filepath.Dir(path), HTTP_SAVED_DIR,
+		filepath.Base(path)+"-"+stashName())
+	for _, name := range changed {
+		src := path + "/" + name
+		dst := dstDir + "/" + name
+
+		info, err := os.Lstat(src)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed locally; nothing to save.
+				continue
+			}
+			return "", util.ChildNewtError(err)
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(src)
+			if err != nil {
+				return "", util.ChildNewtError(err)
+			}
+			if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+				return "", util.ChildNewtError(err)
+			}
+			if err := os.Symlink(target, dst); err != nil {
+				return "", util.ChildNewtError(err)
+			}
+		} else if err := util.CopyFile(src, dst); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("local changes in \"%s\"", dstDir), nil
+}
+
+func (hd *HttpDownloader) Tags(path string) ([]string, error) {
+	if err := hd.ensureInited(); err != nil {
+		return nil, err
+	}
+
+	return tagNames(hd.commitMap()), nil
+}
+
+func (hd *HttpDownloader) CommitType(
+	path string, commit string) (DownloaderCommitType, error) {
+
+	if commit == "HEAD" {
+		return COMMIT_TYPE_HASH, nil
+	}
+
+	if err := hd.ensureInited(); err != nil {
+		return -1, err
+	}
+
+	if a, ok := hd.index[commit]; ok {
+		return a.commit.typ, nil
+	}
+
+	return -1, util.FmtNewtError(
+		"cannot determine commit type of \"%s\"", commit)
+}
+
+// FixupOrigin is a no-op.  The artifact server's URL isn't recorded in the
+// repo directory.
+func (hd *HttpDownloader) FixupOrigin(path string) error {
+	return nil
+}
+
+func (hd *HttpDownloader) CurrentBranch(path string) (string, error) {
+	return "", nil
+}
+
+func (hd *HttpDownloader) LatestRc(path string, base string) (string, error) {
+	if err := hd.ensureInited(); err != nil {
+		return "", err
+	}
+
+	return latestRc(hd.commitMap(), base)
+}
+
+func NewHttpDownloader() *HttpDownloader {
+	return &HttpDownloader{}
+}
+
+func (hd *HttpDownloader) String() string {
+	return fmt.Sprintf("http:%s", hd.Url)
+}
@@ -0,0 +1,235 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+// Network settings for downloads.  git and hg do the actual downloading, so
+// these settings are passed to them via environment variables and command
+// line options.
+//
+// Proxies are read from the standard environment variables (http_proxy,
+// https_proxy, no_proxy, and their upper-case forms).  They can also be
+// specified in $HOME/.newt/newtrc.yml:
+//
+//     network.http_proxy: http://proxy.example.com:3128
+//     network.https_proxy: http://proxy.example.com:3128
+//     network.no_proxy: localhost,.example.com
+//
+// Extra CA certificates (e.g., for a TLS-intercepting proxy) are read from
+// `network.ca_certs` in newtrc.yml and from `project.ca_certs` in
+// project.yml.  Each is a list of PEM files.  The certificates are appended
+// to the system CA bundle; the result is written to $HOME/.newt/ca-bundle.pem.
+
+const CA_BUNDLE_FILENAME = "ca-bundle.pem"
+
+// Locations of the system CA bundle on common platforms.
+var systemCaBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/ssl/cert.pem",
+	"/usr/local/etc/openssl/cert.pem",
+}
+
+// CA certificate files specified by the project.
+var projectCaCerts []string
+
+// Path of the generated CA bundle; "" if there are no extra certificates.
+var caBundlePath string
+var caBundleBuilt bool
+
+// AddCaCerts registers additional CA certificate files to trust when
+// downloading repos.
+func AddCaCerts(paths []string) {
+	projectCaCerts = append(projectCaCerts, paths...)
+	caBundleBuilt = false
+}
+
+func systemCaBundle() string {
+	for _, path := range systemCaBundles {
+		if util.NodeExist(path) {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// buildCaBundle concatenates the system CA bundle and all extra CA
+// certificates into a single file.
+//
+// @return string               The path of the bundle, or "" if no extra
+//                                  certificates are configured.
+func buildCaBundle() (string, error) {
+	newtrc := settings.Newtrc()
+	certs := newtrc.GetValStringSlice("network.ca_certs", nil)
+	certs = append(certs, projectCaCerts...)
+	if len(certs) == 0 {
+		return "", nil
+	}
+
+	var pem []byte
+	if sys := systemCaBundle(); sys != "" {
+		data, err := ioutil.ReadFile(sys)
+		if err != nil {
+			return "", util.ChildNewtError(err)
+		}
+		pem = append(pem, data...)
+	} else {
+		util.OneTimeWarning("Can't find system CA bundle; only trusting " +
+			"certificates specified in network.ca_certs / project.ca_certs")
+	}
+
+	for _, cert := range certs {
+		data, err := ioutil.ReadFile(cert)
+		if err != nil {
+			return "", util.FmtNewtError(
+				"failed to read CA certificate: %s", err.Error())
+		}
+		pem = append(pem, '\n')
+		pem = append(pem, data...)
+	}
+
+	dir, err := settings.NewtrcDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	// Write to a temporary file first so that concurrent newt processes never
+	// see a partial bundle.
+	path := dir + "/" + CA_BUNDLE_FILENAME
+	tmpPath := fmt.Sprintf("%s.tmp%d", path, os.Getpid())
+	if err := ioutil.WriteFile(tmpPath, pem, 0644); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", util.ChildNewtError(err)
+	}
+
+	log.Debugf("Wrote CA bundle with %d extra certificates to %s",
+		len(certs), path)
+
+	return path, nil
+}
+
+// CaBundle returns the path of the CA bundle that downloads should use, or ""
+// if the system default is sufficient.
+func CaBundle() (string, error) {
+	if !caBundleBuilt {
+		path, err := buildCaBundle()
+		if err != nil {
+			return "", err
+		}
+		caBundlePath = path
+		caBundleBuilt = true
+	}
+
+	return caBundlePath, nil
+}
+
+// proxySetting looks up a proxy setting.  The environment takes precedence
+// over newtrc.yml.
+func proxySetting(name string) string {
+	if val := os.Getenv(name); val != "" {
+		return val
+	}
+	if val := os.Getenv(strings.ToUpper(name)); val != "" {
+		return val
+	}
+
+	newtrc := settings.Newtrc()
+	return newtrc.GetValString("network."+name, nil)
+}
+
+// networkEnv produces the environment variables that configure git and hg
+// downloads.  Variables that are already set in newt's environment are not
+// overridden.
+func networkEnv() ([]string, error) {
+	var env []string
+
+	setenv := func(name string, val string) {
+		if val != "" && os.Getenv(name) == "" {
+			env = append(env, name+"="+val)
+		}
+	}
+
+	// curl (used by git) only honors the lower-case form of http_proxy, so
+	// export both forms of each variable.
+	for _, name := range []string{"http_proxy", "https_proxy", "no_proxy"} {
+		val := proxySetting(name)
+		setenv(name, val)
+		setenv(strings.ToUpper(name), val)
+	}
+
+	bundle, err := CaBundle()
+	if err != nil {
+		return nil, err
+	}
+	setenv("GIT_SSL_CAINFO", bundle)
+
+	return env, nil
+}
+
+// hgNetworkArgs produces the hg command line options that configure
+// downloads.  hg doesn't read a CA bundle from the environment.
+func hgNetworkArgs() ([]string, error) {
+	bundle, err := CaBundle()
+	if err != nil {
+		return nil, err
+	}
+	if bundle == "" {
+		return nil, nil
+	}
+
+	return []string{"--config", "web.cacerts=" + bundle}, nil
+}
+
+// runCloneCommand runs a git or hg clone command with the network
+// configuration applied.  Output is displayed if newt is running in verbose
+// mode.
+func runCloneCommand(cmd []string) error {
+	env, err := networkEnv()
+	if err != nil {
+		return err
+	}
+
+	if util.Verbosity >= util.VERBOSITY_VERBOSE {
+		return util.ShellInteractiveCommand(cmd, env)
+	} else {
+		_, err := util.ShellCommand(cmd, env)
+		return err
+	}
+}
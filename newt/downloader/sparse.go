@@ -0,0 +1,103 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Sparse checkouts.  A git repo can specify the subset of its directories that
+// the project actually needs via the `sparse_dirs` field in `project.yml`:
+//
+//     repository.apache-mynewt-core:
+//         type: github
+//         vers: 1-latest
+//         user: apache
+//         repo: mynewt-core
+//         sparse_dirs:
+//             - hw/bsp/nordic_pca10056
+//             - hw/mcu/nordic
+//             - kernel
+//
+// Only the listed directories (and the files at the top of the repo) are
+// written to the working tree.  This relies on `git sparse-checkout`, which
+// requires git 2.25 or later.
+
+// sparseDirs returns the sorted, de-duplicated list of directories to check
+// out, or nil if the repo is fully checked out.
+func (gd *GenericDownloader) sparseDirs() []string {
+	if len(gd.SparseDirs) == 0 {
+		return nil
+	}
+
+	return util.SortFields(gd.SparseDirs...)
+}
+
+// sparseCloneArgs produces the extra `git clone` arguments for a sparse
+// clone.  Blobs are fetched lazily so that files outside the sparse
+// directories are never downloaded; servers that don't support partial clones
+// just ignore the filter.
+func (gd *GenericDownloader) sparseCloneArgs() []string {
+	if len(gd.SparseDirs) == 0 {
+		return nil
+	}
+
+	return []string{"--no-checkout", "--filter=blob:none"}
+}
+
+// applySparse configures the working tree in the specified repo to contain
+// only the sparse directories.  If the repo doesn't specify any sparse
+// directories, a previously configured sparse checkout is disabled.
+func (gd *GenericDownloader) applySparse(path string) error {
+	dirs := gd.sparseDirs()
+	if len(dirs) == 0 {
+		o, err := executeGitCommand(path,
+			[]string{"config", "--get", "core.sparseCheckout"}, false)
+		if err != nil || strings.TrimSpace(string(o)) != "true" {
+			// Not a sparse checkout.
+			return nil
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Disabling sparse checkout in %s\n", path)
+		_, err = executeGitCommand(path,
+			[]string{"sparse-checkout", "disable"}, true)
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Restricting %s to: %s\n", path, strings.Join(dirs, " "))
+
+	cmd := []string{"sparse-checkout", "init", "--cone"}
+	if _, err := executeGitCommand(path, cmd, true); err != nil {
+		return util.FmtNewtError(
+			"failed to enable sparse checkout (git 2.25 or later is "+
+				"required): %s", err.Error())
+	}
+
+	cmd = append([]string{"sparse-checkout", "set"}, dirs...)
+	if _, err := executeGitCommand(path, cmd, true); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -67,6 +67,7 @@ type Syscfg struct {
 	Deprecated      []string                       `json:"deprecated"`
 	Defunct         []string                       `json:"defunct"`
 	UnresolvedRefs  []string                       `json:"unresolved_refs"`
+	TypeViolations  map[string]string              `json:"type_violations"`
 }
 
 func convPoint(p syscfg.CfgPoint) SyscfgPoint {
@@ -206,5 +207,6 @@ func newSyscfg(cfg syscfg.Cfg) Syscfg {
 		Deprecated:      convStringMapToSlice(cfg.Deprecated),
 		Defunct:         convStringMapToSlice(cfg.Defunct),
 		UnresolvedRefs:  convStringMapToSlice(cfg.UnresolvedValueRefs),
+		TypeViolations:  cfg.TypeViolations,
 	}
 }
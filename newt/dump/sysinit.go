@@ -27,9 +27,10 @@ import (
 )
 
 type SysinitFunc struct {
-	Name    string `json:"name"`
-	Stage   int    `json:"stage"`
-	PkgName string `json:"package"`
+	Name    string   `json:"name"`
+	Stage   int      `json:"stage"`
+	After   []string `json:"after,omitempty"`
+	PkgName string   `json:"package"`
 }
 
 type Sysinit struct {
@@ -48,6 +49,7 @@ func newSysinit(scfg sysinit.SysinitCfg) (Sysinit, error) {
 		funcs[i] = SysinitFunc{
 			Name:    f.Name,
 			Stage:   stage,
+			After:   f.After,
 			PkgName: f.Pkg.FullName(),
 		}
 	}
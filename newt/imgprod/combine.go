@@ -0,0 +1,212 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/apache/mynewt-artifact/flash"
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/util"
+)
+
+// Combined images.  A combined image contains a target's bootloader, images,
+// and optionally a file system image, each at the offset of its flash area,
+// so that a device can be programmed in one step.  Gaps between the parts are
+// filled with erased flash.
+
+// One part of a combined image.
+type CombinePart struct {
+	Name     string
+	Filename string
+	Area     flash.FlashArea
+	Size     int
+}
+
+// CombinedImgPath returns the path of the combined binary produced for the
+// specified target.
+func CombinedImgPath(b *builder.TargetBuilder) string {
+	name := b.GetTarget().Name()
+	return builder.TargetBinDir(name) + "/" + filepath.Base(name) +
+		"-combined.bin"
+}
+
+func combinePart(b *builder.TargetBuilder, name string, filename string,
+	areaName string) (CombinePart, error) {
+
+	area, ok := b.BspPkg().FlashMap.Areas[areaName]
+	if !ok {
+		return CombinePart{}, util.FmtNewtError(
+			"BSP flash map does not define %s, required for the %s",
+			areaName, name)
+	}
+
+	if util.NodeNotExist(filename) {
+		return CombinePart{}, util.FmtNewtError(
+			"%s \"%s\" does not exist", name, filename)
+	}
+
+	return CombinePart{
+		Name:     name,
+		Filename: filename,
+		Area:     area,
+	}, nil
+}
+
+// CombineParts lists the parts of a target's combined image.  The app must
+// already have been made into an image, and the bootloader target built.
+//
+// @param b                     The builder of the app target.
+// @param bootB                 The builder of the bootloader target.
+// @param fsFilename            The path of a file system image; "" for none.
+// @param fsArea                The flash area of the file system image.
+//
+// @return []CombinePart        The parts, ordered by flash offset.
+// @return error                Error if a part is missing.
+func CombineParts(b *builder.TargetBuilder, bootB *builder.TargetBuilder,
+	fsFilename string, fsArea string) ([]CombinePart, error) {
+
+	if bootB.BspPkg().FullName() != b.BspPkg().FullName() {
+		return nil, util.FmtNewtError(
+			"bootloader target %s uses a different BSP (%s) than %s (%s)",
+			bootB.GetTarget().FullName(), bootB.BspPkg().FullName(),
+			b.GetTarget().FullName(), b.BspPkg().FullName())
+	}
+
+	type partDesc struct {
+		name     string
+		filename string
+		area     string
+	}
+
+	descs := []partDesc{{
+		"bootloader", bootB.AppBuilder.AppBinPath(),
+		flash.FLASH_AREA_NAME_BOOTLOADER,
+	}}
+
+	appArea := flash.FLASH_AREA_NAME_IMAGE_0
+	if b.LoaderBuilder != nil {
+		descs = append(descs, partDesc{
+			"loader image", b.LoaderBuilder.AppImgPath(),
+			flash.FLASH_AREA_NAME_IMAGE_0,
+		})
+		appArea = flash.FLASH_AREA_NAME_IMAGE_1
+	}
+	descs = append(descs, partDesc{
+		"app image", b.AppBuilder.AppImgPath(), appArea,
+	})
+
+	if fsFilename != "" {
+		descs = append(descs, partDesc{
+			"file system image", fsFilename, fsArea,
+		})
+	}
+
+	var parts []CombinePart
+	for _, d := range descs {
+		part, err := combinePart(b, d.name, d.filename, d.area)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+
+		if part.Area.Device != parts[0].Area.Device {
+			return nil, util.FmtNewtError(
+				"%s area %s is on flash device %d; the bootloader is on "+
+					"device %d", part.Name, part.Area.Name, part.Area.Device,
+				parts[0].Area.Device)
+		}
+	}
+
+	sort.Slice(parts, func(i int, j int) bool {
+		return parts[i].Area.Offset < parts[j].Area.Offset
+	})
+
+	return parts, nil
+}
+
+// CombineImages writes a target's combined image as a binary and an Intel
+// HEX file.
+//
+// @param b                     The builder of the app target.
+// @param parts                 The parts to combine (see CombineParts).
+//
+// @return string               The path of the combined binary.
+// @return error                Error if a part does not fit in its flash
+//                                  area or the output cannot be written.
+func CombineImages(b *builder.TargetBuilder,
+	parts []CombinePart) (string, error) {
+
+	if len(parts) == 0 {
+		return "", util.NewNewtError("nothing to combine")
+	}
+
+	start := parts[0].Area.Offset
+	end := start
+
+	datas := make([][]byte, len(parts))
+	for i := range parts {
+		p := &parts[i]
+
+		data, err := ioutil.ReadFile(p.Filename)
+		if err != nil {
+			return "", util.ChildNewtError(err)
+		}
+		p.Size = len(data)
+		datas[i] = data
+
+		if p.Size > p.Area.Size {
+			return "", util.FmtNewtError(
+				"%s \"%s\" overflows %s by %d bytes (size=%d max=%d)",
+				p.Name, p.Filename, p.Area.Name, p.Size-p.Area.Size,
+				p.Size, p.Area.Size)
+		}
+
+		if p.Area.Offset+p.Size > end {
+			end = p.Area.Offset + p.Size
+		}
+	}
+
+	buf := make([]byte, end-start)
+	for i := range buf {
+		buf[i] = FLASH_ERASED_VAL
+	}
+	for i, p := range parts {
+		copy(buf[p.Area.Offset-start:], datas[i])
+	}
+
+	binPath := CombinedImgPath(b)
+	if err := ioutil.WriteFile(binPath, buf, 0644); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	c, err := b.NewCompiler("", "")
+	if err != nil {
+		return "", err
+	}
+	hexPath := builder.OutputPath(binPath, builder.OUTPUT_FORMAT_HEX)
+	if err := c.ConvertBinToHex(binPath, hexPath, start); err != nil {
+		return "", err
+	}
+
+	return binPath, nil
+}
@@ -0,0 +1,216 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/apache/mynewt-artifact/image"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Compressed images.  The app binary is compressed before the image is
+// created, and the image header carries a flag indicating the compression
+// algorithm so that the bootloader decompresses the image when it installs
+// it.  The size and SHA256 of the decompressed binary are recorded in
+// DECOMP_SIZE and DECOMP_SHA TLVs.  The bootloader requires these TLVs to be
+// in the protected TLV area, which the image hash covers.
+//
+// Setting the header flag and adding protected TLVs changes the image hash,
+// so newt recomputes the hash and produces all of the image's signatures
+// itself.  The hash covers the plaintext body and no loader hash, so
+// compressed images cannot be encrypted or split.
+
+// MCUboot image header flags, TLV types, and TLV area magic for compressed
+// images.
+const (
+	IMAGE_F_COMPRESSED_LZMA2  = 0x00000400
+	IMAGE_TLV_DECOMP_SIZE     = 0x70
+	IMAGE_TLV_DECOMP_SHA      = 0x71
+	IMAGE_TLV_PROT_INFO_MAGIC = 0x6908
+)
+
+type imageCompressor struct {
+	// The image header flag that identifies the algorithm.
+	flag uint32
+
+	// The command that compresses its file argument to stdout.
+	cmd []string
+}
+
+var imageCompressors = map[string]imageCompressor{
+	"lzma2": imageCompressor{
+		flag: IMAGE_F_COMPRESSED_LZMA2,
+		cmd: []string{
+			"xz", "--format=raw", "--lzma2=preset=9,dict=64KiB", "--stdout",
+		},
+	},
+}
+
+// CompressionNames lists the supported image compression algorithms.
+func CompressionNames() []string {
+	names := make([]string, 0, len(imageCompressors))
+	for name := range imageCompressors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// CheckCompression verifies that an image compression algorithm is
+// supported.  An empty name indicates no compression.
+func CheckCompression(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	if _, ok := imageCompressors[name]; !ok {
+		return util.FmtNewtError(
+			"unsupported image compression \"%s\"; must be one of: %s",
+			name, strings.Join(CompressionNames(), ", "))
+	}
+
+	return nil
+}
+
+// compressBin compresses a binary file.  The compressed binary is written
+// alongside the original with the algorithm name appended to its filename.
+//
+// @return string               The path of the compressed binary.
+func compressBin(name string, srcFilename string) (string, error) {
+	if err := CheckCompression(name); err != nil {
+		return "", err
+	}
+	c := imageCompressors[name]
+
+	cmdStrs := append(append([]string{}, c.cmd...), srcFilename)
+	util.LogShellCmd(cmdStrs, nil)
+
+	out, err := exec.Command(cmdStrs[0], cmdStrs[1:]...).Output()
+	if err != nil {
+		return "", util.FmtNewtError(
+			"failed to compress %s with %s: %s",
+			srcFilename, cmdStrs[0], err.Error())
+	}
+
+	dstFilename := srcFilename + "." + name
+	if err := ioutil.WriteFile(dstFilename, out, 0644); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return dstFilename, nil
+}
+
+// protectedTlvArea serializes TLVs into a protected TLV area: a TLV info
+// header followed by the TLVs.
+func protectedTlvArea(tlvs []image.ImageTlv) ([]byte, error) {
+	info := image.ImageTrailer{
+		Magic:     IMAGE_TLV_PROT_INFO_MAGIC,
+		TlvTotLen: image.IMAGE_TRAILER_SIZE,
+	}
+	for _, tlv := range tlvs {
+		info.TlvTotLen += image.IMAGE_TLV_SIZE + tlv.Header.Len
+	}
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, &info); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	for _, tlv := range tlvs {
+		if _, err := tlv.Write(buf); err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// finishCompressedImage marks an image as compressed, adds the decompression
+// TLVs, and signs it.  The image must have been created from the compressed
+// binary without any signatures, encryption, or loader hash.
+//
+// The image library does not model a protected TLV area.  Since the area
+// immediately follows the body, newt appends it to the body and records its
+// size in the header (the second pad field is MCUboot's ih_protect_tlv_size);
+// the image size continues to exclude it.  The image is serialized in the
+// layout that the bootloader expects, and its hash covers the header, body,
+// and protected TLVs.
+//
+// @param ri                    The image to finish.
+// @param name                  The compression algorithm.
+// @param srcFilename           The path of the uncompressed binary.
+// @param keys                  The keys to sign the image with.
+func finishCompressedImage(ri *image.Image, name string, srcFilename string,
+	keys []newtutil.SignKey) error {
+
+	bin, err := ioutil.ReadFile(srcFilename)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(bin)))
+	binHash := sha256.Sum256(bin)
+
+	prot, err := protectedTlvArea([]image.ImageTlv{
+		{
+			Header: image.ImageTlvHdr{
+				Type: IMAGE_TLV_DECOMP_SIZE,
+				Len:  uint16(len(size)),
+			},
+			Data: size,
+		},
+		{
+			Header: image.ImageTlvHdr{
+				Type: IMAGE_TLV_DECOMP_SHA,
+				Len:  uint16(len(binHash)),
+			},
+			Data: binHash[:],
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ri.Header.Flags |= imageCompressors[name].flag
+	ri.Header.Pad2 = uint16(len(prot))
+	ri.Body = append(ri.Body, prot...)
+
+	hash, err := ri.CalcHash()
+	if err != nil {
+		return err
+	}
+	for i, tlv := range ri.Tlvs {
+		if tlv.Header.Type == image.IMAGE_TLV_SHA256 {
+			ri.Tlvs[i].Data = hash
+			return addNewtSigs(ri, keys)
+		}
+	}
+
+	return util.NewNewtError("image does not contain a SHA256 TLV")
+}
@@ -0,0 +1,248 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/apache/mynewt-artifact/image"
+	"github.com/apache/mynewt-artifact/sec"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Detached signing.  An unsigned image's signed payload (the image header and
+// body) is exported so that it can be signed elsewhere, e.g., in an air-gapped
+// signing ceremony.  The resulting signature is then attached to the image.
+
+// PayloadInfo describes an exported signing payload.  It is written alongside
+// the payload as `<image>.payload.json`.
+type PayloadInfo struct {
+	Image         string `json:"image"`
+	Payload       string `json:"payload"`
+	Version       string `json:"version"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	Hash          string `json:"hash"`
+}
+
+// PayloadPath returns the path of the signing payload exported for the
+// specified image file.
+func PayloadPath(imgFilename string) string {
+	return imgFilename + ".payload"
+}
+
+func readImage(imgFilename string) (image.Image, []byte, error) {
+	data, err := ioutil.ReadFile(imgFilename)
+	if err != nil {
+		return image.Image{}, nil, util.ChildNewtError(err)
+	}
+
+	ri, err := parseImage(data)
+	if err != nil {
+		return image.Image{}, nil, util.FmtNewtError(
+			"error parsing image \"%s\": %s", imgFilename, err.Error())
+	}
+
+	return ri, data, nil
+}
+
+// Offsets of the image header's protected TLV area size and image size.
+const (
+	imageHdrProtSzOff = 10
+	imageHdrImgSzOff  = 12
+)
+
+// parseImage parses an image.  The image library does not recognize a
+// protected TLV area (see finishCompressedImage); if the image has one, it is
+// parsed as part of the body, as when the image was created.
+func parseImage(data []byte) (image.Image, error) {
+	if len(data) < image.IMAGE_HEADER_SIZE {
+		return image.ParseImage(data)
+	}
+
+	protSz := binary.LittleEndian.Uint16(data[imageHdrProtSzOff:])
+	if protSz == 0 {
+		return image.ParseImage(data)
+	}
+
+	buf := append([]byte(nil), data...)
+	imgSz := binary.LittleEndian.Uint32(buf[imageHdrImgSzOff:])
+	binary.LittleEndian.PutUint32(buf[imageHdrImgSzOff:],
+		imgSz+uint32(protSz))
+
+	ri, err := image.ParseImage(buf)
+	if err != nil {
+		return ri, err
+	}
+	ri.Header.ImgSz = imgSz
+
+	return ri, nil
+}
+
+// imagePayload extracts the portion of an image file that the image hash
+// covers: the header, body, and protected TLVs.
+func imagePayload(ri image.Image, data []byte) ([]byte, error) {
+	payloadLen := int(ri.Header.HdrSz) + int(ri.Header.ImgSz) +
+		int(ri.Header.Pad2)
+	if payloadLen > len(data) {
+		return nil, util.NewNewtError("image is truncated")
+	}
+
+	return data[:payloadLen], nil
+}
+
+// ExportPayload writes the portion of an image that its signatures cover,
+// along with a JSON description containing the hash to be signed.
+//
+// @param imgFilename           The path of the image file.
+//
+// @return PayloadInfo          A description of the exported payload.
+// @return error                Error if the image cannot be read or the
+//                                  output files cannot be written.
+func ExportPayload(imgFilename string) (PayloadInfo, error) {
+	info := PayloadInfo{}
+
+	ri, data, err := readImage(imgFilename)
+	if err != nil {
+		return info, err
+	}
+
+	hash, err := ri.Hash()
+	if err != nil {
+		return info, err
+	}
+
+	payload, err := imagePayload(ri, data)
+	if err != nil {
+		return info, util.FmtNewtError("image \"%s\": %s", imgFilename,
+			err.(*util.NewtError).Text)
+	}
+
+	// Make sure the payload is exactly what the bootloader hashes.
+	sum := sha256.Sum256(payload)
+	if !bytes.Equal(sum[:], hash) {
+		return info, util.FmtNewtError(
+			"cannot export payload of \"%s\": image hash does not cover the "+
+				"header and body", imgFilename)
+	}
+
+	v := ri.Header.Vers
+	info = PayloadInfo{
+		Image:   imgFilename,
+		Payload: PayloadPath(imgFilename),
+		Version: fmt.Sprintf("%d.%d.%d.%d",
+			v.Major, v.Minor, v.Rev, v.BuildNum),
+		HashAlgorithm: "sha256",
+		Hash:          hex.EncodeToString(hash),
+	}
+
+	if err := ioutil.WriteFile(info.Payload, payload, 0644); err != nil {
+		return info, util.ChildNewtError(err)
+	}
+
+	js, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return info, util.ChildNewtError(err)
+	}
+	if err := ioutil.WriteFile(info.Payload+".json", js, 0644); err != nil {
+		return info, util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Signing payload exported: %s (sha256 %s)\n",
+		info.Payload, info.Hash)
+
+	return info, nil
+}
+
+// AttachSig adds an externally produced signature to an image.  The signature
+// is verified against the image hash before the image is modified.
+//
+// @param imgFilename           The path of the image file.
+// @param pub                   The public key of the signing key (see
+//                                  newtutil.ParsePubSignKey).
+// @param sig                   The signature: RSASSA-PSS for RSA keys, ASN.1
+//                                  DER for EC keys.
+//
+// @return error                Error if the signature is invalid or the
+//                                  image cannot be rewritten.
+func AttachSig(imgFilename string, pub interface{}, sig []byte) error {
+	ri, _, err := readImage(imgFilename)
+	if err != nil {
+		return err
+	}
+
+	hash, err := ri.Hash()
+	if err != nil {
+		return err
+	}
+
+	if !newtutil.VerifySig(pub, hash, sig) {
+		return util.FmtNewtError(
+			"signature does not match image \"%s\" (sha256 %x)",
+			imgFilename, hash)
+	}
+
+	tlvType, err := pubSigTlvType(pub)
+	if err != nil {
+		return err
+	}
+
+	pubBytes, err := newtutil.PubKeyBytes(pub)
+	if err != nil {
+		return err
+	}
+
+	keyHash := sec.RawKeyHash(pubBytes)
+	for _, tlv := range ri.Tlvs {
+		if tlv.Header.Type == image.IMAGE_TLV_KEYHASH &&
+			bytes.Equal(tlv.Data, keyHash) {
+
+			return util.FmtNewtError(
+				"image \"%s\" is already signed with this key", imgFilename)
+		}
+	}
+
+	appendSigTlvs(&ri, pubBytes, tlvType, sig)
+
+	imgFile, err := os.OpenFile(imgFilename,
+		os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return util.FmtNewtError("Can't open image %s: %s",
+			imgFilename, err.Error())
+	}
+	defer imgFile.Close()
+
+	if _, err := ri.Write(imgFile); err != nil {
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Signature attached to image: %s\n", imgFilename)
+
+	return nil
+}
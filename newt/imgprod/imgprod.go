@@ -24,13 +24,13 @@ package imgprod
 import (
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/apache/mynewt-artifact/image"
 	"github.com/apache/mynewt-artifact/sec"
 	"mynewt.apache.org/newt/newt/builder"
 	"mynewt.apache.org/newt/newt/manifest"
 	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
 )
 
@@ -42,6 +42,15 @@ type ImageProdOpts struct {
 	EncKeyFilename    string
 	Version           image.ImageVersion
 	SigKeys           []sec.PrivSignKey
+
+	// Signing keys that the image library does not support.
+	NewtSigKeys []newtutil.SignKey
+
+	// Additional TLVs declared by the target (`target.image_tlvs`).
+	ExtraTlvs []target.ImageTlv
+
+	// The algorithm the app image is compressed with; "" for none.
+	Compression string
 }
 
 type ProducedImage struct {
@@ -71,6 +80,14 @@ func produceLoader(opts ImageProdOpts) (ProducedImage, error) {
 		return pi, err
 	}
 
+	if err := addExtraTlvs(&ri, opts.ExtraTlvs); err != nil {
+		return pi, err
+	}
+
+	if err := addNewtSigs(&ri, opts.NewtSigKeys); err != nil {
+		return pi, err
+	}
+
 	hash, err := ri.Hash()
 	if err != nil {
 		return pi, err
@@ -116,11 +133,46 @@ func produceApp(opts ImageProdOpts, loaderHash []byte) (ProducedImage, error) {
 		LoaderHash:        loaderHash,
 	}
 
+	// A compressed image is created unsigned; newt signs it after marking it
+	// as compressed.
+	if opts.Compression != "" {
+		if opts.EncKeyFilename != "" || loaderHash != nil {
+			return pi, util.NewNewtError(
+				"compressed images cannot be encrypted or split")
+		}
+
+		binPath, err := compressBin(opts.Compression, opts.AppSrcFilename)
+		if err != nil {
+			return pi, err
+		}
+		igo.SrcBinFilename = binPath
+		igo.SigKeys = nil
+	}
+
 	ri, err := image.GenerateImage(igo)
 	if err != nil {
 		return pi, err
 	}
 
+	if err := addExtraTlvs(&ri, opts.ExtraTlvs); err != nil {
+		return pi, err
+	}
+
+	if opts.Compression != "" {
+		keys := opts.NewtSigKeys
+		for i := range opts.SigKeys {
+			keys = append(keys, newtutil.SignKey{Sec: &opts.SigKeys[i]})
+		}
+
+		err := finishCompressedImage(&ri, opts.Compression,
+			opts.AppSrcFilename, keys)
+		if err != nil {
+			return pi, err
+		}
+	} else if err := addNewtSigs(&ri, opts.NewtSigKeys); err != nil {
+		return pi, err
+	}
+
 	hash, err := ri.Hash()
 	if err != nil {
 		return pi, err
@@ -154,42 +206,27 @@ func produceApp(opts ImageProdOpts, loaderHash []byte) (ProducedImage, error) {
 	return pi, nil
 }
 
-// Verifies that each already-built image leaves enough room for a boot trailer
-// a the end of its slot.
-func verifyImgSizes(pset ProducedImageSet, maxSizes []int) error {
-	errLines := []string{}
-	slot := 0
-
-	if pset.Loader != nil {
-		if overflow := int(pset.Loader.FileSize) - maxSizes[0]; overflow > 0 {
-			errLines = append(errLines,
-				fmt.Sprintf("loader overflows slot-0 by %d bytes "+
-					"(image=%d max=%d)",
-					overflow, pset.Loader.FileSize, maxSizes[0]))
-		}
-		slot++
-	}
-
-	if overflow := int(pset.App.FileSize) - maxSizes[slot]; overflow > 0 {
-		errLines = append(errLines,
-			fmt.Sprintf("app overflows slot-%d by %d bytes "+
-				"(image=%d max=%d)",
-				slot, overflow, pset.App.FileSize, maxSizes[slot]))
-
+func producedSlotSize(name string, pi ProducedImage) imgSlotSize {
+	return imgSlotSize{
+		Name:     name,
+		Filename: pi.Filename,
+		HdrSize:  int(pi.Image.Header.HdrSz),
+		BodySize: int(pi.Image.Header.ImgSz),
+		FileSize: pi.FileSize,
 	}
+}
 
-	if len(errLines) > 0 {
-		if !newtutil.NewtForce {
-			return util.NewNewtError(strings.Join(errLines, "; "))
-		} else {
-			for _, e := range errLines {
-				util.StatusMessage(util.VERBOSITY_QUIET,
-					"* Warning: %s (ignoring due to force flag)\n", e)
-			}
-		}
+// Verifies that each already-built image leaves enough room for a boot trailer
+// at the end of its slot.
+func verifyImgSizes(b *builder.TargetBuilder, pset ProducedImageSet) error {
+	var loader *imgSlotSize
+	if pset.Loader != nil {
+		s := producedSlotSize("loader", *pset.Loader)
+		loader = &s
 	}
 
-	return nil
+	return verifySlotSizes(
+		imgSlotSizes(b, loader, producedSlotSize("app", pset.App)))
 }
 
 func ProduceImages(opts ImageProdOpts) (ProducedImageSet, error) {
@@ -215,35 +252,90 @@ func ProduceImages(opts ImageProdOpts) (ProducedImageSet, error) {
 	return pset, nil
 }
 
-func ProduceManifest(opts manifest.ManifestCreateOpts) error {
-	m, err := manifest.CreateManifest(opts)
+func writeManifest(m *manifest.ImageManifest, path string) error {
+	file, err := os.Create(path)
 	if err != nil {
+		return util.FmtNewtError("Cannot create manifest file %s: %s",
+			path, err.Error())
+	}
+	defer file.Close()
+
+	if _, err := m.Write(file); err != nil {
 		return err
 	}
 
-	file, err := os.Create(opts.TgtBldr.AppBuilder.ManifestPath())
+	return nil
+}
+
+// ProduceManifest writes the target's manifest alongside its app image, and
+// a copy alongside its loader image, if any.
+func ProduceManifest(opts manifest.ManifestCreateOpts) error {
+	m, err := manifest.CreateImageManifest(opts)
 	if err != nil {
-		return util.FmtNewtError("Cannot create manifest file %s: %s",
-			opts.TgtBldr.AppBuilder.ManifestPath(), err.Error())
+		return err
 	}
-	defer file.Close()
 
-	if _, err := m.Write(file); err != nil {
+	t := opts.TgtBldr
+	if err := writeManifest(&m, t.AppBuilder.ManifestPath()); err != nil {
 		return err
 	}
 
+	if t.LoaderBuilder != nil {
+		err := writeManifest(&m, t.LoaderBuilder.ManifestPath())
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// signKeyHashes produces the hex-encoded key hashes of the specified signing
+// keys for inclusion in the manifest.
+func signKeyHashes(keys []newtutil.SignKey) ([]string, error) {
+	var hashes []string
+	for _, key := range keys {
+		h, err := key.KeyHash()
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, fmt.Sprintf("%x", h))
+	}
+
+	return hashes, nil
+}
+
 func OptsFromTgtBldr(b *builder.TargetBuilder, ver image.ImageVersion,
-	sigKeys []sec.PrivSignKey, encKeyFilename string) ImageProdOpts {
+	sigKeys []newtutil.SignKey, encKeyFilename string) (
+	ImageProdOpts, error) {
+
+	tlvs, err := b.GetTarget().ImageTlvs()
+	if err != nil {
+		return ImageProdOpts{}, err
+	}
+
+	compression := b.GetTarget().ImageCompression
+	if err := CheckCompression(compression); err != nil {
+		return ImageProdOpts{}, err
+	}
+	if compression != "" && encKeyFilename != "" {
+		return ImageProdOpts{}, util.NewNewtError(
+			"compressed images cannot be encrypted")
+	}
+	if compression != "" && b.LoaderBuilder != nil {
+		return ImageProdOpts{}, util.NewNewtError(
+			"split images cannot be compressed")
+	}
 
 	opts := ImageProdOpts{
 		AppSrcFilename: b.AppBuilder.AppBinPath(),
 		AppDstFilename: b.AppBuilder.AppImgPath(),
 		EncKeyFilename: encKeyFilename,
 		Version:        ver,
-		SigKeys:        sigKeys,
+		SigKeys:        newtutil.SecSignKeys(sigKeys),
+		NewtSigKeys:    newtutil.NewtSignKeys(sigKeys),
+		ExtraTlvs:      tlvs,
+		Compression:    compression,
 	}
 
 	if b.LoaderBuilder != nil {
@@ -251,18 +343,34 @@ func OptsFromTgtBldr(b *builder.TargetBuilder, ver image.ImageVersion,
 		opts.LoaderDstFilename = b.LoaderBuilder.AppImgPath()
 	}
 
-	return opts
+	return opts, nil
 }
 
 func ProduceAll(t *builder.TargetBuilder, ver image.ImageVersion,
-	sigKeys []sec.PrivSignKey, encKeyFilename string) error {
+	sigKeys []newtutil.SignKey, encKeyFilename string) error {
+
+	popts, err := OptsFromTgtBldr(t, ver, sigKeys, encKeyFilename)
+	if err != nil {
+		return err
+	}
 
-	popts := OptsFromTgtBldr(t, ver, sigKeys, encKeyFilename)
 	pset, err := ProduceImages(popts)
 	if err != nil {
 		return err
 	}
 
+	if err := verifyImgSizes(t, pset); err != nil {
+		return err
+	}
+
+	var loaderFilename string
+	if pset.Loader != nil {
+		loaderFilename = pset.Loader.Filename
+	}
+	if err := emitImgOutputs(t, loaderFilename, pset.App.Filename); err != nil {
+		return err
+	}
+
 	var loaderHash []byte
 	if pset.Loader != nil {
 		loaderHash = pset.Loader.Hash
@@ -272,12 +380,12 @@ func ProduceAll(t *builder.TargetBuilder, ver image.ImageVersion,
 	if err != nil {
 		return err
 	}
-
-	if err := ProduceManifest(mopts); err != nil {
+	mopts.SignKeys, err = signKeyHashes(sigKeys)
+	if err != nil {
 		return err
 	}
 
-	if err := verifyImgSizes(pset, mopts.TgtBldr.MaxImgSizes()); err != nil {
+	if err := ProduceManifest(mopts); err != nil {
 		return err
 	}
 
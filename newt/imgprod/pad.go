@@ -0,0 +1,134 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/util"
+)
+
+// Padded images.  A padded image fills an entire image slot, so it can be
+// written directly to the secondary slot with a flash programmer.  The boot
+// trailer at the end of the slot can be populated so that the bootloader
+// swaps to the image on the next reset:
+//
+//     * test: the boot magic is written; the bootloader swaps to the image
+//       once, and reverts unless the image confirms itself.
+//     * confirm: the image-ok flag is also set; the swap is permanent.
+
+// The boot magic, as written to flash.
+var bootTrailerMagic = []byte{
+	0x77, 0xc2, 0x95, 0xf3,
+	0x60, 0xd2, 0xef, 0x7f,
+	0x35, 0x52, 0x50, 0x0f,
+	0x2c, 0xb6, 0x79, 0x80,
+}
+
+// The value of an erased byte of flash.
+const FLASH_ERASED_VAL = 0xff
+
+type ImagePadOpts struct {
+	// The size of the image slot.
+	SlotSize int
+
+	// The size of the boot trailer at the end of the slot.
+	TrailerSize int
+
+	// The flash minimum write size; trailer fields are aligned to it.
+	MinWriteSz int
+
+	// Write the boot magic, requesting a test swap.
+	Test bool
+
+	// Write the boot magic and set image-ok, requesting a permanent swap.
+	Confirm bool
+}
+
+// PadOptsFromTgtBldr creates image padding options for a target's secondary
+// image slot.
+func PadOptsFromTgtBldr(b *builder.TargetBuilder,
+	test bool, confirm bool) ImagePadOpts {
+
+	return ImagePadOpts{
+		SlotSize:    b.SlotSizes()[1],
+		TrailerSize: b.BootTrailerSize(),
+		MinWriteSz:  b.MinWriteSize(),
+		Test:        test,
+		Confirm:     confirm,
+	}
+}
+
+// PaddedImgPath returns the path of the padded copy of the specified image
+// file.
+func PaddedImgPath(imgFilename string) string {
+	return strings.TrimSuffix(imgFilename, ".img") + ".padded.img"
+}
+
+// PadImage writes a copy of an image padded to the full size of its slot,
+// optionally with a populated boot trailer.
+//
+// @param imgFilename           The path of the image file.
+// @param opts                  Describes the slot and its boot trailer.
+//
+// @return string               The path of the padded image.
+// @return error                Error if the image does not fit in the slot
+//                                  or the file cannot be written.
+func PadImage(imgFilename string, opts ImagePadOpts) (string, error) {
+	img, err := ioutil.ReadFile(imgFilename)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	trailerOff := opts.SlotSize - opts.TrailerSize
+	if len(img) > trailerOff {
+		return "", util.FmtNewtError(
+			"cannot pad image \"%s\": image overflows slot by %d bytes "+
+				"(image=%d max=%d)",
+			imgFilename, len(img)-trailerOff, len(img), trailerOff)
+	}
+
+	data := make([]byte, opts.SlotSize)
+	for i := range data {
+		data[i] = FLASH_ERASED_VAL
+	}
+	copy(data, img)
+
+	// The magic begins the trailer; image-ok occupies its final
+	// min-write-size chunk (see builder.BootTrailerSize()).
+	if opts.Test || opts.Confirm {
+		copy(data[trailerOff:], bootTrailerMagic)
+	}
+	if opts.Confirm {
+		data[opts.SlotSize-opts.MinWriteSz] = 0x01
+	}
+
+	dstFilename := PaddedImgPath(imgFilename)
+	if err := ioutil.WriteFile(dstFilename, data, 0644); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Padded image successfully generated: %s\n", dstFilename)
+
+	return dstFilename, nil
+}
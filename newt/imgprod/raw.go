@@ -0,0 +1,70 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"path/filepath"
+
+	"github.com/apache/mynewt-artifact/image"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// RawImgPath returns the path of the image created from the specified raw
+// binary.
+func RawImgPath(binFilename string) string {
+	ext := filepath.Ext(binFilename)
+	return binFilename[:len(binFilename)-len(ext)] + ".img"
+}
+
+// ProduceRaw wraps an arbitrary binary, e.g., co-processor firmware or an
+// FPGA bitstream, in an image header and TLVs.  No target is involved, so
+// no manifest is produced and the image size is not checked against a
+// slot.
+//
+// @param binFilename           The path of the raw binary.
+// @param ver                   The version to put in the image header.
+// @param sigKeys               The keys to sign the image with.
+// @param encKeyFilename        The key to encrypt the image with; "" for
+//                                  none.
+//
+// @return ProducedImage        The produced image.
+// @return error                Error if the image cannot be created.
+func ProduceRaw(binFilename string, ver image.ImageVersion,
+	sigKeys []newtutil.SignKey, encKeyFilename string) (
+	ProducedImage, error) {
+
+	dstFilename := RawImgPath(binFilename)
+	if dstFilename == binFilename {
+		return ProducedImage{}, util.FmtNewtError(
+			"raw binary \"%s\" already has an .img extension", binFilename)
+	}
+
+	opts := ImageProdOpts{
+		AppSrcFilename: binFilename,
+		AppDstFilename: dstFilename,
+		EncKeyFilename: encKeyFilename,
+		Version:        ver,
+		SigKeys:        newtutil.SecSignKeys(sigKeys),
+		NewtSigKeys:    newtutil.NewtSignKeys(sigKeys),
+	}
+
+	return produceApp(opts, nil)
+}
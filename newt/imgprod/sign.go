@@ -0,0 +1,176 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+
+	"github.com/apache/mynewt-artifact/image"
+	"golang.org/x/crypto/ed25519"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+// pubSigTlvType determines the TLV type of a signature that can be verified
+// with the specified public key (see newtutil.ParsePubSignKey).
+func pubSigTlvType(pub interface{}) (uint8, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		switch pub.Size() {
+		case 256:
+			return image.IMAGE_TLV_RSA2048, nil
+		case 384:
+			return image.IMAGE_TLV_RSA3072, nil
+		default:
+			return 0, util.FmtNewtError(
+				"unsupported RSA key size: %d bits; must be 2048 or 3072",
+				pub.Size()*8)
+		}
+
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return 0, util.FmtNewtError(
+				"unsupported EC curve %s; image signing keys must use P-256",
+				pub.Curve.Params().Name)
+		}
+		return image.IMAGE_TLV_ECDSA256, nil
+
+	case ed25519.PublicKey:
+		return image.IMAGE_TLV_ED25519, nil
+
+	default:
+		return 0, util.FmtNewtError("unsupported public key type: %T", pub)
+	}
+}
+
+// sigTlvType determines the TLV type of a signature produced by the specified
+// key.
+func sigTlvType(key newtutil.SignKey) (uint8, error) {
+	if key.Sec != nil {
+		switch {
+		case key.Sec.Rsa != nil:
+			return pubSigTlvType(&key.Sec.Rsa.PublicKey)
+		case key.Sec.Ec != nil:
+			return pubSigTlvType(&key.Sec.Ec.PublicKey)
+		default:
+			return image.IMAGE_TLV_ED25519, nil
+		}
+	}
+
+	t, err := pubSigTlvType(key.External.Pub)
+	if err != nil {
+		return 0, util.FmtNewtError("key \"%s\": %s", key.External.Ref,
+			err.(*util.NewtError).Text)
+	}
+
+	return t, nil
+}
+
+// signHash signs an image hash with a key that newt signs with itself.  Keys
+// that the image library supports are normally used by the library, but newt
+// signs with them when it modifies an image after the library has produced
+// it.
+func signHash(key newtutil.SignKey, hash []byte) ([]byte, error) {
+	if key.Sec != nil {
+		sig, err := image.GenerateSig(*key.Sec, hash)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+		return sig, nil
+	}
+
+	return key.External.Sign(hash)
+}
+
+// addNewtSigs signs an image with each of the specified keys, typically the
+// external keys that the image library does not support.  As with the
+// signatures that the image library produces, each signature covers the image
+// hash and is preceded by a KEYHASH TLV identifying the key.
+func addNewtSigs(ri *image.Image, keys []newtutil.SignKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	hash, err := ri.Hash()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		tlvType, err := sigTlvType(key)
+		if err != nil {
+			return err
+		}
+
+		pubBytes, err := key.PubBytes()
+		if err != nil {
+			return err
+		}
+
+		sig, err := signHash(key, hash)
+		if err != nil {
+			return err
+		}
+
+		appendSigTlvs(ri, pubBytes, tlvType, sig)
+	}
+
+	return nil
+}
+
+// appendSigTlvs adds a signature to an image: a KEYHASH TLV identifying the
+// key, in the form the image library produces, followed by the signature TLV.
+func appendSigTlvs(ri *image.Image, pubBytes []byte, tlvType uint8,
+	sig []byte) {
+
+	ri.Tlvs = append(ri.Tlvs, image.BuildKeyHashTlv(pubBytes))
+
+	ri.Tlvs = append(ri.Tlvs, image.ImageTlv{
+		Header: image.ImageTlvHdr{
+			Type: tlvType,
+			Len:  uint16(len(sig)),
+		},
+		Data: sig,
+	})
+}
+
+// addExtraTlvs adds a target's custom TLVs to an image.  They precede any
+// signatures that newt adds itself.
+func addExtraTlvs(ri *image.Image, tlvs []target.ImageTlv) error {
+	for _, tlv := range tlvs {
+		data, err := tlv.ReadData()
+		if err != nil {
+			return err
+		}
+
+		ri.Tlvs = append(ri.Tlvs, image.ImageTlv{
+			Header: image.ImageTlvHdr{
+				Type: tlv.Type,
+				Len:  uint16(len(data)),
+			},
+			Data: data,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apache/mynewt-artifact/flash"
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// The size of an image and the slot it is destined for.
+type imgSlotSize struct {
+	Name     string
+	Filename string
+	Slot     int
+
+	// The image's header, body, and TLV sizes.
+	HdrSize  int
+	BodySize int
+	FileSize int
+
+	SlotSize    int
+	TrailerSize int
+}
+
+func (s imgSlotSize) maxSize() int {
+	return s.SlotSize - s.TrailerSize
+}
+
+func (s imgSlotSize) breakdown() string {
+	lines := []string{
+		fmt.Sprintf("    %-18s %8d", "header:", s.HdrSize),
+		fmt.Sprintf("    %-18s %8d", "body:", s.BodySize),
+		fmt.Sprintf("    %-18s %8d", "TLVs:", s.FileSize-s.HdrSize-s.BodySize),
+		fmt.Sprintf("    %-18s %8d", "image total:", s.FileSize),
+		fmt.Sprintf("    %-18s %8d", "slot size:", s.SlotSize),
+		fmt.Sprintf("    %-18s %8d", "boot trailer:", s.TrailerSize),
+		fmt.Sprintf("    %-18s %8d", "max image size:", s.maxSize()),
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// imgSlotSizes describes the slot sizes of a target's images.  The loader, if
+// any, occupies slot 0; the app occupies the following slot.
+//
+// @param b                     The builder of the target.
+// @param loader                The size of the loader image; nil if there is
+//                                  no loader.
+// @param app                   The size of the app image.
+func imgSlotSizes(b *builder.TargetBuilder, loader *imgSlotSize,
+	app imgSlotSize) []imgSlotSize {
+
+	slotSizes := b.SlotSizes()
+	trailerSz := b.BootTrailerSize()
+
+	var sizes []imgSlotSize
+	slot := 0
+	if loader != nil {
+		loader.Slot = slot
+		sizes = append(sizes, *loader)
+		slot++
+	}
+	app.Slot = slot
+	sizes = append(sizes, app)
+
+	for i := range sizes {
+		sizes[i].SlotSize = slotSizes[sizes[i].Slot]
+		sizes[i].TrailerSize = trailerSz
+	}
+
+	return sizes
+}
+
+// verifySlotSizes verifies that each image leaves enough room for a boot
+// trailer at the end of its slot.  Images that are too large are deleted so
+// that they cannot be flashed, unless the force flag was specified.
+func verifySlotSizes(sizes []imgSlotSize) error {
+	errLines := []string{}
+
+	for _, s := range sizes {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"%s image uses %d of %d bytes in slot-%d\n%s\n",
+			s.Name, s.FileSize, s.maxSize(), s.Slot, s.breakdown())
+
+		if overflow := s.FileSize - s.maxSize(); overflow > 0 {
+			errLines = append(errLines,
+				fmt.Sprintf("%s overflows slot-%d by %d bytes "+
+					"(image=%d max=%d)\n%s",
+					s.Name, s.Slot, overflow, s.FileSize, s.maxSize(),
+					s.breakdown()))
+		}
+	}
+
+	if len(errLines) == 0 {
+		return nil
+	}
+
+	if newtutil.NewtForce {
+		for _, e := range errLines {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"* Warning: %s\n(ignoring due to force flag)\n", e)
+		}
+		return nil
+	}
+
+	for _, s := range sizes {
+		os.Remove(s.Filename)
+	}
+
+	return util.NewNewtError(strings.Join(errLines, "\n"))
+}
+
+// emitImgOutputs writes a target's images in its additional output formats,
+// at the offsets of their slots.
+//
+// @param b                     The builder of the target.
+// @param loaderFilename        The path of the loader image; "" if there is
+//                                  no loader.
+// @param appFilename           The path of the app image.
+func emitImgOutputs(b *builder.TargetBuilder, loaderFilename string,
+	appFilename string) error {
+
+	appArea := flash.FLASH_AREA_NAME_IMAGE_0
+	if loaderFilename != "" {
+		err := b.EmitOutputs(loaderFilename, flash.FLASH_AREA_NAME_IMAGE_0)
+		if err != nil {
+			return err
+		}
+		appArea = flash.FLASH_AREA_NAME_IMAGE_1
+	}
+
+	return b.EmitOutputs(appFilename, appArea)
+}
@@ -0,0 +1,239 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/apache/mynewt-artifact/image"
+	"github.com/ugorji/go/codec"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/util"
+)
+
+// SUIT manifests.  A SUIT (Software Updates for Internet of Things) manifest
+// describes a target's images in the CBOR format defined by
+// draft-ietf-suit-manifest, for update services that consume standard
+// manifests.  Each image is a component, identified by "loader" or "app", with
+// its SHA256 digest and size.  The manifest's sequence number is derived from
+// the image version, so it increases with each release.
+//
+// The envelope's authentication wrapper contains only the manifest digest; the
+// manifest is expected to be signed (COSE_Sign1) by the update service.
+
+// The filename extension of SUIT manifest files.
+const SUIT_MANIFEST_EXT = ".suit"
+
+// SUIT envelope, manifest, and command sequence keys.
+const (
+	SUIT_AUTHENTICATION_WRAPPER = 2
+	SUIT_MANIFEST               = 3
+
+	SUIT_MANIFEST_VERSION         = 1
+	SUIT_MANIFEST_SEQUENCE_NUMBER = 2
+	SUIT_COMMON                   = 3
+	SUIT_VALIDATE                 = 7
+
+	SUIT_COMPONENTS      = 2
+	SUIT_SHARED_SEQUENCE = 4
+
+	SUIT_CONDITION_IMAGE_MATCH       = 3
+	SUIT_DIRECTIVE_SET_COMPONENT_IDX = 12
+	SUIT_DIRECTIVE_OVERRIDE_PARAMS   = 20
+
+	SUIT_PARAMETER_IMAGE_DIGEST = 3
+	SUIT_PARAMETER_IMAGE_SIZE   = 14
+
+	// Report the result of a condition whether it succeeds or fails.
+	SUIT_REPORT_ALL = 15
+)
+
+// The COSE algorithm identifier of SHA-256.
+const COSE_ALG_SHA256 = -16
+
+// The version of the SUIT manifest format.
+const SUIT_MANIFEST_FORMAT_VERSION = 1
+
+type suitComponent struct {
+	name     string
+	filename string
+}
+
+func suitEncode(v interface{}) ([]byte, error) {
+	var ch codec.CborHandle
+	ch.Canonical = true
+
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, &ch).Encode(v); err != nil {
+		return nil, util.FmtNewtError(
+			"failed to encode SUIT manifest: %s", err.Error())
+	}
+
+	return b, nil
+}
+
+// suitDigest produces an encoded SUIT_Digest of the specified data.
+func suitDigest(data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	return suitEncode([]interface{}{COSE_ALG_SHA256, sum[:]})
+}
+
+// suitSequenceNumber derives a manifest sequence number from an image
+// version.  Later versions produce larger sequence numbers.
+func suitSequenceNumber(ver image.ImageVersion) uint64 {
+	return uint64(ver.Major)<<56 |
+		uint64(ver.Minor)<<48 |
+		uint64(ver.Rev)<<32 |
+		uint64(ver.BuildNum)
+}
+
+// SuitManifestPath returns the path of the SUIT manifest written for the
+// specified image file.
+func SuitManifestPath(imgFilename string) string {
+	ext := filepath.Ext(imgFilename)
+	return imgFilename[:len(imgFilename)-len(ext)] + SUIT_MANIFEST_EXT
+}
+
+// createSuitManifest produces an encoded SUIT envelope describing the
+// specified images.
+//
+// @param ver                   The version of the images.
+// @param comps                 The images to describe, in component order.
+//
+// @return []byte               The encoded SUIT envelope.
+// @return error                Error if an image cannot be read.
+func createSuitManifest(ver image.ImageVersion,
+	comps []suitComponent) ([]byte, error) {
+
+	var ids []interface{}
+	var shared []interface{}
+	var validate []interface{}
+
+	for i, c := range comps {
+		data, err := ioutil.ReadFile(c.filename)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+
+		digest, err := suitDigest(data)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, []interface{}{[]byte(c.name)})
+
+		shared = append(shared,
+			SUIT_DIRECTIVE_SET_COMPONENT_IDX, i,
+			SUIT_DIRECTIVE_OVERRIDE_PARAMS, map[int]interface{}{
+				SUIT_PARAMETER_IMAGE_DIGEST: digest,
+				SUIT_PARAMETER_IMAGE_SIZE:   len(data),
+			})
+
+		validate = append(validate,
+			SUIT_DIRECTIVE_SET_COMPONENT_IDX, i,
+			SUIT_CONDITION_IMAGE_MATCH, SUIT_REPORT_ALL)
+	}
+
+	sharedSeq, err := suitEncode(shared)
+	if err != nil {
+		return nil, err
+	}
+
+	common, err := suitEncode(map[int]interface{}{
+		SUIT_COMPONENTS:      ids,
+		SUIT_SHARED_SEQUENCE: sharedSeq,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	validateSeq, err := suitEncode(validate)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := suitEncode(map[int]interface{}{
+		SUIT_MANIFEST_VERSION:         SUIT_MANIFEST_FORMAT_VERSION,
+		SUIT_MANIFEST_SEQUENCE_NUMBER: suitSequenceNumber(ver),
+		SUIT_COMMON:                   common,
+		SUIT_VALIDATE:                 validateSeq,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	manifestDigest, err := suitDigest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := suitEncode([]interface{}{manifestDigest})
+	if err != nil {
+		return nil, err
+	}
+
+	return suitEncode(map[int]interface{}{
+		SUIT_AUTHENTICATION_WRAPPER: auth,
+		SUIT_MANIFEST:               manifest,
+	})
+}
+
+// ProduceSuitManifest writes a SUIT manifest describing a target's images
+// alongside its app image.  The images must already have been created.
+//
+// @param b                     The builder of the target.
+// @param ver                   The version of the images.
+//
+// @return string               The path of the SUIT manifest.
+// @return error                Error if an image cannot be read or the
+//                                  manifest cannot be written.
+func ProduceSuitManifest(b *builder.TargetBuilder,
+	ver image.ImageVersion) (string, error) {
+
+	var comps []suitComponent
+	if b.LoaderBuilder != nil {
+		comps = append(comps, suitComponent{
+			name:     "loader",
+			filename: b.LoaderBuilder.AppImgPath(),
+		})
+	}
+	comps = append(comps, suitComponent{
+		name:     "app",
+		filename: b.AppBuilder.AppImgPath(),
+	})
+
+	data, err := createSuitManifest(ver, comps)
+	if err != nil {
+		return "", err
+	}
+
+	path := SuitManifestPath(b.AppBuilder.AppImgPath())
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"SUIT manifest successfully generated: %s\n", path)
+
+	return path, nil
+}
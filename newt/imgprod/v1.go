@@ -22,13 +22,12 @@ package imgprod
 import (
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/apache/mynewt-artifact/image"
-	"github.com/apache/mynewt-artifact/sec"
 	"mynewt.apache.org/newt/newt/builder"
 	"mynewt.apache.org/newt/newt/manifest"
 	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
 )
 
@@ -144,42 +143,29 @@ func produceAppV1(opts ImageProdOpts,
 	return pi, nil
 }
 
-// Verifies that each already-built image leaves enough room for a boot trailer
-// a the end of its slot.
-func verifyImgSizesV1(pset ProducedImageSetV1, maxSizes []int) error {
-	errLines := []string{}
-	slot := 0
-
-	if pset.Loader != nil {
-		if overflow := int(pset.Loader.FileSize) - maxSizes[0]; overflow > 0 {
-			errLines = append(errLines,
-				fmt.Sprintf("loader overflows slot-0 by %d bytes "+
-					"(image=%d max=%d)",
-					overflow, pset.Loader.FileSize, maxSizes[0]))
-		}
-		slot++
+func producedSlotSizeV1(name string, pi ProducedImageV1) imgSlotSize {
+	return imgSlotSize{
+		Name:     name,
+		Filename: pi.Filename,
+		HdrSize:  int(pi.Image.Header.HdrSz),
+		BodySize: int(pi.Image.Header.ImgSz),
+		FileSize: pi.FileSize,
 	}
+}
 
-	if overflow := int(pset.App.FileSize) - maxSizes[slot]; overflow > 0 {
-		errLines = append(errLines,
-			fmt.Sprintf("app overflows slot-%d by %d bytes "+
-				"(image=%d max=%d)",
-				slot, overflow, pset.App.FileSize, maxSizes[slot]))
-
-	}
+// Verifies that each already-built image leaves enough room for a boot trailer
+// at the end of its slot.
+func verifyImgSizesV1(b *builder.TargetBuilder,
+	pset ProducedImageSetV1) error {
 
-	if len(errLines) > 0 {
-		if !newtutil.NewtForce {
-			return util.NewNewtError(strings.Join(errLines, "; "))
-		} else {
-			for _, e := range errLines {
-				util.StatusMessage(util.VERBOSITY_QUIET,
-					"* Warning: %s (ignoring due to force flag)\n", e)
-			}
-		}
+	var loader *imgSlotSize
+	if pset.Loader != nil {
+		s := producedSlotSizeV1("loader", *pset.Loader)
+		loader = &s
 	}
 
-	return nil
+	return verifySlotSizes(
+		imgSlotSizes(b, loader, producedSlotSizeV1("app", pset.App)))
 }
 
 func ProduceImagesV1(opts ImageProdOpts) (ProducedImageSetV1, error) {
@@ -206,20 +192,59 @@ func ProduceImagesV1(opts ImageProdOpts) (ProducedImageSetV1, error) {
 }
 
 func ProduceAllV1(t *builder.TargetBuilder, ver image.ImageVersion,
-	sigKeys []sec.PrivSignKey, encKeyFilename string) error {
+	sigKeys []newtutil.SignKey, encKeyFilename string) error {
+
+	if len(newtutil.NewtSignKeys(sigKeys)) > 0 {
+		return util.NewNewtError("external key signing requires version 2 " +
+			"of the image format (-2)")
+	}
+	for _, key := range newtutil.SecSignKeys(sigKeys) {
+		if key.Ed25519 != nil {
+			return util.NewNewtError("Ed25519 signing requires version 2 " +
+				"of the image format (-2)")
+		}
+	}
+
+	popts, err := OptsFromTgtBldr(t, ver, sigKeys, encKeyFilename)
+	if err != nil {
+		return err
+	}
+	if popts.Compression != "" {
+		return util.NewNewtError(
+			"compressed images require version 2 of the image format (-2)")
+	}
+	if len(popts.ExtraTlvs) > 0 {
+		return util.FmtNewtError("custom image TLVs (%s) require version 2 "+
+			"of the image format (-2)", target.TARGET_IMAGE_TLVS_KEY)
+	}
 
-	popts := OptsFromTgtBldr(t, ver, sigKeys, encKeyFilename)
 	pset, err := ProduceImagesV1(popts)
 	if err != nil {
 		return err
 	}
 
+	if err := verifyImgSizesV1(t, pset); err != nil {
+		return err
+	}
+
+	var loaderFilename string
+	if pset.Loader != nil {
+		loaderFilename = pset.Loader.Filename
+	}
+	if err := emitImgOutputs(t, loaderFilename, pset.App.Filename); err != nil {
+		return err
+	}
+
 	mopts := manifest.ManifestCreateOpts{
 		TgtBldr: t,
 		AppHash: pset.App.Hash,
 		Version: ver,
 		BuildID: fmt.Sprintf("%x", pset.App.Hash),
 	}
+	mopts.SignKeys, err = signKeyHashes(sigKeys)
+	if err != nil {
+		return err
+	}
 
 	if pset.Loader != nil {
 		mopts.LoaderHash = pset.Loader.Hash
@@ -229,9 +254,5 @@ func ProduceAllV1(t *builder.TargetBuilder, ver image.ImageVersion,
 		return err
 	}
 
-	if err := verifyImgSizesV1(pset, mopts.TgtBldr.MaxImgSizes()); err != nil {
-		return err
-	}
-
 	return nil
 }
@@ -0,0 +1,233 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/apache/mynewt-artifact/image"
+	"github.com/apache/mynewt-artifact/sec"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+var imageFlagNames = []struct {
+	flag uint32
+	name string
+}{
+	{0x00000001, "PIC"},
+	{image.IMAGE_F_NON_BOOTABLE, "SPLIT_APP"},
+	{0x00000004, "ENCRYPTED_AES128"},
+	{0x00000008, "ENCRYPTED_AES256"},
+	{0x00000010, "NON_BOOTABLE"},
+	{0x00000020, "RAM_LOAD"},
+	{0x00000100, "ROM_FIXED"},
+	{0x00000200, "COMPRESSED_LZMA1"},
+	{IMAGE_F_COMPRESSED_LZMA2, "COMPRESSED_LZMA2"},
+}
+
+var imageTlvNames = map[uint8]string{
+	image.IMAGE_TLV_KEYHASH:  "KEYHASH",
+	0x02:                     "PUBKEY",
+	image.IMAGE_TLV_SHA256:   "SHA256",
+	image.IMAGE_TLV_RSA2048:  "RSA2048_PSS",
+	image.IMAGE_TLV_ECDSA224: "ECDSA224",
+	image.IMAGE_TLV_ECDSA256: "ECDSA256",
+	image.IMAGE_TLV_RSA3072:  "RSA3072_PSS",
+	image.IMAGE_TLV_ED25519:  "ED25519",
+	0x30:                     "ENC_RSA2048",
+	0x31:                     "ENC_KW",
+	0x32:                     "ENC_EC256",
+	0x40:                     "DEPENDENCY",
+	0x50:                     "SEC_CNT",
+	IMAGE_TLV_DECOMP_SIZE:    "DECOMP_SIZE",
+	IMAGE_TLV_DECOMP_SHA:     "DECOMP_SHA",
+	0x72:                     "DECOMP_SIGNATURE",
+}
+
+// ImageFlagsString describes a set of image header flags.
+func ImageFlagsString(flags uint32) string {
+	var names []string
+	for _, f := range imageFlagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+			flags &^= f.flag
+		}
+	}
+	if flags != 0 {
+		names = append(names, fmt.Sprintf("0x%x", flags))
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, " ")
+}
+
+// ImageTlvName describes an image TLV type.
+func ImageTlvName(tlvType uint8) string {
+	if name, ok := imageTlvNames[tlvType]; ok {
+		return name
+	}
+	if tlvType >= 0xa0 {
+		return "CUSTOM"
+	}
+	return "UNKNOWN"
+}
+
+// SigCheck is the result of checking one of an image's signatures.
+type SigCheck struct {
+	KeyHash []byte
+	TlvType uint8
+
+	// Whether one of the provided public keys matches the key hash.
+	KeyKnown bool
+
+	// Whether the signature is valid; only meaningful if KeyKnown is true.
+	Valid bool
+}
+
+// ImageCheck is the result of verifying an image.
+type ImageCheck struct {
+	Image image.Image
+
+	// The SHA256 of the image header, body, and protected TLVs; nil if the
+	// hash could not be computed.
+	ComputedHash []byte
+
+	// Whether the computed hash matches the image's SHA256 TLV.
+	HashValid bool
+
+	// Why the hash could not be computed; "" if it was.
+	HashSkipped string
+
+	Sigs []SigCheck
+}
+
+// Ok indicates whether an image passed verification: its hash is correct (or
+// cannot be computed without other inputs), every signature made by a
+// provided key is valid, and, if any keys were provided, at least one of them
+// signed the image.
+func (ic *ImageCheck) Ok(numKeys int) bool {
+	if ic.HashSkipped == "" && !ic.HashValid {
+		return false
+	}
+
+	matched := false
+	for _, sc := range ic.Sigs {
+		if sc.KeyKnown {
+			if !sc.Valid {
+				return false
+			}
+			matched = true
+		}
+	}
+
+	return numKeys == 0 || matched
+}
+
+// VerifyImage parses an image file and checks its hash and signatures.
+//
+// The hash of an encrypted image covers the plaintext body, and the hash of a
+// split app image is seeded with the hash of its loader image, so neither can
+// be computed from the image alone; the check is skipped and the reason is
+// reported.  Signatures sign the hash in the image's SHA256 TLV, so they are
+// always checked.
+//
+// @param imgFilename           The path of the image file.
+// @param pubs                  Public keys to check signatures against (see
+//                                  newtutil.ParsePubSignKey).
+//
+// @return ImageCheck           The result of the checks.
+// @return error                Error if the file is not a valid image.
+func VerifyImage(imgFilename string,
+	pubs []interface{}) (ImageCheck, error) {
+
+	ic := ImageCheck{}
+
+	ri, _, err := readImage(imgFilename)
+	if err != nil {
+		return ic, err
+	}
+	ic.Image = ri
+
+	if ri.Header.Magic != image.IMAGE_MAGIC {
+		return ic, util.FmtNewtError(
+			"image \"%s\" has bad magic 0x%08x (expected 0x%08x)",
+			imgFilename, ri.Header.Magic, image.IMAGE_MAGIC)
+	}
+
+	hash, err := ri.Hash()
+	if err != nil {
+		return ic, util.FmtNewtError("image \"%s\": %s", imgFilename,
+			err.Error())
+	}
+
+	switch {
+	case ri.Header.Flags&image.IMAGE_F_ENCRYPTED != 0:
+		ic.HashSkipped = "image is encrypted; its hash covers the plaintext"
+
+	case ri.Header.Flags&image.IMAGE_F_NON_BOOTABLE != 0:
+		ic.HashSkipped = "split app image; its hash includes the hash " +
+			"of the loader image"
+
+	default:
+		ic.ComputedHash, err = ri.CalcHash()
+		if err != nil {
+			return ic, util.ChildNewtError(err)
+		}
+		ic.HashValid = bytes.Equal(hash, ic.ComputedHash)
+	}
+
+	keyHashes := make([][]byte, len(pubs))
+	for i, pub := range pubs {
+		pubBytes, err := newtutil.PubKeyBytes(pub)
+		if err != nil {
+			return ic, err
+		}
+		keyHashes[i] = sec.RawKeyHash(pubBytes)
+	}
+
+	// Each signature is preceded by a KEYHASH TLV identifying its key.
+	for i := 0; i+1 < len(ri.Tlvs); i++ {
+		if ri.Tlvs[i].Header.Type != image.IMAGE_TLV_KEYHASH {
+			continue
+		}
+
+		sigTlv := ri.Tlvs[i+1]
+		sc := SigCheck{
+			KeyHash: ri.Tlvs[i].Data,
+			TlvType: sigTlv.Header.Type,
+		}
+		for j, kh := range keyHashes {
+			if bytes.Equal(kh, sc.KeyHash) {
+				sc.KeyKnown = true
+				sc.Valid = newtutil.VerifySig(pubs[j], hash, sigTlv.Data)
+				break
+			}
+		}
+
+		ic.Sigs = append(ic.Sigs, sc)
+	}
+
+	return ic, nil
+}
@@ -0,0 +1,157 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package imgprod
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/apache/mynewt-artifact/image"
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/util"
+)
+
+// Automatic image versions.  A target's `target.image_version` setting
+// specifies where the major, minor, and revision numbers come from:
+//
+//     * "git": the most recent tag reachable from the app's commit (e.g.,
+//       "v1.2.3" or "1.2.3"), as reported by `git describe`.
+//     * Otherwise, the path of a version file containing "<major>.<minor>.
+//       <revision>", relative to the project directory.
+//
+// The build number is a counter that is incremented each time an image is
+// created for the target.
+
+// The value of `target.image_version` that derives versions from git tags.
+const IMAGE_VERSION_GIT = "git"
+
+// The file in a target's bin directory that holds its build number counter.
+const IMAGE_BUILD_NUM_FILENAME = "image_build_num"
+
+func gitDescribeVersion(dir string) (string, error) {
+	o, err := util.ShellCommand([]string{
+		"git", "-C", dir, "describe", "--tags", "--abbrev=0",
+	}, nil)
+	if err != nil {
+		return "", util.FmtNewtError(
+			"cannot derive image version from git in %s: %s",
+			dir, strings.TrimSpace(err.(*util.NewtError).Text))
+	}
+
+	return strings.TrimPrefix(strings.TrimSpace(string(o)), "v"), nil
+}
+
+func fileVersion(path string) (string, error) {
+	proj := interfaces.GetProject()
+	resolved, err := proj.ResolvePath(proj.Path(), path)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return "", util.FmtNewtError(
+			"cannot read image version file: %s", err.Error())
+	}
+
+	lines := strings.SplitN(strings.TrimSpace(string(data)), "\n", 2)
+	return strings.TrimSpace(lines[0]), nil
+}
+
+// nextBuildNum increments and returns the target's build number counter.
+func nextBuildNum(b *builder.TargetBuilder) (uint32, error) {
+	path := builder.TargetBinDir(b.GetTarget().Name()) + "/" +
+		IMAGE_BUILD_NUM_FILENAME
+
+	var num uint64
+	if data, err := ioutil.ReadFile(path); err == nil {
+		num, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return 0, util.FmtNewtError(
+				"invalid build number in %s: %s", path, err.Error())
+		}
+	}
+	num++
+
+	data := []byte(strconv.FormatUint(num, 10) + "\n")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return 0, util.ChildNewtError(err)
+	}
+
+	return uint32(num), nil
+}
+
+// AutoVersion derives an image version for a target from its
+// `target.image_version` setting.
+//
+// @param b                     The builder of the target.
+//
+// @return image.ImageVersion   The image version.
+// @return error                Error if the target does not specify an
+//                                  image version source or the version
+//                                  cannot be determined.
+func AutoVersion(b *builder.TargetBuilder) (image.ImageVersion, error) {
+	t := b.GetTarget()
+
+	var verStr string
+	var err error
+
+	switch t.ImageVersion {
+	case "":
+		return image.ImageVersion{}, util.FmtNewtError(
+			"target %s does not specify `target.image_version`; the image "+
+				"version must be specified", t.FullName())
+
+	case IMAGE_VERSION_GIT:
+		if t.App() == nil {
+			return image.ImageVersion{}, util.FmtNewtError(
+				"target %s does not have an app", t.FullName())
+		}
+		verStr, err = gitDescribeVersion(t.App().BasePath())
+
+	default:
+		verStr, err = fileVersion(t.ImageVersion)
+	}
+	if err != nil {
+		return image.ImageVersion{}, err
+	}
+
+	// Only the first three components are used; the build number is a
+	// counter.
+	parts := strings.SplitN(verStr, ".", 4)
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	ver, err := image.ParseVersion(strings.Join(parts, "."))
+	if err != nil {
+		return image.ImageVersion{}, util.FmtNewtError(
+			"invalid image version \"%s\" for target %s: %s",
+			verStr, t.FullName(), err.Error())
+	}
+
+	ver.BuildNum, err = nextBuildNum(b)
+	if err != nil {
+		return image.ImageVersion{}, err
+	}
+
+	return ver, nil
+}
@@ -32,6 +32,10 @@
 //     * [Git commit]:         <git-commit-ish>-commit
 //           (e.g., "0aae710654b48d9a84d54de771cc18427709df7d-commit")
 //
+// A repo can also be pinned with a `branch`, `tag`, or `commit` field in its
+// `project.yml` entry.  A pin is treated like a git commit requirement, but it
+// overrides the `vers` field and the repo's `repository.yml` version mapping.
+//
 // The first two types (normalized version and floating version) are called
 // "version specifiers".  Version specifiers map to "official releases", while
 // git commits typically map to "custom versions".
@@ -157,6 +161,23 @@ func detectVersion(r *repo.Repo) (newtutil.RepoVersion, error) {
 	return *ver, nil
 }
 
+// Options controlling an install or upgrade operation.
+type UpgradeOpts struct {
+	// Proceed even if some repos are in a dirty state.
+	Force bool
+
+	// Prompt the user for confirmation before changing anything.
+	Ask bool
+
+	// Only report the changes that would be made; don't change anything.
+	DryRun bool
+
+	// Keep installed repos that weren't explicitly selected at their current
+	// versions.  If the selected repos cannot be upgraded without changing
+	// the version of a pinned repo, the operation fails.
+	PinUnselected bool
+}
+
 type Installer struct {
 	// Map of all repos in the project.
 	repos deprepo.RepoMap
@@ -275,6 +296,10 @@ func (inst *Installer) inferReqVers(repos []*repo.Repo) error {
 		if ok {
 			for i, req := range reqs {
 				if req.Ver.Commit != "" {
+					if err := r.VerifyPin(); err != nil {
+						return err
+					}
+
 					ver, err := r.NonInstalledVersion(req.Ver.Commit)
 					if err != nil {
 						return err
@@ -467,17 +492,9 @@ func (inst *Installer) installMessageOneRepo(
 	return msg, nil
 }
 
-// Describes an imminent repo operation to the user.  In addition, prompts the
-// user for confirmation if the `-a` (ask) option was specified.
-func (inst *Installer) installPrompt(vm deprepo.VersionMap, op installOp,
-	force bool, ask bool) (bool, error) {
-
-	if len(vm) == 0 {
-		return true, nil
-	}
-
-	util.StatusMessage(util.VERBOSITY_DEFAULT,
-		"Making the following changes to the project:\n")
+// Prints a description of each repo operation in the specified version map.
+func (inst *Installer) describeChanges(vm deprepo.VersionMap, op installOp,
+	force bool) error {
 
 	names := vm.SortedNames()
 	for _, name := range names {
@@ -494,12 +511,31 @@ func (inst *Installer) installPrompt(vm deprepo.VersionMap, op installOp,
 		msg, err := inst.installMessageOneRepo(
 			r, op, force, curVer, destVer)
 		if err != nil {
-			return false, err
+			return err
 		}
 
 		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", msg)
 	}
 
+	return nil
+}
+
+// Describes an imminent repo operation to the user.  In addition, prompts the
+// user for confirmation if the `-a` (ask) option was specified.
+func (inst *Installer) installPrompt(vm deprepo.VersionMap, op installOp,
+	force bool, ask bool) (bool, error) {
+
+	if len(vm) == 0 {
+		return true, nil
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Making the following changes to the project:\n")
+
+	if err := inst.describeChanges(vm, op, force); err != nil {
+		return false, err
+	}
+
 	if !ask {
 		return true, nil
 	}
@@ -545,6 +581,11 @@ func (inst *Installer) shouldKeepCommit(
 		return false, nil
 	}
 
+	// A pinned commit always overrides the `repository.yml` version mapping.
+	if r.Pin() != nil {
+		return true, nil
+	}
+
 	vers, err := r.VersFromEquivCommit(commit)
 	if err != nil {
 		return false, err
@@ -594,9 +635,54 @@ func (inst *Installer) versionMapRepos(
 	return repos, nil
 }
 
+// Removes all but the installed version of each pinned repo from the
+// specified matrix.  A repo is pinned if it is installed and it is not one of
+// the specified candidates.
+//
+// @return []string             The names of the pinned repos, sorted.
+func (inst *Installer) pinMatrix(m *deprepo.Matrix,
+	repos []*repo.Repo, candidates []*repo.Repo) []string {
+
+	isCandidate := map[string]bool{}
+	for _, r := range candidates {
+		isCandidate[r.Name()] = true
+	}
+
+	var pinned []string
+	for _, r := range repos {
+		if isCandidate[r.Name()] {
+			continue
+		}
+
+		ver := inst.installedVer(r.Name())
+		if ver == nil {
+			// Not installed; nothing to pin.
+			continue
+		}
+
+		pinVer := *ver
+		pinVer.Commit = ""
+		m.ApplyFilter(r.Name(), deprepo.Filter{
+			Name: "installed",
+			Reqs: []newtutil.RepoVersionReq{{
+				CompareType: "==",
+				Ver:         pinVer,
+			}},
+		})
+		pinned = append(pinned, r.Name())
+	}
+
+	sort.Strings(pinned)
+	return pinned
+}
+
 // Calculates a map of repos and version numbers that should be included in an
 // install or upgrade operation.
-func (inst *Installer) calcVersionMap(candidates []*repo.Repo) (
+//
+// @param candidates            The repos the user wants to install or upgrade.
+// @param pin                   Whether to keep all other installed repos at
+//                                  their current versions.
+func (inst *Installer) calcVersionMap(candidates []*repo.Repo, pin bool) (
 	deprepo.VersionMap, error) {
 
 	// Repos that depend on any specified repos must also be considered during
@@ -624,6 +710,11 @@ func (inst *Installer) calcVersionMap(candidates []*repo.Repo) (
 		return nil, err
 	}
 
+	var pinned []string
+	if pin {
+		pinned = inst.pinMatrix(&m, repoList, candidates)
+	}
+
 	// Construct a repo dependency graph from the `project.yml` version
 	// requirements and from each repo's dependency list.
 	dg, err := deprepo.BuildDepGraph(inst.repos, inst.reqs)
@@ -643,7 +734,14 @@ func (inst *Installer) calcVersionMap(candidates []*repo.Repo) (
 	vm, conflicts := deprepo.FindAcceptableVersions(m, dg)
 	log.Debugf("Repo version map:\n%s\n", vm.String())
 	if len(conflicts) > 0 {
-		return nil, deprepo.ConflictError(conflicts)
+		err := deprepo.ConflictError(conflicts)
+		if len(pinned) > 0 {
+			err = util.FmtNewtError("%s\n\nThe following repos are pinned "+
+				"to their installed versions: %s\n"+
+				"Specify them on the command line to allow them to be "+
+				"upgraded.", err.Error(), strings.Join(pinned, ", "))
+		}
+		return nil, err
 	}
 
 	// If project.yml specified any specific git commits, ensure we get them.
@@ -686,19 +784,22 @@ func verifyRepoDirtyState(repos []*repo.Repo, force bool) error {
 		if dirtyState != "" {
 			if m == nil {
 				m = make(map[*repo.Repo]string)
-				m[r] = dirtyState
 			}
+			m[r] = dirtyState
 		}
 	}
 
 	if len(m) > 0 {
 		s := "some repos are in a dirty state:\n"
-		for r, d := range m {
-			s += fmt.Sprintf("    %s: contains %s\n", r.Name(), d)
+		for _, r := range repos {
+			if d, ok := m[r]; ok {
+				s += fmt.Sprintf("    %s: contains %s\n", r.Name(), d)
+			}
 		}
 
 		if !force {
-			s += "Specify the `-f` (force) switch to attempt anyway"
+			s += "Specify the `-f` (force) switch to save the local changes " +
+				"and proceed anyway"
 			return util.NewNewtError(s)
 		} else {
 			util.OneTimeWarning("%s", s)
@@ -731,15 +832,142 @@ func verifyNewtCompat(repos []*repo.Repo, vm deprepo.VersionMap) error {
 	return nil
 }
 
-// Installs or upgrades the specified set of repos.
-func (inst *Installer) Upgrade(candidates []*repo.Repo, force bool,
-	ask bool) error {
+// Abbreviates a commit hash for display.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
 
-	if err := verifyRepoDirtyState(candidates, force); err != nil {
-		return err
+// Determines the commit hash that the specified repo would be checked out at
+// if it were upgraded to the given version.  If the hash can't be determined
+// without downloading the repo, the unresolved commit string is returned.
+func targetCommit(r *repo.Repo, ver newtutil.RepoVersion) string {
+	commit, err := r.CommitFromVer(ver)
+	if err != nil {
+		return "?"
+	}
+
+	if r.CheckExists() {
+		if hash, err := r.Downloader().HashFor(r.Path(), commit); err == nil {
+			return shortHash(hash)
+		}
+	}
+
+	return commit
+}
+
+// Prints the outcome of a dry run upgrade.  For each repo, the current commit,
+// the target commit, and whether local changes would block the update are
+// displayed.
+//
+// @param candidates            The repos the user wants to upgrade.
+// @param vm                    The repos that need to change, and their
+//                                  destination versions.
+// @param force                 Whether the `-f` (force) option was
+//                                  specified.
+func (inst *Installer) dryRunReport(candidates []*repo.Repo,
+	vm deprepo.VersionMap, force bool) error {
+
+	nameMap := map[string]struct{}{}
+	for _, r := range candidates {
+		nameMap[r.Name()] = struct{}{}
+	}
+	for name, _ := range vm {
+		nameMap[name] = struct{}{}
+	}
+
+	names := make([]string, 0, len(nameMap))
+	for name, _ := range nameMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type row struct {
+		name   string
+		cur    string
+		dest   string
+		status string
+	}
+
+	rows := make([]row, len(names))
+	for i, name := range names {
+		r := inst.repos[name]
+		rw := row{name: name}
+
+		curVer := inst.installedVer(name)
+		if !r.CheckExists() || curVer == nil {
+			rw.cur = "not installed"
+		} else {
+			cv := *curVer
+			cv.Commit = ""
+			rw.cur = cv.String()
+			if hash, err := r.CurrentHash(); err == nil {
+				rw.cur += " (" + shortHash(hash) + ")"
+			}
+		}
+
+		destVer, ok := vm[name]
+		if !ok {
+			rw.dest = "-"
+			rw.status = "up to date"
+		} else {
+			dv := destVer
+			dv.Commit = ""
+			rw.dest = fmt.Sprintf("%s (%s)", dv.String(),
+				targetCommit(r, destVer))
+
+			rw.status = "will update"
+			if r.CheckExists() {
+				dirty, err := r.DirtyState()
+				if err != nil {
+					return err
+				}
+				if dirty != "" {
+					if force {
+						rw.status = "will update; contains " + dirty +
+							" (forced)"
+					} else {
+						rw.status = "blocked; contains " + dirty
+					}
+				}
+			} else {
+				rw.status = "will install"
+			}
+		}
+
+		rows[i] = rw
+	}
+
+	nameWidth, curWidth, destWidth := 0, 0, 0
+	for _, rw := range rows {
+		nameWidth = util.Max(nameWidth, len(rw.name))
+		curWidth = util.Max(curWidth, len(rw.cur))
+		destWidth = util.Max(destWidth, len(rw.dest))
 	}
 
-	vm, err := inst.calcVersionMap(candidates)
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Dry run; no repos will be modified:\n")
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"    %-*s  %-*s  %-*s  %s\n",
+		nameWidth, "repo", curWidth, "current", destWidth, "target",
+		"status")
+	for _, rw := range rows {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    %-*s  %-*s  %-*s  %s\n",
+			nameWidth, rw.name, curWidth, rw.cur, destWidth, rw.dest,
+			rw.status)
+	}
+
+	return nil
+}
+
+// Installs or upgrades the specified set of repos.
+func (inst *Installer) Upgrade(candidates []*repo.Repo,
+	opts UpgradeOpts) error {
+
+	vm, err := inst.calcVersionMap(candidates, opts.PinUnselected)
 	if err != nil {
 		return err
 	}
@@ -750,20 +978,39 @@ func (inst *Installer) Upgrade(candidates []*repo.Repo, force bool,
 		return err
 	}
 
-	// Notify the user of what install operations are about to happen, and
-	// prompt if the `-a` (ask) option was specified.
-	proceed, err := inst.installPrompt(vm, INSTALL_OP_UPGRADE, false, ask)
+	// A dry run doesn't modify any repos; dirty repos are indicated in its
+	// report instead.
+	if opts.DryRun {
+		return inst.dryRunReport(candidates, vm, opts.Force)
+	}
+
+	repos, err := inst.versionMapRepos(vm)
 	if err != nil {
 		return err
 	}
-	if !proceed {
-		return nil
+
+	// Refuse to touch repos containing local changes or unpushed commits
+	// unless the user forces the upgrade.
+	var installed []*repo.Repo
+	for _, r := range repos {
+		if r.CheckExists() {
+			installed = append(installed, r)
+		}
+	}
+	if err := verifyRepoDirtyState(installed, opts.Force); err != nil {
+		return err
 	}
 
-	repos, err := inst.versionMapRepos(vm)
+	// Notify the user of what install operations are about to happen, and
+	// prompt if the `-a` (ask) option was specified.
+	proceed, err := inst.installPrompt(vm, INSTALL_OP_UPGRADE, false,
+		opts.Ask)
 	if err != nil {
 		return err
 	}
+	if !proceed {
+		return nil
+	}
 
 	if err := verifyNewtCompat(repos, vm); err != nil {
 		return err
@@ -772,12 +1019,35 @@ func (inst *Installer) Upgrade(candidates []*repo.Repo, force bool,
 	// Upgrade each repo in the version map.
 	for _, r := range repos {
 		destVer := vm[r.Name()]
+
+		// Don't let the upgrade discard the user's work.
+		if opts.Force && r.CheckExists() {
+			saved, err := r.Stash()
+			if err != nil {
+				return err
+			}
+			if saved != "" {
+				util.StatusMessage(util.VERBOSITY_DEFAULT,
+					"%s: saved %s\n", r.Name(), saved)
+			}
+		}
+
 		if err := r.Upgrade(destVer); err != nil {
 			return err
 		}
-		util.StatusMessage(util.VERBOSITY_DEFAULT,
-			"%s successfully upgraded to version %s\n",
-			r.Name(), destVer.String())
+		if err := r.RecordCheckout(destVer); err != nil {
+			return err
+		}
+
+		if pin := r.Pin(); pin != nil {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"%s successfully upgraded to version %s (pinned to %s)\n",
+				r.Name(), destVer.String(), pin.String())
+		} else {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"%s successfully upgraded to version %s\n",
+				r.Name(), destVer.String())
+		}
 	}
 
 	return nil
@@ -861,7 +1131,7 @@ func (inst *Installer) Info(repos []*repo.Repo, remote bool) error {
 			}
 		}
 
-		vm, err := inst.calcVersionMap(repos)
+		vm, err := inst.calcVersionMap(repos, false)
 		if err != nil {
 			return err
 		}
@@ -893,3 +1163,48 @@ func (inst *Installer) Info(repos []*repo.Repo, remote bool) error {
 
 	return nil
 }
+
+// Prints a summary of the version control state of each specified repo:
+//     * Installed version and checked out commit.
+//     * Checked out branch, or "detached" if not on a branch.
+//     * Whether the repo contains local changes or unpushed commits.
+//
+// @param repos                 The set of repositories to inspect.
+func (inst *Installer) Status(repos []*repo.Repo) error {
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Repository status:\n")
+	for _, r := range repos {
+		s := fmt.Sprintf("    * %s: ", r.Name())
+
+		ri := inst.gatherInfo(r, nil)
+		if ri.errorText != "" {
+			s += fmt.Sprintf("unknown (%s)", ri.errorText)
+		} else if ri.installedVer == nil {
+			s += "not installed"
+		} else {
+			ver := *ri.installedVer
+			ver.Commit = ""
+			s += fmt.Sprintf("%s (%s), ", ver.String(),
+				shortHash(ri.commitHash))
+
+			branch, err := r.Downloader().CurrentBranch(r.Path())
+			if err != nil {
+				return err
+			}
+			if branch == "" {
+				s += "detached; "
+			} else {
+				s += fmt.Sprintf("branch %s; ", branch)
+			}
+
+			if ri.dirtyState == "" {
+				s += "clean"
+			} else {
+				s += fmt.Sprintf("dirty (%s)", ri.dirtyState)
+			}
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", s)
+	}
+
+	return nil
+}
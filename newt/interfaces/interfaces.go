@@ -45,6 +45,7 @@ type DependencyInterface interface {
 type ProjectInterface interface {
 	Name() string
 	Path() string
+	ReposPath() string
 	ResolveDependency(dep DependencyInterface) PackageInterface
 	ResolvePath(basePath string, name string) (string, error)
 	PackageList() PackageList
@@ -0,0 +1,107 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package itm decodes the ARM Instrumentation Trace Macrocell (ITM) packets
+// that a Cortex-M MCU emits on its SWO pin.  The TPIU formatter must be
+// bypassed, so that the stream contains only ITM packets.
+package itm
+
+import (
+	"bufio"
+	"io"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Packet headers.
+const (
+	ITM_HDR_SYNC     = 0x00
+	ITM_HDR_SYNC_END = 0x80
+	ITM_HDR_OVERFLOW = 0x70
+
+	itmHdrSizeMask  = 0x03
+	itmHdrHwSource  = 0x04
+	itmHdrContinue  = 0x80
+	itmHdrPortShift = 3
+)
+
+// Decode reads ITM packets until the end of the stream, and passes the
+// payload of each instrumentation (stimulus port) packet to the specified
+// function.  Protocol packets (synchronization, timestamps, and extensions)
+// and hardware source packets are skipped.
+//
+// @param r                     The SWO stream.
+// @param fn                    Called with the port number and payload of
+//                                  each instrumentation packet.
+//
+// @return error                Error reading the stream; nil at the end of
+//                                  the stream.
+func Decode(r io.Reader, fn func(port int, data []byte)) error {
+	br := bufio.NewReader(r)
+	payload := make([]byte, 4)
+
+	// A synchronization packet is a run of zero bytes terminated by 0x80.
+	inSync := false
+
+	for {
+		hdr, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return util.ChildNewtError(err)
+		}
+
+		prevSync := inSync
+		inSync = hdr == ITM_HDR_SYNC
+
+		switch {
+		case hdr == ITM_HDR_SYNC || hdr == ITM_HDR_OVERFLOW:
+
+		case hdr == ITM_HDR_SYNC_END && prevSync:
+			// End of synchronization packet.
+
+		case hdr&itmHdrSizeMask == 0:
+			// Timestamp or extension packet; its payload bytes have the
+			// continuation bit set, except for the last.
+			for c := hdr; c&itmHdrContinue != 0; {
+				if c, err = br.ReadByte(); err != nil {
+					return eofOk(err)
+				}
+			}
+
+		default:
+			// Source packet: 1, 2, or 4 payload bytes.
+			sz := 1 << uint((hdr&itmHdrSizeMask)-1)
+			if _, err := io.ReadFull(br, payload[:sz]); err != nil {
+				return eofOk(err)
+			}
+			if hdr&itmHdrHwSource == 0 {
+				fn(int(hdr>>itmHdrPortShift), payload[:sz])
+			}
+		}
+	}
+}
+
+func eofOk(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return util.ChildNewtError(err)
+}
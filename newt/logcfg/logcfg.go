@@ -268,6 +268,16 @@ func (lcfg *LCfg) writeLogMacros(w io.Writer) {
 	for _, l := range logs {
 		fmt.Fprintf(w, "\n")
 
+		fmt.Fprintf(w, "/* Defined by %s",
+			l.Source.RelativeFilePath(pkg.SYSCFG_YAML_FILENAME))
+		if l.Module.RefName != "" {
+			fmt.Fprintf(w, "; module from %s", l.Module.RefName)
+		}
+		if l.Level.RefName != "" {
+			fmt.Fprintf(w, "; level from %s", l.Level.RefName)
+		}
+		fmt.Fprintf(w, " */\n")
+
 		levelInt, _ := util.AtoiNoOct(l.Level.Value)
 		for i, levelStr := range logLevelNames {
 			if i < levelInt {
@@ -22,7 +22,10 @@
 package manifest
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
@@ -49,6 +52,23 @@ type ManifestCreateOpts struct {
 	Version    image.ImageVersion
 	BuildID    string
 	Syscfg     map[string]string
+
+	// Syscfg overrides specified on the command line (-DSETTING=value).
+	SyscfgOverrides map[string]string
+
+	// Hex-encoded SHA256 hashes of the keys the images are signed with.
+	SignKeys []string
+}
+
+// ImageManifest is the manifest written alongside a target's images.  It
+// extends the image library's manifest with details of how the images were
+// produced.
+type ImageManifest struct {
+	manifest.Manifest
+
+	SignKeys        []string          `json:"sign_keys,omitempty"`
+	Toolchain       string            `json:"toolchain,omitempty"`
+	SyscfgOverrides map[string]string `json:"syscfg_overrides,omitempty"`
 }
 
 type RepoManager struct {
@@ -251,8 +271,9 @@ func OptsForNonImage(t *builder.TargetBuilder) (ManifestCreateOpts, error) {
 	}
 
 	return ManifestCreateOpts{
-		TgtBldr: t,
-		Syscfg:  res.Cfg.SettingValues(),
+		TgtBldr:         t,
+		Syscfg:          res.Cfg.SettingValues(),
+		SyscfgOverrides: t.OverrideSettings(),
 	}, nil
 }
 
@@ -265,12 +286,13 @@ func OptsForImage(t *builder.TargetBuilder, ver image.ImageVersion,
 	}
 
 	return ManifestCreateOpts{
-		TgtBldr:    t,
-		AppHash:    appHash,
-		LoaderHash: loaderHash,
-		Version:    ver,
-		BuildID:    fmt.Sprintf("%x", appHash),
-		Syscfg:     res.Cfg.SettingValues(),
+		TgtBldr:         t,
+		AppHash:         appHash,
+		LoaderHash:      loaderHash,
+		Version:         ver,
+		BuildID:         fmt.Sprintf("%x", appHash),
+		Syscfg:          res.Cfg.SettingValues(),
+		SyscfgOverrides: t.OverrideSettings(),
 	}, nil
 }
 
@@ -294,7 +316,7 @@ func CreateManifest(opts ManifestCreateOpts) (manifest.Manifest, error) {
 
 	m.Repos = rm.AllRepos()
 
-	vars := t.GetTarget().TargetY.AllSettingsAsStrings()
+	vars := t.GetTarget().EffectiveY().AllSettingsAsStrings()
 	keys := make([]string, 0, len(vars))
 	for k := range vars {
 		keys = append(keys, k)
@@ -332,3 +354,61 @@ func CreateManifest(opts ManifestCreateOpts) (manifest.Manifest, error) {
 
 	return m, nil
 }
+
+// CreateImageManifest creates the manifest that is written alongside a
+// target's images.
+func CreateImageManifest(opts ManifestCreateOpts) (ImageManifest, error) {
+	m, err := CreateManifest(opts)
+	if err != nil {
+		return ImageManifest{}, err
+	}
+
+	im := ImageManifest{
+		Manifest:        m,
+		SignKeys:        opts.SignKeys,
+		SyscfgOverrides: opts.SyscfgOverrides,
+	}
+
+	cc, ver, err := opts.TgtBldr.CompilerVersion()
+	if err != nil {
+		log.Debugf("failed to determine compiler version: %s", err.Error())
+	} else if ver != "" {
+		im.Toolchain = fmt.Sprintf("%s: %s", cc, ver)
+	} else {
+		im.Toolchain = cc
+	}
+
+	return im, nil
+}
+
+func (im *ImageManifest) Write(w io.Writer) (int, error) {
+	buffer, err := json.MarshalIndent(im, "", "  ")
+	if err != nil {
+		return 0, util.FmtNewtError("Cannot encode manifest: %s", err.Error())
+	}
+
+	cnt, err := w.Write(buffer)
+	if err != nil {
+		return 0, util.FmtNewtError("Cannot write manifest: %s", err.Error())
+	}
+
+	return cnt, nil
+}
+
+// ReadImageManifest reads a manifest written alongside a target's images.
+func ReadImageManifest(path string) (ImageManifest, error) {
+	im := ImageManifest{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return im, util.ChildNewtError(err)
+	}
+
+	if err := json.Unmarshal(data, &im); err != nil {
+		return im, util.FmtNewtError(
+			"Failure decoding manifest with path \"%s\": %s",
+			path, err.Error())
+	}
+
+	return im, nil
+}
@@ -0,0 +1,360 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mock
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Style selects how generated stubs are implemented.
+type Style int
+
+const (
+	// Each stub is a weak symbol returning a zeroed value.  A test overrides
+	// a stub by defining a function with the same name.
+	STYLE_WEAK Style = iota
+
+	// Each stub calls through a function pointer that the test can set at
+	// runtime, and counts its invocations.
+	STYLE_FPTR
+)
+
+var styleNames = map[Style]string{
+	STYLE_WEAK: "weak",
+	STYLE_FPTR: "fptr",
+}
+
+func (s Style) String() string {
+	return styleNames[s]
+}
+
+// ParseStyle converts a style name ("weak" or "fptr") to a Style.
+func ParseStyle(s string) (Style, error) {
+	for style, name := range styleNames {
+		if name == s {
+			return style, nil
+		}
+	}
+
+	return 0, util.FmtNewtError(
+		"invalid mock style \"%s\"; must be one of: weak, fptr", s)
+}
+
+// Header is a C header belonging to the provider of the mocked API.
+type Header struct {
+	// Absolute path of the header.
+	Path string
+
+	// Path relative to the provider's include directory; this is the name
+	// the header is included by.
+	Name string
+}
+
+// Mock describes a stub package to generate.
+type Mock struct {
+	// Name of the API being mocked (e.g., "log").
+	Api string
+
+	// Full name of the package whose headers are being mocked.
+	Provider string
+
+	// Full name of the package to generate.
+	PkgName string
+
+	Style   Style
+	Headers []Header
+	Funcs   []Func
+}
+
+// FindHeaders lists the headers in a package's include directory.
+//
+// @param pkgDir                The base directory of the package.
+//
+// @return []Header             The package's headers, sorted by name.
+// @return error                Error on failure.
+func FindHeaders(pkgDir string) ([]Header, error) {
+	incDir := filepath.Join(pkgDir, "include")
+	if !util.NodeExist(incDir) {
+		return nil, nil
+	}
+
+	hdrs := []Header{}
+	err := filepath.Walk(incDir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || filepath.Ext(path) != ".h" {
+				return nil
+			}
+
+			rel, err := filepath.Rel(incDir, path)
+			if err != nil {
+				return err
+			}
+			hdrs = append(hdrs, Header{
+				Path: path,
+				Name: filepath.ToSlash(rel),
+			})
+			return nil
+		})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	sort.Slice(hdrs, func(i int, j int) bool {
+		return hdrs[i].Name < hdrs[j].Name
+	})
+
+	return hdrs, nil
+}
+
+// NewMock parses the specified headers and creates a description of the stub
+// package for them.  Functions declared in more than one header are stubbed
+// once.
+func NewMock(api string, provider string, pkgName string, style Style,
+	hdrs []Header) (*Mock, error) {
+
+	m := &Mock{
+		Api:      api,
+		Provider: provider,
+		PkgName:  pkgName,
+		Style:    style,
+		Headers:  hdrs,
+	}
+
+	seen := map[string]struct{}{}
+	for _, h := range hdrs {
+		funcs, err := ParseHeader(h.Path, h.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range funcs {
+			if _, ok := seen[f.Name]; !ok {
+				seen[f.Name] = struct{}{}
+				m.Funcs = append(m.Funcs, f)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// Joins a type and a name into a declaration, omitting the space after a
+// pointer type's asterisk.
+func joinDecl(typ string, name string) string {
+	if strings.HasSuffix(typ, "*") {
+		return typ + name
+	}
+	return typ + " " + name
+}
+
+// baseName is the last element of the generated package's name; it is used
+// to name the generated source and header files.
+func (m *Mock) baseName() string {
+	return filepath.Base(m.PkgName)
+}
+
+func (m *Mock) writeIncludes(w io.Writer) {
+	fmt.Fprintf(w, "#include <string.h>\n")
+	fmt.Fprintf(w, "#include <stddef.h>\n")
+	for _, h := range m.Headers {
+		fmt.Fprintf(w, "#include \"%s\"\n", h.Name)
+	}
+}
+
+func writeRcDecl(w io.Writer, f *Func) {
+	if !f.ReturnsVoid() {
+		fmt.Fprintf(w, "    %s;\n\n", joinDecl(f.Ret, "rc"))
+	}
+}
+
+func writeZeroReturn(w io.Writer, f *Func) {
+	if !f.ReturnsVoid() {
+		fmt.Fprintf(w, "    memset(&rc, 0, sizeof rc);\n")
+		fmt.Fprintf(w, "    return rc;\n")
+	}
+}
+
+func (m *Mock) writeWeakSrc(w io.Writer) {
+	for i, _ := range m.Funcs {
+		f := &m.Funcs[i]
+
+		fmt.Fprintf(w, "\n__attribute__((weak)) %s\n{\n", f.Decl(f.Name))
+		writeRcDecl(w, f)
+		writeZeroReturn(w, f)
+		fmt.Fprintf(w, "}\n")
+	}
+}
+
+func (m *Mock) writeFptrSrc(w io.Writer) {
+	fmt.Fprintf(w, "#include \"%s/%s.h\"\n", m.baseName(), m.baseName())
+
+	for i, _ := range m.Funcs {
+		f := &m.Funcs[i]
+
+		fmt.Fprintf(w, "\n%s (*%s_mock)(%s);\n", f.Ret, f.Name, f.ParamList())
+		fmt.Fprintf(w, "int %s_mock_calls;\n", f.Name)
+
+		fmt.Fprintf(w, "\n%s\n{\n", f.Decl(f.Name))
+		writeRcDecl(w, f)
+		fmt.Fprintf(w, "    %s_mock_calls++;\n", f.Name)
+		fmt.Fprintf(w, "    if (%s_mock != NULL) {\n", f.Name)
+		if f.ReturnsVoid() {
+			fmt.Fprintf(w, "        %s_mock(%s);\n", f.Name, f.ArgList())
+		} else {
+			fmt.Fprintf(w, "        return %s_mock(%s);\n",
+				f.Name, f.ArgList())
+		}
+		fmt.Fprintf(w, "    }\n")
+		if !f.ReturnsVoid() {
+			fmt.Fprintf(w, "\n")
+		}
+		writeZeroReturn(w, f)
+		fmt.Fprintf(w, "}\n")
+	}
+
+	fmt.Fprintf(w, "\nvoid\n%s_reset(void)\n{\n", m.baseName())
+	for _, f := range m.Funcs {
+		fmt.Fprintf(w, "    %s_mock = NULL;\n", f.Name)
+		fmt.Fprintf(w, "    %s_mock_calls = 0;\n", f.Name)
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+// Src generates the contents of the stub source file.
+func (m *Mock) Src() []byte {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, newtutil.GeneratedPreamble())
+	m.writeIncludes(&buf)
+
+	switch m.Style {
+	case STYLE_WEAK:
+		m.writeWeakSrc(&buf)
+	case STYLE_FPTR:
+		m.writeFptrSrc(&buf)
+	}
+
+	return buf.Bytes()
+}
+
+// MockHeader generates the contents of the header declaring the function
+// pointers and call counters.  It returns nil for styles that don't use one.
+func (m *Mock) MockHeader() []byte {
+	if m.Style != STYLE_FPTR {
+		return nil
+	}
+
+	guard := "H_" + strings.ToUpper(m.baseName()) + "_"
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, newtutil.GeneratedPreamble())
+	fmt.Fprintf(&buf, "#ifndef %s\n#define %s\n\n", guard, guard)
+	m.writeIncludes(&buf)
+	fmt.Fprintf(&buf, "\n#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n")
+
+	for _, f := range m.Funcs {
+		fmt.Fprintf(&buf, "extern %s (*%s_mock)(%s);\n",
+			f.Ret, f.Name, f.ParamList())
+		fmt.Fprintf(&buf, "extern int %s_mock_calls;\n", f.Name)
+	}
+
+	fmt.Fprintf(&buf,
+		"\n/** Clears all mock function pointers and call counts. */\n")
+	fmt.Fprintf(&buf, "void %s_reset(void);\n", m.baseName())
+	fmt.Fprintf(&buf, "\n#ifdef __cplusplus\n}\n#endif\n\n#endif\n")
+
+	return buf.Bytes()
+}
+
+// PkgYml generates the contents of the stub package's pkg.yml file.
+func (m *Mock) PkgYml() []byte {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "# Generated by \"newt pkg mock\" from %s.\n", m.Provider)
+	fmt.Fprintf(&buf, "# Add any dependencies required by the copied headers "+
+		"to pkg.deps.\n\n")
+	fmt.Fprintf(&buf, "pkg.name: %s\n", m.PkgName)
+	fmt.Fprintf(&buf,
+		"pkg.description: Mock implementation of the \"%s\" API.\n", m.Api)
+	fmt.Fprintf(&buf, "pkg.author: \"Apache Mynewt <dev@mynewt.apache.org>\"\n")
+	fmt.Fprintf(&buf, "pkg.homepage: \"http://mynewt.apache.org/\"\n")
+	fmt.Fprintf(&buf, "pkg.keywords:\n    - mock\n\n")
+	fmt.Fprintf(&buf, "pkg.apis:\n    - %s\n", m.Api)
+
+	return buf.Bytes()
+}
+
+// Write creates the stub package in the specified directory.  The provider's
+// headers are copied into the package's include directory so that the stub
+// package can replace the provider entirely.
+//
+// @param dstDir                The directory to create the package in.  It
+//                                  must not already exist.
+//
+// @return error                Error on failure.
+func (m *Mock) Write(dstDir string) error {
+	if util.NodeExist(dstDir) {
+		return util.FmtNewtError(
+			"cannot create mock package; \"%s\" already exists", dstDir)
+	}
+
+	incDir := filepath.Join(dstDir, "include")
+	for _, h := range m.Headers {
+		if err := util.CopyFile(h.Path,
+			filepath.Join(incDir, filepath.FromSlash(h.Name))); err != nil {
+
+			return err
+		}
+	}
+
+	files := map[string][]byte{
+		"pkg.yml": m.PkgYml(),
+	}
+	files[filepath.Join("src", m.baseName()+".c")] = m.Src()
+	if hdr := m.MockHeader(); hdr != nil {
+		files[filepath.Join("include", m.baseName(),
+			m.baseName()+".h")] = hdr
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(dstDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return util.ChildNewtError(err)
+		}
+		if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	return nil
+}
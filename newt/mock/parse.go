@@ -0,0 +1,330 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package mock extracts function prototypes from C headers and generates stub
+// packages implementing them.  A stub package stands in for the real provider
+// of an API so that unit tests of mid-layer packages don't pull in the whole
+// driver stack.
+package mock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Param is a single parameter of a function prototype.
+type Param struct {
+	// Full declaration, including the parameter name (e.g., "uint8_t *buf").
+	Decl string
+
+	// Parameter name.  Synthesized if the header omits it.
+	Name string
+}
+
+// Func is a function prototype parsed from a header.
+type Func struct {
+	Ret    string
+	Name   string
+	Params []Param
+
+	// Header the prototype was read from.
+	Header string
+}
+
+var (
+	reBlockComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	reLineComment  = regexp.MustCompile(`//[^\n]*`)
+	reExternC      = regexp.MustCompile(`extern\s+"C"\s*\{`)
+	reAttribute    = regexp.MustCompile(`__attribute__\s*\(\(.*?\)\)`)
+	reSpace        = regexp.MustCompile(`\s+`)
+	reProto        = regexp.MustCompile(`^([^(]*[\s*])(\w+)\s*\((.*)\)$`)
+	reFptrName     = regexp.MustCompile(`\(\s*\*\s*(\w*)\s*\)`)
+	reArrayName    = regexp.MustCompile(`(\w+)\s*\[[^\]]*\]$`)
+	reIdent        = regexp.MustCompile(`^\w+$`)
+)
+
+// Words that can end a parameter type.  A parameter whose last word is one of
+// these has no name.
+var typeWords = map[string]bool{
+	"void":     true,
+	"char":     true,
+	"short":    true,
+	"int":      true,
+	"long":     true,
+	"float":    true,
+	"double":   true,
+	"signed":   true,
+	"unsigned": true,
+	"const":    true,
+	"volatile": true,
+	"_Bool":    true,
+	"bool":     true,
+}
+
+// Removes comments and preprocessor directives from C source text.
+func stripHeader(text string) string {
+	text = reBlockComment.ReplaceAllString(text, " ")
+	text = reLineComment.ReplaceAllString(text, "")
+	text = strings.Replace(text, "\\\n", " ", -1)
+
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+
+	text = strings.Join(out, "\n")
+	text = reExternC.ReplaceAllString(text, "")
+	text = reAttribute.ReplaceAllString(text, "")
+
+	return text
+}
+
+// Splits C source text into top-level declarations.  Function definitions
+// (e.g., static inline functions) are discarded, as are unmatched closing
+// braces left over from `extern "C"` blocks.
+func splitDecls(text string) []string {
+	decls := []string{}
+	cur := []rune{}
+	depth := 0
+
+	for _, c := range text {
+		switch c {
+		case '{':
+			if depth == 0 && strings.HasSuffix(
+				strings.TrimSpace(string(cur)), ")") {
+
+				// Function definition; don't treat it as a prototype.
+				cur = append(cur, []rune("{}")...)
+			}
+			depth++
+
+		case '}':
+			if depth > 0 {
+				depth--
+				if depth == 0 &&
+					strings.HasSuffix(string(cur), "{}") {
+
+					cur = cur[:0]
+				}
+			}
+
+		case ';':
+			if depth == 0 {
+				decls = append(decls, strings.TrimSpace(string(cur)))
+				cur = cur[:0]
+			}
+
+		default:
+			if depth == 0 {
+				cur = append(cur, c)
+			}
+		}
+	}
+
+	return decls
+}
+
+// Splits a parameter list on top-level commas.
+func splitParams(s string) []string {
+	params := []string{}
+	depth := 0
+	start := 0
+
+	for i, c := range s {
+		switch c {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	params = append(params, strings.TrimSpace(s[start:]))
+
+	return params
+}
+
+// Determines a parameter's name, inserting a synthesized one if the
+// declaration lacks a name.
+func parseParam(decl string, idx int) Param {
+	dflt := fmt.Sprintf("arg%d", idx)
+
+	// Function pointer: "void (*cb)(int)".
+	if m := reFptrName.FindStringSubmatchIndex(decl); m != nil {
+		if m[3] > m[2] {
+			return Param{Decl: decl, Name: decl[m[2]:m[3]]}
+		}
+		return Param{
+			Decl: decl[:m[2]] + dflt + decl[m[3]:],
+			Name: dflt,
+		}
+	}
+
+	// Array: "uint8_t buf[16]".
+	if m := reArrayName.FindStringSubmatch(decl); m != nil {
+		fields := strings.Fields(decl[:strings.Index(decl, "[")])
+		if len(fields) > 1 && !typeWords[m[1]] {
+			return Param{Decl: decl, Name: m[1]}
+		}
+		i := strings.Index(decl, "[")
+		return Param{
+			Decl: joinDecl(strings.TrimSpace(decl[:i]), dflt) + decl[i:],
+			Name: dflt,
+		}
+	}
+
+	fields := strings.Fields(strings.Replace(decl, "*", " * ", -1))
+	last := fields[len(fields)-1]
+	named := len(fields) > 1 && reIdent.MatchString(last) && !typeWords[last]
+	if named && len(fields) == 2 {
+		switch fields[0] {
+		case "struct", "union", "enum":
+			named = false
+		}
+	}
+
+	if named {
+		return Param{Decl: decl, Name: last}
+	}
+	return Param{Decl: joinDecl(decl, dflt), Name: dflt}
+}
+
+// Parses a single top-level declaration.  It returns nil if the declaration
+// is not a function prototype that can be stubbed.
+func parseDecl(decl string) *Func {
+	decl = strings.TrimSpace(reSpace.ReplaceAllString(decl, " "))
+	if decl == "" || strings.HasPrefix(decl, "typedef ") {
+		return nil
+	}
+
+	m := reProto.FindStringSubmatch(decl)
+	if m == nil {
+		return nil
+	}
+
+	ret := strings.TrimSpace(m[1])
+	ret = strings.TrimSpace(strings.TrimPrefix(ret, "extern "))
+	if ret == "" || strings.HasPrefix(ret, "static ") {
+		return nil
+	}
+
+	f := &Func{
+		Ret:  ret,
+		Name: m[2],
+	}
+
+	args := strings.TrimSpace(m[3])
+	if args == "" || args == "void" {
+		return f
+	}
+
+	for i, a := range splitParams(args) {
+		if a == "..." || a == "" {
+			// Variadic functions can't be forwarded portably.
+			return nil
+		}
+		f.Params = append(f.Params, parseParam(a, i))
+	}
+
+	return f
+}
+
+// ParseHeaderText extracts the function prototypes from the contents of a C
+// header.
+//
+// @param text                  The header contents.
+//
+// @return []Func               The prototypes, in order of appearance.
+func ParseHeaderText(text string) []Func {
+	funcs := []Func{}
+	for _, d := range splitDecls(stripHeader(text)) {
+		if f := parseDecl(d); f != nil {
+			funcs = append(funcs, *f)
+		}
+	}
+
+	return funcs
+}
+
+// ParseHeader extracts the function prototypes from a C header file.
+//
+// @param path                  The path of the header to parse.
+// @param name                  The name the header is included by (e.g.,
+//                                  "hal/hal_gpio.h").
+//
+// @return []Func               The prototypes, in order of appearance.
+// @return error                Error on failure.
+func ParseHeader(path string, name string) ([]Func, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	funcs := ParseHeaderText(string(b))
+	for i, _ := range funcs {
+		funcs[i].Header = name
+	}
+
+	return funcs, nil
+}
+
+// Decl returns the prototype's declaration, without a trailing semicolon,
+// using the specified function name.
+func (f *Func) Decl(name string) string {
+	return fmt.Sprintf("%s\n%s(%s)", f.Ret, name, f.ParamList())
+}
+
+// ParamList returns the parameter list as it appears in a declaration.
+func (f *Func) ParamList() string {
+	if len(f.Params) == 0 {
+		return "void"
+	}
+
+	decls := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		decls[i] = p.Decl
+	}
+	return strings.Join(decls, ", ")
+}
+
+// ArgList returns the parameter names, as they appear in a call.
+func (f *Func) ArgList() string {
+	names := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// ReturnsVoid indicates whether the function has no return value.
+func (f *Func) ReturnsVoid() bool {
+	return f.Ret == "void"
+}
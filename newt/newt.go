@@ -153,14 +153,17 @@ func main() {
 
 	cli.AddBuildCommands(cmd)
 	cli.AddCompleteCommands(cmd)
+	cli.AddIdeCommands(cmd)
 	cli.AddImageCommands(cmd)
 	cli.AddPackageCommands(cmd)
 	cli.AddProjectCommands(cmd)
+	cli.AddRebuildCommands(cmd)
 	cli.AddRunCommands(cmd)
 	cli.AddTargetCommands(cmd)
 	cli.AddValsCommands(cmd)
 	cli.AddMfgCommands(cmd)
 	cli.AddDocsCommands(cmd)
+	cli.AddFuzzCommands(cmd)
 
 	/* only pass the first two args to check for complete command */
 	if len(os.Args) > 2 {
@@ -0,0 +1,97 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package newtutil
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Image encryption keys.  An encrypted image's payload is encrypted with a
+// random AES-CTR key, and that key is wrapped for the device with one of the
+// following:
+//
+//     * An RSA public key (PEM); the image key is wrapped with RSA-OAEP.
+//     * A base64-encoded 128-bit AES key; the image key is wrapped with AES
+//       key-wrap.
+//
+// The image library performs the encryption; the key file is checked here so
+// that an unusable key is reported before the target is built.
+
+// CheckEncKey verifies that a file contains a supported image encryption key.
+//
+// @param filename              The path of the key file.
+//
+// @return error                Error if the file cannot be read or does not
+//                                  contain a supported key.
+func CheckEncKey(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return util.FmtNewtError("Error reading encryption key file: %s",
+			err.Error())
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type == "PRIVATE KEY" || strings.HasSuffix(
+			block.Type, " PRIVATE KEY") {
+
+			return util.FmtNewtError(
+				"%s: image encryption requires the device's public key, "+
+					"not a private key", filename)
+		}
+
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		}
+		if err != nil {
+			return util.FmtNewtError(
+				"%s: unrecognized public key: %s", filename, err.Error())
+		}
+		if _, ok := pub.(*rsa.PublicKey); !ok {
+			return util.FmtNewtError(
+				"%s: unsupported encryption key type: %T; must be RSA",
+				filename, pub)
+		}
+
+		return nil
+	}
+
+	kek, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(data)))
+	if err != nil {
+		return util.FmtNewtError(
+			"%s: encryption key must be a PEM RSA public key or a "+
+				"base64-encoded AES key", filename)
+	}
+	if len(kek) != 16 {
+		return util.FmtNewtError(
+			"%s: AES key-encryption key must be 128 bits; have %d bits",
+			filename, len(kek)*8)
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package newtutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"os/exec"
+	"strings"
+
+	"github.com/apache/mynewt-artifact/sec"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ed25519"
+	"mynewt.apache.org/newt/util"
+)
+
+// External signing keys.  An external key is held by an HSM or a key
+// management service and never leaves it; newt signs with it by running the
+// project's signing command (`project.sign_cmd` or `--sign-cmd`).  A signing
+// key argument refers to an external key if it is a PKCS#11 URI
+// ("pkcs11:...") or a KMS key reference ("kms:...").  The reference is passed
+// verbatim to the signing command, which is invoked as follows:
+//
+//     <sign-cmd> pubkey <key-ref>
+//         Writes the key's public key to stdout in PEM format.
+//
+//     <sign-cmd> sign <key-ref> <digest>
+//         Signs the hex-encoded SHA256 image hash and writes the base64-encoded
+//         signature to stdout.  RSA keys must produce an RSASSA-PSS signature
+//         (SHA256, 32-byte salt), EC keys an ASN.1 DER ECDSA signature, and
+//         Ed25519 keys a signature of the 32-byte hash.
+
+var extKeyPrefixes = []string{"pkcs11:", "kms:"}
+
+// ExternalKey is a signing key that is held outside of newt.
+type ExternalKey struct {
+	// The PKCS#11 URI or KMS reference of the key.
+	Ref string
+
+	// The command that signs with the key.
+	Cmd []string
+
+	// One of: *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey.
+	Pub interface{}
+}
+
+// IsExternalKeyRef indicates whether a signing key argument refers to an
+// external key rather than a key file.
+func IsExternalKeyRef(s string) bool {
+	for _, prefix := range extKeyPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runSignCmd executes the signing command with the specified arguments and
+// returns its standard output.  Standard error is only used for reporting
+// failures.
+func (key *ExternalKey) runSignCmd(args ...string) ([]byte, error) {
+	cmdStrs := append(append([]string{}, key.Cmd...), args...)
+	util.LogShellCmd(cmdStrs, nil)
+
+	out, err := exec.Command(cmdStrs[0], cmdStrs[1:]...).Output()
+	if err != nil {
+		text := err.Error()
+		if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+			text = strings.TrimSpace(string(ee.Stderr))
+		}
+		return nil, util.FmtNewtError(
+			"signing command failed for key \"%s\": %s", key.Ref, text)
+	}
+	log.Debugf("o=%s", string(out))
+
+	return out, nil
+}
+
+// ParsePubSignKey parses the PEM-encoded public key of a signing key.
+//
+// @param data                  The PEM-encoded public key.
+//
+// @return interface{}          One of: *rsa.PublicKey, *ecdsa.PublicKey,
+//                                  ed25519.PublicKey.
+// @return error                Error if the data does not contain a
+//                                  supported public key.
+func ParsePubSignKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, util.NewNewtError("not a PEM public key")
+	}
+
+	if pk, err := sec.ParsePubSignKey(data); err == nil && pk.Ed25519 != nil {
+		return pk.Ed25519, nil
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"unrecognized public key: %s", err.Error())
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return k, nil
+
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, util.FmtNewtError(
+				"unsupported EC curve %s; image signing keys must use P-256",
+				k.Curve.Params().Name)
+		}
+		return k, nil
+
+	default:
+		return nil, util.FmtNewtError("unsupported public key type: %T", pub)
+	}
+}
+
+// LoadExternalKey retrieves the public key of an external signing key.
+//
+// @param signCmd               The signing command, including any fixed
+//                                  arguments.
+// @param ref                   The PKCS#11 URI or KMS reference of the key.
+//
+// @return *ExternalKey         The external key.
+// @return error                Error if there is no signing command or it
+//                                  does not produce a supported public key.
+func LoadExternalKey(signCmd string, ref string) (*ExternalKey, error) {
+	cmd := strings.Fields(signCmd)
+	if len(cmd) == 0 {
+		return nil, util.FmtNewtError(
+			"key \"%s\" requires a signing command; specify --sign-cmd or "+
+				"set `project.sign_cmd`", ref)
+	}
+
+	key := &ExternalKey{
+		Ref: ref,
+		Cmd: cmd,
+	}
+
+	out, err := key.runSignCmd("pubkey", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Pub, err = ParsePubSignKey(out)
+	if err != nil {
+		return nil, util.FmtNewtError("key \"%s\": %s", ref,
+			err.(*util.NewtError).Text)
+	}
+
+	return key, nil
+}
+
+// PubBytes produces the public key in the form that the bootloader embeds.
+func (key *ExternalKey) PubBytes() ([]byte, error) {
+	return PubKeyBytes(key.Pub)
+}
+
+// PubKeyBytes produces a public key in the form that the bootloader embeds: a
+// PKCS#1 RSAPublicKey for RSA keys, or a SubjectPublicKeyInfo otherwise.
+func PubKeyBytes(pub interface{}) ([]byte, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return x509.MarshalPKCS1PublicKey(pub), nil
+
+	case ed25519.PublicKey:
+		pk := sec.PubSignKey{Ed25519: pub}
+		b, err := pk.Bytes()
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+		return b, nil
+
+	default:
+		b, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+		return b, nil
+	}
+}
+
+// VerifySig checks an image signature against a public key (see
+// ParsePubSignKey).  RSA signatures must use RSASSA-PSS.
+func VerifySig(pub interface{}, hash []byte, sig []byte) bool {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPSS(pub, crypto.SHA256, hash, sig,
+			&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+
+	case *ecdsa.PublicKey:
+		var esig struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(sig, &esig); err != nil {
+			return false
+		}
+		return ecdsa.Verify(pub, hash, esig.R, esig.S)
+
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, hash, sig)
+
+	default:
+		return false
+	}
+}
+
+// Sign signs an image hash with the external key.
+//
+// @param hash                  The SHA256 hash of the image.
+//
+// @return []byte               The signature.
+// @return error                Error if the signing command fails or
+//                                  produces an invalid signature.
+func (key *ExternalKey) Sign(hash []byte) ([]byte, error) {
+	out, err := key.runSignCmd("sign", key.Ref, hex.EncodeToString(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"signing command produced invalid base64 for key \"%s\": %s",
+			key.Ref, err.Error())
+	}
+
+	// Catch a misconfigured command before it produces an image that the
+	// bootloader rejects.
+	if !VerifySig(key.Pub, hash, sig) {
+		return nil, util.FmtNewtError(
+			"signing command produced an invalid signature for key \"%s\"",
+			key.Ref)
+	}
+
+	return sig, nil
+}
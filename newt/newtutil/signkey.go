@@ -0,0 +1,216 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package newtutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/apache/mynewt-artifact/sec"
+	"mynewt.apache.org/newt/util"
+)
+
+// Image signing keys.  A key file can be in PEM or DER format and can contain
+// any of the following (PEM keys may also be encrypted PKCS#8):
+//
+//     * An RSA key (PKCS#1 or PKCS#8).
+//     * An EC key on the P-256 curve (SEC 1 or PKCS#8).  Images signed with an
+//       EC key carry an ECDSA-SHA256 signature.
+//     * An Ed25519 key (PKCS#8).
+//
+// A signing key can also be an external key held by an HSM or KMS (see
+// ExternalKey).
+
+// SignKey is an image signing key.  The image library signs with RSA, EC, and
+// Ed25519 keys; newt produces external key signatures itself.
+type SignKey struct {
+	// Only one of these members is set.
+	Sec      *sec.PrivSignKey
+	External *ExternalKey
+}
+
+// PubBytes produces the public key in the form that the bootloader embeds.
+// For Ed25519 keys, this is the DER-encoded SubjectPublicKeyInfo.
+func (key SignKey) PubBytes() ([]byte, error) {
+	if key.External != nil {
+		return key.External.PubBytes()
+	}
+
+	return key.Sec.PubBytes()
+}
+
+// KeyHash produces the SHA256 hash of the public key that the bootloader
+// embeds; this is the value of the KEYHASH TLV that identifies the key in a
+// signed image.
+func (key SignKey) KeyHash() ([]byte, error) {
+	pubBytes, err := key.PubBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.Sum256(pubBytes)
+	return h[:], nil
+}
+
+// SecSignKeys extracts the keys that the image library signs with.
+func SecSignKeys(keys []SignKey) []sec.PrivSignKey {
+	var secKeys []sec.PrivSignKey
+	for _, key := range keys {
+		if key.Sec != nil {
+			secKeys = append(secKeys, *key.Sec)
+		}
+	}
+
+	return secKeys
+}
+
+// NewtSignKeys extracts the external keys, which the image library does not
+// support; newt produces their signatures itself.
+func NewtSignKeys(keys []SignKey) []SignKey {
+	var newtKeys []SignKey
+	for _, key := range keys {
+		if key.Sec == nil {
+			newtKeys = append(newtKeys, key)
+		}
+	}
+
+	return newtKeys
+}
+
+// ecSignKey verifies that an EC key uses a curve that the bootloader supports.
+func ecSignKey(key *ecdsa.PrivateKey) (SignKey, error) {
+	if key.Curve != elliptic.P256() {
+		return SignKey{}, util.FmtNewtError(
+			"unsupported EC curve %s; image signing keys must use P-256",
+			key.Curve.Params().Name)
+	}
+
+	return SignKey{Sec: &sec.PrivSignKey{Ec: key}}, nil
+}
+
+// parseDerSignKey parses a DER-encoded private key.
+func parseDerSignKey(der []byte) (SignKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return SignKey{Sec: &sec.PrivSignKey{Rsa: key}}, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return ecSignKey(key)
+	}
+
+	if key, err := sec.ParseEd25519Pkcs8(der); err == nil {
+		return SignKey{Sec: &sec.PrivSignKey{Ed25519: key}}, nil
+	}
+
+	itf, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return SignKey{}, util.FmtNewtError(
+			"unrecognized private key: %s", err.Error())
+	}
+
+	switch key := itf.(type) {
+	case *rsa.PrivateKey:
+		return SignKey{Sec: &sec.PrivSignKey{Rsa: key}}, nil
+
+	case *ecdsa.PrivateKey:
+		return ecSignKey(key)
+
+	default:
+		return SignKey{}, util.FmtNewtError(
+			"unsupported private key type: %T", itf)
+	}
+}
+
+// ParseSignKey parses an image signing key in PEM or DER format.  PEM keys
+// are parsed by the image library, which also accepts the EC PARAMETERS block
+// that `openssl ecparam -genkey` writes and encrypted PKCS#8 keys.
+//
+// @param data                  The contents of the key file.
+//
+// @return SignKey              The parsed key.
+// @return error                Error if the data does not contain a
+//                                  supported private key.
+func ParseSignKey(data []byte) (SignKey, error) {
+	if block, _ := pem.Decode(data); block == nil {
+		return parseDerSignKey(data)
+	}
+
+	key, err := sec.ParsePrivSignKey(data)
+	if err != nil {
+		return SignKey{}, util.FmtNewtError(
+			"unrecognized private key: %s", err.Error())
+	}
+	if key.Ec != nil {
+		return ecSignKey(key.Ec)
+	}
+
+	return SignKey{Sec: &key}, nil
+}
+
+// ReadSignKeys reads image signing keys from the specified files (see
+// ParseSignKey).  Arguments that refer to external keys are loaded with the
+// specified signing command instead (see LoadExternalKey).
+func ReadSignKeys(filenames []string, signCmd string) ([]SignKey, error) {
+	keys := make([]SignKey, len(filenames))
+	for i, filename := range filenames {
+		if IsExternalKeyRef(filename) {
+			ext, err := LoadExternalKey(signCmd, filename)
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = SignKey{External: ext}
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, util.FmtNewtError("Error reading key file: %s",
+				err.Error())
+		}
+
+		keys[i], err = ParseSignKey(data)
+		if err != nil {
+			return nil, util.FmtNewtError("%s: %s", filename,
+				err.(*util.NewtError).Text)
+		}
+	}
+
+	// Each signature is identified by its key hash; signing twice with the
+	// same key would produce a redundant signature.
+	seen := map[string]string{}
+	for i, key := range keys {
+		h, err := key.KeyHash()
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := seen[string(h)]; ok {
+			return nil, util.FmtNewtError(
+				"signing keys %s and %s are the same key", prev, filenames[i])
+		}
+		seen[string(h)] = filenames[i]
+	}
+
+	return keys, nil
+}
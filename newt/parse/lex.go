@@ -91,7 +91,7 @@ func lexLitString(s string) (string, int, error) {
 
 	quote2 := strings.IndexByte(s[1:], '"')
 	if quote2 == -1 {
-		return "", 0, fmt.Errorf("unterminated quote: %s", s)
+		return "", 0, fmt.Errorf("unterminated quote")
 	}
 
 	return s[1 : quote2+1], quote2 + 2, nil
@@ -136,7 +136,7 @@ func lexOneToken(expr string, offset int) (Token, int, error) {
 	for _, e := range lexEntries {
 		text, sz, err := e.fn(subexpr)
 		if err != nil {
-			return t, 0, err
+			return t, 0, fmt.Errorf("%s at column %d", err.Error(), offset+1)
 		}
 
 		if sz != 0 {
@@ -169,7 +169,8 @@ func Lex(expr string) ([]Token, error) {
 		}
 
 		if skip == 0 {
-			return nil, fmt.Errorf("Invalid token starting with: %s", expr)
+			return nil, fmt.Errorf("invalid token at column %d: %s",
+				off+1, expr[off:])
 		}
 
 		tokens = append(tokens, t)
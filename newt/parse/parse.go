@@ -32,6 +32,12 @@ import (
 // literal  ::= """ <printable-char> { <printable-char> } """
 // unary    ::= "!"
 // binary   ::= "&&" | "^^" | "||" | "==" | "!=" | "<" | "<=" | ">" | ">="
+//
+// Binary operators bind as they do in C, loosest first: "||", "^^", "&&",
+// then the comparison operators.  "!" binds tighter than any binary operator.
+// For example, `A || B && !C` means `A || (B && (!C))`.  Older versions of
+// newt bound "&&" loosest and "||" tightest, so LexAndParse warns about
+// expressions that mix logical operators without parentheses.
 
 type ParseCode int
 
@@ -135,7 +141,8 @@ func findAnyToken(tokens []Token, any []TokenCode) (int, error) {
 			} else if t.Code == TOKEN_RPAREN {
 				pcount--
 				if pcount < 0 {
-					return -1, fmt.Errorf("imbalanced parenthesis")
+					return -1, fmt.Errorf("unmatched \")\" at column %d",
+						t.Offset+1)
 				}
 			} else if pcount == 0 && t.Code == a {
 				return i, nil
@@ -160,7 +167,8 @@ func binTokenToParse(t TokenCode) ParseCode {
 	}[t]
 }
 
-// Removes the outer layer of parentheses from a tokenized expression.
+// Removes the outer layer of parentheses from a tokenized expression.  The
+// parentheses must enclose the entire expression.
 func stripParens(tokens []Token) ([]Token, error) {
 	if tokens[0].Code != TOKEN_LPAREN {
 		panic("internal error: stripParens() received unparenthesized string")
@@ -175,6 +183,15 @@ func stripParens(tokens []Token) ([]Token, error) {
 		case TOKEN_RPAREN:
 			pcount--
 			if pcount == 0 {
+				if i == 1 {
+					return nil, fmt.Errorf("empty parentheses at column %d",
+						tokens[0].Offset+1)
+				}
+				if i != len(tokens)-1 {
+					return nil, fmt.Errorf(
+						"missing operator before \"%s\" at column %d",
+						tokens[i+1].Text, tokens[i+1].Offset+1)
+				}
 				return tokens[1:i], nil
 			}
 
@@ -182,14 +199,15 @@ func stripParens(tokens []Token) ([]Token, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("unterminated parenthesis")
+	return nil, fmt.Errorf("unterminated \"(\" at column %d",
+		tokens[0].Offset+1)
 }
 
 var binaryTokens = []TokenCode{
 	// Lowest precedence.
-	TOKEN_AND,
-	TOKEN_XOR,
 	TOKEN_OR,
+	TOKEN_XOR,
+	TOKEN_AND,
 	TOKEN_EQUALS,
 	TOKEN_NOT_EQUALS,
 	TOKEN_LT,
@@ -199,6 +217,41 @@ var binaryTokens = []TokenCode{
 	// Highest precedence.
 }
 
+// mixedLogicTokens finds two different logical operators ("&&", "^^", "||")
+// that an expression combines within the same set of parentheses.  Older
+// versions of newt bound "&&" loosest and "||" tightest, so such expressions
+// mean something different now.
+//
+// @return Token                The first of the operators.
+// @return Token                The second operator.
+// @return bool                 Whether the expression mixes operators.
+func mixedLogicTokens(tokens []Token) (Token, Token, bool) {
+	// The first logical operator at each level of parentheses.
+	firsts := []*Token{nil}
+
+	for i, t := range tokens {
+		switch t.Code {
+		case TOKEN_LPAREN:
+			firsts = append(firsts, nil)
+
+		case TOKEN_RPAREN:
+			if len(firsts) > 1 {
+				firsts = firsts[:len(firsts)-1]
+			}
+
+		case TOKEN_AND, TOKEN_XOR, TOKEN_OR:
+			first := firsts[len(firsts)-1]
+			if first == nil {
+				firsts[len(firsts)-1] = &tokens[i]
+			} else if first.Code != t.Code {
+				return *first, t, true
+			}
+		}
+	}
+
+	return Token{}, Token{}, false
+}
+
 func FindBinaryToken(tokens []Token) int {
 	binIdx, err := findAnyToken(tokens, binaryTokens)
 	if err != nil {
@@ -241,8 +294,13 @@ func Parse(tokens []Token) (*Node, error) {
 				Data: tokens[0].Text,
 			}, nil
 
+		case TOKEN_NOT:
+			return nil, fmt.Errorf("operator \"!\" at column %d is "+
+				"missing its operand", tokens[0].Offset+1)
+
 		default:
-			return nil, fmt.Errorf("invalid expression: %s", tokens[0].Text)
+			return nil, fmt.Errorf("unexpected \"%s\" at column %d",
+				tokens[0].Text, tokens[0].Offset+1)
 		}
 	}
 
@@ -253,9 +311,13 @@ func Parse(tokens []Token) (*Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	if binIdx == 0 || binIdx == len(tokens)-1 {
-		return nil, fmt.Errorf("binary operator %s at start or end",
-			tokens[binIdx].Text)
+	if binIdx == 0 {
+		return nil, fmt.Errorf("operator \"%s\" at column %d is missing "+
+			"its left operand", tokens[binIdx].Text, tokens[binIdx].Offset+1)
+	}
+	if binIdx == len(tokens)-1 {
+		return nil, fmt.Errorf("operator \"%s\" at column %d is missing "+
+			"its right operand", tokens[binIdx].Text, tokens[binIdx].Offset+1)
 	}
 	if binIdx != -1 {
 		n := &Node{
@@ -303,7 +365,8 @@ func Parse(tokens []Token) (*Node, error) {
 		return Parse(stripped)
 	}
 
-	return nil, fmt.Errorf("invalid expression")
+	return nil, fmt.Errorf("missing operator before \"%s\" at column %d",
+		tokens[1].Text, tokens[1].Offset+1)
 }
 
 // Evaluates two expressions into boolean values.
@@ -598,7 +661,8 @@ func Eval(expr *Node, settings map[string]string) (bool, error) {
 func LexAndParse(expr string) (*Node, error) {
 	tokens, err := Lex(expr)
 	if err != nil {
-		return nil, err
+		return nil, util.FmtNewtError("error parsing [%s]: %s",
+			expr, err.Error())
 	}
 
 	n, err := Parse(tokens)
@@ -607,6 +671,14 @@ func LexAndParse(expr string) (*Node, error) {
 			expr, err.Error())
 	}
 
+	if t1, t2, ok := mixedLogicTokens(tokens); ok {
+		util.OneTimeWarning("expression [%s] combines \"%s\" and \"%s\" "+
+			"without parentheses; \"&&\" now binds tighter than \"^^\", "+
+			"which binds tighter than \"||\", so its meaning may have "+
+			"changed from earlier versions of newt; add parentheses",
+			expr, t1.Text, t2.Text)
+	}
+
 	return n, nil
 }
 
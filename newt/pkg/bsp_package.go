@@ -41,6 +41,16 @@ type BspPackage struct {
 	Part2LinkerScripts []string /* scripts to link app to second partition */
 	DownloadScript     string
 	DebugScript        string
+	Debugger           string
+	PyocdTarget        string
+	JlinkDevice        string
+	JlinkInterface     string
+	JlinkSpeed         string
+	OpenocdCfg         []string
+	SvdFile            string
+	ConsoleUsbIds      []string
+	SwoCpuFreq         int
+	SwoFreq            int
 	FlashMap           flashmap.FlashMap
 	BspV               ycfg.YCfg
 }
@@ -148,6 +158,24 @@ func (bsp *BspPackage) Reload(settings map[string]string) error {
 		return err
 	}
 
+	bsp.SvdFile, err = bsp.resolvePathSetting(settings, "bsp.svd")
+	if err != nil {
+		return err
+	}
+
+	bsp.ConsoleUsbIds = bsp.BspV.GetValStringSlice("bsp.console_usb_ids",
+		settings)
+
+	bsp.Debugger = bsp.BspV.GetValString("bsp.debugger", settings)
+	bsp.PyocdTarget = bsp.BspV.GetValString("bsp.pyocd_target", settings)
+	bsp.JlinkDevice = bsp.BspV.GetValString("bsp.jlink_device", settings)
+	bsp.JlinkInterface = bsp.BspV.GetValString("bsp.jlink_interface",
+		settings)
+	bsp.JlinkSpeed = bsp.BspV.GetValString("bsp.jlink_speed", settings)
+	bsp.OpenocdCfg = bsp.BspV.GetValStringSlice("bsp.openocd_cfg", settings)
+	bsp.SwoCpuFreq = bsp.BspV.GetValInt("bsp.swo_cpu_freq", settings)
+	bsp.SwoFreq = bsp.BspV.GetValInt("bsp.swo_freq", settings)
+
 	if bsp.CompilerName == "" {
 		return util.NewNewtError("BSP does not specify a compiler " +
 			"(bsp.compiler)")
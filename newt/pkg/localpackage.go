@@ -28,6 +28,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/spf13/cast"
+
 	"mynewt.apache.org/newt/newt/config"
 	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/newtutil"
@@ -117,6 +119,14 @@ func (pkg *LocalPackage) RelativePath() string {
 	return strings.TrimPrefix(pkg.BasePath(), proj.Path())
 }
 
+// RelativeFilePath returns the project-relative path of a file in the
+// package's directory (e.g., "apps/blinky/syscfg.yml").  Unlike an absolute
+// path, it is the same on every machine, so it can be written to generated
+// files.
+func (pkg *LocalPackage) RelativeFilePath(filename string) string {
+	return strings.TrimPrefix(pkg.RelativePath()+"/"+filename, "/")
+}
+
 func (pkg *LocalPackage) PkgYamlPath() string {
 	return fmt.Sprintf("%s/%s", pkg.BasePath(), PACKAGE_FILE_NAME)
 }
@@ -273,6 +283,7 @@ func (pkg *LocalPackage) Save() error {
 	file.WriteString(pkg.sequenceString("pkg.cflags"))
 	file.WriteString(pkg.sequenceString("pkg.cxxflags"))
 	file.WriteString(pkg.sequenceString("pkg.lflags"))
+	file.WriteString(pkg.sequenceString("pkg.deps"))
 
 	return nil
 }
@@ -363,10 +374,25 @@ func (pkg *LocalPackage) Load() error {
 	return nil
 }
 
+// InitFuncs retrieves the package's system initialization functions.  The
+// returned map has: key=C-function-name, value=stage-specifiers.  A function
+// may be specified with a single stage or with a list of specifiers (see
+// stage.NewStageFuncDeps).
 func (pkg *LocalPackage) InitFuncs(
-	settings map[string]string) map[string]string {
+	settings map[string]string) map[string][]string {
+
+	valMap := pkg.PkgY.GetValStringMap("pkg.init", settings)
+
+	fnMap := make(map[string][]string, len(valMap))
+	for name, v := range valMap {
+		if _, ok := v.([]interface{}); ok {
+			fnMap[name] = cast.ToStringSlice(v)
+		} else {
+			fnMap[name] = []string{cast.ToString(v)}
+		}
+	}
 
-	return pkg.PkgY.GetValStringMapString("pkg.init", settings)
+	return fnMap
 }
 
 // DownFuncs retrieves the package's shutdown functions.  The returned map has:
@@ -377,6 +403,19 @@ func (pkg *LocalPackage) DownFuncs(
 	return pkg.PkgY.GetValStringMapString("pkg.down", settings)
 }
 
+// TestConfigs retrieves the names of the additional configurations that a
+// unit test package is built and run with (the "pkg.test_configs" list).
+func (pkg *LocalPackage) TestConfigs() []string {
+	return pkg.PkgY.GetValStringSlice("pkg.test_configs", nil)
+}
+
+// TestTimeout retrieves the number of seconds that a unit test package's
+// tests may run (`pkg.test_timeout`); 0 if the package does not specify a
+// limit.
+func (pkg *LocalPackage) TestTimeout() int {
+	return pkg.PkgY.GetValInt("pkg.test_timeout", nil)
+}
+
 func (pkg *LocalPackage) InjectedSettings() map[string]string {
 	return pkg.injectedSettings
 }
@@ -40,6 +40,7 @@ const (
 	PACKAGE_TYPE_TRANSIENT
 	PACKAGE_TYPE_BSP
 	PACKAGE_TYPE_UNITTEST
+	PACKAGE_TYPE_FUZZ
 	PACKAGE_TYPE_APP
 	PACKAGE_TYPE_TARGET
 )
@@ -53,10 +54,17 @@ var PackageTypeNames = map[interfaces.PackageType]string{
 	PACKAGE_TYPE_TRANSIENT: "transient",
 	PACKAGE_TYPE_BSP:       "bsp",
 	PACKAGE_TYPE_UNITTEST:  "unittest",
+	PACKAGE_TYPE_FUZZ:      "fuzz",
 	PACKAGE_TYPE_APP:       "app",
 	PACKAGE_TYPE_TARGET:    "target",
 }
 
+// IsTestType indicates whether a package type is built into a test executable
+// rather than an image: unit test packages and fuzz target packages.
+func IsTestType(typ interfaces.PackageType) bool {
+	return typ == PACKAGE_TYPE_UNITTEST || typ == PACKAGE_TYPE_FUZZ
+}
+
 // An interface, representing information about a Package
 // This interface is implemented by both packages in the
 // local directory, but also packages that are stored in
@@ -0,0 +1,80 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"io/ioutil"
+
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+// The target that commands operate on when none is specified.
+const DEFAULT_TARGET_KEY = "project.default_target"
+
+// DefaultTarget retrieves the name of the project's default target, or "" if
+// the project does not have one.
+func (proj *Project) DefaultTarget() string {
+	return proj.yc.GetValString(DEFAULT_TARGET_KEY, nil)
+}
+
+// SetDefaultTarget records the project's default target in the
+// machine-specific `project.local.yml` file.  The file is created if it does
+// not exist; its other settings are preserved.
+//
+// @param name                  The name of the default target, or "" to
+//                                  remove the machine-specific default.  A
+//                                  default specified in `project.yml` is
+//                                  unaffected.
+//
+// @return error                Error if the file cannot be read or written.
+func (proj *Project) SetDefaultTarget(name string) error {
+	path := proj.BasePath + "/" + PROJECT_LOCAL_FILE_NAME
+
+	settings := map[string]interface{}{}
+	if util.NodeExist(path) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		if err := yaml.Unmarshal(data, &settings); err != nil {
+			return util.FmtNewtError("Failure parsing \"%s\": %s",
+				path, err.Error())
+		}
+		if settings == nil {
+			settings = map[string]interface{}{}
+		}
+	}
+
+	if name == "" {
+		delete(settings, DEFAULT_TARGET_KEY)
+	} else {
+		settings[DEFAULT_TARGET_KEY] = name
+	}
+	proj.yc.Replace(DEFAULT_TARGET_KEY, name)
+
+	s := yaml.MapToYaml(settings)
+	if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
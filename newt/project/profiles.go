@@ -0,0 +1,125 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/config"
+	"mynewt.apache.org/newt/util"
+)
+
+// Custom build profiles.  In addition to the build profiles that a compiler
+// package supports (e.g., "debug" and "optimized"), a project can define its
+// own profiles in a `profiles.yml` file at the top of the project:
+//
+//     profile.size:
+//         base: optimized
+//         cflags: [-Os, -flto]
+//         defines: [LOG_LEVEL_MIN]
+//         lflags: [-flto]
+//
+// A custom profile starts with the compiler's settings for its base profile
+// (default: "default") and adds the specified flags.  A flag replaces any
+// conflicting flag of the base profile, so a profile's `-Os` replaces the base
+// profile's optimization level and `-std=c11` replaces its `-std=` setting.
+// Targets select a custom profile the same way as a compiler profile, via
+// `target.build_profile`.
+
+const PROFILES_FILE_NAME = "profiles.yml"
+
+const DEFAULT_PROFILE_BASE = "default"
+
+type BuildProfile struct {
+	Name string
+
+	// The compiler build profile that this profile extends.
+	Base string
+
+	Cflags   []string
+	CXXflags []string
+	Lflags   []string
+	Aflags   []string
+}
+
+// loadProfiles reads the project's `profiles.yml` file, if it exists.
+func (proj *Project) loadProfiles() error {
+	proj.profiles = map[string]*BuildProfile{}
+
+	path := proj.BasePath + "/" + PROFILES_FILE_NAME
+	if util.NodeNotExist(path) {
+		return nil
+	}
+
+	yc, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for k, _ := range yc.AllSettings() {
+		name := strings.TrimPrefix(k, "profile.")
+		if name == k || strings.Contains(name, ".") {
+			continue
+		}
+
+		bp := &BuildProfile{
+			Name:     name,
+			Base:     yc.GetValString(k+".base", nil),
+			Cflags:   yc.GetValStringSlice(k+".cflags", nil),
+			CXXflags: yc.GetValStringSlice(k+".cxxflags", nil),
+			Lflags:   yc.GetValStringSlice(k+".lflags", nil),
+			Aflags:   yc.GetValStringSlice(k+".aflags", nil),
+		}
+		if bp.Base == "" {
+			bp.Base = DEFAULT_PROFILE_BASE
+		}
+		if bp.Base == name {
+			return util.FmtNewtError(
+				"%s: build profile \"%s\" cannot extend itself", path, name)
+		}
+
+		for _, d := range yc.GetValStringSlice(k+".defines", nil) {
+			bp.Cflags = append(bp.Cflags, "-D"+d)
+		}
+
+		proj.profiles[name] = bp
+	}
+
+	return nil
+}
+
+// BuildProfile retrieves the custom build profile with the specified name.
+// It returns nil if the project doesn't define such a profile, i.e., if the
+// name refers to one of the compiler's own build profiles.
+func (proj *Project) BuildProfile(name string) *BuildProfile {
+	return proj.profiles[name]
+}
+
+// BuildProfileNames lists the names of the project's custom build profiles.
+func (proj *Project) BuildProfileNames() []string {
+	names := make([]string, 0, len(proj.profiles))
+	for name, _ := range proj.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
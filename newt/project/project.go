@@ -24,6 +24,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -45,6 +46,10 @@ var globalProject *Project = nil
 
 const PROJECT_FILE_NAME = "project.yml"
 
+// Optional, machine-specific file whose settings override those in
+// `project.yml`.  This file is not meant to be checked in.
+const PROJECT_LOCAL_FILE_NAME = "project.local.yml"
+
 var ignoreSearchDirs []string = []string{
 	"bin",
 	"repos",
@@ -57,6 +62,15 @@ type Project struct {
 	// Base path of the project
 	BasePath string
 
+	// Path of the directory containing the project's installed repos.  This
+	// is `<project>/repos` unless `project.yml` specifies a shared repos
+	// directory via `project.repos_dir`.
+	reposPath string
+
+	// Path of the directory that build output is written to.  This is
+	// `<project>/bin` unless `project.yml` specifies `project.bin_dir`.
+	binPath string
+
 	packages interfaces.PackageList
 
 	// Contains all the repos that form this project.  Each repo is in one of
@@ -82,6 +96,9 @@ type Project struct {
 	// duplicate warnings.
 	unknownRepoVers map[string]struct{}
 
+	// Custom build profiles, as read from `profiles.yml`.
+	profiles map[string]*BuildProfile
+
 	yc ycfg.YCfg
 }
 
@@ -164,6 +181,39 @@ func (proj *Project) Name() string {
 	return proj.name
 }
 
+func (proj *Project) ReposPath() string {
+	return proj.reposPath
+}
+
+func (proj *Project) BinPath() string {
+	return proj.binPath
+}
+
+// Indicates whether the project's repos directory is shared with other
+// projects (i.e., is not the default `<project>/repos`).
+func (proj *Project) ReposShared() bool {
+	return proj.reposPath != proj.BasePath+"/"+repo.REPOS_DIR
+}
+
+// Retrieves the list of hook commands with the specified name (e.g.,
+// "pre_build_cmds") from the `project.yml` file.
+func (proj *Project) HookCmds(name string) []string {
+	return proj.yc.GetValStringSliceNonempty("project."+name, nil)
+}
+
+// Retrieves the project's target aliases (`project.target_aliases`), a map of
+// short alias names to target names.
+func (proj *Project) TargetAliases() map[string]string {
+	return proj.yc.GetValStringMapString("project.target_aliases", nil)
+}
+
+// Retrieves the command that signs images with external (HSM or KMS) keys
+// (`project.sign_cmd`).  This is typically specified in the machine-specific
+// `project.local.yml` file.
+func (proj *Project) SignCmd() string {
+	return proj.yc.GetValString("project.sign_cmd", nil)
+}
+
 func (proj *Project) Repos() map[string]*repo.Repo {
 	return proj.repos
 }
@@ -256,7 +306,7 @@ func (proj *Project) SelectRepos(pred func(r *repo.Repo) bool) []*repo.Repo {
 
 // Installs or upgrades repos matching the specified predicate.
 func (proj *Project) UpgradeIf(
-	force bool, ask bool, predicate func(r *repo.Repo) bool) error {
+	opts install.UpgradeOpts, predicate func(r *repo.Repo) bool) error {
 
 	// Make sure we have an up to date copy of all `repository.yml` files.
 	if err := proj.downloadRepositoryYmlFiles(); err != nil {
@@ -274,7 +324,7 @@ func (proj *Project) UpgradeIf(
 		return err
 	}
 
-	return inst.Upgrade(specifiedRepoList, force, ask)
+	return inst.Upgrade(specifiedRepoList, opts)
 }
 
 func (proj *Project) InfoIf(predicate func(r *repo.Repo) bool,
@@ -300,6 +350,17 @@ func (proj *Project) InfoIf(predicate func(r *repo.Repo) bool,
 	return nil
 }
 
+// Prints the version control state of each repo matching the specified
+// predicate.
+func (proj *Project) StatusIf(predicate func(r *repo.Repo) bool) error {
+	repoList := proj.SelectRepos(predicate)
+
+	// Ignore errors.  Problems with individual repos are reported in the
+	// status output.
+	inst, _ := install.NewInstaller(proj.repos, proj.rootRepoReqs)
+	return inst.Status(repoList)
+}
+
 // Loads a complete repo definition from the appropriate `repository.yml` file.
 // The supplied fields form a basic repo description as read from `project.yml`
 // or from another repo's dependency list.
@@ -329,10 +390,20 @@ func (proj *Project) loadRepo(name string, fields map[string]string) (
 		return nil, err
 	}
 
-	for _, ignDir := range ignoreSearchDirs {
-		r.AddIgnoreDir(ignDir)
+	// Some repos publish their versions as git tags instead of in
+	// `repository.yml`.
+	if fields["tag_versions"] != "" {
+		tagVersions, err := strconv.ParseBool(fields["tag_versions"])
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Repo \"%s\" contains invalid tag_versions setting: %s",
+				name, fields["tag_versions"])
+		}
+		r.SetTagVersions(tagVersions)
 	}
 
+	proj.addIgnoreDirs(r)
+
 	// Read the full repo definition from its `repository.yml` file.
 	if err := r.Read(); err != nil {
 		return r, err
@@ -507,11 +578,62 @@ func (proj *Project) addRepo(r *repo.Repo) error {
 	return nil
 }
 
+// Adds the directories that never contain packages to the specified repo's
+// list of ignored directories.
+func (proj *Project) addIgnoreDirs(r *repo.Repo) {
+	for _, ignDir := range ignoreSearchDirs {
+		r.AddIgnoreDir(ignDir)
+	}
+
+	// Don't search a shared repos directory or a custom output directory that
+	// lives inside the project.
+	for _, dir := range []string{proj.reposPath, proj.binPath} {
+		rel, err := filepath.Rel(proj.BasePath, dir)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			r.AddIgnoreDir(filepath.ToSlash(rel))
+		}
+	}
+}
+
+// Adds each local path repo located within the project directory to the local
+// repo's list of ignored directories.
+func (proj *Project) ignorePathRepoDirs() error {
+	for _, r := range proj.repos {
+		pd, ok := r.Downloader().(*downloader.PathDownloader)
+		if !ok {
+			continue
+		}
+
+		path, err := pd.AbsPath()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(proj.BasePath, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		proj.localRepo.AddIgnoreDir(filepath.ToSlash(rel))
+	}
+
+	return nil
+}
+
 func (proj *Project) loadConfig() error {
 	yc, err := config.ReadFile(proj.BasePath + "/" + PROJECT_FILE_NAME)
 	if err != nil {
 		return util.NewNewtError(err.Error())
 	}
+
+	// Apply the user's machine-specific overrides, if any.
+	localPath := proj.BasePath + "/" + PROJECT_LOCAL_FILE_NAME
+	if util.NodeExist(localPath) {
+		if err := config.ApplyOverrideFile(&yc, localPath); err != nil {
+			return util.NewNewtError(err.Error())
+		}
+	}
+
 	// Store configuration object for access to future values,
 	// this avoids keeping every string around as a project variable when
 	// we need to process it later.
@@ -519,6 +641,36 @@ func (proj *Project) loadConfig() error {
 
 	proj.name = yc.GetValString("project.name", nil)
 
+	// Several projects can share a single repos directory.
+	if reposDir := yc.GetValString("project.repos_dir", nil); reposDir != "" {
+		if !filepath.IsAbs(reposDir) {
+			reposDir = proj.BasePath + "/" + reposDir
+		}
+		proj.reposPath = filepath.ToSlash(filepath.Clean(reposDir))
+		log.Debugf("Using shared repos directory %s", proj.reposPath)
+	}
+
+	if binDir := yc.GetValString("project.bin_dir", nil); binDir != "" {
+		if !filepath.IsAbs(binDir) {
+			binDir = proj.BasePath + "/" + binDir
+		}
+		proj.binPath = filepath.ToSlash(filepath.Clean(binDir))
+	}
+
+	if err := proj.loadProfiles(); err != nil {
+		return err
+	}
+
+	// Extra CA certificates to trust when downloading repos.
+	var caCerts []string
+	for _, cert := range yc.GetValStringSlice("project.ca_certs", nil) {
+		if !filepath.IsAbs(cert) {
+			cert = proj.BasePath + "/" + cert
+		}
+		caCerts = append(caCerts, cert)
+	}
+	downloader.AddCaCerts(caCerts)
+
 	// Local repository always included in initialization
 	r, err := repo.NewLocalRepo(proj.name)
 	if err != nil {
@@ -527,9 +679,7 @@ func (proj *Project) loadConfig() error {
 
 	proj.repos[proj.name] = r
 	proj.localRepo = r
-	for _, ignDir := range ignoreSearchDirs {
-		r.AddIgnoreDir(ignDir)
-	}
+	proj.addIgnoreDirs(r)
 
 	// Assume every item starting with "repository." is a repository descriptor
 	// and try to load it.
@@ -537,6 +687,14 @@ func (proj *Project) loadConfig() error {
 		repoName := strings.TrimPrefix(k, "repository.")
 		if repoName != k {
 			fields := yc.GetValStringMapString(k, nil)
+
+			// The sparse directories can be specified as a YAML list or as
+			// a whitespace-separated string.
+			dirs := yc.GetValStringSlice(k+".sparse_dirs", nil)
+			if dirs != nil {
+				fields["sparse_dirs"] = strings.Join(dirs, " ")
+			}
+
 			r, err := proj.loadRepo(repoName, fields)
 			if err != nil {
 				// if `repository.yml` does not exist, it is not an error; we
@@ -545,12 +703,28 @@ func (proj *Project) loadConfig() error {
 					return err
 				}
 			}
-			verReqs, err := newtutil.ParseRepoVersionReqs(fields["vers"])
+
+			// An explicit branch, tag, or commit overrides the version
+			// requirement.
+			pin, err := repo.ParsePin(fields)
+			if err != nil {
+				return util.FmtNewtError("Repo \"%s\": %s",
+					repoName, err.Error())
+			}
+
+			versStr := fields["vers"]
+			if pin != nil {
+				log.Debugf("Repo %s pinned to %s", repoName, pin.String())
+				r.SetPin(pin)
+				versStr = pin.Commit + "-" + newtutil.VERSION_STABILITY_COMMIT
+			}
+
+			verReqs, err := newtutil.ParseRepoVersionReqs(versStr)
 			if err != nil {
 				return util.FmtNewtError(
 					"Repo \"%s\" contains invalid version requirement: "+
 						"%s (%s)",
-					repoName, fields["vers"], err.Error())
+					repoName, versStr, err.Error())
 			}
 
 			if err := proj.addRepo(r); err != nil {
@@ -560,6 +734,12 @@ func (proj *Project) loadConfig() error {
 		}
 	}
 
+	// A local path repo may live inside the project (e.g., a vendored repo).
+	// Don't let the local repo claim its packages.
+	if err := proj.ignorePathRepoDirs(); err != nil {
+		return err
+	}
+
 	// Read `repository.yml` files belonging to dependee repos from disk.
 	// These repos might not be specified in the `project.yml` file, but they
 	// are still part of the project.
@@ -599,6 +779,8 @@ func (proj *Project) loadConfig() error {
 
 func (proj *Project) Init(dir string) error {
 	proj.BasePath = filepath.ToSlash(filepath.Clean(dir))
+	proj.reposPath = proj.BasePath + "/" + repo.REPOS_DIR
+	proj.binPath = proj.BasePath + "/bin"
 
 	// Only one project per system, when created, set it as the global project
 	interfaces.SetProject(proj)
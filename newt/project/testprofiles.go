@@ -0,0 +1,120 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"sort"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Test profiles.  A project can name sets of unit test packages in its
+// `project.yml` file, so that `newt test --profile <name>` replaces the
+// scripts that enumerate packages:
+//
+//     project.test_profiles:
+//         quick:
+//             include: [sys/log, net/ip]
+//             exclude: [net/ip/lwip_base]
+//         hardware-only:
+//             include: [hw/drivers]
+//             target: nordic_pca10056
+//
+// Each `include` entry is anything `newt test` accepts as an argument: a
+// package, "all", or an "@<tag>" target tag.  Each `exclude` entry is anything
+// `newt test -e` accepts.  `target` runs the tests on a hardware target, as
+// `newt test --target` does.
+
+type TestProfile struct {
+	Name    string
+	Include []string
+	Exclude []string
+	Target  string
+}
+
+func (proj *Project) testProfileMap() map[string]interface{} {
+	return proj.yc.GetValStringMap("project.test_profiles", nil)
+}
+
+// TestProfile retrieves the test profile with the specified name.
+func (proj *Project) TestProfile(name string) (*TestProfile, error) {
+	itf, ok := proj.testProfileMap()[name]
+	if !ok {
+		return nil, util.FmtNewtError(
+			"project.yml does not define test profile \"%s\"", name)
+	}
+
+	fields, err := cast.ToStringMapE(itf)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"invalid test profile \"%s\" in project.yml: %s",
+			name, err.Error())
+	}
+
+	tp := &TestProfile{
+		Name: name,
+	}
+	for k, v := range fields {
+		if k == "target" {
+			tp.Target = cast.ToString(v)
+			continue
+		}
+
+		strs, err := cast.ToStringSliceE(v)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"invalid test profile \"%s\" in project.yml: "+
+					"\"%s\" must be a list of strings", name, k)
+		}
+
+		switch k {
+		case "include":
+			tp.Include = strs
+		case "exclude":
+			tp.Exclude = strs
+		default:
+			return nil, util.FmtNewtError(
+				"invalid test profile \"%s\" in project.yml: "+
+					"unknown field \"%s\"", name, k)
+		}
+	}
+
+	if len(tp.Include) == 0 {
+		return nil, util.FmtNewtError(
+			"test profile \"%s\" does not include any packages", name)
+	}
+
+	return tp, nil
+}
+
+// TestProfileNames lists the names of the project's test profiles.
+func (proj *Project) TestProfileNames() []string {
+	m := proj.testProfileMap()
+
+	names := make([]string, 0, len(m))
+	for name, _ := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,283 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+// The directory, relative to the project base, that vendored repos are copied
+// to.
+const VENDOR_DIR = "vendor"
+
+// Names of version control files and directories that get stripped from
+// vendored repos.
+var vcsMetadataNames = map[string]struct{}{
+	".git":        struct{}{},
+	".gitmodules": struct{}{},
+	".hg":         struct{}{},
+	".hgsub":      struct{}{},
+	".hgsubstate": struct{}{},
+	".hgtags":     struct{}{},
+	".svn":        struct{}{},
+}
+
+// stripVcsMetadata removes all version control metadata from the specified
+// directory tree.
+func stripVcsMetadata(dir string) error {
+	var doomed []string
+
+	err := filepath.Walk(dir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if _, ok := vcsMetadataNames[info.Name()]; ok {
+				doomed = append(doomed, path)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+			}
+
+			return nil
+		})
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	for _, path := range doomed {
+		if err := os.RemoveAll(path); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	return nil
+}
+
+// replaceYmlBlock replaces the top-level YAML block with the specified key.
+// The original block is retained as a comment.  If the document does not
+// contain the key, the new block is appended to the end.
+func replaceYmlBlock(lines []string, key string, block []string) []string {
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, key+":") {
+			start = i
+			break
+		}
+	}
+
+	if start == -1 {
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		return append(lines, block...)
+	}
+
+	// The block ends at the first non-empty line that isn't indented.
+	end := start + 1
+	for end < len(lines) {
+		line := lines[end]
+		if line != "" && line[0] != ' ' && line[0] != '\t' {
+			break
+		}
+		end++
+	}
+
+	// Leave trailing blank lines alone.
+	for end > start+1 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+
+	result := append([]string{}, lines[:start]...)
+	result = append(result, block...)
+	result = append(result, "# Original entry (replaced by `newt vendor`):")
+	for _, line := range lines[start:end] {
+		result = append(result, "# "+line)
+	}
+	result = append(result, lines[end:]...)
+
+	return result
+}
+
+// vendorRepoBlock generates the `project.yml` entry for a vendored repo.
+func (proj *Project) vendorRepoBlock(r *repo.Repo) ([]string, error) {
+	ver, err := proj.GetRepoVersion(r.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	// The vendored copy is used as-is; its version is only used to resolve
+	// inter-repo dependencies.
+	vers := "0.0.0"
+	if ver != nil {
+		v := *ver
+		v.Commit = ""
+		vers = v.String()
+	}
+
+	return []string{
+		"repository." + r.Name() + ":",
+		"    type: path",
+		"    path: " + VENDOR_DIR + "/" + r.Name(),
+		"    vers: " + vers,
+	}, nil
+}
+
+// vendorOneRepo copies a single repo into the project's vendor directory.
+func (proj *Project) vendorOneRepo(r *repo.Repo, force bool) error {
+	src, err := filepath.EvalSymlinks(r.Path())
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	dst := proj.BasePath + "/" + VENDOR_DIR + "/" + r.Name()
+	if util.NodeExist(dst) {
+		if !force {
+			return util.FmtNewtError(
+				"vendor directory for repo \"%s\" already exists (%s); "+
+					"specify the `-f` (force) switch to overwrite it",
+				r.Name(), dst)
+		}
+
+		if err := os.RemoveAll(dst); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Vendoring repository %s into %s\n", r.Name(), VENDOR_DIR)
+
+	if err := util.CopyDir(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+
+	if err := stripVcsMetadata(dst); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Vendor copies every installed repo into the project's `vendor` directory
+// and rewrites `project.yml` to use the copies in-place (as local path repos).
+// The resulting project can be built without network access.
+//
+// @param force                 Overwrite any previously vendored repos.
+func (proj *Project) Vendor(force bool) error {
+	// Vendoring removes the repos' clones, which other projects may still be
+	// using.
+	if proj.ReposShared() {
+		return util.FmtNewtError(
+			"cannot vendor a project that uses a shared repos directory (%s)",
+			proj.ReposPath())
+	}
+
+	var repos []*repo.Repo
+	for _, r := range proj.repos.Sorted() {
+		if r.IsLocal() {
+			continue
+		}
+
+		// Skip repos that have already been vendored.
+		if pd, ok := r.Downloader().(*downloader.PathDownloader); ok {
+			path, err := pd.AbsPath()
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(path, proj.BasePath+"/") {
+				continue
+			}
+		}
+
+		if !r.CheckExists() {
+			return util.FmtNewtError(
+				"repo \"%s\" is not installed; run `newt upgrade` first",
+				r.Name())
+		}
+
+		dirty, err := r.DirtyState()
+		if err != nil {
+			return err
+		}
+		if dirty != "" {
+			util.OneTimeWarning(
+				"repo \"%s\" contains %s; vendoring its working tree as-is",
+				r.Name(), dirty)
+		}
+
+		repos = append(repos, r)
+	}
+
+	if len(repos) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No repositories to vendor\n")
+		return nil
+	}
+
+	for _, r := range repos {
+		if err := proj.vendorOneRepo(r, force); err != nil {
+			return err
+		}
+	}
+
+	// Point each repo's `project.yml` entry at its vendored copy.
+	ymlPath := proj.BasePath + "/" + PROJECT_FILE_NAME
+	data, err := ioutil.ReadFile(ymlPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for _, r := range repos {
+		block, err := proj.vendorRepoBlock(r)
+		if err != nil {
+			return err
+		}
+		lines = replaceYmlBlock(lines, "repository."+r.Name(), block)
+	}
+
+	s := strings.Join(lines, "\n") + "\n"
+	if err := ioutil.WriteFile(ymlPath, []byte(s), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	// Remove the old clones.  Newt links the vendored copies in their place
+	// the next time the project is loaded.
+	for _, r := range repos {
+		if err := os.RemoveAll(r.Path()); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Vendored %d repositories; %s updated\n", len(repos),
+		PROJECT_FILE_NAME)
+
+	return nil
+}
@@ -37,6 +37,7 @@ import (
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/ycfg"
 	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
 )
 
 const REPO_NAME_LOCAL = "local"
@@ -45,6 +46,25 @@ const REPO_DEFAULT_PERMS = 0755
 const REPO_FILE_NAME = "repository.yml"
 const REPO_VER_FILE_NAME = "version.yml"
 const REPOS_DIR = "repos"
+const REPO_CHECKOUT_FILE_NAME = "checkout.yml"
+
+// Maps each `project.yml` pin field to the type of commit it specifies.
+var pinFieldTypes = map[string]downloader.DownloaderCommitType{
+	"branch": downloader.COMMIT_TYPE_BRANCH,
+	"tag":    downloader.COMMIT_TYPE_TAG,
+	"commit": downloader.COMMIT_TYPE_HASH,
+}
+
+// Describes an explicit branch, tag, or commit that a repo is pinned to in
+// `project.yml`.  A pin overrides the repo's `repository.yml` version mapping.
+type RepoPin struct {
+	// The name of the `project.yml` field specifying the pin ("branch",
+	// "tag", or "commit").
+	Field string
+
+	// The branch, tag, or commit string.
+	Commit string
+}
 
 type Repo struct {
 	name       string
@@ -58,6 +78,12 @@ type Repo struct {
 	// True if this repo was cloned during this invocation of newt.
 	newlyCloned bool
 
+	// True if this repo's versions are read from its git tags.
+	tagVersions bool
+
+	// Explicit commit specified in `project.yml`; nil if not pinned.
+	pin *RepoPin
+
 	// commit => [dependencies]
 	deps map[string][]*RepoDependency
 
@@ -181,9 +207,104 @@ func (r *Repo) IsNewlyCloned() bool {
 	return r.newlyCloned
 }
 
+func (r *Repo) Pin() *RepoPin {
+	return r.pin
+}
+
+func (r *Repo) SetPin(pin *RepoPin) {
+	r.pin = pin
+}
+
+func (pin *RepoPin) String() string {
+	return fmt.Sprintf("%s %s", pin.Field, pin.Commit)
+}
+
+// ParsePin reads the pin fields ("branch", "tag", and "commit") from a repo
+// description in `project.yml`.  At most one pin field may be specified.  It
+// returns nil if the repo is not pinned.
+func ParsePin(fields map[string]string) (*RepoPin, error) {
+	var pin *RepoPin
+
+	for _, field := range []string{"branch", "commit", "tag"} {
+		commit := fields[field]
+		if commit == "" {
+			continue
+		}
+
+		if pin != nil {
+			return nil, util.FmtNewtError(
+				"conflicting pins: \"%s\" and \"%s\"; "+
+					"only one of branch, tag, or commit may be specified",
+				pin.Field, field)
+		}
+
+		pin = &RepoPin{
+			Field:  field,
+			Commit: commit,
+		}
+	}
+
+	return pin, nil
+}
+
+// VerifyPin ensures the repo's pinned commit exists.  If the pin specifies a
+// branch or tag, this function also ensures the commit is of the expected
+// type.  The repo must have been fetched before this function is called.
+func (r *Repo) VerifyPin() error {
+	if r.pin == nil {
+		return nil
+	}
+
+	typ, err := r.downloader.CommitType(r.Path(), r.pin.Commit)
+	if err != nil {
+		return util.FmtNewtError(
+			"repo \"%s\" is pinned to nonexistent %s \"%s\"",
+			r.Name(), r.pin.Field, r.pin.Commit)
+	}
+
+	want := pinFieldTypes[r.pin.Field]
+	if want != downloader.COMMIT_TYPE_HASH && typ != want {
+		return util.FmtNewtError(
+			"repo \"%s\" is pinned to %s \"%s\", but no such %s exists",
+			r.Name(), r.pin.Field, r.pin.Commit, r.pin.Field)
+	}
+
+	return nil
+}
+
+// RecordCheckout writes the repo's checked out version and commit hash to
+// `repos/.configs/<repo>/checkout.yml`.  This provides a record of exactly
+// what the most recent upgrade operation installed.
+func (r *Repo) RecordCheckout(ver newtutil.RepoVersion) error {
+	hash, err := r.CurrentHash()
+	if err != nil {
+		return err
+	}
+
+	m := map[string]interface{}{
+		"repo.version": ver.String(),
+		"repo.commit":  hash,
+	}
+	if r.pin != nil {
+		m["repo.pin."+r.pin.Field] = r.pin.Commit
+	}
+
+	cpath := r.repoFilePath()
+	if err := os.MkdirAll(cpath, REPO_DEFAULT_PERMS); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	s := "# Generated by newt; do not edit.\n" + yaml.MapToYaml(m)
+	path := cpath + "/" + REPO_CHECKOUT_FILE_NAME
+	if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
 func RepoFilePath(repoName string) string {
-	return interfaces.GetProject().Path() + "/" + REPOS_DIR + "/" +
-		".configs/" + repoName
+	return interfaces.GetProject().ReposPath() + "/.configs/" + repoName
 }
 
 func (r *Repo) repoFilePath() string {
@@ -191,21 +312,33 @@ func (r *Repo) repoFilePath() string {
 }
 
 func (r *Repo) patchesFilePath() string {
-	return interfaces.GetProject().Path() + "/" + REPOS_DIR +
-		"/.patches/"
+	return interfaces.GetProject().ReposPath() + "/.patches/"
 }
 
 func (r *Repo) downloadRepo(commit string) error {
 	dl := r.downloader
 
+	// A local path repo is linked in place rather than copied.
+	if _, ok := dl.(*downloader.PathDownloader); ok {
+		if err := dl.Clone(commit, r.Path()); err != nil {
+			return util.FmtNewtError("Error linking repository %s: %s",
+				r.Name(), err.Error())
+		}
+
+		r.newlyCloned = true
+		return nil
+	}
+
 	tmpdir, err := newtutil.MakeTempRepoDir()
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(tmpdir)
 
-	// Download the git repo, returns the git repo, checked out to that commit
-	if err := dl.Clone(commit, tmpdir); err != nil {
+	// Download the git repo, returns the git repo, checked out to that commit.
+	// If another project has already downloaded this repo, the clone is
+	// copied from the shared repo cache.
+	if err := downloader.CloneCached(dl, commit, tmpdir); err != nil {
 		return util.FmtNewtError("Error downloading repository %s: %s",
 			r.Name(), err.Error())
 	}
@@ -275,6 +408,15 @@ func (r *Repo) DirtyState() (string, error) {
 	return r.downloader.DirtyState(r.Path())
 }
 
+// Saves the repo's local changes so that they survive an upgrade.
+//
+// @return string               Text describing what was saved, or "" if
+//                                  there was nothing to save.
+// @return error                Error.
+func (r *Repo) Stash() (string, error) {
+	return r.downloader.Stash(r.Path())
+}
+
 func (r *Repo) Upgrade(ver newtutil.RepoVersion) error {
 	commit, err := r.CommitFromVer(ver)
 	if err != nil {
@@ -360,7 +502,15 @@ func (r *Repo) downloadFile(commit string, srcPath string) (string, error) {
 
 func (r *Repo) downloadRepositoryYml() error {
 	if _, err := r.downloadFile("master", REPO_FILE_NAME); err != nil {
-		return err
+		if !r.tagVersions {
+			return err
+		}
+
+		// A repo whose versions are read from tags may lack a
+		// `repository.yml` file.  Discard any stale copy.
+		log.Debugf("Repo %s has no %s; using tags only: %s",
+			r.Name(), REPO_FILE_NAME, err.Error())
+		os.Remove(r.repoFilePath() + "/" + REPO_FILE_NAME)
 	}
 
 	return nil
@@ -472,9 +622,16 @@ func (r *Repo) readDepRepos(yc ycfg.YCfg) error {
 func (r *Repo) Read() error {
 	r.Init(r.Name(), r.downloader)
 
-	yc, err := config.ReadFile(r.repoFilePath() + "/" + REPO_FILE_NAME)
+	path := r.repoFilePath() + "/" + REPO_FILE_NAME
+	yc, err := config.ReadFile(path)
 	if err != nil {
-		return err
+		// A repo that publishes its versions as tags doesn't need a
+		// `repository.yml` file.  Its tags can only be read once it has been
+		// cloned, however.
+		if !r.tagVersions || !util.IsNotExist(err) || !r.CheckExists() {
+			return err
+		}
+		yc = ycfg.NewYCfg(path)
 	}
 
 	versMap := yc.GetValStringMapString("repo.versions", nil)
@@ -490,6 +647,12 @@ func (r *Repo) Read() error {
 		r.vers[vers] = commit
 	}
 
+	if r.tagVersions {
+		if err := r.readTagVersions(); err != nil {
+			return err
+		}
+	}
+
 	if err := r.readDepRepos(yc); err != nil {
 		return err
 	}
@@ -509,12 +672,13 @@ func (r *Repo) Init(repoName string, d downloader.Downloader) error {
 	r.deps = map[string][]*RepoDependency{}
 	r.vers = map[newtutil.RepoVersion]string{}
 
-	path := interfaces.GetProject().Path()
+	proj := interfaces.GetProject()
 
 	if r.local {
-		r.localPath = filepath.ToSlash(filepath.Clean(path))
+		r.localPath = filepath.ToSlash(filepath.Clean(proj.Path()))
 	} else {
-		r.localPath = filepath.ToSlash(filepath.Clean(path + "/" + REPOS_DIR + "/" + r.name))
+		r.localPath = filepath.ToSlash(
+			filepath.Clean(proj.ReposPath() + "/" + r.name))
 	}
 
 	return nil
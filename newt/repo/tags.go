@@ -0,0 +1,133 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// This file implements version discovery for repos that publish their
+// versions as semantic version git tags (e.g., "v1.2.3") rather than in the
+// `repo.versions` map of a `repository.yml` file.  Such repos are identified
+// by the `tag_versions: true` setting in their `project.yml` entry.
+
+package repo
+
+import (
+	"regexp"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+)
+
+// Matches tags of the form "1.2.3" or "v1.2.3".
+var versionTagRe = regexp.MustCompile(`^[vV]?(\d+)\.(\d+)\.(\d+)$`)
+
+func (r *Repo) TagVersions() bool {
+	return r.tagVersions
+}
+
+func (r *Repo) SetTagVersions(tagVersions bool) {
+	r.tagVersions = tagVersions
+}
+
+// Parses a version tag.  It returns false if the tag doesn't name a version.
+func parseVersionTag(tag string) (newtutil.RepoVersion, bool) {
+	m := versionTagRe.FindStringSubmatch(tag)
+	if m == nil {
+		return newtutil.RepoVersion{}, false
+	}
+
+	var parts [3]int64
+	for i := range parts {
+		n, err := strconv.ParseInt(m[i+1], 10, 64)
+		if err != nil {
+			return newtutil.RepoVersion{}, false
+		}
+		parts[i] = n
+	}
+
+	return newtutil.RepoVersion{
+		Major:     parts[0],
+		Minor:     parts[1],
+		Revision:  parts[2],
+		Stability: newtutil.VERSION_STABILITY_NONE,
+	}, true
+}
+
+// Records a floating version (e.g., "1-latest") that maps to the specified
+// fixed version, unless the floating version already maps to something newer.
+func (r *Repo) addFloatingVer(floating newtutil.RepoVersion,
+	ver newtutil.RepoVersion) {
+
+	if cur, ok := r.vers[floating]; ok {
+		curVer, err := newtutil.ParseRepoVersion(cur)
+		if err == nil && newtutil.CompareRepoVersions(curVer, ver) >= 0 {
+			return
+		}
+	}
+
+	r.vers[floating] = ver.String()
+}
+
+// Populates the repo's version map from its version tags.  Each tag maps a
+// fixed version to the tag itself.  In addition, "X-latest", "X.Y-latest",
+// and the equivalent "stable" versions map to the newest matching version.
+// Fixed versions listed in `repository.yml` take precedence over tags.
+func (r *Repo) readTagVersions() error {
+	tags, err := r.downloader.Tags(r.Path())
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		ver, ok := parseVersionTag(tag)
+		if !ok {
+			continue
+		}
+
+		if _, ok := r.vers[ver]; ok {
+			// Already mapped, either by `repository.yml` or by an equivalent
+			// tag (e.g., "1.2.3" and "v1.2.3").
+			continue
+		}
+
+		log.Debugf("Repo %s: tag %s provides version %s",
+			r.Name(), tag, ver.String())
+		r.vers[ver] = tag
+
+		for _, stability := range []string{
+			newtutil.VERSION_STABILITY_LATEST,
+			newtutil.VERSION_STABILITY_STABLE,
+		} {
+			r.addFloatingVer(newtutil.RepoVersion{
+				Major:     ver.Major,
+				Minor:     newtutil.VERSION_FLOATING,
+				Revision:  newtutil.VERSION_FLOATING,
+				Stability: stability,
+			}, ver)
+
+			r.addFloatingVer(newtutil.RepoVersion{
+				Major:     ver.Major,
+				Minor:     ver.Minor,
+				Revision:  newtutil.VERSION_FLOATING,
+				Stability: stability,
+			}, ver)
+		}
+	}
+
+	return nil
+}
@@ -27,6 +27,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"mynewt.apache.org/newt/newt/config"
+	"mynewt.apache.org/newt/newt/downloader"
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/util"
 )
@@ -430,6 +431,12 @@ func (r *Repo) InstalledVersion() (*newtutil.RepoVersion, error) {
 		return nil, err
 	}
 	if hash == "" {
+		// A local path repo isn't under newt's version control; its
+		// `version.yml` describes exactly the files that are linked in.  For
+		// any other repo, an unresolved commit means the version is unknown.
+		if _, ok := r.downloader.(*downloader.PathDownloader); ok {
+			return vyVer, nil
+		}
 		return nil, nil
 	}
 
@@ -62,6 +62,7 @@ type Resolver struct {
 	pkgMap           map[*pkg.LocalPackage]*ResolvePackage
 	seedPkgs         []*pkg.LocalPackage
 	injectedSettings map[string]string
+	overrideSettings map[string]string
 	flashMap         flashmap.FlashMap
 	cfg              syscfg.Cfg
 	lcfg             logcfg.LCfg
@@ -135,6 +136,7 @@ type Resolution struct {
 func newResolver(
 	seedPkgs []*pkg.LocalPackage,
 	injectedSettings map[string]string,
+	overrideSettings map[string]string,
 	flashMap flashmap.FlashMap) *Resolver {
 
 	r := &Resolver{
@@ -142,6 +144,7 @@ func newResolver(
 		pkgMap:           map[*pkg.LocalPackage]*ResolvePackage{},
 		seedPkgs:         seedPkgs,
 		injectedSettings: injectedSettings,
+		overrideSettings: overrideSettings,
 		flashMap:         flashMap,
 		cfg:              syscfg.NewCfg(),
 		apiConflicts:     map[string]map[*ResolvePackage]struct{}{},
@@ -552,8 +555,8 @@ func (r *Resolver) reloadCfg() (bool, error) {
 	// required for reloading syscfg, as settings may unlock additional
 	// settings.
 	settings := r.cfg.SettingValues()
-	cfg, err := syscfg.Read(lpkgs, apis, r.injectedSettings, settings,
-		r.flashMap)
+	cfg, err := syscfg.Read(lpkgs, apis, r.injectedSettings,
+		r.overrideSettings, settings, r.flashMap)
 	if err != nil {
 		return false, err
 	}
@@ -1065,6 +1068,7 @@ func ResolveFull(
 	loaderSeeds []*pkg.LocalPackage,
 	appSeeds []*pkg.LocalPackage,
 	injectedSettings map[string]string,
+	overrideSettings map[string]string,
 	flashMap flashmap.FlashMap) (*Resolution, error) {
 
 	// First, calculate syscfg and determine which package provides each
@@ -1074,7 +1078,7 @@ func ResolveFull(
 	// calculated here as a byproduct.
 
 	allSeeds := append(loaderSeeds, appSeeds...)
-	r := newResolver(allSeeds, injectedSettings, flashMap)
+	r := newResolver(allSeeds, injectedSettings, overrideSettings, flashMap)
 
 	if err := r.resolveDepsAndCfg(); err != nil {
 		return nil, err
@@ -1142,7 +1146,8 @@ func ResolveFull(
 	}
 
 	// Resolve loader dependencies.
-	r = newResolver(loaderSeeds, injectedSettings, flashMap)
+	r = newResolver(loaderSeeds, injectedSettings, overrideSettings,
+		flashMap)
 	r.cfg = res.Cfg
 
 	var err error
@@ -1163,7 +1168,7 @@ func ResolveFull(
 		}
 	}
 
-	r = newResolver(appSeeds, injectedSettings, flashMap)
+	r = newResolver(appSeeds, injectedSettings, overrideSettings, flashMap)
 	r.cfg = res.Cfg
 
 	res.AppSet.Rpkgs, err = r.resolveDeps()
@@ -0,0 +1,193 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package serialport opens serial ports and finds the ports of attached USB
+// devices.
+package serialport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A USB device's vendor and product IDs.
+type UsbId struct {
+	Vendor  uint16
+	Product uint16
+}
+
+func (id UsbId) String() string {
+	return fmt.Sprintf("%04x:%04x", id.Vendor, id.Product)
+}
+
+// ParseUsbId parses a USB ID of the form "<vid>:<pid>", where both IDs are
+// hexadecimal (e.g., "1366:1015").
+func ParseUsbId(s string) (UsbId, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return UsbId{}, util.FmtNewtError(
+			"invalid USB ID \"%s\"; must have the form <vid>:<pid>", s)
+	}
+
+	var ids [2]uint16
+	for i, p := range parts {
+		n, err := strconv.ParseUint(strings.TrimPrefix(p, "0x"), 16, 16)
+		if err != nil {
+			return UsbId{}, util.FmtNewtError(
+				"invalid USB ID \"%s\"; IDs must be hexadecimal", s)
+		}
+		ids[i] = uint16(n)
+	}
+
+	return UsbId{Vendor: ids[0], Product: ids[1]}, nil
+}
+
+// configure sets a serial port's baud rate and puts it in raw mode.
+func configure(port string, baud int) error {
+	var cmd []string
+	switch runtime.GOOS {
+	case "linux":
+		cmd = []string{"stty", "-F", port}
+	case "darwin", "freebsd", "netbsd", "openbsd":
+		cmd = []string{"stty", "-f", port}
+	default:
+		return util.FmtNewtError(
+			"serial ports are not supported on %s", runtime.GOOS)
+	}
+	cmd = append(cmd, strconv.Itoa(baud), "raw", "-echo", "clocal")
+
+	if _, err := util.ShellCommand(cmd, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Open configures and opens a serial port.
+//
+// @param port                  The path of the serial port (e.g.,
+//                                  /dev/ttyUSB0).
+// @param baud                  The port's baud rate.
+func Open(port string, baud int) (*os.File, error) {
+	if err := configure(port, baud); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(port, os.O_RDWR, 0)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return f, nil
+}
+
+// readUsbId reads the ID of the USB device that a sysfs device directory
+// belongs to, searching its ancestors.
+func readUsbId(dir string) (UsbId, bool) {
+	for ; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		vid, err := ioutil.ReadFile(dir + "/idVendor")
+		if err != nil {
+			continue
+		}
+		pid, err := ioutil.ReadFile(dir + "/idProduct")
+		if err != nil {
+			continue
+		}
+
+		id, err := ParseUsbId(strings.TrimSpace(string(vid)) + ":" +
+			strings.TrimSpace(string(pid)))
+		if err != nil {
+			return UsbId{}, false
+		}
+		return id, true
+	}
+
+	return UsbId{}, false
+}
+
+// Detect finds the serial port of an attached USB device with one of the
+// specified IDs.  Ports are found through sysfs, so detection is only
+// supported on Linux.
+//
+// @param ids                   The acceptable USB IDs.
+//
+// @return string               The path of the port.
+// @return error                Error if no port or more than one port
+//                                  matches.
+func Detect(ids []UsbId) (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", util.FmtNewtError(
+			"serial port detection is not supported on %s; specify the "+
+				"port", runtime.GOOS)
+	}
+
+	ttys, err := filepath.Glob("/sys/class/tty/*/device")
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	var ports []string
+	for _, tty := range ttys {
+		dev, err := filepath.EvalSymlinks(tty)
+		if err != nil {
+			continue
+		}
+
+		id, ok := readUsbId(dev)
+		if !ok {
+			continue
+		}
+
+		for _, want := range ids {
+			if id == want {
+				ports = append(ports,
+					"/dev/"+filepath.Base(filepath.Dir(tty)))
+				break
+			}
+		}
+	}
+	sort.Strings(ports)
+
+	idStrs := make([]string, len(ids))
+	for i, id := range ids {
+		idStrs[i] = id.String()
+	}
+
+	switch len(ports) {
+	case 0:
+		return "", util.FmtNewtError(
+			"no serial port found for USB device %s",
+			strings.Join(idStrs, ", "))
+	case 1:
+		return ports[0], nil
+	default:
+		return "", util.FmtNewtError(
+			"several serial ports found for USB device %s (%s); specify "+
+				"the port", strings.Join(idStrs, ", "),
+			strings.Join(ports, ", "))
+	}
+}
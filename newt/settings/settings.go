@@ -51,15 +51,25 @@ func processNewtrc(yc ycfg.YCfg) {
 	}
 }
 
-func readNewtrc() ycfg.YCfg {
+// Retrieves the path of the user's newt settings directory ($HOME/.newt).
+func NewtrcDir() (string, error) {
 	usr, err := user.Current()
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return fmt.Sprintf("%s/%s", usr.HomeDir, NEWTRC_DIR), nil
+}
+
+func readNewtrc() ycfg.YCfg {
+	dir, err := NewtrcDir()
 	if err != nil {
 		return ycfg.YCfg{}
 	}
 
 	yc := ycfg.NewYCfg("newtrc")
 	for _, filename := range []string{NEWTRC_FILENAME, REPOS_FILENAME} {
-		path := fmt.Sprintf("%s/%s/%s", usr.HomeDir, NEWTRC_DIR, filename)
+		path := fmt.Sprintf("%s/%s", dir, filename)
 		sub, err := config.ReadFile(path)
 		if err != nil && !util.IsNotExist(err) {
 			log.Warnf("Failed to read %s file", path)
@@ -0,0 +1,153 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package smp
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Management groups and commands.
+const (
+	SMP_GROUP_DEFAULT = 0
+	SMP_GROUP_IMAGE   = 1
+
+	SMP_ID_DEFAULT_RESET  = 5
+	SMP_ID_IMAGE_UPLOAD   = 1
+	SMP_ID_IMAGE_CORELOAD = 4
+)
+
+// The number of image bytes sent per upload request.  The serial bootloader
+// limits the size of a request, so this is kept small.
+const SMP_UPLOAD_CHUNK_SZ = 128
+
+// The number of times an upload request is retried before giving up.
+const SMP_UPLOAD_RETRIES = 3
+
+// UploadImage writes an image to the device.  The device chooses the slot:
+// the serial bootloader writes to slot 0, an app's image manager to slot 1.
+//
+// @param c                     The connection to the device.
+// @param data                  The contents of the image file.
+// @param progress              Called with the number of bytes written after
+//                                  each request; may be nil.
+func (c *Conn) UploadImage(data []byte, progress func(off int)) error {
+	off := 0
+	retries := 0
+
+	for off < len(data) {
+		end := off + SMP_UPLOAD_CHUNK_SZ
+		if end > len(data) {
+			end = len(data)
+		}
+
+		req := map[string]interface{}{
+			"off":  off,
+			"data": data[off:end],
+		}
+		if off == 0 {
+			req["len"] = len(data)
+		}
+
+		rsp, err := c.Request(SMP_OP_WRITE, SMP_GROUP_IMAGE,
+			SMP_ID_IMAGE_UPLOAD, req)
+		if err != nil {
+			if retries >= SMP_UPLOAD_RETRIES {
+				return util.FmtNewtError(
+					"image upload failed at offset %d: %s", off, err.Error())
+			}
+			retries++
+			log.Debugf("retrying upload at offset %d: %s", off, err.Error())
+			continue
+		}
+		retries = 0
+
+		// The device reports the offset it expects next.
+		next, ok := rsp["off"]
+		if !ok {
+			return util.NewNewtError(
+				"image upload response does not specify an offset")
+		}
+		off = intVal(next)
+
+		if progress != nil {
+			progress(off)
+		}
+	}
+
+	return nil
+}
+
+// Reset resets the device.
+func (c *Conn) Reset() error {
+	_, err := c.Request(SMP_OP_WRITE, SMP_GROUP_DEFAULT,
+		SMP_ID_DEFAULT_RESET, map[string]interface{}{})
+	return err
+}
+
+// DownloadCoreDump reads the core dump stored on the device.
+//
+// @param progress              Called with the number of bytes read after
+//                                  each request; may be nil.
+//
+// @return []byte               The raw core dump.
+// @return error                Error if the device has no core dump or the
+//                                  download fails.
+func (c *Conn) DownloadCoreDump(progress func(off int)) ([]byte, error) {
+	var data []byte
+	retries := 0
+
+	for {
+		rsp, err := c.Request(SMP_OP_READ, SMP_GROUP_IMAGE,
+			SMP_ID_IMAGE_CORELOAD, map[string]interface{}{
+				"off": len(data),
+			})
+		if err != nil {
+			// The device reports a missing core dump with an error code;
+			// there is no point retrying.
+			if rsp != nil || retries >= SMP_UPLOAD_RETRIES {
+				return nil, util.FmtNewtError(
+					"core dump download failed at offset %d: %s",
+					len(data), err.Error())
+			}
+			retries++
+			log.Debugf("retrying core dump download at offset %d: %s",
+				len(data), err.Error())
+			continue
+		}
+		retries = 0
+
+		chunk, _ := rsp["data"].([]byte)
+		if len(chunk) == 0 {
+			return data, nil
+		}
+		if off := intVal(rsp["off"]); off != len(data) {
+			return nil, util.FmtNewtError(
+				"core dump response has offset %d; expected %d",
+				off, len(data))
+		}
+		data = append(data, chunk...)
+
+		if progress != nil {
+			progress(len(data))
+		}
+	}
+}
@@ -0,0 +1,308 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package smp implements the Simple Management Protocol (SMP) over a serial
+// port, as spoken by the Mynewt serial bootloader and by apps that include
+// the image manager.
+package smp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+
+	"mynewt.apache.org/newt/newt/serialport"
+	"mynewt.apache.org/newt/util"
+)
+
+// SMP operations.
+const (
+	SMP_OP_READ      = 0
+	SMP_OP_READ_RSP  = 1
+	SMP_OP_WRITE     = 2
+	SMP_OP_WRITE_RSP = 3
+)
+
+const SMP_HDR_SZ = 8
+
+// Serial framing.  A packet is prefixed with its length, suffixed with its
+// CRC16, base64 encoded, and split into newline-terminated frames.  The first
+// frame of a packet starts with a distinct marker.
+const (
+	SERIAL_FRAME_MAX_SZ = 127
+	SERIAL_RSP_TIMEOUT  = 5 * time.Second
+)
+
+var serialPktStart = []byte{0x06, 0x09}
+var serialFrameStart = []byte{0x04, 0x14}
+
+type smpHdr struct {
+	Op    uint8
+	Flags uint8
+	Len   uint16
+	Group uint16
+	Seq   uint8
+	Id    uint8
+}
+
+// A connection to a device's SMP server over a serial port.
+type Conn struct {
+	port  *os.File
+	lines chan []byte
+	seq   uint8
+}
+
+// Open opens a connection to the SMP server on the specified serial port.
+//
+// @param port                  The path of the serial port (e.g.,
+//                                  /dev/ttyUSB0).
+// @param baud                  The port's baud rate.
+//
+// @return *Conn                The connection.
+// @return error                Error if the port cannot be opened.
+func Open(port string, baud int) (*Conn, error) {
+	f, err := serialport.Open(port, baud)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		port:  f,
+		lines: make(chan []byte, 16),
+	}
+
+	// Read lines in the background so that responses can time out.  Reading
+	// stops when the port is closed.
+	go func() {
+		r := bufio.NewReader(f)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				close(c.lines)
+				return
+			}
+			c.lines <- line
+		}
+	}()
+
+	return c, nil
+}
+
+func (c *Conn) Close() error {
+	return c.port.Close()
+}
+
+// crc16 computes the CRC16-CCITT of the specified data, with an initial value
+// of 0.
+func crc16(data []byte) uint16 {
+	crc := uint16(0)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// encodeFrames frames a packet for transmission over a serial port.
+func encodeFrames(pkt []byte) []byte {
+	buf := make([]byte, 2, len(pkt)+4)
+	binary.BigEndian.PutUint16(buf, uint16(len(pkt)+2))
+	buf = append(buf, pkt...)
+	crc := make([]byte, 2)
+	binary.BigEndian.PutUint16(crc, crc16(pkt))
+	buf = append(buf, crc...)
+
+	enc := base64.StdEncoding.EncodeToString(buf)
+
+	var out bytes.Buffer
+	maxChunk := SERIAL_FRAME_MAX_SZ - len(serialPktStart) - 1
+	for off := 0; off < len(enc); off += maxChunk {
+		if off == 0 {
+			out.Write(serialPktStart)
+		} else {
+			out.Write(serialFrameStart)
+		}
+
+		end := off + maxChunk
+		if end > len(enc) {
+			end = len(enc)
+		}
+		out.WriteString(enc[off:end])
+		out.WriteByte('\n')
+	}
+
+	return out.Bytes()
+}
+
+// readPkt reads and decodes the next packet from the port.  Lines that are not
+// SMP frames (e.g., console output) are ignored.
+func (c *Conn) readPkt() ([]byte, error) {
+	var enc []byte
+	timeout := time.After(SERIAL_RSP_TIMEOUT)
+
+	for {
+		var line []byte
+		var ok bool
+		select {
+		case line, ok = <-c.lines:
+			if !ok {
+				return nil, util.NewNewtError("serial port closed")
+			}
+		case <-timeout:
+			return nil, util.NewNewtError("timeout waiting for response")
+		}
+
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case bytes.HasPrefix(line, serialPktStart):
+			enc = append([]byte{}, line[len(serialPktStart):]...)
+		case bytes.HasPrefix(line, serialFrameStart) && enc != nil:
+			enc = append(enc, line[len(serialFrameStart):]...)
+		default:
+			log.Debugf("serial: ignoring line: %s", string(line))
+			continue
+		}
+
+		// Frames may split the base64 encoding at any point; wait until a
+		// complete packet has been received.
+		if len(enc)%4 != 0 {
+			continue
+		}
+		buf, err := base64.StdEncoding.DecodeString(string(enc))
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"invalid response encoding: %s", err.Error())
+		}
+		if len(buf) < 2 {
+			continue
+		}
+		pktLen := int(binary.BigEndian.Uint16(buf))
+		if len(buf)-2 < pktLen {
+			continue
+		}
+
+		pkt := buf[2 : 2+pktLen]
+		if pktLen < 2 || crc16(pkt) != 0 {
+			return nil, util.NewNewtError("response CRC mismatch")
+		}
+
+		return pkt[:pktLen-2], nil
+	}
+}
+
+// Request sends an SMP request and waits for its response.
+//
+// @param op                    The operation (SMP_OP_READ or SMP_OP_WRITE).
+// @param group                 The management group of the command.
+// @param id                    The command's ID within its group.
+// @param req                   The request body; encoded as CBOR.
+//
+// @return map[string]interface{} The decoded response body.
+// @return error                Error if no valid response is received.
+func (c *Conn) Request(op uint8, group uint16, id uint8,
+	req interface{}) (map[string]interface{}, error) {
+
+	var body []byte
+	if err := codec.NewEncoderBytes(&body,
+		new(codec.CborHandle)).Encode(req); err != nil {
+
+		return nil, util.ChildNewtError(err)
+	}
+
+	hdr := smpHdr{
+		Op:    op,
+		Len:   uint16(len(body)),
+		Group: group,
+		Seq:   c.seq,
+		Id:    id,
+	}
+	c.seq++
+
+	var pkt bytes.Buffer
+	binary.Write(&pkt, binary.BigEndian, hdr)
+	pkt.Write(body)
+
+	if _, err := c.port.Write(encodeFrames(pkt.Bytes())); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	for {
+		rsp, err := c.readPkt()
+		if err != nil {
+			return nil, err
+		}
+
+		var rspHdr smpHdr
+		if len(rsp) < SMP_HDR_SZ {
+			return nil, util.NewNewtError("response too short")
+		}
+		binary.Read(bytes.NewReader(rsp), binary.BigEndian, &rspHdr)
+
+		// Skip stale responses to earlier, timed out requests.
+		if rspHdr.Seq != hdr.Seq {
+			log.Debugf("serial: ignoring response with seq=%d", rspHdr.Seq)
+			continue
+		}
+		if rspHdr.Group != group || rspHdr.Id != id || rspHdr.Op != op+1 {
+			return nil, util.FmtNewtError(
+				"unexpected response (op=%d group=%d id=%d)",
+				rspHdr.Op, rspHdr.Group, rspHdr.Id)
+		}
+
+		m := map[string]interface{}{}
+		err = codec.NewDecoderBytes(rsp[SMP_HDR_SZ:],
+			new(codec.CborHandle)).Decode(&m)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"invalid response body: %s", err.Error())
+		}
+
+		if rc := intVal(m["rc"]); rc != 0 {
+			return m, util.FmtNewtError("device returned error rc=%d", rc)
+		}
+
+		return m, nil
+	}
+}
+
+// intVal converts a decoded CBOR integer to an int; 0 if the value is absent
+// or not an integer.
+func intVal(v interface{}) int {
+	switch n := v.(type) {
+	case int64:
+		return int(n)
+	case uint64:
+		return int(n)
+	default:
+		return 0
+	}
+}
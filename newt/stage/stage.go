@@ -31,6 +31,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -41,8 +42,14 @@ import (
 	"mynewt.apache.org/newt/util"
 )
 
+// Prefix of a stage specifier that names a function which must be called
+// first.
+const STAGE_AFTER_PREFIX = "$after:"
+
 type StageFunc struct {
-	Stage      val.ValSetting
+	Stage val.ValSetting
+	// Names of functions that must be called before this one.
+	After      []string
 	Name       string
 	ReturnType string
 	ArgList    string
@@ -73,6 +80,60 @@ func NewStageFunc(name string, textVal string,
 	return sf, nil
 }
 
+// NewStageFuncDeps constructs a stage function from a list of specifiers.
+// Each specifier is either a stage number (possibly a `MYNEWT_VAL(...)`
+// reference) or "$after:<function-name>".  At most one stage number may be
+// specified.  If none is, the function's stage is derived from the functions
+// it must follow when the functions are ordered (see OrderStageFuncs).
+func NewStageFuncDeps(name string, specs []string,
+	p *pkg.LocalPackage, cfg *syscfg.Cfg) (StageFunc, error) {
+
+	stageStr := ""
+	haveStage := false
+	var after []string
+
+	for _, spec := range specs {
+		if strings.HasPrefix(spec, STAGE_AFTER_PREFIX) {
+			dep := strings.TrimSpace(
+				strings.TrimPrefix(spec, STAGE_AFTER_PREFIX))
+			if dep == "" {
+				return StageFunc{}, util.FmtNewtError(
+					"Invalid stage setting: %s=%s; missing function name",
+					name, spec)
+			}
+			after = append(after, dep)
+		} else if haveStage {
+			return StageFunc{}, util.FmtNewtError(
+				"Invalid stage setting: %s; multiple stages specified: "+
+					"%s, %s", name, stageStr, spec)
+		} else {
+			stageStr = spec
+			haveStage = true
+		}
+	}
+
+	if !haveStage {
+		if len(after) == 0 {
+			return StageFunc{}, util.FmtNewtError(
+				"Invalid stage setting: %s; no stage specified", name)
+		}
+
+		return StageFunc{
+			Name:  name,
+			After: after,
+			Pkg:   p,
+		}, nil
+	}
+
+	sf, err := NewStageFunc(name, stageStr, p, cfg)
+	if err != nil {
+		return StageFunc{}, err
+	}
+	sf.After = after
+
+	return sf, nil
+}
+
 type stageFuncSorter struct {
 	// Used in logging; either "sysinit" or "sysdown".
 	funcType string
@@ -127,6 +188,184 @@ func SortStageFuncs(unsorted []StageFunc, funcType string) {
 	sort.Sort(s)
 }
 
+func stageFuncLess(a StageFunc, b StageFunc) bool {
+	inta, _ := a.Stage.IntVal()
+	intb, _ := b.Stage.IntVal()
+
+	if inta != intb {
+		return inta < intb
+	}
+
+	return a.Name < b.Name
+}
+
+// deriveStages assigns a stage to each function that does not specify one:
+// the highest stage of the functions it must follow.  It returns a
+// description of each dependency cycle it encounters.  The functions must be
+// sorted by name.
+func deriveStages(fns []StageFunc, idxMap map[string]int) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var cycles []string
+	state := make([]int, len(fns))
+	path := []string{}
+
+	var visit func(i int) int
+	visit = func(i int) int {
+		f := &fns[i]
+
+		if state[i] == visited {
+			intStage, _ := f.Stage.IntVal()
+			return intStage
+		}
+
+		state[i] = visiting
+		path = append(path, f.Name)
+
+		maxStage := 0
+		for _, dep := range f.After {
+			j, ok := idxMap[dep]
+			if !ok {
+				continue
+			}
+
+			if state[j] == visiting {
+				start := 0
+				for path[start] != dep {
+					start++
+				}
+				cycle := append([]string{}, path[start:]...)
+				cycle = append(cycle, dep)
+				cycles = append(cycles, strings.Join(cycle, " after "))
+				continue
+			}
+
+			depStage := visit(j)
+			if depStage > maxStage {
+				maxStage = depStage
+			}
+		}
+
+		if f.Stage.Value == "" {
+			f.Stage = val.ValSetting{
+				Value: strconv.Itoa(maxStage),
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[i] = visited
+
+		intStage, _ := f.Stage.IntVal()
+		return intStage
+	}
+
+	for i := range fns {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+
+	return cycles
+}
+
+// OrderStageFuncs performs an in-place sort of the provided StageFunc slice
+// into call order.  Functions are called in order of stage number.  A
+// function is called after each function listed in its `After` set, and is
+// otherwise ordered by name.  A function without a stage inherits the highest
+// stage of the functions it follows.
+//
+// The returned strings describe ordering errors: references to unknown
+// functions, dependency cycles, and functions whose stage precedes that of a
+// function they must follow.  If there are any errors, the functions are
+// sorted by stage and name only.
+func OrderStageFuncs(fns []StageFunc, funcType string) []string {
+	sort.SliceStable(fns, func(i int, j int) bool {
+		return fns[i].Name < fns[j].Name
+	})
+
+	idxMap := make(map[string]int, len(fns))
+	for i, f := range fns {
+		idxMap[f.Name] = i
+	}
+
+	var errs []string
+	for _, f := range fns {
+		for _, dep := range f.After {
+			if _, ok := idxMap[dep]; !ok {
+				errs = append(errs, fmt.Sprintf(
+					"%s (%s) must be called after unknown function %s",
+					f.Name, f.Pkg.FullName(), dep))
+			}
+		}
+	}
+
+	for _, cycle := range deriveStages(fns, idxMap) {
+		errs = append(errs, "Dependency cycle: "+cycle)
+	}
+
+	for _, f := range fns {
+		intStage, _ := f.Stage.IntVal()
+		for _, dep := range f.After {
+			j, ok := idxMap[dep]
+			if !ok {
+				continue
+			}
+
+			depStage, _ := fns[j].Stage.IntVal()
+			if depStage > intStage {
+				errs = append(errs, fmt.Sprintf(
+					"%s (%s) has stage %d but must be called after "+
+						"%s (%s), which has stage %d",
+					f.Name, f.Pkg.FullName(), intStage,
+					dep, fns[j].Pkg.FullName(), depStage))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		SortStageFuncs(fns, funcType)
+		return errs
+	}
+
+	// Repeatedly emit the first function (by stage and name) whose
+	// dependencies have all been emitted.
+	numDeps := make([]int, len(fns))
+	followers := make([][]int, len(fns))
+	for i, f := range fns {
+		for _, dep := range f.After {
+			j := idxMap[dep]
+			numDeps[i]++
+			followers[j] = append(followers[j], i)
+		}
+	}
+
+	sorted := make([]StageFunc, 0, len(fns))
+	emitted := make([]bool, len(fns))
+	for len(sorted) < len(fns) {
+		next := -1
+		for i, f := range fns {
+			if !emitted[i] && numDeps[i] == 0 &&
+				(next == -1 || stageFuncLess(f, fns[next])) {
+
+				next = i
+			}
+		}
+
+		emitted[next] = true
+		sorted = append(sorted, fns[next])
+		for _, k := range followers[next] {
+			numDeps[k]--
+		}
+	}
+	copy(fns, sorted)
+
+	return nil
+}
+
 func (f *StageFunc) ReturnTypeString() string {
 	if f.ReturnType == "" {
 		return "void"
@@ -143,6 +382,19 @@ func (f *StageFunc) ArgListString() string {
 	}
 }
 
+// provenance describes where a function and its stage are specified.
+func (f *StageFunc) provenance() string {
+	s := f.Pkg.RelativeFilePath(pkg.PACKAGE_FILE_NAME)
+	if f.Stage.RefName != "" {
+		s += "; stage from " + f.Stage.RefName
+	}
+	if len(f.After) > 0 {
+		s += "; after " + strings.Join(f.After, ", ")
+	}
+
+	return s
+}
+
 // WriteCalls emits C code: a list of function prototypes corresponding to the
 // provided slice of stage functions.
 func WritePrototypes(sortedFns []StageFunc, w io.Writer) {
@@ -174,7 +426,7 @@ func WriteCalls(sortedFuncs []StageFunc, argList string, w io.Writer) {
 		}
 
 		fmt.Fprintf(w, "    /* %d.%d: %s (%s) */\n",
-			intStage, dupCount, f.Name, f.Pkg.Name())
+			intStage, dupCount, f.Name, f.provenance())
 		fmt.Fprintf(w, "    %s(%s);\n", f.Name, argList)
 	}
 }
@@ -202,7 +454,7 @@ func WriteArr(sortedFuncs []StageFunc, w io.Writer) {
 		}
 
 		fmt.Fprintf(w, "    /* %d.%d: %s (%s) */\n",
-			intStage, dupCount, f.Name, f.Pkg.Name())
+			intStage, dupCount, f.Name, f.provenance())
 		fmt.Fprintf(w, "    %s,\n", f.Name)
 	}
 	fmt.Fprintf(w, "\n")
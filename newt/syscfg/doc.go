@@ -0,0 +1,193 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Generates reference documentation for the settings in a resolved syscfg.
+
+package syscfg
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const (
+	DOC_FORMAT_MARKDOWN = "md"
+	DOC_FORMAT_HTML     = "html"
+)
+
+// docEntry is the documented form of a single setting.
+type docEntry struct {
+	Name        string
+	Description string
+	Type        string
+	Default     string
+	Value       string
+	SetBy       string
+	Notes       []string
+}
+
+func newDocEntry(entry CfgEntry) docEntry {
+	de := docEntry{
+		Name:        entry.Name,
+		Description: strings.Join(strings.Fields(entry.Description), " "),
+		Type:        entry.SettingType.String(),
+		Value:       entry.Value,
+	}
+
+	if len(entry.History) > 0 {
+		de.Default = entry.History[0].Value
+		de.SetBy = mostRecentPoint(entry).Name()
+	}
+
+	if entry.ValueRefName != "" {
+		de.Notes = append(de.Notes, "copied from "+entry.ValueRefName)
+	}
+	if entry.ValidChoices != nil {
+		de.Notes = append(de.Notes,
+			"choices: "+strings.Join(entry.ValidChoices, ", "))
+	}
+	for _, r := range entry.Restrictions {
+		if r.Expr != "" {
+			de.Notes = append(de.Notes, "restriction: "+r.Expr)
+		}
+	}
+	switch entry.State {
+	case CFG_SETTING_STATE_DEPRECATED:
+		de.Notes = append(de.Notes, "deprecated")
+	case CFG_SETTING_STATE_DEFUNCT:
+		de.Notes = append(de.Notes, "defunct")
+	}
+
+	return de
+}
+
+// docEntriesByPkg groups the documented settings by defining package.  Both
+// the package names and each package's settings are sorted.
+func docEntriesByPkg(cfg Cfg) ([]string, map[string][]docEntry) {
+	pkgEntries := EntriesByPkg(cfg)
+
+	pkgNames := make([]string, 0, len(pkgEntries))
+	docMap := make(map[string][]docEntry, len(pkgEntries))
+	for pkgName, entries := range pkgEntries {
+		pkgNames = append(pkgNames, pkgName)
+
+		des := make([]docEntry, len(entries))
+		for i, entry := range entries {
+			des[i] = newDocEntry(entry)
+		}
+		sort.Slice(des, func(i int, j int) bool {
+			return des[i].Name < des[j].Name
+		})
+		docMap[pkgName] = des
+	}
+	sort.Strings(pkgNames)
+
+	return pkgNames, docMap
+}
+
+func mdEscape(s string) string {
+	s = strings.Replace(s, "|", "\\|", -1)
+	s = strings.Replace(s, "`", "\\`", -1)
+	s = strings.Replace(s, "<", "&lt;", -1)
+	return strings.Replace(s, ">", "&gt;", -1)
+}
+
+func writeMarkdownDoc(cfg Cfg, targetName string, w io.Writer) {
+	pkgNames, docMap := docEntriesByPkg(cfg)
+
+	fmt.Fprintf(w, "# System configuration: %s\n", mdEscape(targetName))
+
+	for _, pkgName := range pkgNames {
+		fmt.Fprintf(w, "\n## %s\n\n", mdEscape(pkgName))
+		fmt.Fprintf(w, "| Setting | Description | Type | Default | "+
+			"Value | Set by | Notes |\n")
+		fmt.Fprintf(w, "|---|---|---|---|---|---|---|\n")
+
+		for _, de := range docMap[pkgName] {
+			fmt.Fprintf(w, "| `%s` | %s | %s | %s | %s | %s | %s |\n",
+				de.Name,
+				mdEscape(de.Description),
+				de.Type,
+				mdEscape(de.Default),
+				mdEscape(de.Value),
+				mdEscape(de.SetBy),
+				mdEscape(strings.Join(de.Notes, "; ")))
+		}
+	}
+}
+
+func writeHtmlDoc(cfg Cfg, targetName string, w io.Writer) {
+	pkgNames, docMap := docEntriesByPkg(cfg)
+
+	title := html.EscapeString("System configuration: " + targetName)
+
+	fmt.Fprintf(w, "<!DOCTYPE html>\n")
+	fmt.Fprintf(w, "<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(w, "<title>%s</title>\n</head>\n<body>\n", title)
+	fmt.Fprintf(w, "<h1>%s</h1>\n", title)
+
+	for _, pkgName := range pkgNames {
+		fmt.Fprintf(w, "<h2>%s</h2>\n", html.EscapeString(pkgName))
+		fmt.Fprintf(w, "<table>\n<tr><th>Setting</th><th>Description</th>"+
+			"<th>Type</th><th>Default</th><th>Value</th><th>Set by</th>"+
+			"<th>Notes</th></tr>\n")
+
+		for _, de := range docMap[pkgName] {
+			fmt.Fprintf(w, "<tr><td><code>%s</code></td><td>%s</td>"+
+				"<td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td>"+
+				"</tr>\n",
+				html.EscapeString(de.Name),
+				html.EscapeString(de.Description),
+				html.EscapeString(de.Type),
+				html.EscapeString(de.Default),
+				html.EscapeString(de.Value),
+				html.EscapeString(de.SetBy),
+				html.EscapeString(strings.Join(de.Notes, "; ")))
+		}
+
+		fmt.Fprintf(w, "</table>\n")
+	}
+
+	fmt.Fprintf(w, "</body>\n</html>\n")
+}
+
+// WriteDoc writes reference documentation for every setting in the
+// specified syscfg.  For each setting, the documentation lists its
+// description, type, default value, current value, and the package (or
+// target) that set the current value.  The format is one of
+// DOC_FORMAT_MARKDOWN or DOC_FORMAT_HTML.
+func WriteDoc(cfg Cfg, targetName string, format string, w io.Writer) error {
+	switch format {
+	case DOC_FORMAT_MARKDOWN:
+		writeMarkdownDoc(cfg, targetName, w)
+	case DOC_FORMAT_HTML:
+		writeHtmlDoc(cfg, targetName, w)
+	default:
+		return util.FmtNewtError(
+			"invalid documentation format: \"%s\"; must be one of: %s, %s",
+			format, DOC_FORMAT_MARKDOWN, DOC_FORMAT_HTML)
+	}
+
+	return nil
+}
@@ -29,6 +29,9 @@ var cfgSettingNameTypeMap = map[string]CfgSettingType{
 	"raw":           CFG_SETTING_TYPE_RAW,
 	"task_priority": CFG_SETTING_TYPE_TASK_PRIO,
 	"flash_owner":   CFG_SETTING_TYPE_FLASH_OWNER,
+	"bool":          CFG_SETTING_TYPE_BOOL,
+	"int":           CFG_SETTING_TYPE_INT,
+	"string":        CFG_SETTING_TYPE_STRING,
 }
 
 var cfgSettingNameStateMap = map[string]CfgSettingState{
@@ -39,11 +39,16 @@ import (
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/parse"
 	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/ycfg"
 	"mynewt.apache.org/newt/util"
 )
 
 const HEADER_PATH = "syscfg/syscfg.h"
 
+// The resolution report lists each setting's final value and the packages
+// that defined and overrode it.
+const REPORT_FILENAME = "syscfg-report.txt"
+
 const SYSCFG_PREFIX_SETTING = "MYNEWT_VAL_"
 
 type CfgSettingType int
@@ -53,6 +58,11 @@ const (
 	CFG_SETTING_TYPE_TASK_PRIO
 	CFG_SETTING_TYPE_INTERRUPT_PRIO
 	CFG_SETTING_TYPE_FLASH_OWNER
+
+	// Typed settings: newt verifies that the value has the correct form.
+	CFG_SETTING_TYPE_BOOL
+	CFG_SETTING_TYPE_INT
+	CFG_SETTING_TYPE_STRING
 )
 
 type CfgSettingState int
@@ -81,6 +91,14 @@ var cfgChoiceValRe = regexp.MustCompile("^[A-Za-z0-9_]+$")
 type CfgPoint struct {
 	Value  string
 	Source *pkg.LocalPackage
+
+	// The file that specified the value.  This is usually the source
+	// package's syscfg.yml, but a target's values can also come from a base
+	// target or an override file.  Empty if unknown.
+	Path string
+
+	// Set on the newt command line (e.g., "newt build -DFOO=1").
+	CmdLine bool
 }
 
 type CfgDeprecatedPoint struct {
@@ -107,6 +125,15 @@ type CfgPriority struct {
 	PackageSrc  *pkg.LocalPackage // package overriding setting value.
 }
 
+// A value that a package assigns to a setting under a particular condition.
+type CfgConflictPoint struct {
+	Value  string
+	Source *pkg.LocalPackage
+
+	// The conditional key the value is specified under.
+	Expr string
+}
+
 type CfgFlashConflict struct {
 	SettingNames []string
 	Code         CfgFlashConflictCode
@@ -126,6 +153,10 @@ type Cfg struct {
 	// values; not overridden by higher priority package.
 	Ambiguities map[string][]CfgPoint
 
+	// A single package sets a setting to different values under conditional
+	// keys that are all true.
+	Conflicts map[string][]CfgConflictPoint
+
 	// Setting-level restrictions not met.
 	SettingViolations map[string][]CfgRestriction
 
@@ -150,6 +181,14 @@ type Cfg struct {
 
 	// Unresolved value references
 	UnresolvedValueRefs map[string]struct{}
+
+	// Values that don't match their setting's type ([setting-name] =>
+	// reason).
+	TypeViolations map[string]string
+
+	// Command line overrides of settings that no package defines
+	// ([setting-name] => value).
+	UndefinedOverrides map[string]string
 }
 
 func NewCfg() Cfg {
@@ -158,6 +197,7 @@ func NewCfg() Cfg {
 		PackageRestrictions: map[string][]CfgRestriction{},
 		Orphans:             map[string][]CfgPoint{},
 		Ambiguities:         map[string][]CfgPoint{},
+		Conflicts:           map[string][]CfgConflictPoint{},
 		SettingViolations:   map[string][]CfgRestriction{},
 		PackageViolations:   map[string][]CfgRestriction{},
 		PriorityViolations:  []CfgPriority{},
@@ -166,6 +206,8 @@ func NewCfg() Cfg {
 		Deprecated:          map[string]struct{}{},
 		Defunct:             map[string]struct{}{},
 		UnresolvedValueRefs: map[string]struct{}{},
+		TypeViolations:      map[string]string{},
+		UndefinedOverrides:  map[string]string{},
 	}
 }
 
@@ -267,13 +309,50 @@ func (cfg *Cfg) AllSettingsForLpkg(lpkg *pkg.LocalPackage) map[string]string {
 }
 
 func (point CfgPoint) Name() string {
-	if point.Source == nil {
+	if point.CmdLine {
+		return "command line"
+	} else if point.Source == nil {
 		return "newt"
 	} else {
 		return point.Source.FullName()
 	}
 }
 
+// Provenance describes where a point's value comes from: the yml file and
+// priority level that produced it.
+func (point CfgPoint) Provenance() string {
+	if point.CmdLine {
+		return "newt command line"
+	} else if point.Source == nil {
+		return "newt (injected)"
+	} else {
+		return fmt.Sprintf("%s (priority: %s)", point.relativePath(),
+			priorityName(point.Source.Type()))
+	}
+}
+
+// relativePath produces the path of the file that specified a point's value,
+// in a form that is the same on every machine.
+func (point CfgPoint) relativePath() string {
+	if point.Path == "" {
+		return point.Source.RelativeFilePath(pkg.SYSCFG_YAML_FILENAME)
+	}
+
+	rel, err := filepath.Rel(point.Source.BasePath(), point.Path)
+	if err == nil && !strings.HasPrefix(rel, "..") {
+		return point.Source.RelativeFilePath(filepath.ToSlash(rel))
+	}
+
+	// A base target or an override file; report the path relative to the
+	// project.
+	rel, err = filepath.Rel(interfaces.GetProject().Path(), point.Path)
+	if err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+
+	return point.Path
+}
+
 func (point CfgPoint) IsInjected() bool {
 	return point.Source == nil
 }
@@ -282,9 +361,11 @@ func (entry *CfgEntry) IsTrue() bool {
 	return parse.ValueIsTrue(entry.Value)
 }
 
-func (entry *CfgEntry) appendValue(lpkg *pkg.LocalPackage, value interface{}) {
+func (entry *CfgEntry) appendValue(lpkg *pkg.LocalPackage, value interface{},
+	path string) {
+
 	strval := stringValue(value)
-	point := CfgPoint{Value: strval, Source: lpkg}
+	point := CfgPoint{Value: strval, Source: lpkg, Path: path}
 	entry.History = append(entry.History, point)
 	entry.Value = strval
 }
@@ -365,11 +446,23 @@ func (entry *CfgEntry) ambiguityText() string {
 
 		str += p.Source.FullName()
 	}
-	str += "]"
+	str += "]\n"
+
+	for _, p := range points {
+		str += fmt.Sprintf("        %s (priority: %s): %s\n",
+			util.TryRelPath(p.Source.SyscfgYamlPath()),
+			priorityName(p.Source.Type()), p.Value)
+	}
 
 	return str
 }
 
+// priorityName returns the name of the priority level that a package of the
+// specified type overrides settings at.
+func priorityName(typ interfaces.PackageType) string {
+	return pkg.PackageTypeNames[normalizePkgType(typ)]
+}
+
 // Detects all priority violations in an entry and returns them in a slice.
 func (entry *CfgEntry) priorityViolations() []CfgPriority {
 	var violations []CfgPriority
@@ -455,7 +548,7 @@ func readSetting(name string, lpkg *pkg.LocalPackage,
 				"setting %s specifies invalid type: %s", name, typename)
 		}
 	}
-	entry.appendValue(lpkg, entry.Value)
+	entry.appendValue(lpkg, entry.Value, "")
 
 	entry.Restrictions = []CfgRestriction{}
 	restrictionStrings := cast.ToStringSlice(vals["restrictions"])
@@ -588,11 +681,12 @@ func (cfg *Cfg) readDefsOnce(lpkg *pkg.LocalPackage,
 
 // Records an orphan override error (override of undefined setting).
 func (cfg *Cfg) addOrphan(settingName string, value string,
-	lpkg *pkg.LocalPackage) {
+	lpkg *pkg.LocalPackage, path string) {
 
 	cfg.Orphans[settingName] = append(cfg.Orphans[settingName], CfgPoint{
 		Value:  value,
 		Source: lpkg,
+		Path:   path,
 	})
 }
 
@@ -621,8 +715,20 @@ func (cfg *Cfg) readValsOnce(lpkg *pkg.LocalPackage,
 
 	lsettings := cfg.settingsForLpkg(lpkg, settings)
 
-	values := yc.GetValStringMap("syscfg.vals", lsettings)
-	for k, v := range values {
+	cfg.detectConflicts(lpkg, yc.Get("syscfg.vals", lsettings))
+
+	values := yc.GetStringMap("syscfg.vals", lsettings)
+	for k, ye := range values {
+		v := ye.Value
+		if v == nil {
+			continue
+		}
+
+		path := ""
+		if ye.FileInfo != nil {
+			path = ye.FileInfo.Path
+		}
+
 		switch v.(type) {
 		case map[interface{}]interface{}, []interface{}:
 			return util.FmtNewtError("Package \"%s\" contains invalid "+
@@ -634,10 +740,10 @@ func (cfg *Cfg) readValsOnce(lpkg *pkg.LocalPackage,
 
 		entry, ok := cfg.Settings[k]
 		if ok {
-			entry.appendValue(lpkg, v)
+			entry.appendValue(lpkg, v, path)
 			cfg.Settings[k] = entry
 		} else {
-			cfg.addOrphan(k, stringValue(v), lpkg)
+			cfg.addOrphan(k, stringValue(v), lpkg, path)
 		}
 
 		switch entry.State {
@@ -651,6 +757,41 @@ func (cfg *Cfg) readValsOnce(lpkg *pkg.LocalPackage,
 	return nil
 }
 
+// detectConflicts records each setting that a package's "syscfg.vals" map
+// assigns different values under conditional keys that are all true.  A
+// conditional value always replaces an unconditional one, but when two
+// conditional values disagree, which one takes effect is unspecified.
+func (cfg *Cfg) detectConflicts(lpkg *pkg.LocalPackage,
+	entries []ycfg.YCfgEntry) {
+
+	pointMap := map[string][]CfgConflictPoint{}
+	for _, e := range entries {
+		if e.Expr == nil {
+			continue
+		}
+
+		for k, v := range cast.ToStringMap(e.Value) {
+			pointMap[k] = append(pointMap[k], CfgConflictPoint{
+				Value:  stringValue(v),
+				Source: lpkg,
+				Expr:   e.Expr.String(),
+			})
+		}
+	}
+
+	for k, points := range pointMap {
+		for _, p := range points[1:] {
+			if p.Value != points[0].Value {
+				sort.Slice(points, func(i int, j int) bool {
+					return points[i].Expr < points[j].Expr
+				})
+				cfg.Conflicts[k] = append(cfg.Conflicts[k], points...)
+				break
+			}
+		}
+	}
+}
+
 func (cfg *Cfg) Log() {
 	keys := make([]string, len(cfg.Settings))
 	i := 0
@@ -708,7 +849,7 @@ func (cfg *Cfg) DeletePkg(lpkg *pkg.LocalPackage) {
 			// become orphans.
 			for i := 1; i < len(entry.History); i++ {
 				p := entry.History[i]
-				cfg.addOrphan(name, stringValue(p.Value), p.Source)
+				cfg.addOrphan(name, stringValue(p.Value), p.Source, p.Path)
 			}
 			delete(cfg.Settings, name)
 		} else {
@@ -774,6 +915,70 @@ func (cfg *Cfg) detectViolations() {
 	}
 }
 
+// typeViolation checks a setting's value against its type.  It returns a
+// description of the problem, or "" if the value is valid.  An empty value
+// (i.e., an undefined setting) is valid for every type.
+func (entry *CfgEntry) typeViolation() string {
+	val := entry.Value
+	if val == "" {
+		return ""
+	}
+
+	switch entry.SettingType {
+	case CFG_SETTING_TYPE_BOOL:
+		switch strings.ToLower(val) {
+		case "0", "1", "true", "false":
+			return ""
+		}
+		return fmt.Sprintf("value \"%s\" is not a bool (0, 1, true, or "+
+			"false)", val)
+
+	case CFG_SETTING_TYPE_INT:
+		// Allow C integer suffixes (e.g., 0x20000000UL).
+		digits := strings.TrimRight(val, "uUlL")
+		if _, err := strconv.ParseInt(digits, 0, 64); err == nil {
+			return ""
+		}
+		if _, err := strconv.ParseUint(digits, 0, 64); err == nil {
+			return ""
+		}
+		return fmt.Sprintf("value \"%s\" is not an integer", val)
+
+	case CFG_SETTING_TYPE_STRING:
+		if len(val) >= 2 && strings.HasPrefix(val, "\"") &&
+			strings.HasSuffix(val, "\"") {
+
+			return ""
+		}
+		return fmt.Sprintf("value %s is not a quoted C string", val)
+
+	default:
+		return ""
+	}
+}
+
+// headerValue returns the setting's value as it appears in the generated
+// header.  Bool settings are normalized to 0 or 1.
+func (entry *CfgEntry) headerValue() string {
+	if entry.SettingType == CFG_SETTING_TYPE_BOOL && entry.Value != "" {
+		if parse.ValueIsTrue(entry.Value) {
+			return "1"
+		}
+		return "0"
+	}
+
+	return entry.Value
+}
+
+// Detects all type violations in the syscfg and records them internally.
+func (cfg *Cfg) detectTypeViolations() {
+	for name, entry := range cfg.Settings {
+		if reason := entry.typeViolation(); reason != "" {
+			cfg.TypeViolations[name] = reason
+		}
+	}
+}
+
 // Detects all priority violations in the syscfg and records them internally.
 func (cfg *Cfg) detectPriorityViolations() {
 	for _, entry := range cfg.Settings {
@@ -941,6 +1146,27 @@ func (cfg *Cfg) ErrorText() string {
 		}
 	}
 
+	// Conflicting values within a package.
+	if len(cfg.Conflicts) > 0 {
+		str += "Syscfg conflicts detected (a package sets a setting to " +
+			"different values under conditions that are all true):\n"
+
+		settingNames := make([]string, 0, len(cfg.Conflicts))
+		for k, _ := range cfg.Conflicts {
+			settingNames = append(settingNames, k)
+		}
+		sort.Strings(settingNames)
+
+		for _, name := range settingNames {
+			str += fmt.Sprintf("    Setting: %s\n", name)
+			for _, p := range cfg.Conflicts[name] {
+				str += fmt.Sprintf("        %s (priority: %s, if %s): %s\n",
+					util.TryRelPath(p.Source.SyscfgYamlPath()),
+					priorityName(p.Source.Type()), p.Expr, p.Value)
+			}
+		}
+	}
+
 	// Priority violation errors.
 	if len(cfg.PriorityViolations) > 0 {
 		str += "Priority violations detected (Packages can only override " +
@@ -979,6 +1205,40 @@ func (cfg *Cfg) ErrorText() string {
 		}
 	}
 
+	// Command line overrides of undefined settings.
+	if len(cfg.UndefinedOverrides) > 0 {
+		str += "Command line overrides of undefined settings:\n"
+
+		settingNames := make([]string, 0, len(cfg.UndefinedOverrides))
+		for k, _ := range cfg.UndefinedOverrides {
+			settingNames = append(settingNames, k)
+		}
+		sort.Strings(settingNames)
+
+		for _, name := range settingNames {
+			str += fmt.Sprintf("    %s=%s\n", name,
+				cfg.UndefinedOverrides[name])
+		}
+	}
+
+	// Type violations.
+	if len(cfg.TypeViolations) > 0 {
+		str += "Syscfg type violations detected:\n"
+
+		settingNames := make([]string, 0, len(cfg.TypeViolations))
+		for k, _ := range cfg.TypeViolations {
+			settingNames = append(settingNames, k)
+		}
+		sort.Strings(settingNames)
+
+		for _, name := range settingNames {
+			entry := cfg.Settings[name]
+			str += fmt.Sprintf("    %s (type %s): %s\n", name,
+				entry.SettingType.String(), cfg.TypeViolations[name])
+			historyMap[name] = entry.History
+		}
+	}
+
 	// Unresolved value references
 	if len(cfg.UnresolvedValueRefs) > 0 {
 		str += "Unresolved value references:\n"
@@ -1053,7 +1313,7 @@ func normalizePkgType(typ interfaces.PackageType) interfaces.PackageType {
 		return pkg.PACKAGE_TYPE_TARGET
 	case pkg.PACKAGE_TYPE_APP:
 		return pkg.PACKAGE_TYPE_APP
-	case pkg.PACKAGE_TYPE_UNITTEST:
+	case pkg.PACKAGE_TYPE_UNITTEST, pkg.PACKAGE_TYPE_FUZZ:
 		return pkg.PACKAGE_TYPE_UNITTEST
 	case pkg.PACKAGE_TYPE_BSP:
 		return pkg.PACKAGE_TYPE_BSP
@@ -1107,6 +1367,29 @@ func (cfg *Cfg) readValsForPkgType(lpkgs []*pkg.LocalPackage,
 	return nil
 }
 
+// applyOverrides applies the settings specified on the newt command line.
+// These take precedence over the values specified by every package.
+func (cfg *Cfg) applyOverrides(overrides map[string]string,
+	settings map[string]string) {
+
+	for k, v := range overrides {
+		entry, ok := cfg.Settings[k]
+		if !ok {
+			cfg.UndefinedOverrides[k] = v
+			continue
+		}
+
+		entry.History = append(entry.History, CfgPoint{
+			Value:   v,
+			CmdLine: true,
+		})
+		entry.Value = v
+		cfg.Settings[k] = entry
+
+		settings[k] = v
+	}
+}
+
 func (cfg *Cfg) detectAmbiguities() {
 	for _, entry := range cfg.Settings {
 		if points := entry.ambiguities(); len(points) > 0 {
@@ -1122,11 +1405,12 @@ func (cfg *Cfg) DetectErrors(flashMap flashmap.FlashMap) {
 	cfg.detectViolations()
 	cfg.detectPriorityViolations()
 	cfg.detectFlashConflicts(flashMap)
+	cfg.detectTypeViolations()
 }
 
 func Read(lpkgs []*pkg.LocalPackage, apis []string,
-	injectedSettings map[string]string, settings map[string]string,
-	flashMap flashmap.FlashMap) (Cfg, error) {
+	injectedSettings map[string]string, overrides map[string]string,
+	settings map[string]string, flashMap flashmap.FlashMap) (Cfg, error) {
 
 	cfg := NewCfg()
 	for k, v := range injectedSettings {
@@ -1178,6 +1462,8 @@ func Read(lpkgs []*pkg.LocalPackage, apis []string,
 		}
 	}
 
+	cfg.applyOverrides(overrides, settings)
+
 	for _, lpkg := range lpkgs {
 		if err := cfg.readRestrictions(lpkg, settings); err != nil {
 			return cfg, err
@@ -1287,9 +1573,12 @@ func writeCheckMacros(w io.Writer) {
 
 func writeComment(entry CfgEntry, w io.Writer) {
 	if len(entry.History) > 1 {
-		fmt.Fprintf(w, "/* Overridden by %s (defined by %s) */\n",
-			mostRecentPoint(entry).Name(),
-			entry.History[0].Name())
+		fmt.Fprintf(w, "/* Overridden by %s; defined by %s */\n",
+			mostRecentPoint(entry).Provenance(),
+			entry.History[0].Provenance())
+	} else {
+		fmt.Fprintf(w, "/* Defined by %s */\n",
+			entry.History[0].Provenance())
 	}
 	if len(entry.ValueRefName) > 1 {
 		fmt.Fprintf(w, "/* Value copied from %s */\n",
@@ -1362,7 +1651,7 @@ func writeSettingsOnePkg(cfg Cfg, pkgName string, pkgEntries []CfgEntry,
 		if entry.ValidChoices != nil {
 			writeChoiceDefine(settingName(n), entry.Value, entry.ValidChoices, w)
 		} else {
-			writeDefine(settingName(n), entry.Value, w)
+			writeDefine(settingName(n), entry.headerValue(), w)
 		}
 	}
 }
@@ -1435,6 +1724,79 @@ func EnsureWritten(cfg Cfg, includeDir string) error {
 	return nil
 }
 
+// writeReport writes the resolution report: each setting's final value,
+// followed by the package that defined it and each package that overrode it.
+func writeReport(cfg Cfg, w io.Writer) {
+	fmt.Fprintf(w, "# Syscfg resolution report.  Generated by newt; "+
+		"do not edit.\n")
+	fmt.Fprintf(w, "#\n")
+	fmt.Fprintf(w, "# <setting> = <value> (<type>)\n")
+	fmt.Fprintf(w, "#     defined by <package>: <value>\n")
+	fmt.Fprintf(w, "#     overridden by <package>: <value>\n")
+
+	names := make([]string, 0, len(cfg.Settings))
+	for name, _ := range cfg.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := cfg.Settings[name]
+
+		val := entry.Value
+		if val == "" {
+			val = "(undefined)"
+		}
+		fmt.Fprintf(w, "\n%s = %s (%s)\n", name, val,
+			entry.SettingType.String())
+
+		for i, p := range entry.History {
+			verb := "overridden by"
+			if i == 0 {
+				verb = "defined by"
+			}
+			fmt.Fprintf(w, "    %s %s: %s\n", verb, p.Name(), p.Value)
+		}
+		if entry.ValueRefName != "" {
+			fmt.Fprintf(w, "    value copied from %s\n", entry.ValueRefName)
+		}
+		for _, r := range entry.Restrictions {
+			fmt.Fprintf(w, "    restriction: %s\n", r.Expr)
+		}
+		if entry.ValidChoices != nil {
+			fmt.Fprintf(w, "    choices: %s\n",
+				strings.Join(entry.ValidChoices, ", "))
+		}
+	}
+}
+
+// EnsureReportWritten writes the resolution report to the specified
+// directory if it has changed.
+func EnsureReportWritten(cfg Cfg, dir string) error {
+	buf := bytes.Buffer{}
+	writeReport(cfg, &buf)
+
+	path := dir + "/" + REPORT_FILENAME
+
+	writeReqd, err := util.FileContentsChanged(path, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if !writeReqd {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return util.NewNewtError(err.Error())
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return util.NewNewtError(err.Error())
+	}
+
+	return nil
+}
+
 func KeyValueFromStr(str string) (map[string]string, error) {
 	vals := map[string]string{}
 
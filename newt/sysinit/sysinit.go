@@ -31,12 +31,16 @@ import (
 )
 
 type SysinitCfg struct {
-	// Sorted in call order (stage-num,function-name).
+	// Sorted in call order (stage-num,dependencies,function-name).
 	StageFuncs []stage.StageFunc
 
 	// Strings describing errors encountered while parsing the sysinit config.
 	InvalidSettings []string
 
+	// Strings describing unknown dependencies, dependency cycles, and stage
+	// conflicts that prevent the functions from being ordered.
+	OrderErrors []string
+
 	// Contains sets of entries with conflicting function names.
 	//     [function-name] => <slice-of-stages-with-function-name>
 	Conflicts map[string][]stage.StageFunc
@@ -45,8 +49,8 @@ type SysinitCfg struct {
 func (scfg *SysinitCfg) readOnePkg(lpkg *pkg.LocalPackage, cfg *syscfg.Cfg) {
 	settings := cfg.AllSettingsForLpkg(lpkg)
 	initMap := lpkg.InitFuncs(settings)
-	for name, stageStr := range initMap {
-		sf, err := stage.NewStageFunc(name, stageStr, lpkg, cfg)
+	for name, specs := range initMap {
+		sf, err := stage.NewStageFuncDeps(name, specs, lpkg, cfg)
 		if err != nil {
 			scfg.InvalidSettings = append(scfg.InvalidSettings, err.Error())
 		} else {
@@ -81,7 +85,7 @@ func Read(lpkgs []*pkg.LocalPackage, cfg *syscfg.Cfg) SysinitCfg {
 	}
 
 	scfg.detectConflicts()
-	stage.SortStageFuncs(scfg.StageFuncs, "sysinit")
+	scfg.OrderErrors = stage.OrderStageFuncs(scfg.StageFuncs, "sysinit")
 
 	return scfg
 }
@@ -129,6 +133,19 @@ func (scfg *SysinitCfg) ErrorText() string {
 			"to each entry."
 	}
 
+	if len(scfg.OrderErrors) > 0 {
+		if str != "" {
+			str += "\n"
+		}
+		str += "Sysinit ordering errors detected:"
+		for _, e := range scfg.OrderErrors {
+			str += "\n    " + e
+		}
+
+		str += "\n\nResolve the problem by correcting the stages or " +
+			"\"$after:\" dependencies of the listed functions."
+	}
+
 	return str
 }
 
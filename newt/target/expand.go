@@ -0,0 +1,278 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package target
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"mynewt.apache.org/newt/newt/config"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/ycfg"
+	"mynewt.apache.org/newt/util"
+)
+
+// Variable expansion.  Target settings can refer to properties of the target
+// with the `${NAME}` syntax:
+//
+//     target.yml:
+//         target.bsp: "@apache-mynewt-core/hw/bsp/${TARGET_NAME}"
+//         target.key_file: "keys/${BSP}-${BUILD_PROFILE}.pem"
+//
+//     pkg.yml:
+//         pkg.cflags:
+//             - -DBOARD_${BSP}
+//             - -I${ARCH}/include
+//
+// The supported variables are:
+//
+//     TARGET          Full name of the target (e.g., "targets/my_blinky").
+//     TARGET_NAME     Last element of the target name (e.g., "my_blinky").
+//     BSP             Last element of the BSP package name.
+//     APP             Last element of the app package name.
+//     LOADER          Last element of the loader package name.
+//     BUILD_PROFILE   The target's build profile.
+//     ARCH            The architecture of the target's BSP (bsp.arch).
+//
+// The BSP, app, and loader names can only refer to TARGET and TARGET_NAME.
+// Only the `${NAME}` form is expanded; a plain `$NAME` is left alone so that
+// flags like `-Wl,-rpath,$ORIGIN` are unaffected.
+
+var targetVarRe = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+// The `pkg.yml` lists that are subject to variable expansion.
+var expandedPkgLists = []string{
+	"pkg.cflags",
+	"pkg.cxxflags",
+	"pkg.lflags",
+	"pkg.aflags",
+}
+
+// varLookup returns the value of a single target variable.  The ARCH
+// variable is determined lazily, as it requires reading the BSP's `bsp.yml`
+// file.
+func (target *Target) varLookup(name string) (string, bool) {
+	switch name {
+	case "TARGET":
+		return target.FullName(), true
+
+	case "TARGET_NAME":
+		return target.ShortName(), true
+
+	case "BSP":
+		return filepath.Base(target.BspName), target.BspName != ""
+
+	case "APP":
+		return filepath.Base(target.AppName), target.AppName != ""
+
+	case "LOADER":
+		return filepath.Base(target.LoaderName), target.LoaderName != ""
+
+	case "BUILD_PROFILE":
+		return target.BuildProfile, target.BuildProfile != ""
+
+	case "ARCH":
+		if target.arch == "" {
+			target.arch = target.readArch()
+		}
+		return target.arch, target.arch != ""
+
+	default:
+		return "", false
+	}
+}
+
+// readArch determines the target's architecture from its BSP.  An empty
+// string is returned if the BSP cannot be read.
+func (target *Target) readArch() string {
+	if target.BspName == "" {
+		return ""
+	}
+
+	bsp := target.resolvePackageName(target.BspName)
+	if bsp == nil {
+		return ""
+	}
+
+	yc, err := config.ReadFile(fmt.Sprintf("%s/%s", bsp.BasePath(),
+		pkg.BSP_YAML_FILENAME))
+	if err != nil {
+		return ""
+	}
+
+	return yc.GetValString("bsp.arch", nil)
+}
+
+// expandVars replaces all `${NAME}` references in a string with the values
+// returned by the specified lookup function.
+func (target *Target) expandVars(s string,
+	lookup func(name string) (string, bool)) (string, error) {
+
+	var err error
+
+	result := targetVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := targetVarRe.FindStringSubmatch(m)[1]
+
+		val, ok := lookup(name)
+		if !ok && err == nil {
+			err = util.FmtNewtError(
+				"target \"%s\": unknown or empty variable \"%s\" in \"%s\"",
+				target.FullName(), m, s)
+		}
+
+		return val
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+// ExpandVars replaces all `${NAME}` references in the specified string with
+// the values of the corresponding target variables.
+//
+// @param s                     The string to expand.
+//
+// @return string               The expanded string.
+// @return error                Error if the string refers to an unknown or
+//                                  empty variable.
+func (target *Target) ExpandVars(s string) (string, error) {
+	return target.expandVars(s, target.varLookup)
+}
+
+// expandSettings expands variable references in the settings that were read
+// from the target's `target.yml` file.
+func (target *Target) expandSettings() error {
+	var err error
+
+	// The package names can only refer to the target itself.
+	nameLookup := func(name string) (string, bool) {
+		if name != "TARGET" && name != "TARGET_NAME" {
+			return "", false
+		}
+		return target.varLookup(name)
+	}
+
+	for _, p := range []*string{
+		&target.BspName, &target.AppName, &target.LoaderName,
+	} {
+		if *p, err = target.expandVars(*p, nameLookup); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range []*string{
+		&target.BuildProfile, &target.KeyFile, &target.EncKeyFile,
+	} {
+		if *p, err = target.ExpandVars(*p); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range [][]string{
+		target.SignKeys, target.GdbScripts, target.GdbCmds,
+	} {
+		for i, v := range s {
+			if s[i], err = target.ExpandVars(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	for k, v := range target.PkgProfiles {
+		if target.PkgProfiles[k], err = target.ExpandVars(v); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range target.Env {
+		if target.Env[k], err = target.ExpandVars(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ApplyVars expands variable references in the target package's flags and
+// syscfg values.  Like ApplyInheritance, this only affects the in-memory copy
+// of the target; it is performed when the target is built and is never
+// saved.
+func (target *Target) ApplyVars() error {
+	if target.varsApplied {
+		return nil
+	}
+	target.varsApplied = true
+
+	pack := target.basePkg
+
+	for _, key := range expandedPkgLists {
+		vals := pack.PkgY.GetValStringSlice(key, nil)
+		if len(vals) == 0 {
+			continue
+		}
+
+		for i, v := range vals {
+			exp, err := target.ExpandVars(v)
+			if err != nil {
+				return err
+			}
+			vals[i] = exp
+		}
+		pack.PkgY.Replace(key, vals)
+	}
+
+	// Expand the syscfg values in place so that conditional blocks and the
+	// file that specified each value are preserved.
+	node := syscfgValsNode(pack.SyscfgY)
+	if node == nil {
+		return nil
+	}
+
+	nodes := []*ycfg.YCfgNode{node}
+	for _, child := range node.Children {
+		nodes = append(nodes, child)
+	}
+
+	for _, n := range nodes {
+		vals, ok := n.Value.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+
+		for k, v := range vals {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+
+			exp, err := target.ExpandVars(s)
+			if err != nil {
+				return err
+			}
+			vals[k] = exp
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,417 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package target
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/config"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/ycfg"
+	"mynewt.apache.org/newt/util"
+)
+
+// Target inheritance.  A target can specify a base target in its `target.yml`
+// file:
+//
+//     target.inherits: "targets/nrf52_base"
+//
+// The target starts with all of its base target's settings and only needs to
+// specify the ones that differ:
+//
+//     * target.yml: Each setting replaces the base target's setting.
+//     * syscfg.yml: Each `syscfg.vals` entry replaces the base target's
+//       entries for the setting.  An entry in a conditional block only
+//       replaces base entries with the same condition.
+//     * pkg.yml: Flags (cflags, cxxflags, lflags, aflags) and deps are
+//       appended to the base target's.
+//
+// A base target can inherit from another target.
+
+const TARGET_INHERITS_KEY = "target.inherits"
+
+// The directory that target names are implicitly relative to.
+const TARGET_DEFAULT_DIR = "targets"
+
+// The `pkg.yml` lists that are accumulated from base targets.
+var inheritedPkgLists = []string{
+	"pkg.cflags",
+	"pkg.cxxflags",
+	"pkg.lflags",
+	"pkg.aflags",
+	"pkg.deps",
+}
+
+// resolveBase finds the target package named by another target's
+// `target.inherits` setting.  The name is relative to the inheriting
+// target's repo; the "targets/" prefix is optional.
+func (target *Target) resolveBase(name string) (*pkg.LocalPackage, error) {
+	pack := target.resolvePackageYmlName(name)
+	if pack == nil && !strings.HasPrefix(name, TARGET_DEFAULT_DIR+"/") {
+		pack = target.resolvePackageYmlName(TARGET_DEFAULT_DIR + "/" + name)
+	}
+
+	if pack == nil {
+		return nil, util.FmtNewtError(
+			"target \"%s\" inherits from unknown target \"%s\"",
+			target.FullName(), name)
+	}
+	if pack.Type() != pkg.PACKAGE_TYPE_TARGET {
+		return nil, util.FmtNewtError(
+			"target \"%s\" inherits from \"%s\", which is not a target",
+			target.FullName(), pack.FullName())
+	}
+
+	return pack, nil
+}
+
+// lineage determines the chain of targets that this target inherits from.
+// The result is ordered from the root-most base target to this target's
+// package.
+func (target *Target) lineage() ([]*pkg.LocalPackage, error) {
+	packs := []*pkg.LocalPackage{target.basePkg}
+	seen := map[string]struct{}{target.basePkg.FullName(): struct{}{}}
+
+	cur := target
+	yc := target.TargetY
+	for {
+		baseName := yc.GetValString(TARGET_INHERITS_KEY, nil)
+		if baseName == "" {
+			break
+		}
+
+		base, err := cur.resolveBase(baseName)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := seen[base.FullName()]; ok {
+			chain := make([]string, len(packs))
+			for i, p := range packs {
+				chain[i] = p.FullName()
+			}
+			return nil, util.FmtNewtError(
+				"target inheritance cycle: %s -> %s",
+				strings.Join(chain, " -> "), base.FullName())
+		}
+		seen[base.FullName()] = struct{}{}
+
+		packs = append([]*pkg.LocalPackage{base}, packs...)
+
+		cur = &Target{basePkg: base}
+		yc, err = config.ReadFile(cur.TargetYamlPath())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return packs, nil
+}
+
+// effectiveTargetY produces the target's `target.yml` settings with all
+// inherited settings applied.
+func effectiveTargetY(lineage []*pkg.LocalPackage) (ycfg.YCfg, error) {
+	path := fmt.Sprintf("%s/%s", lineage[0].BasePath(), TARGET_FILENAME)
+	yc, err := config.ReadFile(path)
+	if err != nil {
+		return yc, err
+	}
+
+	for _, pack := range lineage[1:] {
+		path := fmt.Sprintf("%s/%s", pack.BasePath(), TARGET_FILENAME)
+		if err := config.ApplyOverrideFile(&yc, path); err != nil {
+			return yc, err
+		}
+	}
+
+	return yc, nil
+}
+
+// Inherits indicates whether the target inherits from another target.
+func (target *Target) Inherits() bool {
+	return len(target.basePkgs) > 0
+}
+
+// BaseTargets lists the full names of the targets that this target inherits
+// from, nearest first.
+func (target *Target) BaseTargets() []string {
+	names := make([]string, len(target.basePkgs))
+	for i, pack := range target.basePkgs {
+		names[len(names)-1-i] = pack.FullName()
+	}
+
+	return names
+}
+
+// lineageEntry holds the `pkg.yml` and `syscfg.yml` settings that a single
+// target in an inheritance chain, or a single override file, specifies
+// itself.
+type lineageEntry struct {
+	// The target's full name or the override file's path.
+	source  string
+	pkgY    ycfg.YCfg
+	syscfgY ycfg.YCfg
+}
+
+// lineageConfigs reads the target's override files, followed by the
+// configuration files of each target in this target's inheritance chain,
+// root-most first.  The files are read from disk because the in-memory copies
+// of a target's package may already contain merged settings.
+func (target *Target) lineageConfigs() ([]lineageEntry, error) {
+	packs := make([]*pkg.LocalPackage, 0, len(target.basePkgs)+1)
+	packs = append(packs, target.basePkgs...)
+	packs = append(packs, target.basePkg)
+
+	entries, err := target.overrideConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pack := range packs {
+		py, err := config.ReadFile(pack.PkgYamlPath())
+		if err != nil && !util.IsNotExist(err) {
+			return nil, err
+		}
+
+		sy, err := config.ReadFile(pack.SyscfgYamlPath())
+		if err != nil && !util.IsNotExist(err) {
+			return nil, err
+		}
+
+		entries = append(entries, lineageEntry{
+			source:  pack.FullName(),
+			pkgY:    py,
+			syscfgY: sy,
+		})
+	}
+
+	return entries, nil
+}
+
+// SettingEntry is a single value of a list- or map-valued target setting,
+// along with the target that specified it.
+type SettingEntry struct {
+	// The syscfg setting name; empty for list entries.
+	Name string
+
+	Value string
+
+	// The full name of the target, or the path of the override file, that
+	// specified the value.
+	Source string
+}
+
+// SettingEntries lists the individual values of one of the target's
+// list-valued `pkg.yml` settings (e.g., "pkg.cflags") or of its `syscfg.vals`
+// map, including values inherited from base targets.  List entries are
+// returned in the order they are inherited; syscfg entries are sorted by
+// setting name and report the target whose value takes effect.
+func (target *Target) SettingEntries(key string) ([]SettingEntry, error) {
+	lineage, err := target.lineageConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []SettingEntry{}
+
+	if key == "syscfg.vals" {
+		byName := map[string]SettingEntry{}
+		for _, le := range lineage {
+			for k, v := range le.syscfgY.GetValStringMapString(key, nil) {
+				byName[k] = SettingEntry{
+					Name:   k,
+					Value:  v,
+					Source: le.source,
+				}
+			}
+		}
+
+		names := make([]string, 0, len(byName))
+		for k, _ := range byName {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, k := range names {
+			entries = append(entries, byName[k])
+		}
+
+		return entries, nil
+	}
+
+	for _, le := range lineage {
+		for _, v := range le.pkgY.GetValStringSlice(key, nil) {
+			entries = append(entries, SettingEntry{
+				Value:  v,
+				Source: le.source,
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// syscfgValsNode retrieves the `syscfg.vals` node of a syscfg tree.  The
+// node's value holds the unconditional settings; each child holds the
+// settings of one conditional block, keyed by the condition.
+func syscfgValsNode(yc ycfg.YCfg) *ycfg.YCfgNode {
+	node := yc.Tree()["syscfg"]
+	if node == nil {
+		return nil
+	}
+
+	return node.Children["vals"]
+}
+
+// deleteSyscfgVal removes a single setting from a `syscfg.vals` node's map.
+func deleteSyscfgVal(node *ycfg.YCfgNode, name interface{}) {
+	if node == nil {
+		return
+	}
+
+	if m, ok := node.Value.(map[interface{}]interface{}); ok {
+		delete(m, name)
+	}
+	delete(node.KeyFileInfo, cast.ToString(name))
+}
+
+// mergeSyscfgVals merges the `syscfg.vals` settings of one target or override
+// file into the target's syscfg tree.  Conditional blocks are preserved, as is
+// the file that specified each value.  A later unconditional value replaces
+// every earlier value of the setting; a later conditional value only replaces
+// earlier values specified under the same condition.
+func mergeSyscfgVals(dst *ycfg.YCfg, src ycfg.YCfg) error {
+	srcNode := syscfgValsNode(src)
+	if srcNode == nil {
+		return nil
+	}
+
+	merge := func(key string, node *ycfg.YCfgNode,
+		clear func(k interface{})) error {
+
+		m, ok := node.Value.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+
+		for k, v := range m {
+			clear(k)
+
+			fileInfo := node.KeyFileInfo[cast.ToString(k)]
+			if fileInfo == nil {
+				fileInfo = node.FileInfo
+			}
+
+			kv := map[interface{}]interface{}{k: v}
+			if err := dst.MergeFromFile(key, kv, fileInfo); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err := merge("syscfg.vals", srcNode, func(k interface{}) {
+		dstNode := syscfgValsNode(*dst)
+		if dstNode == nil {
+			return
+		}
+
+		deleteSyscfgVal(dstNode, k)
+		for _, child := range dstNode.Children {
+			deleteSyscfgVal(child, k)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for expr, srcChild := range srcNode.Children {
+		expr := expr
+		err := merge("syscfg.vals."+expr, srcChild, func(k interface{}) {
+			if dstNode := syscfgValsNode(*dst); dstNode != nil {
+				deleteSyscfgVal(dstNode.Children[expr], k)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if srcChild.Overwrite {
+			syscfgValsNode(*dst).Children[expr].Overwrite = true
+		}
+	}
+
+	return nil
+}
+
+// ApplyInheritance merges the `syscfg.yml` and `pkg.yml` settings of the
+// target's override files and base targets into the target package.  The
+// merge only affects the in-memory copy of the target; it is performed when
+// the target is built and is never saved.
+func (target *Target) ApplyInheritance() error {
+	if target.inheritanceApplied ||
+		(!target.Inherits() && len(target.Overrides) == 0) {
+
+		return nil
+	}
+	target.inheritanceApplied = true
+
+	lineage, err := target.lineageConfigs()
+	if err != nil {
+		return err
+	}
+
+	// The target's own settings are part of the lineage; rebuild its
+	// `syscfg.vals` tree from scratch.
+	if node := target.basePkg.SyscfgY.Tree()["syscfg"]; node != nil {
+		delete(node.Children, "vals")
+	}
+
+	lists := map[string][]string{}
+	for _, le := range lineage {
+		if err := mergeSyscfgVals(&target.basePkg.SyscfgY,
+			le.syscfgY); err != nil {
+
+			return err
+		}
+
+		for _, key := range inheritedPkgLists {
+			lists[key] = append(lists[key],
+				le.pkgY.GetValStringSlice(key, nil)...)
+		}
+	}
+
+	// A dependency only needs to be listed once, but a repeated flag may be
+	// significant (e.g., "-include").
+	lists["pkg.deps"] = util.UniqueStrings(lists["pkg.deps"])
+
+	for _, key := range inheritedPkgLists {
+		if len(lists[key]) > 0 {
+			target.basePkg.PkgY.Replace(key, lists[key])
+		}
+	}
+
+	return nil
+}
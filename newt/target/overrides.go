@@ -0,0 +1,72 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package target
+
+import (
+	"mynewt.apache.org/newt/newt/config"
+	"mynewt.apache.org/newt/util"
+)
+
+// Override files.  A target can list configuration fragments that are shared
+// among many targets:
+//
+//     target.overrides:
+//         - cfg/debug-logging.yml
+//         - "@my_repo/cfg/low-power.yml"
+//
+// Paths are relative to the project directory unless they begin with a repo
+// name.  A fragment can contain `syscfg.vals` and the `pkg.yml` lists that
+// targets inherit (cflags, cxxflags, lflags, aflags, and deps):
+//
+//     syscfg.vals:
+//         LOG_LEVEL: 0
+//     pkg.cflags:
+//         - -DDEBUG_LOGGING
+//
+// Fragments are merged in the order they are listed, before any base target
+// and before the target's own files.  A later fragment's `syscfg.vals` entry
+// replaces an earlier one's, and the target's own settings replace both.  The
+// override list itself is inherited like any other `target.yml` setting.
+
+const TARGET_OVERRIDES_KEY = "target.overrides"
+
+// overrideConfigs reads the target's override files, in order.
+func (target *Target) overrideConfigs() ([]lineageEntry, error) {
+	entries := make([]lineageEntry, len(target.Overrides))
+	for i, path := range target.Overrides {
+		yc, err := config.ReadFile(path)
+		if err != nil {
+			if util.IsNotExist(err) {
+				return nil, util.FmtNewtError(
+					"target \"%s\": override file \"%s\" does not exist",
+					target.FullName(), path)
+			}
+			return nil, err
+		}
+
+		entries[i] = lineageEntry{
+			source:  path,
+			pkgY:    yc,
+			syscfgY: yc,
+		}
+	}
+
+	return entries, nil
+}
@@ -27,6 +27,7 @@ import (
 
 	"mynewt.apache.org/newt/newt/config"
 	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/repo"
@@ -49,10 +50,76 @@ type Target struct {
 	BuildProfile string
 	HeaderSize   uint32
 	KeyFile      string
+	SignKeys     []string
+	RsaPss       bool
+	EncKeyFile   string
+	ImageVersion string
+	ImageFormat  int
 	PkgProfiles  map[string]string
+	Env          map[string]string
+	Tags         []string
+
+	// The algorithm that app images are compressed with; "" for none.
+	ImageCompression string
+
+	// The debugger backend that loads and debugs the target, overriding the
+	// BSP's; "" for the BSP's scripts.  ProbeId selects one of several
+	// attached probes.
+	Debugger       string
+	PyocdTarget    string
+	ProbeId        string
+	JlinkDevice    string
+	JlinkInterface string
+	JlinkSpeed     string
+
+	// Additional OpenOCD configuration files, appended to the BSP's, and
+	// overrides of the BSP's OpenOCD adapter, transport, and speed (kHz).
+	OpenocdCfg       []string
+	OpenocdAdapter   string
+	OpenocdTransport string
+	OpenocdSpeed     string
+
+	// GDB command files and commands that `newt debug` runs after
+	// connecting to the target.
+	GdbScripts []string
+	GdbCmds    []string
+
+	// Whether debug sessions enable semihosting.
+	Semihosting bool
+
+	// The gdb frontend that debug sessions run: "tui", "gdbgui", or a
+	// command template; "" for command-line gdb.
+	GdbFrontend string
+
+	// The serial port of the board's console; "" to detect it.
+	ConsolePort string
+
+	// Additional output file formats (e.g., "hex", "uf2") and the UF2 family
+	// ID of the target's MCU.
+	OutputFormats []string
+	Uf2FamilyId   uint32
+
+	// Configuration fragments that are merged into the target, in order.
+	Overrides []string
 
 	// target.yml configuration structure
 	TargetY ycfg.YCfg
+
+	// target.yml settings with inherited settings applied.
+	effectiveY ycfg.YCfg
+
+	// Targets this target inherits from, root-most first.
+	basePkgs []*pkg.LocalPackage
+
+	// Whether the base targets' syscfg and pkg settings have been merged.
+	inheritanceApplied bool
+
+	// The BSP's architecture; read on demand for variable expansion.
+	arch string
+
+	// Whether variable references in syscfg and pkg settings have been
+	// expanded.
+	varsApplied bool
 }
 
 func NewTarget(basePkg *pkg.LocalPackage) *Target {
@@ -87,6 +154,20 @@ func (target *Target) Load(basePkg *pkg.LocalPackage) error {
 	}
 
 	target.TargetY = yc
+	target.effectiveY = yc
+
+	lineage, err := target.lineage()
+	if err != nil {
+		return err
+	}
+	target.basePkgs = lineage[:len(lineage)-1]
+	if target.Inherits() {
+		yc, err = effectiveTargetY(lineage)
+		if err != nil {
+			return err
+		}
+		target.effectiveY = yc
+	}
 
 	target.BspName = yc.GetValString("target.bsp", nil)
 	target.AppName = yc.GetValString("target.app", nil)
@@ -107,22 +188,114 @@ func (target *Target) Load(basePkg *pkg.LocalPackage) error {
 	}
 
 	target.KeyFile = yc.GetValString("target.key_file", nil)
-	if target.KeyFile != "" {
-		proj := interfaces.GetProject()
-		path, err := proj.ResolvePath(proj.Path(), target.KeyFile)
-		if err == nil {
-			target.KeyFile = path
+	target.SignKeys = yc.GetValStringSlice("target.sign_keys", nil)
+	target.RsaPss = yc.GetValBool("target.rsa_pss", nil)
+	target.EncKeyFile = yc.GetValString("target.enc_key_file", nil)
+	target.ImageVersion = yc.GetValString("target.image_version", nil)
+	target.ImageCompression = yc.GetValString(
+		"target.image_compression", nil)
+
+	switch f := yc.GetValString("target.image_format", nil); f {
+	case "":
+		target.ImageFormat = 0
+	case "1", "2":
+		target.ImageFormat, _ = strconv.Atoi(f)
+	default:
+		return util.FmtNewtError(
+			"invalid target.image_format \"%s\"; must be 1 or 2", f)
+	}
+	target.Debugger = yc.GetValString("target.debugger", nil)
+	target.PyocdTarget = yc.GetValString("target.pyocd_target", nil)
+	target.ProbeId = yc.GetValString("target.probe_id", nil)
+	target.JlinkDevice = yc.GetValString("target.jlink_device", nil)
+	target.JlinkInterface = yc.GetValString("target.jlink_interface", nil)
+	target.JlinkSpeed = yc.GetValString("target.jlink_speed", nil)
+	target.OpenocdCfg = yc.GetValStringSlice("target.openocd_cfg", nil)
+	target.OpenocdAdapter = yc.GetValString("target.openocd_adapter", nil)
+	target.OpenocdTransport = yc.GetValString("target.openocd_transport", nil)
+	target.OpenocdSpeed = yc.GetValString("target.openocd_speed", nil)
+	target.GdbScripts = yc.GetValStringSlice("target.gdb_scripts", nil)
+	target.GdbCmds = yc.GetValStringSlice("target.gdb_cmds", nil)
+	target.Semihosting = yc.GetValBool("target.semihosting", nil)
+	target.GdbFrontend = yc.GetValString("target.gdb_frontend", nil)
+	target.ConsolePort = yc.GetValString("target.console_port", nil)
+
+	target.OutputFormats = yc.GetValStringSlice("target.output_formats", nil)
+	target.Uf2FamilyId = 0
+	if f := yc.GetValString("target.uf2_family_id", nil); f != "" {
+		id, err := strconv.ParseUint(f, 0, 32)
+		if err != nil {
+			return util.FmtNewtError(
+				"invalid target.uf2_family_id \"%s\"; must be a 32-bit "+
+					"integer", f)
 		}
+		target.Uf2FamilyId = uint32(id)
 	}
 
 	target.PkgProfiles = yc.GetValStringMapString(
 		"target.package_profiles", nil)
+	target.Env = yc.GetValStringMapString("target.env", nil)
+	target.Tags = yc.GetValStringSlice("target.tags", nil)
+
+	target.Overrides = nil
+	for _, o := range yc.GetValStringSlice(TARGET_OVERRIDES_KEY, nil) {
+		proj := interfaces.GetProject()
+		path, err := proj.ResolvePath(proj.Path(), o)
+		if err != nil {
+			return util.FmtNewtError(
+				"target \"%s\": cannot resolve override file \"%s\": %s",
+				target.FullName(), o, err.Error())
+		}
+		target.Overrides = append(target.Overrides, path)
+	}
+
+	if err := target.expandSettings(); err != nil {
+		return err
+	}
+
+	for _, p := range []*string{&target.KeyFile, &target.EncKeyFile} {
+		if *p != "" {
+			proj := interfaces.GetProject()
+			path, err := proj.ResolvePath(proj.Path(), *p)
+			if err == nil {
+				*p = path
+			}
+		}
+	}
+
+	// PKCS#11 URIs and KMS key references are not paths.
+	for i, k := range target.SignKeys {
+		if !newtutil.IsExternalKeyRef(k) {
+			proj := interfaces.GetProject()
+			path, err := proj.ResolvePath(proj.Path(), k)
+			if err == nil {
+				target.SignKeys[i] = path
+			}
+		}
+	}
+
+	for i, s := range target.GdbScripts {
+		proj := interfaces.GetProject()
+		path, err := proj.ResolvePath(proj.Path(), s)
+		if err == nil {
+			target.GdbScripts[i] = path
+		}
+	}
 
 	// Note: App not required in the case of unit tests.
 
 	// Remember the name of the configuration file so that it can be specified
 	// as a dependency to the compiler.
 	target.basePkg.AddCfgFilename(target.TargetYamlPath())
+	for _, base := range target.basePkgs {
+		target.basePkg.AddCfgFilename(
+			fmt.Sprintf("%s/%s", base.BasePath(), TARGET_FILENAME))
+		target.basePkg.AddCfgFilename(base.PkgYamlPath())
+		target.basePkg.AddCfgFilename(base.SyscfgYamlPath())
+	}
+	for _, path := range target.Overrides {
+		target.basePkg.AddCfgFilename(path)
+	}
 
 	return nil
 }
@@ -180,6 +353,24 @@ func (target *Target) Validate(appRequired bool) error {
 	return nil
 }
 
+// HasTag indicates whether the target's `target.tags` list contains the
+// specified tag.
+func (target *Target) HasTag(tag string) bool {
+	for _, t := range target.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EffectiveY returns the target's `target.yml` settings, including those
+// inherited from base targets.
+func (target *Target) EffectiveY() *ycfg.YCfg {
+	return &target.effectiveY
+}
+
 func (target *Target) Package() *pkg.LocalPackage {
 	return target.basePkg
 }
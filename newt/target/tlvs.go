@@ -0,0 +1,168 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package target
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/util"
+)
+
+// Additional TLVs that `newt create-image` adds to the target's images, e.g.:
+//
+//     target.image_tlvs:
+//         - type: 0xa0
+//           value: "rev-b"
+//         - type: 0xa1
+//           hex: "0102deadbeef"
+//         - type: 0xa2
+//           file: "bin/cfg_digest.bin"
+//
+// Each entry specifies exactly one of `value` (a string), `hex` (hex-encoded
+// bytes), or `file` (a file whose contents are read when the image is
+// created).  Types below IMAGE_TLV_CUSTOM_MIN are reserved for the
+// bootloader.
+const TARGET_IMAGE_TLVS_KEY = "target.image_tlvs"
+
+// The lowest TLV type available for vendor-specific TLVs.
+const IMAGE_TLV_CUSTOM_MIN = 0xa0
+
+// The maximum length of a TLV's data.
+const IMAGE_TLV_MAX_LEN = 0xffff
+
+// ImageTlv is a custom image TLV declared by a target.
+type ImageTlv struct {
+	Type uint8
+
+	// Only one of these is set.
+	Data     []byte
+	Filename string
+}
+
+// ReadData retrieves a TLV's data, reading it from its file if necessary.
+func (tlv ImageTlv) ReadData() ([]byte, error) {
+	data := tlv.Data
+	if tlv.Filename != "" {
+		var err error
+		data, err = ioutil.ReadFile(tlv.Filename)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"error reading data for image TLV 0x%02x: %s",
+				tlv.Type, err.Error())
+		}
+	}
+
+	if len(data) > IMAGE_TLV_MAX_LEN {
+		return nil, util.FmtNewtError(
+			"image TLV 0x%02x is too long: %d bytes (max %d)",
+			tlv.Type, len(data), IMAGE_TLV_MAX_LEN)
+	}
+
+	return data, nil
+}
+
+func (target *Target) decodeImageTlv(yamlTlv interface{},
+	entryIdx int) (ImageTlv, error) {
+
+	tlv := ImageTlv{}
+
+	kv, err := cast.ToStringMapE(yamlTlv)
+	if err != nil {
+		return tlv, util.FmtNewtError(
+			"target contains invalid `%s` entry: %s",
+			TARGET_IMAGE_TLVS_KEY, err.Error())
+	}
+
+	typeVal := kv["type"]
+	if typeVal == nil {
+		return tlv, util.FmtNewtError(
+			"image TLV entry %d missing required field \"type\"", entryIdx)
+	}
+	typeInt, err := cast.ToIntE(typeVal)
+	if err != nil || typeInt < IMAGE_TLV_CUSTOM_MIN || typeInt > 0xff {
+		return tlv, util.FmtNewtError(
+			"image TLV entry %d has invalid type \"%v\"; must be between "+
+				"0x%02x and 0xff", entryIdx, typeVal, IMAGE_TLV_CUSTOM_MIN)
+	}
+	tlv.Type = uint8(typeInt)
+
+	numSrcs := 0
+	if v := kv["value"]; v != nil {
+		numSrcs++
+		s, err := target.ExpandVars(cast.ToString(v))
+		if err != nil {
+			return tlv, err
+		}
+		tlv.Data = []byte(s)
+	}
+	if v := kv["hex"]; v != nil {
+		numSrcs++
+		tlv.Data, err = hex.DecodeString(cast.ToString(v))
+		if err != nil {
+			return tlv, util.FmtNewtError(
+				"image TLV entry %d contains invalid hex: %s",
+				entryIdx, err.Error())
+		}
+	}
+	if v := kv["file"]; v != nil {
+		numSrcs++
+		s, err := target.ExpandVars(cast.ToString(v))
+		if err != nil {
+			return tlv, err
+		}
+		proj := interfaces.GetProject()
+		tlv.Filename, err = proj.ResolvePath(proj.Path(), s)
+		if err != nil {
+			return tlv, err
+		}
+	}
+
+	if numSrcs != 1 {
+		return tlv, util.FmtNewtError(
+			"image TLV entry %d must specify exactly one of \"value\", "+
+				"\"hex\", or \"file\"", entryIdx)
+	}
+
+	return tlv, nil
+}
+
+// ImageTlvs decodes the custom image TLVs declared by the target.
+//
+// @return []ImageTlv           The TLVs, in the order they are declared.
+// @return error                Error if an entry is malformed.
+func (target *Target) ImageTlvs() ([]ImageTlv, error) {
+	var tlvs []ImageTlv
+
+	itf := target.effectiveY.GetValSlice(TARGET_IMAGE_TLVS_KEY, nil)
+	for i, yamlTlv := range cast.ToSlice(itf) {
+		tlv, err := target.decodeImageTlv(yamlTlv, i)
+		if err != nil {
+			return nil, err
+		}
+
+		tlvs = append(tlvs, tlv)
+	}
+
+	return tlvs, nil
+}
@@ -0,0 +1,155 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package testreport
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+
+	// Surefire's extension for a case that passed on a retry.
+	FlakyFailure *junitMessage `xml:"flakyFailure,omitempty"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Package    string          `xml:"package,attr"`
+	Hostname   string          `xml:"hostname,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+// junitMsg creates a failure or error element.  The message attribute holds
+// the first line; the body holds the full text.
+func junitMsg(text string) *junitMessage {
+	msg := text
+	for i, c := range text {
+		if c == '\n' {
+			msg = text[:i]
+			break
+		}
+	}
+
+	return &junitMessage{
+		Message: msg,
+		Body:    text,
+	}
+}
+
+// writeJunit writes the report as JUnit XML.  Each test suite of each
+// package is a <testsuite>; its cases' class name is <package>.<suite>.
+func (r *Report) writeJunit(w io.Writer) error {
+	hostname, _ := os.Hostname()
+
+	js := junitSuites{}
+	var total time.Duration
+	for _, s := range r.Suites {
+		failures, errors := s.Counts()
+		jsuite := junitSuite{
+			Name:      s.Name,
+			Package:   s.Package,
+			Hostname:  hostname,
+			Tests:     len(s.Cases),
+			Failures:  failures,
+			Errors:    errors,
+			Time:      seconds(s.Duration()),
+			Timestamp: s.Time.Format("2006-01-02T15:04:05"),
+		}
+		if s.Target != "" {
+			jsuite.Properties = []junitProperty{{
+				Name:  "target",
+				Value: s.Target,
+			}}
+		}
+
+		for _, c := range s.Cases {
+			jc := junitCase{
+				Name:      c.Name,
+				Classname: s.Package + "." + s.Name,
+				Time:      seconds(c.Duration),
+			}
+			if c.Error != "" {
+				jc.Error = junitMsg(c.Error)
+			} else if c.Failure != "" {
+				jc.Failure = junitMsg(c.Failure)
+			} else if c.Flaky != "" {
+				jc.FlakyFailure = junitMsg(c.Flaky)
+			}
+			jsuite.Cases = append(jsuite.Cases, jc)
+		}
+
+		js.Suites = append(js.Suites, jsuite)
+		js.Tests += jsuite.Tests
+		js.Failures += failures
+		js.Errors += errors
+		total += s.Duration()
+	}
+	js.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(js); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,340 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package testreport collects the results of unit test executables and
+// writes them in formats that CI systems understand.
+package testreport
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Report formats.
+const (
+	FORMAT_JUNIT = "junit"
+	FORMAT_TAP   = "tap"
+)
+
+var formats = []string{FORMAT_JUNIT, FORMAT_TAP}
+
+// Case is the result of a single test case.
+type Case struct {
+	Name     string
+	Duration time.Duration
+
+	// Why the case failed; "" if it passed.
+	Failure string
+
+	// Why the case could not run to completion (e.g., the test executable
+	// crashed or could not be built); "" if it ran.
+	Error string
+
+	// Why the case failed before it passed on a retry; "" if the case is not
+	// flaky.  Retries is the number of times the case was re-run.
+	Flaky   string
+	Retries int
+}
+
+// Suite is the result of a test suite in a package's test executable.
+type Suite struct {
+	Name    string
+	Package string
+	Target  string
+	Time    time.Time
+	Cases   []Case
+}
+
+// Duration returns the total duration of the suite's cases.
+func (s *Suite) Duration() time.Duration {
+	var d time.Duration
+	for _, c := range s.Cases {
+		d += c.Duration
+	}
+
+	return d
+}
+
+// Counts returns the number of failed cases and the number of cases that
+// could not run.
+func (s *Suite) Counts() (int, int) {
+	failures := 0
+	errors := 0
+	for _, c := range s.Cases {
+		if c.Error != "" {
+			errors++
+		} else if c.Failure != "" {
+			failures++
+		}
+	}
+
+	return failures, errors
+}
+
+// Line is a line of a test executable's output, along with the time it was
+// written.
+type Line struct {
+	Text string
+	Time time.Time
+}
+
+// The test harness reports each case on its own line:
+//     [pass] <suite>/<case>
+//     [FAIL] <suite>/<case> |<file>:<line>| <message>
+var caseRe = regexp.MustCompile(`^\[(pass|FAIL)\] ([^/\s]+)/(\S+)\s*(.*)$`)
+
+// Parse extracts the results of a test executable from its output.  The
+// duration of a case is the time between its result and the previous one, as
+// the harness does not time cases itself.
+//
+// @param pkgName               The name of the package under test.
+// @param target                The name of the target the test ran on.
+// @param start                 The time the executable started.
+// @param lines                 The executable's output.
+//
+// @return []*Suite             The suites, in the order they ran.
+func Parse(pkgName string, target string, start time.Time,
+	lines []Line) []*Suite {
+
+	var suites []*Suite
+	suiteMap := map[string]*Suite{}
+
+	prev := start
+	for _, line := range lines {
+		m := caseRe.FindStringSubmatch(strings.TrimSpace(line.Text))
+		if m == nil {
+			continue
+		}
+
+		s := suiteMap[m[2]]
+		if s == nil {
+			s = &Suite{
+				Name:    m[2],
+				Package: pkgName,
+				Target:  target,
+				Time:    prev,
+			}
+			suiteMap[m[2]] = s
+			suites = append(suites, s)
+		}
+
+		c := Case{
+			Name:     m[3],
+			Duration: line.Time.Sub(prev),
+		}
+		if m[1] == "FAIL" {
+			c.Failure = strings.TrimSpace(m[4])
+			if c.Failure == "" {
+				c.Failure = "test case failed"
+			}
+		}
+		s.Cases = append(s.Cases, c)
+
+		prev = line.Time
+	}
+
+	return suites
+}
+
+// HasFailure indicates whether any case in the specified suites failed.
+func HasFailure(suites []*Suite) bool {
+	for _, s := range suites {
+		if failures, errors := s.Counts(); failures+errors > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FailedCases lists the "<suite>/<case>" names of the cases that failed.
+func FailedCases(suites []*Suite) []string {
+	var names []string
+	for _, s := range suites {
+		for _, c := range s.Cases {
+			if c.Failure != "" || c.Error != "" {
+				names = append(names, s.Name+"/"+c.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+// MarkRetried records the results of re-running the failed cases of a test
+// executable.  Each failed case that passed on the retry is marked as flaky.
+//
+// @param suites                The results of the original run.
+// @param retried               The results of the retry.
+// @param attempt               The number of the retry, starting at 1.
+func MarkRetried(suites []*Suite, retried []*Suite, attempt int) {
+	passed := map[string]struct{}{}
+	for _, s := range retried {
+		for _, c := range s.Cases {
+			if c.Failure == "" && c.Error == "" {
+				passed[s.Name+"/"+c.Name] = struct{}{}
+			}
+		}
+	}
+
+	for _, s := range suites {
+		for i := range s.Cases {
+			c := &s.Cases[i]
+			if c.Failure == "" && c.Error == "" {
+				continue
+			}
+			if _, ok := passed[s.Name+"/"+c.Name]; !ok {
+				continue
+			}
+
+			c.Flaky = c.Failure
+			if c.Flaky == "" {
+				c.Flaky = c.Error
+			}
+			c.Failure = ""
+			c.Error = ""
+			c.Retries = attempt
+		}
+	}
+}
+
+// FlakyCases lists the cases that passed on a retry, each as
+// "<package> <suite>/<case>".
+func FlakyCases(suites []*Suite) []string {
+	var names []string
+	for _, s := range suites {
+		for _, c := range s.Cases {
+			if c.Flaky != "" {
+				names = append(names, s.Package+" "+s.Name+"/"+c.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+// ErrorSuite creates a suite that records a package whose test executable
+// could not be built or run to completion.
+//
+// @param pkgName               The name of the package under test.
+// @param target                The name of the target the test ran on.
+// @param start                 The time the test started.
+// @param name                  The name of the step that failed (e.g.,
+//                                  "build").
+// @param err                   The error.
+func ErrorSuite(pkgName string, target string, start time.Time, name string,
+	err error) *Suite {
+
+	return &Suite{
+		Name:    pkgName,
+		Package: pkgName,
+		Target:  target,
+		Time:    start,
+		Cases: []Case{{
+			Name:     name,
+			Duration: time.Since(start),
+			Error:    err.Error(),
+		}},
+	}
+}
+
+// Report accumulates test results for the reports that newt writes.
+type Report struct {
+	Suites []*Suite
+
+	// Report format => path of the file to write.
+	files map[string]string
+}
+
+// NewReport creates a report from the specified report arguments.
+//
+// @param args                  The reports to write, each in the form
+//                                  <format>=<path> (e.g., junit=out.xml).
+func NewReport(args []string) (*Report, error) {
+	r := &Report{
+		files: map[string]string{},
+	}
+
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, util.FmtNewtError(
+				"invalid report \"%s\"; must have the form <format>=<file>",
+				arg)
+		}
+
+		switch parts[0] {
+		case FORMAT_JUNIT, FORMAT_TAP:
+		default:
+			return nil, util.FmtNewtError(
+				"invalid report format \"%s\"; must be one of: %s",
+				parts[0], strings.Join(formats, ", "))
+		}
+
+		r.files[parts[0]] = parts[1]
+	}
+
+	return r, nil
+}
+
+// Add records the results of a package's test executable.
+func (r *Report) Add(suites ...*Suite) {
+	r.Suites = append(r.Suites, suites...)
+}
+
+// Write writes each of the requested reports.
+func (r *Report) Write() error {
+	for _, format := range formats {
+		path := r.files[format]
+		if path == "" {
+			continue
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		switch format {
+		case FORMAT_JUNIT:
+			err = r.writeJunit(f)
+		case FORMAT_TAP:
+			err = r.writeTap(f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Wrote %s test report: %s\n", format, path)
+	}
+
+	return nil
+}
+
+// seconds formats a duration for a report.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
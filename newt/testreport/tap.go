@@ -0,0 +1,87 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package testreport
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// writeTap writes the report in the Test Anything Protocol (version 13).
+// Each case is a test point named <package> <suite>/<case>; the reason for a
+// failure is in the point's YAML block.
+func (r *Report) writeTap(w io.Writer) error {
+	var b strings.Builder
+
+	total := 0
+	for _, s := range r.Suites {
+		total += len(s.Cases)
+	}
+
+	b.WriteString("TAP version 13\n")
+	fmt.Fprintf(&b, "1..%d\n", total)
+
+	n := 0
+	for _, s := range r.Suites {
+		for _, c := range s.Cases {
+			n++
+
+			name := fmt.Sprintf("%s %s/%s", s.Package, s.Name, c.Name)
+			if s.Target != "" {
+				name += " on " + s.Target
+			}
+
+			msg := c.Error
+			if msg == "" {
+				msg = c.Failure
+			}
+			if msg == "" {
+				fmt.Fprintf(&b, "ok %d - %s\n", n, name)
+				if c.Flaky != "" {
+					fmt.Fprintf(&b, "# flaky: passed on retry %d\n",
+						c.Retries)
+				}
+				continue
+			}
+
+			fmt.Fprintf(&b, "not ok %d - %s\n", n, name)
+			b.WriteString("  ---\n")
+			b.WriteString("  message: |\n")
+			for _, line := range strings.Split(strings.TrimRight(msg, "\n"),
+				"\n") {
+
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+			fmt.Fprintf(&b, "  duration_ms: %d\n",
+				int64(c.Duration/time.Millisecond))
+			b.WriteString("  ...\n")
+		}
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
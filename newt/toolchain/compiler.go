@@ -83,6 +83,8 @@ type Compiler struct {
 	odPath                string
 	osPath                string
 	ocPath                string
+	gdbPath               string
+	gcovPath              string
 	ldResolveCircularDeps bool
 	ldMapFile             bool
 	ldBinFile             bool
@@ -127,6 +129,17 @@ func (c *Compiler) GetArPath() string {
 	return c.arPath
 }
 
+// GetGdbPath returns the path of the debugger that accompanies the toolchain.
+func (c *Compiler) GetGdbPath() string {
+	return c.gdbPath
+}
+
+// GetGcovPath returns the path of the coverage tool that accompanies the
+// toolchain.
+func (c *Compiler) GetGcovPath() string {
+	return c.gcovPath
+}
+
 func (c *Compiler) GetLdResolveCircularDeps() bool {
 	return c.ldResolveCircularDeps
 }
@@ -164,7 +177,7 @@ func flagsBase(cflags string) string {
 	// "-O" (optimization level) is one possible flag base.  By singling these
 	// out, newt can prevent the original optimization flag from being
 	// overwritten by subsequent ones.
-	if cflags == "-O" || len(cflags) == 3 && strings.HasPrefix(cflags, "-O") {
+	if strings.HasPrefix(cflags, "-O") {
 		return "-O"
 	}
 
@@ -222,6 +235,27 @@ func addFlags(flagType string, orig []string, new []string) []string {
 	return combined
 }
 
+// removeConflictingFlags removes the flags that conflict with any of the
+// specified overrides.  Each entry of a flag list may contain several
+// whitespace-separated flags; the result has one flag per entry.
+func removeConflictingFlags(flags []string, overrides []string) []string {
+	bases := map[string]struct{}{}
+	for _, o := range util.SortFields(overrides...) {
+		bases[flagsBase(o)] = struct{}{}
+	}
+
+	result := []string{}
+	for _, s := range flags {
+		for _, f := range strings.Fields(s) {
+			if _, ok := bases[flagsBase(f)]; !ok {
+				result = append(result, f)
+			}
+		}
+	}
+
+	return result
+}
+
 func (ci *CompilerInfo) AddCflags(cflags []string) {
 	ci.Cflags = addFlags("cflag", ci.Cflags, cflags)
 }
@@ -297,6 +331,23 @@ func (c *Compiler) load(compilerDir string, buildProfile string) error {
 	c.osPath = yc.GetValString("compiler.path.objsize", settings)
 	c.ocPath = yc.GetValString("compiler.path.objcopy", settings)
 
+	// If the compiler doesn't specify a debugger, assume one with the same
+	// prefix as objcopy (e.g., arm-none-eabi-gdb).
+	c.gdbPath = yc.GetValString("compiler.path.gdb", settings)
+	if c.gdbPath == "" && strings.HasSuffix(c.ocPath, "objcopy") {
+		c.gdbPath = strings.TrimSuffix(c.ocPath, "objcopy") + "gdb"
+	}
+
+	// Likewise, assume a coverage tool with the same prefix as gcc.
+	c.gcovPath = yc.GetValString("compiler.path.gcov", settings)
+	if c.gcovPath == "" {
+		if strings.HasSuffix(c.ccPath, "gcc") {
+			c.gcovPath = strings.TrimSuffix(c.ccPath, "gcc") + "gcov"
+		} else {
+			c.gcovPath = "gcov"
+		}
+	}
+
 	c.lclInfo.Cflags = loadFlags(yc, settings, "compiler.flags")
 	c.lclInfo.CXXflags = loadFlags(yc, settings, "compiler.cxx.flags")
 	c.lclInfo.Lflags = loadFlags(yc, settings, "compiler.ld.flags")
@@ -317,10 +368,65 @@ func (c *Compiler) load(compilerDir string, buildProfile string) error {
 	return nil
 }
 
+// Identifies the C compiler that the specified compiler package uses on this
+// OS.
+//
+// @param compilerDir           The base directory of the compiler package.
+// @param buildProfile          The build profile to read the compiler path
+//                                  for.
+//
+// @return string               The compiler command, as specified in the
+//                                  package's `compiler.yml` file.
+// @return string               The first line of the compiler's `--version`
+//                                  output; "" if the compiler is not
+//                                  installed.
+// @return error                Error if the compiler package can't be read.
+func CompilerVersion(compilerDir string, buildProfile string) (
+	string, string, error) {
+
+	yc, err := config.ReadFile(compilerDir + "/" + COMPILER_FILENAME)
+	if err != nil {
+		return "", "", err
+	}
+
+	settings := map[string]string{
+		buildProfile:                  "1",
+		strings.ToUpper(runtime.GOOS): "1",
+	}
+
+	ccPath := yc.GetValString("compiler.path.cc", settings)
+	if ccPath == "" {
+		return "", "", nil
+	}
+
+	o, err := util.ShellCommandLimitDbgOutput(
+		[]string{ccPath, "--version"}, nil, false, 0)
+	if err != nil {
+		return ccPath, "", nil
+	}
+
+	lines := strings.SplitN(strings.TrimSpace(string(o)), "\n", 2)
+	return ccPath, strings.TrimSpace(lines[0]), nil
+}
+
 func (c *Compiler) AddInfo(info *CompilerInfo) {
 	c.info.AddCompilerInfo(info)
 }
 
+// OverrideLocalInfo removes the compiler package's own flags that conflict
+// with the specified flags (e.g., "-O2" when the specified flags contain
+// "-Os"), and then adds the specified flags.  This allows a custom build
+// profile to replace settings of the compiler profile that it extends.
+func (c *Compiler) OverrideLocalInfo(info *CompilerInfo) {
+	c.lclInfo.Cflags = removeConflictingFlags(c.lclInfo.Cflags, info.Cflags)
+	c.lclInfo.CXXflags = removeConflictingFlags(c.lclInfo.CXXflags,
+		info.CXXflags)
+	c.lclInfo.Lflags = removeConflictingFlags(c.lclInfo.Lflags, info.Lflags)
+	c.lclInfo.Aflags = removeConflictingFlags(c.lclInfo.Aflags, info.Aflags)
+
+	c.AddInfo(info)
+}
+
 func (c *Compiler) DstDir() string {
 	return c.dstDir
 }
@@ -78,6 +78,12 @@ type YCfg struct {
 type YCfgEntry struct {
 	Value interface{}
 	Expr  *parse.Node
+
+	// The file that specified the value.  The entries of a map value may come
+	// from different files; see KeyFileInfo.
+	FileInfo *util.FileInfo
+
+	keyFileInfo map[string]*util.FileInfo
 }
 
 type YCfgNode struct {
@@ -87,6 +93,11 @@ type YCfgNode struct {
 	Children  YCfgTree
 	Parent    *YCfgNode
 	FileInfo  *util.FileInfo
+
+	// For a map value, the file that specified each of the map's entries.
+	// Maps merged from several files (e.g., via `$import`) have entries from
+	// more than one file.
+	KeyFileInfo map[string]*util.FileInfo
 }
 
 type YCfgTree map[string]*YCfgNode
@@ -99,6 +110,32 @@ func NewYCfgNode() *YCfgNode {
 	return &YCfgNode{Children: YCfgTree{}}
 }
 
+// setKeyFileInfo records the file that specified each entry of a map value.
+func (node *YCfgNode) setKeyFileInfo(val interface{},
+	fileInfo *util.FileInfo) {
+
+	m, ok := val.(map[interface{}]interface{})
+	if !ok {
+		return
+	}
+
+	if node.KeyFileInfo == nil {
+		node.KeyFileInfo = map[string]*util.FileInfo{}
+	}
+	for k, _ := range m {
+		node.KeyFileInfo[cast.ToString(k)] = fileInfo
+	}
+}
+
+// KeyFileInfo reports the file that specified one entry of a map value.
+func (entry YCfgEntry) KeyFileInfo(key string) *util.FileInfo {
+	if fi := entry.keyFileInfo[key]; fi != nil {
+		return fi
+	}
+
+	return entry.FileInfo
+}
+
 func (node *YCfgNode) addChild(name string) (*YCfgNode, error) {
 	if node.Children == nil {
 		node.Children = YCfgTree{}
@@ -160,6 +197,8 @@ func (yc *YCfg) ReplaceFromFile(key string, val interface{},
 		if i == len(elems)-1 {
 			child.Overwrite = overwrite
 			child.Value = val
+			child.KeyFileInfo = nil
+			child.setKeyFileInfo(val, fileInfo)
 		}
 		child.FileInfo = fileInfo
 
@@ -217,6 +256,7 @@ func (yc *YCfg) MergeFromFile(key string, val interface{},
 		for k, v := range newVal {
 			nodeVal[k] = v
 		}
+		node.setKeyFileInfo(newVal, fileInfo)
 
 	case []interface{}:
 		newVal, ok := val.([]interface{})
@@ -275,25 +315,33 @@ func (yc *YCfg) Get(key string, settings map[string]string) []YCfgEntry {
 	entries := []YCfgEntry{}
 
 	if node.Value != nil {
-		entry := YCfgEntry{Value: node.Value}
+		entry := YCfgEntry{
+			Value:       node.Value,
+			FileInfo:    node.FileInfo,
+			keyFileInfo: node.KeyFileInfo,
+		}
 		entries = append(entries, entry)
 	}
 
 	for _, child := range node.Children {
 		expr, err := parse.LexAndParse(child.Name)
 		if err != nil {
-			util.OneTimeWarning("%s: %s", yc.name, err.Error())
+			util.OneTimeWarning("%s: ignoring \"%s.%s\": %s",
+				yc.name, key, child.Name, err.Error())
 			continue
 		}
 		val, err := parse.Eval(expr, settings)
 		if err != nil {
-			util.OneTimeWarning("%s: %s", yc.name, err.Error())
+			util.OneTimeWarning("%s: ignoring \"%s.%s\": %s",
+				yc.name, key, child.Name, err.Error())
 			continue
 		}
 		if val {
 			entry := YCfgEntry{
-				Value: child.Value,
-				Expr:  expr,
+				Value:       child.Value,
+				Expr:        expr,
+				FileInfo:    child.FileInfo,
+				keyFileInfo: child.KeyFileInfo,
 			}
 			if child.Overwrite {
 				return []YCfgEntry{entry}
@@ -423,8 +471,9 @@ func (yc *YCfg) GetStringMap(
 	for _, mapEntry := range mapEntries {
 		for k, v := range cast.ToStringMap(mapEntry.Value) {
 			entry := YCfgEntry{
-				Value: v,
-				Expr:  mapEntry.Expr,
+				Value:    v,
+				Expr:     mapEntry.Expr,
+				FileInfo: mapEntry.KeyFileInfo(k),
 			}
 
 			// XXX: Report collisions?
@@ -514,8 +563,9 @@ func (yc *YCfg) GetStringMapString(key string,
 	for _, mapEntry := range mapEntries {
 		for k, v := range cast.ToStringMapString(mapEntry.Value) {
 			entry := YCfgEntry{
-				Value: v,
-				Expr:  mapEntry.Expr,
+				Value:    v,
+				Expr:     mapEntry.Expr,
+				FileInfo: mapEntry.KeyFileInfo(k),
 			}
 
 			// XXX: Report collisions?
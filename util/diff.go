@@ -0,0 +1,171 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type diffOp struct {
+	kind byte // ' ', '-', or '+'
+	line string
+}
+
+// diffOps computes the shortest edit script that transforms a into b.  The
+// inputs are expected to be small (e.g., configuration listings), so a simple
+// longest-common-subsequence table is used.
+func diffOps(a []string, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+
+	return ops
+}
+
+// hunkRange formats the line range of one side of a unified diff hunk.
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// UnifiedDiff produces a unified diff of two lists of lines.
+//
+// @param aName                 The name of the first input, used in the
+//                                  "---" header line.
+// @param bName                 The name of the second input, used in the
+//                                  "+++" header line.
+// @param a                     The lines of the first input.
+// @param b                     The lines of the second input.
+// @param context               The number of unchanged lines to show around
+//                                  each change.
+//
+// @return string               The diff, or "" if the inputs are identical.
+func UnifiedDiff(aName string, bName string, a []string, b []string,
+	context int) string {
+
+	ops := diffOps(a, b)
+
+	// Find the indices of the changed operations.
+	changes := []int{}
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	buffer := bytes.Buffer{}
+	fmt.Fprintf(&buffer, "--- %s\n", aName)
+	fmt.Fprintf(&buffer, "+++ %s\n", bName)
+
+	for c := 0; c < len(changes); {
+		// Group changes that are separated by no more than twice the number of
+		// context lines into a single hunk.
+		first := changes[c]
+		last := first
+		c++
+		for c < len(changes) && changes[c]-last <= 2*context {
+			last = changes[c]
+			c++
+		}
+
+		start := first - context
+		if start < 0 {
+			start = 0
+		}
+		end := last + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		// Determine each side's line numbers at the start of the hunk.
+		aStart, bStart := 0, 0
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+
+		aCount, bCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+
+		fmt.Fprintf(&buffer, "@@ -%s +%s @@\n",
+			hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&buffer, "%c%s\n", op.kind, op.line)
+		}
+	}
+
+	return buffer.String()
+}
@@ -328,7 +328,7 @@ func ShellCommandLimitDbgOutput(
 	cmd := exec.Command(name, args...)
 
 	if env != nil {
-		cmd.Env = append(env, os.Environ()...)
+		cmd.Env = childEnv(env)
 	}
 
 	o, err := cmd.CombinedOutput()
@@ -366,6 +366,35 @@ func ShellCommand(cmdStrs []string, env []string) ([]byte, error) {
 	return ShellCommandLimitDbgOutput(cmdStrs, env, true, -1)
 }
 
+// childEnv produces the environment of a child process: the specified
+// variables followed by those variables of newt's environment that they do
+// not replace.  If a variable is specified more than once, the last
+// setting wins.
+func childEnv(env []string) []string {
+	envKey := func(kv string) string {
+		return strings.SplitN(kv, "=", 2)[0]
+	}
+
+	last := map[string]int{}
+	for i, kv := range env {
+		last[envKey(kv)] = i
+	}
+
+	result := make([]string, 0, len(env)+len(os.Environ()))
+	for i, kv := range env {
+		if last[envKey(kv)] == i {
+			result = append(result, kv)
+		}
+	}
+	for _, kv := range os.Environ() {
+		if _, ok := last[envKey(kv)]; !ok {
+			result = append(result, kv)
+		}
+	}
+
+	return result
+}
+
 // Run interactive shell command
 func ShellInteractiveCommand(cmdStr []string, env []string) error {
 	// Escape special characters for Windows.
@@ -383,7 +412,7 @@ func ShellInteractiveCommand(cmdStr []string, env []string) error {
 	}()
 
 	if env != nil {
-		env = append(env, os.Environ()...)
+		env = childEnv(env)
 	}
 
 	// Transfer stdin, stdout, and stderr to the new process